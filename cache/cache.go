@@ -0,0 +1,20 @@
+package cache
+
+// Store — хранилище кэша. LRU в памяти — реализация по умолчанию; внешнее хранилище
+// (например, Redis) подключается своей реализацией этого интерфейса.
+type Store interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{})
+	Delete(keys ...string)
+	DeletePrefix(prefix string)
+	Len() int
+}
+
+// Stats — статистика обращений к кэшу
+type Stats struct {
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	HitRatio  float64 `json:"hitRatio"`
+	Evictions uint64  `json:"evictions"` // Вытеснено по размеру или сроку; 0, если хранилище не считает
+	Entries   int     `json:"entries"`
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LRU — кэш в памяти с ограничением по числу записей и сроком жизни записи
+type LRU struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu        sync.Mutex
+	items     map[string]*list.Element
+	order     *list.List // Начало списка — самые свежие записи
+	evictions uint64
+}
+
+type entry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{
+		size:  size,
+		ttl:   ttl,
+		now:   time.Now,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (c *LRU) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if c.now().After(e.expires) {
+		c.remove(el)
+		atomic.AddUint64(&c.evictions, 1)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *LRU) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+func (c *LRU) Delete(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *LRU) DeletePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Evictions — сколько записей вытеснено по размеру или сроку жизни
+func (c *LRU) Evictions() uint64 {
+	return atomic.LoadUint64(&c.evictions)
+}
+
+func (c *LRU) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry).key)
+}
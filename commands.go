@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"tmv/config"
+	"tmv/migrations"
+	"tmv/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Служебные команды: tmv <команда> <действие> [флаги настроек] [аргументы]
+var commands = map[string]func(args []string) error{
+	"indexes": indexesCommand,
+	"migrate": migrateCommand,
+}
+
+const indexesUsage = `usage: tmv indexes <action> [config flags] [args]
+
+actions:
+  list               show indexes of all collections
+  verify             compare indexes with the declared ones; exits with 1 on mismatch
+  ensure             create missing declared indexes
+  drop <coll.name>…  drop the given indexes`
+
+func indexesCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(indexesUsage)
+	}
+	action := args[0]
+	switch action {
+	case "list", "verify", "ensure", "drop":
+	default:
+		return fmt.Errorf("unknown action %q\n%s", action, indexesUsage)
+	}
+	cfg, rest, err := config.LoadCommand("tmv indexes "+action, args[1:], nil)
+	if err != nil {
+		return err
+	}
+	if cfg.Storage != "mongo" {
+		return fmt.Errorf("tmv indexes works with storage mongo; %s indexes are part of the schema created at startup", cfg.Storage)
+	}
+
+	mongoStorage, err := storage.NewMongoStorage(cfg.Mongo)
+	if err != nil {
+		return err
+	}
+	defer mongoStorage.Client.Disconnect(context.Background())
+
+	// Построение индекса на большой коллекции может занять время
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	switch action {
+	case "list":
+		indexes, err := mongoStorage.ListIndexes(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "COLLECTION\tNAME\tKEYS\tOPTIONS\tDECLARED")
+		for _, idx := range indexes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", idx.Collection, idx.Name, formatKeys(idx.Keys), indexOptions(idx), idx.Declared)
+		}
+		return w.Flush()
+
+	case "verify":
+		mismatches, err := mongoStorage.VerifyIndexes(ctx)
+		if err != nil {
+			return err
+		}
+		if len(mismatches) > 0 {
+			problems := make([]string, len(mismatches))
+			for i, m := range mismatches {
+				problems[i] = m.String()
+			}
+			return fmt.Errorf("indexes differ from declared:\n  %s", strings.Join(problems, "\n  "))
+		}
+		fmt.Println("indexes match the declared ones")
+		return nil
+
+	case "ensure":
+		if err := mongoStorage.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+		fmt.Println("indexes created")
+		return nil
+
+	case "drop":
+		if len(rest) == 0 {
+			return errors.New("drop: specify indexes as collection.name")
+		}
+		for _, full := range rest {
+			collection, name, ok := strings.Cut(full, ".")
+			if !ok {
+				return fmt.Errorf("drop: %q is not collection.name", full)
+			}
+			if err := mongoStorage.DropIndex(ctx, collection, name); err != nil {
+				return fmt.Errorf("drop %s: %w", full, err)
+			}
+			fmt.Println("dropped", full)
+		}
+	}
+	return nil
+}
+
+const migrateUsage = `usage: tmv migrate <action> [-dry-run] [-to version] [config flags]
+
+actions:
+  status   show applied and pending migrations
+  up       apply pending migrations up to -to, all by default
+  down     roll back migrations above -to, the last one by default`
+
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	action := args[0]
+	switch action {
+	case "status", "up", "down":
+	default:
+		return fmt.Errorf("unknown action %q\n%s", action, migrateUsage)
+	}
+	var (
+		dryRun bool
+		to     int
+		toSet  bool
+	)
+	cfg, rest, err := config.LoadCommand("tmv migrate "+action, args[1:], func(fs *flag.FlagSet) {
+		fs.BoolVar(&dryRun, "dry-run", false, "report what would change without writing")
+		fs.Func("to", "target version", func(v string) (err error) {
+			to, err = strconv.Atoi(v)
+			toSet = err == nil && to >= 0
+			if !toSet {
+				return fmt.Errorf("invalid version %q", v)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " "))
+	}
+	if cfg.Storage != "mongo" {
+		return fmt.Errorf("tmv migrate works with storage mongo; the %s schema is migrated at startup", cfg.Storage)
+	}
+
+	mongoStorage, err := storage.NewMongoStorage(cfg.Mongo)
+	if err != nil {
+		return err
+	}
+	defer mongoStorage.Client.Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	migrator := migrations.NewMigrator(mongoStorage, os.Stdout)
+	migrator.DryRun = dryRun
+
+	switch action {
+	case "status":
+		states, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, st := range states {
+			status, appliedAt := "pending", "-"
+			if st.Applied {
+				status, appliedAt = "applied", st.AppliedAt.Local().Format(time.RFC3339)
+			}
+			if st.Unknown {
+				status = "unknown"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", st.Version, st.Name, status, appliedAt)
+		}
+		return w.Flush()
+
+	case "up":
+		return migrator.Up(ctx, to)
+
+	case "down":
+		if !toSet {
+			// По умолчанию откатывается только последняя применённая миграция: цель — предпоследняя
+			states, err := migrator.Status(ctx)
+			if err != nil {
+				return err
+			}
+			last := 0
+			for _, st := range states {
+				if st.Applied {
+					to, last = last, st.Version
+				}
+			}
+		}
+		return migrator.Down(ctx, to)
+	}
+	return nil
+}
+
+func formatKeys(keys bson.D) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s:%v", k.Key, k.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func indexOptions(idx storage.IndexInfo) string {
+	var opts []string
+	if idx.Unique {
+		opts = append(opts, "unique")
+	}
+	if idx.Sparse {
+		opts = append(opts, "sparse")
+	}
+	if idx.Partial != nil {
+		opts = append(opts, "partial")
+	}
+	if len(opts) == 0 {
+		return "-"
+	}
+	return strings.Join(opts, ",")
+}
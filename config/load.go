@@ -0,0 +1,330 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// setting связывает поле Config с ключом файла, переменной окружения и флагом.
+// Имя переменной — TMV_ и ключ в верхнем регистре с «_» вместо «.», флаг — ключ с «-» вместо «_».
+type setting struct {
+	key     string
+	usage   string
+	target  interface{}
+	aliases []string // Прежние имена переменных окружения
+}
+
+func (s setting) env() string {
+	return "TMV_" + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+func (s setting) flag() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+func settings(c *Config) []setting {
+	return []setting{
+		{"instance", "instance name used for change stream resume tokens", &c.Instance, nil},
+
+		{"server.addr", "listen address", &c.Server.Addr, nil},
+		{"server.tls_cert_file", "TLS certificate file; enables HTTPS", &c.Server.TLSCertFile, nil},
+		{"server.tls_key_file", "TLS private key file", &c.Server.TLSKeyFile, nil},
+		{"server.read_timeout", "maximum duration for reading a request", &c.Server.ReadTimeout, nil},
+		{"server.write_timeout", "maximum duration for writing a response, 0 for none", &c.Server.WriteTimeout, nil},
+		{"server.idle_timeout", "keep-alive idle timeout", &c.Server.IdleTimeout, nil},
+		{"server.shutdown_timeout", "time to finish active requests on shutdown", &c.Server.ShutdownTimeout, nil},
+		{"server.shutdown_delay", "time /readyz reports not ready before the server stops accepting requests", &c.Server.ShutdownDelay, nil},
+		{"server.status_token", "bearer token required for /status; empty disables /status", &c.Server.StatusToken, nil},
+		{"server.cors.allowed_origins", "comma-separated CORS origins, * for any; empty disables CORS", &c.Server.CORS.AllowedOrigins, nil},
+		{"server.cors.allowed_methods", "comma-separated CORS methods", &c.Server.CORS.AllowedMethods, nil},
+		{"server.cors.allowed_headers", "comma-separated CORS request headers", &c.Server.CORS.AllowedHeaders, nil},
+		{"server.cors.allow_credentials", "allow credentialed CORS requests", &c.Server.CORS.AllowCredentials, nil},
+		{"server.cors.max_age", "how long browsers may cache preflight responses", &c.Server.CORS.MaxAge, nil},
+
+		{"storage", "storage backend: mongo, postgres or sqlite", &c.Storage, nil},
+
+		{"mongo.uri", "MongoDB connection URI", &c.Mongo.URI, nil},
+		{"mongo.database", "MongoDB database", &c.Mongo.Database, nil},
+		{"mongo.username", "MongoDB user", &c.Mongo.Username, nil},
+		{"mongo.password", "MongoDB password", &c.Mongo.Password, nil},
+		{"mongo.auth_source", "MongoDB authentication database", &c.Mongo.AuthSource, nil},
+		{"mongo.tls", "connect to MongoDB over TLS", &c.Mongo.TLS, nil},
+		{"mongo.tls_ca_file", "CA bundle for the MongoDB server certificate", &c.Mongo.TLSCAFile, nil},
+		{"mongo.tls_cert_file", "client certificate for MongoDB", &c.Mongo.TLSCertFile, nil},
+		{"mongo.tls_key_file", "client key for MongoDB", &c.Mongo.TLSKeyFile, nil},
+		{"mongo.tls_insecure", "skip MongoDB server certificate verification", &c.Mongo.TLSInsecure, nil},
+		{"mongo.min_pool_size", "minimum MongoDB connections", &c.Mongo.MinPoolSize, nil},
+		{"mongo.max_pool_size", "maximum MongoDB connections, 0 for unlimited", &c.Mongo.MaxPoolSize, nil},
+		{"mongo.connect_timeout", "MongoDB connect timeout", &c.Mongo.ConnectTimeout, nil},
+		{"mongo.server_selection_timeout", "MongoDB server selection timeout", &c.Mongo.ServerSelectionTimeout, nil},
+		{"mongo.timeout", "MongoDB operation timeout, 0 for none", &c.Mongo.Timeout, nil},
+		{"mongo.ensure_indexes", "create missing indexes at startup", &c.Mongo.EnsureIndexes, nil},
+		{"mongo.collections.users", "users collection", &c.Mongo.Collections.Users, nil},
+		{"mongo.collections.projects", "projects collection", &c.Mongo.Collections.Projects, nil},
+		{"mongo.collections.tasks", "tasks collection", &c.Mongo.Collections.Tasks, nil},
+		{"mongo.collections.sprints", "sprints collection", &c.Mongo.Collections.Sprints, nil},
+		{"mongo.collections.worklogs", "worklogs collection", &c.Mongo.Collections.Worklogs, nil},
+		{"mongo.collections.notifications", "notifications collection", &c.Mongo.Collections.Notifications, nil},
+		{"mongo.collections.reminders", "reminders collection", &c.Mongo.Collections.Reminders, nil},
+		{"mongo.collections.comments", "comments collection", &c.Mongo.Collections.Comments, nil},
+		{"mongo.collections.watches", "watches collection", &c.Mongo.Collections.Watches, nil},
+		{"mongo.collections.webhooks", "webhooks collection", &c.Mongo.Collections.Webhooks, nil},
+		{"mongo.collections.webhook_deliveries", "webhook deliveries collection", &c.Mongo.Collections.WebhookDeliveries, nil},
+		{"mongo.collections.outbox", "event outbox collection", &c.Mongo.Collections.Outbox, nil},
+		{"mongo.collections.resume_tokens", "change stream resume tokens collection", &c.Mongo.Collections.ResumeTokens, nil},
+		{"mongo.collections.migrations", "applied data migrations collection", &c.Mongo.Collections.Migrations, nil},
+
+		{"postgres.dsn", "PostgreSQL connection string", &c.Postgres.DSN, nil},
+		{"postgres.max_open_conns", "maximum PostgreSQL connections, 0 for unlimited", &c.Postgres.MaxOpenConns, nil},
+		{"postgres.max_idle_conns", "maximum idle PostgreSQL connections", &c.Postgres.MaxIdleConns, nil},
+		{"postgres.conn_max_lifetime", "how long a PostgreSQL connection is reused, 0 for forever", &c.Postgres.ConnMaxLifetime, nil},
+
+		{"sqlite.path", "SQLite database file", &c.SQLite.Path, nil},
+
+		{"log.level", "log level: debug, info, warn or error", &c.Log.Level, []string{"LOG_LEVEL"}},
+
+		{"tracing.exporter", "trace exporter: otlp, console or none", &c.Tracing.Exporter, []string{"OTEL_TRACES_EXPORTER"}},
+		{"tracing.service_name", "service name in traces", &c.Tracing.ServiceName, []string{"OTEL_SERVICE_NAME"}},
+
+		{"cache.enabled", "cache users, projects and tasks in memory", &c.Cache.Enabled, nil},
+		{"cache.size", "maximum cached entities", &c.Cache.Size, nil},
+		{"cache.ttl", "cached entity lifetime", &c.Cache.TTL, nil},
+
+		{"metrics.enabled", "serve Prometheus metrics on /metrics", &c.Metrics.Enabled, nil},
+		{"metrics.totals_max_age", "how often business gauges are recomputed", &c.Metrics.TotalsMaxAge, nil},
+
+		{"features.change_streams", "receive changes of other instances via change streams", &c.Features.ChangeStreams, []string{"MONGO_CHANGE_STREAMS"}},
+		{"features.change_stream_pre_images", "request pre-images for deletes (MongoDB 6+)", &c.Features.ChangeStreamPreImages, []string{"MONGO_CHANGE_STREAM_PREIMAGES"}},
+		{"features.recurrence", "run the recurring task scheduler", &c.Features.Recurrence, nil},
+		{"features.reminders", "run the deadline reminder scheduler", &c.Features.Reminders, nil},
+		{"features.webhooks", "deliver project webhooks", &c.Features.Webhooks, nil},
+
+		{"smtp.addr", "SMTP server host:port; enables email reminders", &c.SMTP.Addr, []string{"SMTP_ADDR"}},
+		{"smtp.from", "sender address", &c.SMTP.From, []string{"SMTP_FROM"}},
+		{"smtp.username", "SMTP user", &c.SMTP.Username, []string{"SMTP_USERNAME"}},
+		{"smtp.password", "SMTP password", &c.SMTP.Password, []string{"SMTP_PASSWORD"}},
+	}
+}
+
+// Load собирает и проверяет конфигурацию. Путь к файлу задаётся флагом -config или TMV_CONFIG;
+// формат определяется по расширению (.yaml, .yml или .toml).
+func Load(name string, args []string) (*Config, error) {
+	c, rest, err := LoadCommand(name, args, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " "))
+	}
+	return c, nil
+}
+
+// LoadCommand как Load, но возвращает аргументы после флагов вместо ошибки — для команд вроде
+// tmv indexes drop. commandFlags, если задан, добавляет собственные флаги команды.
+func LoadCommand(name string, args []string, commandFlags func(fs *flag.FlagSet)) (*Config, []string, error) {
+	c := Default()
+	all := settings(c)
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("TMV_CONFIG"), "configuration file (YAML or TOML)")
+	// Флаги применяются последними, поэтому при разборе только запоминаются
+	var fromFlags []func() error
+	for _, s := range all {
+		fs.Var(&settingFlag{setting: s, applied: &fromFlags}, s.flag(), fmt.Sprintf("%s (env %s)", s.usage, s.env()))
+	}
+	if commandFlags != nil {
+		commandFlags(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	// Разбор выше мог изменить значения; начинаем заново с умолчаний
+	*c = *Default()
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, all); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, s := range all {
+		if err := s.fromEnv(); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, apply := range fromFlags {
+		if err := apply(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return c, fs.Args(), nil
+}
+
+// settingFlag проверяет значение флага при разборе и откладывает его применение
+type settingFlag struct {
+	setting
+	applied *[]func() error
+}
+
+// String показывает значение по умолчанию в -help
+func (f *settingFlag) String() string {
+	switch t := f.target.(type) {
+	case nil:
+		return ""
+	case *[]string:
+		return strings.Join(*t, ",")
+	case *string:
+		return *t
+	default:
+		return fmt.Sprint(reflect.ValueOf(t).Elem().Interface())
+	}
+}
+
+func (f *settingFlag) Set(v string) error {
+	if err := parseInto(f.target, v); err != nil {
+		return err
+	}
+	target := f.target
+	*f.applied = append(*f.applied, func() error { return parseInto(target, v) })
+	return nil
+}
+
+// IsBoolFlag позволяет писать логические флаги без значения: -features.webhooks
+func (f *settingFlag) IsBoolFlag() bool {
+	_, ok := f.target.(*bool)
+	return ok
+}
+
+// loadFile читает файл в виде дерева ключей и применяет его через ту же таблицу settings,
+// что и окружение: неизвестный ключ — ошибка, длительности записываются как "30s"
+func loadFile(path string, all []setting) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	tree := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return fmt.Errorf("config %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flatten("", tree, values); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	byKey := make(map[string]setting, len(all))
+	for _, s := range all {
+		byKey[s.key] = s
+	}
+	for key, v := range values {
+		s, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("config %s: unknown setting %q", path, key)
+		}
+		if err := parseInto(s.target, v); err != nil {
+			return fmt.Errorf("config %s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+func flatten(prefix string, tree map[string]interface{}, out map[string]string) error {
+	for k, v := range tree {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if err := flatten(key, v, out); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// fromEnv применяет TMV_-переменную, а если её нет — прежнее имя
+func (s setting) fromEnv() error {
+	for _, name := range append([]string{s.env()}, s.aliases...) {
+		if v, ok := os.LookupEnv(name); ok {
+			if err := parseInto(s.target, v); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func parseInto(target interface{}, v string) error {
+	v = strings.TrimSpace(v)
+	switch t := target.(type) {
+	case *string:
+		*t = v
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*t = b
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		*t = n
+	case *uint64:
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		*t = n
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		*t = d
+	case *[]string:
+		*t = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*t = append(*t, item)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported setting type %T", target)
+	}
+	return nil
+}
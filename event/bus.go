@@ -0,0 +1,106 @@
+package event
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"tmv/logging"
+)
+
+// Handler обрабатывает событие. Ошибка асинхронного обработчика приводит к повтору.
+type Handler func(e *Event) error
+
+type subscription struct {
+	name    string
+	pattern string
+	handler Handler
+}
+
+// Bus — внутренняя шина событий.
+// Синхронные подписчики вызываются в той же горутине сразу после записи,
+// асинхронные — ретранслятором outbox, поэтому переживают перезапуск процесса.
+type Bus struct {
+	mu    sync.RWMutex
+	sync  []subscription
+	async []subscription
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe регистрирует синхронный обработчик событий, подходящих под pattern
+func (b *Bus) Subscribe(pattern string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sync = append(b.sync, subscription{pattern: pattern, handler: h})
+}
+
+// SubscribeAsync регистрирует асинхронный обработчик. По name outbox помнит,
+// кто уже обработал событие, поэтому имя должно быть уникальным и не меняться между запусками.
+func (b *Bus) SubscribeAsync(name, pattern string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.async {
+		if s.name == name {
+			panic("event: duplicate async subscriber " + name)
+		}
+	}
+	b.async = append(b.async, subscription{name: name, pattern: pattern, handler: h})
+}
+
+// Publish вызывает синхронных подписчиков. Их ошибки только логируются: запись уже выполнена.
+func (b *Bus) Publish(e *Event) {
+	b.mu.RLock()
+	subs := b.sync
+	b.mu.RUnlock()
+
+	for _, s := range subs {
+		if !Matches(s.pattern, e.Type) {
+			continue
+		}
+		if err := safeCall(s.handler, e); err != nil {
+			logging.Default().Error("event: subscriber failed", "event", e.Type, "event_id", e.ID.Hex(), "error", err)
+		}
+	}
+}
+
+// Dispatch вызывает асинхронных подписчиков, кроме перечисленных в done,
+// и возвращает обновлённый список обработавших событие
+func (b *Bus) Dispatch(e *Event, done []string) ([]string, error) {
+	b.mu.RLock()
+	subs := b.async
+	b.mu.RUnlock()
+
+	skip := make(map[string]bool, len(done))
+	for _, name := range done {
+		skip[name] = true
+	}
+
+	var failed []string
+	for _, s := range subs {
+		if skip[s.name] || !Matches(s.pattern, e.Type) {
+			continue
+		}
+		if err := safeCall(s.handler, e); err != nil {
+			failed = append(failed, s.name+": "+err.Error())
+			continue
+		}
+		done = append(done, s.name)
+	}
+
+	if len(failed) > 0 {
+		return done, fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return done, nil
+}
+
+// safeCall не даёт панике подписчика уронить запрос или ретранслятор
+func safeCall(h Handler, e *Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(e)
+}
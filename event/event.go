@@ -0,0 +1,148 @@
+package event
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Типы доменных событий. Имена задач и проектов совпадают с событиями webhook.
+const (
+	TaskCreated    = project.EventTaskCreated
+	TaskUpdated    = project.EventTaskUpdated
+	TaskDeleted    = project.EventTaskDeleted
+	ProjectCreated = project.EventProjectCreated
+	ProjectUpdated = project.EventProjectUpdated
+	ProjectDeleted = project.EventProjectDeleted
+	UserCreated    = "user.created"
+	UserUpdated    = "user.updated"
+	UserDeleted    = "user.deleted"
+)
+
+// Event — изменение, которое уже записано в хранилище.
+// Data — *TaskPayload, *ProjectPayload или *UserPayload в зависимости от префикса Type.
+type Event struct {
+	ID         ident.ID    `json:"id"`
+	Type       string      `json:"type"`
+	ProjectID  ident.ID    `json:"projectId"` // Нулевой для событий пользователей
+	OccurredAt time.Time   `json:"occurredAt"`
+	Data       interface{} `json:"data"`
+
+	Trace map[string]string `json:"-"` // Заголовки W3C Trace Context операции, породившей событие
+}
+
+// TaskPayload — данные событий task.*
+type TaskPayload struct {
+	ProjectID ident.ID      `bson:"projectId" json:"projectId"`
+	TaskID    ident.ID      `bson:"taskId" json:"taskId"`
+	Task      *project.Task `bson:"task,omitempty" json:"task,omitempty"`       // Состояние после записи
+	Changes   bson.M        `bson:"changes,omitempty" json:"changes,omitempty"` // Изменённые поля для task.updated
+}
+
+// ProjectPayload — данные событий project.*
+type ProjectPayload struct {
+	ProjectID ident.ID         `bson:"projectId" json:"projectId"`
+	Project   *project.Project `bson:"project,omitempty" json:"project,omitempty"`
+	Changes   bson.M           `bson:"changes,omitempty" json:"changes,omitempty"`
+}
+
+// UserPayload — данные событий user.*
+type UserPayload struct {
+	UserID ident.ID   `bson:"userId" json:"userId"`
+	User   *user.User `bson:"user,omitempty" json:"user,omitempty"`
+}
+
+func New(eventType string, projectId ident.ID, data interface{}) *Event {
+	return &Event{
+		ID:         ident.New(),
+		Type:       eventType,
+		ProjectID:  projectId,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+}
+
+// Matches проверяет тип события по шаблону: "*", "task.*" или точное имя
+func Matches(pattern, eventType string) bool {
+	if pattern == "*" || pattern == eventType {
+		return true
+	}
+	if strings.HasSuffix(pattern, ".*") {
+		return strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+// Record — запись outbox: событие, сохранённое до того, как его получат асинхронные подписчики
+type Record struct {
+	Id          ident.ID          `bson:"_id"`
+	Type        string            `bson:"type"`
+	ProjectID   ident.ID          `bson:"projectId"`
+	OccurredAt  time.Time         `bson:"occurredAt"`
+	Payload     bson.Raw          `bson:"payload"`
+	Done        []string          `bson:"done"`     // Подписчики, уже обработавшие событие
+	Attempts    int               `bson:"attempts"` // Неудачные попытки доставки
+	LastError   string            `bson:"lastError,omitempty"`
+	Failed      bool              `bson:"failed"` // Попытки исчерпаны, запись оставлена для разбора
+	NextAttempt time.Time         `bson:"nextAttempt"`
+	Trace       map[string]string `bson:"trace,omitempty"`
+}
+
+// NewRecord готовит запись outbox, которую ретранслятор возьмёт не раньше notBefore
+func NewRecord(e *Event, notBefore time.Time) (*Record, error) {
+	r := &Record{
+		Id:          e.ID,
+		Type:        e.Type,
+		ProjectID:   e.ProjectID,
+		OccurredAt:  e.OccurredAt,
+		Done:        []string{},
+		NextAttempt: notBefore,
+		Trace:       e.Trace,
+	}
+	if err := r.SetPayload(e); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetPayload перезаписывает данные записи из события
+func (r *Record) SetPayload(e *Event) error {
+	payload, err := bson.Marshal(e.Data)
+	if err != nil {
+		return fmt.Errorf("marshal %s payload: %w", e.Type, err)
+	}
+	r.Payload = payload
+	return nil
+}
+
+// Event восстанавливает событие из записи с типизированными данными
+func (r *Record) Event() (*Event, error) {
+	var data interface{}
+	switch {
+	case strings.HasPrefix(r.Type, "task."):
+		data = &TaskPayload{}
+	case strings.HasPrefix(r.Type, "project."):
+		data = &ProjectPayload{}
+	case strings.HasPrefix(r.Type, "user."):
+		data = &UserPayload{}
+	default:
+		return nil, fmt.Errorf("unknown event type %q", r.Type)
+	}
+	if err := bson.Unmarshal(r.Payload, data); err != nil {
+		return nil, fmt.Errorf("unmarshal %s payload: %w", r.Type, err)
+	}
+
+	return &Event{
+		ID:         r.Id,
+		Type:       r.Type,
+		ProjectID:  r.ProjectID,
+		OccurredAt: r.OccurredAt,
+		Data:       data,
+		Trace:      r.Trace,
+	}, nil
+}
@@ -0,0 +1,120 @@
+package event
+
+import (
+	"context"
+	"time"
+	"tmv/ident"
+	"tmv/logging"
+)
+
+// Outbox — хранилище записей, из которого читает ретранслятор
+type Outbox interface {
+	ClaimOutbox(now time.Time, lease time.Duration) (*Record, error)
+	UpdateOutbox(r *Record) error
+	DeleteOutbox(id ident.ID) error
+}
+
+// Relay передаёт события из outbox асинхронным подписчикам шины с повторами
+type Relay struct {
+	Outbox      Outbox
+	Bus         *Bus
+	MaxAttempts int           // После стольких неудач запись помечается failed
+	BaseDelay   time.Duration // Пауза перед повтором, дальше удваивается
+	MaxDelay    time.Duration
+	Lease       time.Duration // На сколько запись закрепляется за экземпляром
+	PollEvery   time.Duration
+
+	wake chan struct{}
+}
+
+func NewRelay(outbox Outbox, bus *Bus) *Relay {
+	return &Relay{
+		Outbox:      outbox,
+		Bus:         bus,
+		MaxAttempts: 10,
+		BaseDelay:   5 * time.Second,
+		MaxDelay:    30 * time.Minute,
+		Lease:       time.Minute,
+		PollEvery:   5 * time.Second,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Wake будит ретранслятор, не дожидаясь очередного опроса
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run передаёт события, пока не отменён ctx
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollEvery)
+	defer ticker.Stop()
+
+	for {
+		r.ProcessDue(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// ProcessDue обрабатывает все записи, чья очередь наступила к now, и возвращает их число
+func (r *Relay) ProcessDue(now time.Time) int {
+	processed := 0
+	for {
+		rec, err := r.Outbox.ClaimOutbox(now, r.Lease)
+		if err != nil {
+			logging.Default().Error("event: claim outbox", "error", err)
+			return processed
+		}
+		if rec == nil {
+			return processed
+		}
+		r.deliver(rec)
+		processed++
+	}
+}
+
+func (r *Relay) deliver(rec *Record) {
+	e, err := rec.Event()
+	if err == nil {
+		rec.Done, err = r.Bus.Dispatch(e, rec.Done)
+	}
+	if err == nil {
+		if err := r.Outbox.DeleteOutbox(rec.Id); err != nil {
+			logging.Default().Error("event: delete outbox record", "event_id", rec.Id.Hex(), "error", err)
+		}
+		return
+	}
+
+	rec.Attempts++
+	rec.LastError = err.Error()
+	if rec.Attempts >= r.MaxAttempts {
+		rec.Failed = true
+		logging.Default().Error("event: delivery failed", "event", rec.Type, "event_id", rec.Id.Hex(), "attempts", rec.Attempts, "error", err)
+	} else {
+		rec.NextAttempt = time.Now().Add(r.Backoff(rec.Attempts))
+	}
+	if err := r.Outbox.UpdateOutbox(rec); err != nil {
+		logging.Default().Error("event: save outbox record", "event_id", rec.Id.Hex(), "error", err)
+	}
+}
+
+// Backoff — пауза после attempts неудачных попыток
+func (r *Relay) Backoff(attempts int) time.Duration {
+	delay := r.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= r.MaxDelay {
+			return r.MaxDelay
+		}
+	}
+	return delay
+}
@@ -0,0 +1,23 @@
+package event
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// SetTrace сохраняет в событии контекст трассировки ctx, чтобы асинхронные подписчики
+// продолжили ту же трассу. Без активного span-а ничего не сохраняется.
+func (e *Event) SetTrace(ctx context.Context) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		e.Trace = carrier
+	}
+}
+
+// TraceContext восстанавливает контекст трассировки, сохранённый SetTrace
+func (e *Event) TraceContext() context.Context {
+	return otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(e.Trace))
+}
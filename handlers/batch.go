@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchRequests — сколько подзапросов можно передать в одном пакете
+const maxBatchRequests = 50
+
+// batchRequest — тело POST /batch
+type batchRequest struct {
+	Requests   []batchItem `json:"requests"`
+	Sequential bool        `json:"sequential"` // Выполнять по порядку, даже если ссылок между подзапросами нет
+}
+
+// batchItem — один подзапрос. В path и в строках body можно сослаться на ответ предыдущего
+// подзапроса: {{projects.0.id}} — поле JSON-ответа подзапроса с id "projects".
+type batchItem struct {
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// batchResponse — ответ одного подзапроса
+type batchResponse struct {
+	ID     string          `json:"id,omitempty"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// batchReference — {{id.path}}: id подзапроса и путь к полю его ответа
+var batchReference = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_-]+)((?:\.[^.{}\s]+)*)\s*\}\}`)
+
+type batchContextKey struct{}
+
+// inBatch сообщает, что запрос — подзапрос /batch
+func inBatch(c *gin.Context) bool {
+	return c.Request.Context().Value(batchContextKey{}) != nil
+}
+
+// Batch выполняет несколько подзапросов через маршруты router за один запрос (POST /batch).
+// Независимые подзапросы выполняются параллельно, подзапрос со ссылками ждёт тех, на кого
+// ссылается, а если один из них завершился ошибкой, не выполняется и получает 424.
+// Ответ — 200 со статусом и телом каждого подзапроса в порядке запроса.
+func Batch(router http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req batchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid batch format"})
+			return
+		}
+		switch n := len(req.Requests); {
+		case n == 0:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "no requests given"})
+			return
+		case n > maxBatchRequests:
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": fmt.Sprintf("at most %d requests per batch", maxBatchRequests)})
+			return
+		}
+
+		deps, err := batchDependencies(req.Requests)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		ctx := context.WithValue(c.Request.Context(), batchContextKey{}, true)
+		responses := make([]batchResponse, len(req.Requests))
+		done := make([]chan struct{}, len(req.Requests))
+		for i := range done {
+			done[i] = make(chan struct{})
+		}
+
+		var wg sync.WaitGroup
+		for i := range req.Requests {
+			wait := deps[i]
+			if req.Sequential && i > 0 {
+				wait = append([]int{i - 1}, wait...)
+			}
+
+			wg.Add(1)
+			go func(i int, wait []int) {
+				defer wg.Done()
+				defer close(done[i])
+				for _, j := range wait {
+					<-done[j]
+				}
+
+				item := req.Requests[i]
+				for _, j := range deps[i] {
+					if responses[j].Status >= http.StatusBadRequest {
+						msg := fmt.Sprintf("request %q failed with status %d", req.Requests[j].ID, responses[j].Status)
+						responses[i] = batchError(item.ID, http.StatusFailedDependency, msg)
+						return
+					}
+				}
+				responses[i] = serveBatchItem(ctx, router, c.Request.Header, item, req.Requests, responses)
+			}(i, wait)
+		}
+		wg.Wait()
+
+		c.JSON(http.StatusOK, gin.H{"responses": responses})
+	}
+}
+
+// batchDependencies проверяет подзапросы и возвращает для каждого номера подзапросов,
+// на ответы которых он ссылается. Ссылаться можно только на подзапросы выше по списку.
+func batchDependencies(items []batchItem) ([][]int, error) {
+	index := make(map[string]int, len(items))
+	deps := make([][]int, len(items))
+	for i, item := range items {
+		switch item.Method {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return nil, fmt.Errorf("request %d: unsupported method %q", i, item.Method)
+		}
+		if !strings.HasPrefix(item.Path, "/") {
+			return nil, fmt.Errorf("request %d: path must start with /", i)
+		}
+		if p := strings.SplitN(item.Path, "?", 2)[0]; strings.TrimSuffix(p, "/") == "/batch" {
+			return nil, fmt.Errorf("request %d: batches cannot be nested", i)
+		}
+
+		seen := make(map[int]bool)
+		for _, m := range batchReference.FindAllStringSubmatch(item.Path+string(item.Body), -1) {
+			j, ok := index[m[1]]
+			if !ok {
+				return nil, fmt.Errorf("request %d: reference to unknown or later request %q", i, m[1])
+			}
+			if !seen[j] {
+				seen[j] = true
+				deps[i] = append(deps[i], j)
+			}
+		}
+
+		if item.ID != "" {
+			if _, dup := index[item.ID]; dup {
+				return nil, fmt.Errorf("request %d: duplicate id %q", i, item.ID)
+			}
+			index[item.ID] = i
+		}
+	}
+	return deps, nil
+}
+
+// serveBatchItem подставляет ссылки и выполняет подзапрос через router. Заголовки исходного
+// запроса (X-User-ID, X-Request-ID, трассировка) наследуются, заголовки подзапроса их перекрывают.
+func serveBatchItem(ctx context.Context, router http.Handler, header http.Header, item batchItem, items []batchItem, responses []batchResponse) batchResponse {
+	resolve := func(id string, path []string) (interface{}, error) {
+		for j := range items {
+			if items[j].ID == id {
+				return lookupJSON(responses[j].Body, path)
+			}
+		}
+		return nil, fmt.Errorf("unknown request %q", id)
+	}
+
+	path, err := substitutePath(item.Path, resolve)
+	if err != nil {
+		return batchError(item.ID, http.StatusBadRequest, err.Error())
+	}
+	var body io.Reader
+	if len(item.Body) > 0 {
+		b, err := substituteBody(item.Body, resolve)
+		if err != nil {
+			return batchError(item.ID, http.StatusBadRequest, err.Error())
+		}
+		body = bytes.NewReader(b)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, item.Method, path, body)
+	if err != nil {
+		return batchError(item.ID, http.StatusBadRequest, err.Error())
+	}
+	r.Header = header.Clone()
+	r.Header.Del("Content-Length")
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range item.Headers {
+		r.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return batchResponse{ID: item.ID, Status: w.Code, Body: responseBody(w.Body.Bytes())}
+}
+
+// responseBody встраивает JSON-ответ как есть, остальное — строкой
+func responseBody(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+	if json.Valid(b) {
+		return b
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
+
+func batchError(id string, status int, message string) batchResponse {
+	body, _ := json.Marshal(gin.H{"message": message})
+	return batchResponse{ID: id, Status: status, Body: body}
+}
+
+type batchResolver func(id string, path []string) (interface{}, error)
+
+func referencePath(m []string) []string {
+	if m[2] == "" {
+		return nil
+	}
+	return strings.Split(m[2][1:], ".")
+}
+
+// substitutePath подставляет в путь значения ссылок
+func substitutePath(path string, resolve batchResolver) (string, error) {
+	var failed error
+	out := batchReference.ReplaceAllStringFunc(path, func(ref string) string {
+		m := batchReference.FindStringSubmatch(ref)
+		v, err := resolve(m[1], referencePath(m))
+		if err != nil {
+			failed = fmt.Errorf("%s: %v", ref, err)
+			return ""
+		}
+		return url.PathEscape(scalarString(v))
+	})
+	return out, failed
+}
+
+// substituteBody подставляет ссылки в строки тела. Строка, целиком состоящая из одной ссылки,
+// заменяется значением как есть (число, объект); иначе значение вставляется в текст.
+func substituteBody(body json.RawMessage, resolve batchResolver) ([]byte, error) {
+	if !batchReference.Match(body) {
+		return body, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	var failed error
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			for k, e := range x {
+				x[k] = walk(e)
+			}
+		case []interface{}:
+			for i, e := range x {
+				x[i] = walk(e)
+			}
+		case string:
+			if m := batchReference.FindStringSubmatch(x); m != nil && m[0] == x {
+				r, err := resolve(m[1], referencePath(m))
+				if err != nil {
+					failed = fmt.Errorf("%s: %v", x, err)
+				}
+				return r
+			}
+			return batchReference.ReplaceAllStringFunc(x, func(ref string) string {
+				m := batchReference.FindStringSubmatch(ref)
+				r, err := resolve(m[1], referencePath(m))
+				if err != nil {
+					failed = fmt.Errorf("%s: %v", ref, err)
+				}
+				return scalarString(r)
+			})
+		}
+		return v
+	}
+	v = walk(v)
+	if failed != nil {
+		return nil, failed
+	}
+	return json.Marshal(v)
+}
+
+// lookupJSON возвращает поле JSON-документа по пути; номера выбирают элементы массивов
+func lookupJSON(doc json.RawMessage, path []string) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("response is not JSON")
+	}
+
+	for _, key := range path {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			e, ok := x[key]
+			if !ok {
+				return nil, fmt.Errorf("no field %q", key)
+			}
+			v = e
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil, fmt.Errorf("no element %q", key)
+			}
+			v = x[i]
+		default:
+			return nil, fmt.Errorf("no field %q", key)
+		}
+	}
+	return v, nil
+}
+
+// scalarString записывает значение ссылки для вставки в текст
+func scalarString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case json.Number:
+		return x.String()
+	case bool:
+		return strconv.FormatBool(x)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"tmv/ident"
+	"tmv/project"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetBoard(c *gin.Context) {
+	// Маршрут делит wildcard-сегмент с /project/:userId/:projectId, поэтому id проекта лежит в userId
+	projectId, err := ident.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	tasks, err := h.storage(c).GetTasksByProject(projectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Необязательный порядок колонок: ?columns=todo,in progress,done
+	var statuses []string
+	if columns := c.Query("columns"); columns != "" {
+		statuses = strings.Split(columns, ",")
+	}
+
+	c.JSON(http.StatusOK, project.NewBoard(projectId.Hex(), tasks, statuses))
+}
+func (h *Handler) MoveTask(c *gin.Context) {
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	taskId, err := ident.Parse(c.Param("taskId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid taskId format"})
+		return
+	}
+
+	// position — индекс в целевой колонке; отсутствие означает конец колонки
+	var requestBody struct {
+		Status   string `json:"status" binding:"required"`
+		Position *int   `json:"position"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	position := -1
+	if requestBody.Position != nil {
+		position = *requestBody.Position
+	}
+
+	before, err := h.storage(c).GetTask(projectId, taskId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "task not found"})
+		return
+	}
+
+	err = h.storage(c).MoveTask(projectId, taskId, requestBody.Status, position)
+	if err != nil {
+		if err.Error() == "task not found" {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		}
+		return
+	}
+
+	h.notifyTaskChanged(c, before)
+
+	c.JSON(http.StatusOK, gin.H{"message": "task moved successfully"})
+}
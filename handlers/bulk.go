@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkTasks — сколько задач можно создать или изменить одним запросом
+const maxBulkTasks = 1000
+
+// bulkResult — итог по одному элементу пакета
+type bulkResult struct {
+	Index   int    `json:"index"`
+	Status  int    `json:"status"`
+	TaskID  string `json:"taskId,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// taskPatch — элемент PATCH /tasks/:projectId/bulk
+type taskPatch struct {
+	TaskID string                 `json:"taskId"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// CreateTasks создаёт задачи проекта пакетом. Сначала проверяется весь пакет: если хоть один
+// элемент неверен, ничего не записывается и ответ 400 перечисляет ошибки. Иначе ответ содержит
+// итог по каждому элементу; 207 — часть задач не создана.
+func (h *Handler) CreateTasks(c *gin.Context) {
+	projectID, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	var items []json.RawMessage
+	if err := c.ShouldBindJSON(&items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid tasks format"})
+		return
+	}
+	if !checkBulkSize(c, len(items)) {
+		return
+	}
+
+	tasks := make([]*project.Task, len(items))
+	var invalid []bulkResult
+	for i, raw := range items {
+		var task project.Task
+		err := json.Unmarshal(raw, &task)
+		if err == nil {
+			err = prepareNewTask(&task)
+		}
+		if err != nil {
+			invalid = append(invalid, bulkResult{Index: i, Status: http.StatusBadRequest, Message: err.Error()})
+			continue
+		}
+		tasks[i] = &task
+	}
+	if len(invalid) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid tasks", "results": invalid})
+		return
+	}
+
+	errs, err := h.storage(c).InsertTasks(tasks, projectID)
+	if err != nil {
+		logger(c).Error("failed to insert tasks", "error", err)
+		c.JSON(bulkErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	// Одна сессия входящих на пакет: пользователи для назначений читаются один раз, а не на каждую задачу
+	actor, inbox := currentUserID(c), h.Inbox.Session()
+	results := make([]bulkResult, len(tasks))
+	failed := 0
+	for i, task := range tasks {
+		if errs[i] != nil {
+			failed++
+			results[i] = bulkResult{Index: i, Status: bulkErrorStatus(errs[i]), Message: errs[i].Error()}
+			continue
+		}
+		results[i] = bulkResult{Index: i, Status: http.StatusOK, TaskID: task.ID.Hex()}
+
+		inbox.TaskAssigned(actor, task, task.Assignees())
+		inbox.TaskMentioned(actor, task, project.Mentions(task.Description), task.Description)
+	}
+
+	writeBulkResults(c, results, failed, "tasks created successfully")
+}
+
+// UpdateTasks частично обновляет задачи проекта пакетом: [{"taskId": "...", "fields": {...}}].
+// Проверка пакета и ответы — как у CreateTasks; id задач в пакете не должны повторяться.
+func (h *Handler) UpdateTasks(c *gin.Context) {
+	projectID, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	var items []json.RawMessage
+	if err := c.ShouldBindJSON(&items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid tasks format"})
+		return
+	}
+	if !checkBulkSize(c, len(items)) {
+		return
+	}
+
+	updates := make([]storage.TaskUpdate, len(items))
+	seen := make(map[ident.ID]int, len(items))
+	var invalid []bulkResult
+	for i, raw := range items {
+		update, err := parseTaskPatch(raw)
+		if err == nil {
+			if first, dup := seen[update.ID]; dup {
+				err = fmt.Errorf("task is already updated by item %d", first)
+			}
+		}
+		if err != nil {
+			invalid = append(invalid, bulkResult{Index: i, Status: http.StatusBadRequest, Message: err.Error()})
+			continue
+		}
+		seen[update.ID] = i
+		updates[i] = update
+	}
+	if len(invalid) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid tasks", "results": invalid})
+		return
+	}
+
+	// Состояние до изменения нужно для уведомлений во входящие
+	before, err := h.tasksByID(c, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	errs, err := h.storage(c).UpdateTasks(projectID, updates)
+	if err != nil {
+		logger(c).Error("failed to update tasks", "error", err)
+		c.JSON(bulkErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	results := make([]bulkResult, len(updates))
+	failed := 0
+	for i, update := range updates {
+		if errs[i] != nil {
+			failed++
+			results[i] = bulkResult{Index: i, Status: bulkErrorStatus(errs[i]), TaskID: update.ID.Hex(), Message: errs[i].Error()}
+			continue
+		}
+		results[i] = bulkResult{Index: i, Status: http.StatusOK, TaskID: update.ID.Hex()}
+	}
+
+	if failed < len(updates) {
+		if after, err := h.tasksByID(c, projectID); err == nil {
+			actor, inbox := currentUserID(c), h.Inbox.Session()
+			for i, update := range updates {
+				if errs[i] != nil || before[update.ID] == nil || after[update.ID] == nil {
+					continue
+				}
+				notifyTaskDiff(inbox, actor, before[update.ID], after[update.ID])
+			}
+		}
+	}
+
+	writeBulkResults(c, results, failed, "tasks updated successfully")
+}
+
+// parseTaskPatch разбирает и проверяет элемент пакета обновления
+func parseTaskPatch(raw json.RawMessage) (storage.TaskUpdate, error) {
+	var patch taskPatch
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return storage.TaskUpdate{}, err
+	}
+	id, err := ident.Parse(patch.TaskID)
+	if err != nil {
+		return storage.TaskUpdate{}, errors.New("invalid taskId format")
+	}
+	if len(patch.Fields) == 0 {
+		return storage.TaskUpdate{}, errors.New("fields are required")
+	}
+	// Тот же список полей, что и у PUT /task; проверяется до записи, чтобы пакет не применился частично
+	fields, err := storage.NormalizeTaskUpdate(patch.Fields)
+	if err != nil {
+		return storage.TaskUpdate{}, err
+	}
+	return storage.TaskUpdate{ID: id, Fields: fields}, nil
+}
+
+// tasksByID возвращает задачи проекта по id
+func (h *Handler) tasksByID(c *gin.Context, projectID ident.ID) (map[ident.ID]*project.Task, error) {
+	tasks, err := h.storage(c).GetTasksByProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[ident.ID]*project.Task, len(tasks))
+	for i := range tasks {
+		byID[tasks[i].ID] = &tasks[i]
+	}
+	return byID, nil
+}
+
+// checkBulkSize отклоняет пустой и слишком большой пакет; при ошибке ответ уже отправлен
+func checkBulkSize(c *gin.Context, n int) bool {
+	switch {
+	case n == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "no tasks given"})
+		return false
+	case n > maxBulkTasks:
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": fmt.Sprintf("at most %d tasks per request", maxBulkTasks)})
+		return false
+	}
+	return true
+}
+
+// writeBulkResults отвечает 200, если все элементы выполнены, и 207 с итогами, если нет
+func writeBulkResults(c *gin.Context, results []bulkResult, failed int, message string) {
+	if failed > 0 {
+		c.JSON(http.StatusMultiStatus, gin.H{
+			"message": fmt.Sprintf("%d of %d tasks failed", failed, len(results)),
+			"results": results,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "results": results})
+}
+
+func bulkErrorStatus(err error) int {
+	if errors.Is(err, storage.ErrInvalidUpdate) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, storage.ErrTaskNotFound) || err.Error() == "project not found" {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
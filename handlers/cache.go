@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetCacheStats(c *gin.Context) {
+	if h.Cache == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "cache is disabled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.Cache.Stats())
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// Пауза между heartbeat-сообщениями: меньше типичного таймаута простоя у прокси
+const heartbeatInterval = 25 * time.Second
+
+// ProjectEvents отдаёт изменения задач и проекта потоком Server-Sent Events
+func (h *Handler) ProjectEvents(c *gin.Context) {
+	projectId, ok := h.authorizeStream(c)
+	if !ok {
+		return
+	}
+
+	lastEventId := c.GetHeader("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = c.Query("lastEventId")
+	}
+
+	sub, backlog, resumed := h.Realtime.Subscribe(projectId, lastEventId)
+	defer h.Realtime.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if !resumed {
+		// Событие уже вытеснено из истории: клиент должен перечитать задачи целиком
+		c.Render(-1, sse.Event{Event: "reset", Data: gin.H{"lastEventId": lastEventId}})
+	}
+	for _, e := range backlog {
+		c.Render(-1, sseEvent(e))
+	}
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			c.Render(-1, sseEvent(e))
+		case <-ticker.C:
+			io.WriteString(c.Writer, ": heartbeat\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+// ProjectEventsWS отдаёт те же события через WebSocket, по одному JSON-сообщению на событие
+func (h *Handler) ProjectEventsWS(c *gin.Context) {
+	projectId, ok := h.authorizeStream(c)
+	if !ok {
+		return
+	}
+
+	server := websocket.Server{
+		// Браузер присылает Origin и при подключении с чужой страницы, поэтому он проверяется
+		// и здесь, на случай если запрос дошёл сюда в обход authorizeStream
+		Handshake: func(_ *websocket.Config, req *http.Request) error {
+			if !h.streamOriginAllowed(req) {
+				return errors.New("origin not allowed")
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			sub, backlog, resumed := h.Realtime.Subscribe(projectId, c.Query("lastEventId"))
+			defer h.Realtime.Unsubscribe(sub)
+
+			// Клиент ничего не присылает; чтение нужно только, чтобы заметить закрытие соединения
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				var discard []byte
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+			}()
+
+			if !resumed && websocket.JSON.Send(ws, gin.H{"type": "reset"}) != nil {
+				return
+			}
+			for _, e := range backlog {
+				if websocket.JSON.Send(ws, e) != nil {
+					return
+				}
+			}
+
+			ticker := time.NewTicker(heartbeatInterval)
+			defer ticker.Stop()
+
+			for {
+				var err error
+				select {
+				case <-closed:
+					return
+				case e, ok := <-sub.C:
+					if !ok {
+						return
+					}
+					err = websocket.JSON.Send(ws, e)
+				case <-ticker.C:
+					err = websocket.JSON.Send(ws, gin.H{"type": "heartbeat"})
+				}
+				if err != nil {
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// authorizeStream проверяет источник запроса и то, что пользователь состоит в проекте;
+// при ошибке ответ уже отправлен. Пользователь берётся только из заголовка X-User-ID:
+// EventSource и WebSocket в браузере заголовков не задают, его выставляет прокси аутентификации.
+func (h *Handler) authorizeStream(c *gin.Context) (ident.ID, bool) {
+	// Ответ подзапроса /batch собирается целиком, поток в нём не отдать
+	if inBatch(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "event streams are not available in a batch"})
+		return ident.Nil, false
+	}
+
+	// Маршрут делит wildcard-сегмент с /project/:userId/:projectId, поэтому id проекта лежит в userId
+	projectId, err := ident.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return ident.Nil, false
+	}
+
+	// Поток с чужой страницы открылся бы с правами пользователя, который её открыл
+	if !h.streamOriginAllowed(c.Request) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "origin not allowed"})
+		return ident.Nil, false
+	}
+
+	userId, ok := requireUser(c)
+	if !ok {
+		return ident.Nil, false
+	}
+
+	u, err := h.storage(c).GetUser(userId)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		}
+		return ident.Nil, false
+	}
+	for _, id := range u.Projects {
+		if id == projectId {
+			return projectId, true
+		}
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{"message": "no access to project"})
+	return ident.Nil, false
+}
+
+// streamOriginAllowed допускает запросы без Origin (не из браузера), со страниц того же хоста
+// и из источников StreamOrigins
+func (h *Handler) streamOriginAllowed(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == req.Host {
+		return true
+	}
+	for _, allowed := range h.StreamOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func sseEvent(e *event.Event) sse.Event {
+	return sse.Event{Id: e.ID.Hex(), Event: e.Type, Data: e}
+}
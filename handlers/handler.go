@@ -1,39 +1,69 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
+	"tmv/ident"
+	"tmv/logging"
+	"tmv/notify"
 	"tmv/project"
+	"tmv/realtime"
 	"tmv/storage"
 	"tmv/user"
+	"tmv/webhook"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ErrorResponse struct {
 	Message string `json:"message"`
 }
 type Handler struct {
-	Storage storage.Storage
+	Storage  storage.Storage
+	Inbox    *notify.Inbox
+	Webhooks *webhook.Dispatcher
+	Realtime *realtime.Hub
+	Cache    *storage.CachedStorage // nil, если кэш не подключён
+	// Источники браузерных страниц, которым разрешены потоки событий (server.cors.allowed_origins).
+	// Страницы того же хоста и клиенты без Origin допускаются всегда.
+	StreamOrigins []string
 }
 
 func NewHandler(st storage.Storage) *Handler {
-	return &Handler{Storage: st}
+	return &Handler{
+		Storage:  st,
+		Inbox:    notify.NewInbox(st),
+		Webhooks: webhook.NewDispatcher(st),
+		Realtime: realtime.NewHub(),
+	}
+}
+
+// storage возвращает хранилище, привязанное к контексту запроса: запросы к базе
+// отменяются вместе с ним и попадают в его трассировку
+func (h *Handler) storage(c *gin.Context) storage.Storage {
+	return storage.WithContext(h.Storage, c.Request.Context())
+}
+
+// logger возвращает журнал запроса с его request_id
+func logger(c *gin.Context) *logging.Logger {
+	return logging.FromContext(c.Request.Context())
 }
 
 func (h *Handler) CreateUser(c *gin.Context) {
 	var newUser user.User
 
 	if err := c.BindJSON(&newUser); err != nil {
-		fmt.Printf("failer to bind user: %s\n", err.Error())
+		logger(c).Warn("failed to bind user", "error", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
 
-	h.Storage.InsertUser(&newUser)
+	if err := h.storage(c).InsertUser(&newUser); err != nil {
+		writeUserError(c, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, map[string]interface{}{
 		"userId": newUser.Id.Hex(),
@@ -44,7 +74,7 @@ func (h *Handler) CreateProject(c *gin.Context) {
 	var proj project.Project
 
 	if err := c.BindJSON(&proj); err != nil {
-		fmt.Printf("failed to bind project: %s\n", err.Error())
+		logger(c).Warn("failed to bind project", "error", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
@@ -52,18 +82,18 @@ func (h *Handler) CreateProject(c *gin.Context) {
 	}
 
 	userIDStr := c.Param("userId")
-	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	userID, err := ident.Parse(userIDStr)
 	if err != nil {
-		fmt.Printf("failed to convert userId to ObjectID: %s\n", err.Error())
+		logger(c).Warn("failed to convert userId to ID", "error", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: "invalid userId format",
 		})
 		return
 	}
 
-	err = h.Storage.InsertProject(&proj, userID)
+	err = h.storage(c).InsertProject(&proj, userID)
 	if err != nil {
-		fmt.Printf("failed to insert project: %s\n", err.Error())
+		logger(c).Error("failed to insert project", "error", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Message: err.Error(),
 		})
@@ -76,18 +106,18 @@ func (h *Handler) CreateProject(c *gin.Context) {
 	})
 }
 func (h *Handler) UpdateUser(c *gin.Context) {
-	userId, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	userId, err := ident.Parse(c.Param("userId"))
 	if err != nil {
-		fmt.Printf("failed to convert params userId to ObjectID: %s\n", err.Error())
+		logger(c).Warn("failed to convert params userId to ID", "error", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
 
-	existingUser, err := h.Storage.GetUser(userId)
+	existingUser, err := h.storage(c).GetUser(userId)
 	if err != nil {
-		fmt.Printf("failed to get user: %s\n", err.Error())
+		logger(c).Error("failed to get user", "error", err)
 		c.JSON(http.StatusNotFound, ErrorResponse{
 			Message: err.Error(),
 		})
@@ -96,7 +126,7 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 
 	var newUser user.User
 	if err := c.BindJSON(&newUser); err != nil {
-		fmt.Printf("failed to bind user: %s\n", err.Error())
+		logger(c).Warn("failed to bind user", "error", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
@@ -119,29 +149,42 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 		existingUser.Email = newUser.Email
 	}
 
-	h.Storage.UpdateUser(userId, &existingUser)
+	if err := h.storage(c).UpdateUser(userId, &existingUser); err != nil {
+		writeUserError(c, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, map[string]interface{}{
 		"userId": existingUser.Id.Hex(),
 	})
 }
+
+// writeUserError отвечает 409 на занятый email и 500 на остальные ошибки записи пользователя
+func writeUserError(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	logger(c).Error("failed to save user", "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+}
 func (h *Handler) GetAllUsers(c *gin.Context) {
-	storage := h.Storage.GetAllUsers()
+	storage := h.storage(c).GetAllUsers()
 	c.JSON(http.StatusOK, storage)
 }
 func (h *Handler) GetUser(c *gin.Context) {
-	userId, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	userId, err := ident.Parse(c.Param("userId"))
 	if err != nil {
-		fmt.Printf("failer convert params userId to ObjectID: %s\n", err.Error())
+		logger(c).Warn("failed to convert params userId to ID", "error", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
 
-	user, err := h.Storage.GetUser(userId)
+	user, err := h.storage(c).GetUser(userId)
 	if err != nil {
-		fmt.Printf("failed to get user %s\n", err.Error())
+		logger(c).Error("failed to get user", "error", err)
 		c.JSON(http.StatusNotFound, ErrorResponse{
 			Message: err.Error(),
 		})
@@ -151,28 +194,28 @@ func (h *Handler) GetUser(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 func (h *Handler) DeleteUser(c *gin.Context) {
-	userId, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	userId, err := ident.Parse(c.Param("userId"))
 	if err != nil {
-		fmt.Printf("failed to convert userId param to ObjectID: %s\n", err.Error())
+		logger(c).Warn("failed to convert userId param to ID", "error", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 	}
 
-	h.Storage.DeleteUser(userId)
+	h.storage(c).DeleteUser(userId)
 	c.String(http.StatusOK, "user deleted")
 }
 func (h *Handler) GetProjectsByUser(c *gin.Context) {
 	// Получаем userId из параметров запроса
 	userIdHex := c.Param("userId")
-	userId, err := primitive.ObjectIDFromHex(userIdHex)
+	userId, err := ident.Parse(userIdHex)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid userId format"})
 		return
 	}
 
 	// Получаем проекты пользователя
-	projects, err := h.Storage.GetProjectByUser(userId)
+	projects, err := h.storage(c).GetProjectByUser(userId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
@@ -184,21 +227,21 @@ func (h *Handler) GetProjectsByUser(c *gin.Context) {
 func (h *Handler) GetProject(c *gin.Context) {
 	// Получаем userId и projectId из параметров запроса
 	userIdHex := c.Param("userId")
-	userId, err := primitive.ObjectIDFromHex(userIdHex)
+	userId, err := ident.Parse(userIdHex)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid userId format"})
 		return
 	}
 
 	projectIdHex := c.Param("projectId")
-	projectId, err := primitive.ObjectIDFromHex(projectIdHex)
+	projectId, err := ident.Parse(projectIdHex)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
 		return
 	}
 
 	// Получаем проект
-	project, err := h.Storage.GetProject(userId, projectId)
+	project, err := h.storage(c).GetProject(userId, projectId)
 	if err != nil {
 		if err.Error() == "проект не найден" {
 			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
@@ -212,7 +255,7 @@ func (h *Handler) GetProject(c *gin.Context) {
 	c.JSON(http.StatusOK, project)
 }
 func (h *Handler) GetAllProjects(c *gin.Context) {
-	storage := h.Storage.GetAllProjects()
+	storage := h.storage(c).GetAllProjects()
 	c.JSON(http.StatusOK, storage)
 }
 func (h *Handler) UpdateProject(c *gin.Context) {
@@ -222,8 +265,8 @@ func (h *Handler) UpdateProject(c *gin.Context) {
 		return
 	}
 
-	// Преобразуем строку projectID в ObjectID
-	projectObjectID, err := primitive.ObjectIDFromHex(projectID)
+	// Преобразуем строку projectID в идентификатор
+	projectObjectID, err := ident.Parse(projectID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
 		return
@@ -235,7 +278,11 @@ func (h *Handler) UpdateProject(c *gin.Context) {
 		return
 	}
 
-	err = h.Storage.UpdateProject(projectObjectID, updateFields)
+	err = h.storage(c).UpdateProject(projectObjectID, updateFields)
+	if errors.Is(err, storage.ErrInvalidUpdate) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "failed to update project", "error": err.Error()})
 		return
@@ -245,15 +292,15 @@ func (h *Handler) UpdateProject(c *gin.Context) {
 }
 
 func (h *Handler) DeleteProject(c *gin.Context) {
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	id, err := ident.Parse(c.Param("id"))
 	if err != nil {
-		fmt.Printf("failed to convert id param to ProjectID: %s\n", err.Error())
+		logger(c).Warn("failed to convert id param to ProjectID", "error", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 	}
 
-	h.Storage.DeleteProject(id)
+	h.storage(c).DeleteProject(id)
 	c.String(http.StatusOK, "project deleted")
 }
 func (h *Handler) DeleteProjects(c *gin.Context) {
@@ -263,8 +310,8 @@ func (h *Handler) DeleteProjects(c *gin.Context) {
 		return
 	}
 
-	// Преобразуем строку userID в ObjectID
-	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	// Преобразуем строку userID в идентификатор
+	userObjectID, err := ident.Parse(userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid userId format"})
 		return
@@ -279,10 +326,10 @@ func (h *Handler) DeleteProjects(c *gin.Context) {
 		return
 	}
 
-	// Преобразуем строковые идентификаторы проектов в ObjectID
-	projectObjectIDs := make([]primitive.ObjectID, len(requestBody.ProjectIDs))
+	// Разбираем строковые идентификаторы проектов
+	projectObjectIDs := make([]ident.ID, len(requestBody.ProjectIDs))
 	for i, projectID := range requestBody.ProjectIDs {
-		projectObjectID, err := primitive.ObjectIDFromHex(projectID)
+		projectObjectID, err := ident.Parse(projectID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectID format"})
 			return
@@ -291,7 +338,7 @@ func (h *Handler) DeleteProjects(c *gin.Context) {
 	}
 
 	// Вызовем метод для удаления проектов
-	err = h.Storage.DeleteProjects(userObjectID, projectObjectIDs)
+	err = h.storage(c).DeleteProjects(userObjectID, projectObjectIDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "failed to delete projects", "error": err.Error()})
 		return
@@ -301,18 +348,18 @@ func (h *Handler) DeleteProjects(c *gin.Context) {
 }
 
 func (h *Handler) GetAlltasks(c *gin.Context) {
-	storage := h.Storage.GetAllTasks()
+	storage := h.storage(c).GetAllTasks()
 	c.JSON(http.StatusOK, storage)
 }
 func (h *Handler) GetTasksByProject(c *gin.Context) {
 	projectIdParam := c.Param("projectId")
-	projectId, err := primitive.ObjectIDFromHex(projectIdParam)
+	projectId, err := ident.Parse(projectIdParam)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
 		return
 	}
 
-	tasks, err := h.Storage.GetTasksByProject(projectId)
+	tasks, err := h.storage(c).GetTasksByProject(projectId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
@@ -324,7 +371,14 @@ func (h *Handler) CreateTask(c *gin.Context) {
 	var task project.Task
 
 	if err := c.BindJSON(&task); err != nil {
-		fmt.Printf("failed to bind project: %s\n", err.Error())
+		logger(c).Warn("failed to bind task", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := prepareNewTask(&task); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
@@ -332,46 +386,62 @@ func (h *Handler) CreateTask(c *gin.Context) {
 	}
 
 	projectIDStr := c.Param("projectId")
-	projectID, err := primitive.ObjectIDFromHex(projectIDStr)
+	projectID, err := ident.Parse(projectIDStr)
 	if err != nil {
-		fmt.Printf("failed to convert userId to ObjectID: %s\n", err.Error())
+		logger(c).Warn("failed to convert projectId to ID", "error", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: "invalid userId format",
 		})
 		return
 	}
 
-	err = h.Storage.InsertTask(&task, projectID)
+	err = h.storage(c).InsertTask(&task, projectID)
 	if err != nil {
-		fmt.Printf("failed to insert project: %s\n", err.Error())
+		logger(c).Error("failed to insert task", "error", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
 
+	actor, inbox := currentUserID(c), h.Inbox.Session()
+	inbox.TaskAssigned(actor, &task, task.Assignees())
+	inbox.TaskMentioned(actor, &task, project.Mentions(task.Description), task.Description)
+
 	c.JSON(http.StatusOK, map[string]interface{}{
 		"taskId":    task.ID,
 		"projectId": projectID.Hex(),
 	})
 }
+
+// prepareNewTask проверяет задачу из запроса. Из повторения принимаем только правило,
+// поля серии заполняет хранилище.
+func prepareNewTask(task *project.Task) error {
+	if task.Recurrence != nil {
+		if _, err := project.ParseRule(task.Recurrence.Rule); err != nil {
+			return err
+		}
+		task.Recurrence = &project.Recurrence{Rule: task.Recurrence.Rule}
+	}
+	return nil
+}
 func (h *Handler) GetTask(c *gin.Context) {
 	projectIdParam := c.Param("projectId")
 	taskIdParam := c.Param("taskId")
 
-	projectId, err := primitive.ObjectIDFromHex(projectIdParam)
+	projectId, err := ident.Parse(projectIdParam)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
 		return
 	}
 
-	taskId, err := primitive.ObjectIDFromHex(taskIdParam)
+	taskId, err := ident.Parse(taskIdParam)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid taskId format"})
 		return
 	}
 
-	task, err := h.Storage.GetTask(projectId, taskId)
+	task, err := h.storage(c).GetTask(projectId, taskId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
@@ -388,19 +458,19 @@ func (h *Handler) DeleteTask(c *gin.Context) {
 	projectIdParam := c.Param("projectId")
 	taskIdParam := c.Param("taskId")
 
-	projectId, err := primitive.ObjectIDFromHex(projectIdParam)
+	projectId, err := ident.Parse(projectIdParam)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
 		return
 	}
 
-	taskId, err := primitive.ObjectIDFromHex(taskIdParam)
+	taskId, err := ident.Parse(taskIdParam)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid taskId format"})
 		return
 	}
 
-	err = h.Storage.DeleteTask(projectId, taskId)
+	err = h.storage(c).DeleteTask(projectId, taskId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
@@ -412,7 +482,7 @@ func (h *Handler) DeleteTasks(c *gin.Context) {
 	projectIdParam := c.Param("projectId")
 
 	// Проверка правильности формата projectId
-	projectId, err := primitive.ObjectIDFromHex(projectIdParam)
+	projectId, err := ident.Parse(projectIdParam)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
 		return
@@ -424,10 +494,10 @@ func (h *Handler) DeleteTasks(c *gin.Context) {
 		return
 	}
 
-	// Преобразование taskIds в []primitive.ObjectID
-	var objectIDs []primitive.ObjectID
+	// Преобразование taskIds в []ident.ID
+	var objectIDs []ident.ID
 	for _, id := range taskIds {
-		objectID, err := primitive.ObjectIDFromHex(id)
+		objectID, err := ident.Parse(id)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid taskId format"})
 			return
@@ -436,7 +506,7 @@ func (h *Handler) DeleteTasks(c *gin.Context) {
 	}
 
 	// Вызов метода DeleteTasks для удаления задач
-	err = h.Storage.DeleteTasks(projectId, objectIDs)
+	err = h.storage(c).DeleteTasks(projectId, objectIDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
@@ -448,13 +518,13 @@ func (h *Handler) UpdateTask(c *gin.Context) {
 	projectIdParam := c.Param("projectId")
 	taskIdParam := c.Param("taskId")
 
-	projectId, err := primitive.ObjectIDFromHex(projectIdParam)
+	projectId, err := ident.Parse(projectIdParam)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
 		return
 	}
 
-	taskId, err := primitive.ObjectIDFromHex(taskIdParam)
+	taskId, err := ident.Parse(taskIdParam)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid taskId format"})
 		return
@@ -465,12 +535,32 @@ func (h *Handler) UpdateTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid task format"})
 		return
 	}
+	// Ранг, история статусов и повторение меняются отдельными маршрутами
+	updateFields, err = storage.NormalizeTaskUpdate(updateFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
 
-	err = h.Storage.UpdateTask(projectId, taskId, updateFields)
+	before, err := h.storage(c).GetTask(projectId, taskId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
 
+	err = h.storage(c).UpdateTask(projectId, taskId, updateFields)
+	if errors.Is(err, storage.ErrInvalidUpdate) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	if before != nil {
+		h.notifyTaskChanged(c, before)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "task updated successfully"})
 }
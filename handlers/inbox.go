@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"tmv/ident"
+	"tmv/notify"
+	"tmv/project"
+	"tmv/user"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Заголовок с id текущего пользователя: отдельной аутентификации в сервисе нет
+const userIDHeader = "X-User-ID"
+
+func (h *Handler) GetMyNotifications(c *gin.Context) {
+	userId, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid offset parameter"})
+		return
+	}
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid limit parameter"})
+		return
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications, total, err := h.storage(c).GetNotifications(userId, unreadOnly, offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	unread, err := h.storage(c).CountUnreadNotifications(userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":  notifications,
+		"total":  total,
+		"unread": unread,
+		"offset": offset,
+		"limit":  limit,
+	})
+}
+func (h *Handler) MarkNotificationRead(c *gin.Context) {
+	userId, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	notificationId, err := ident.Parse(c.Param("notificationId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid notificationId format"})
+		return
+	}
+
+	err = h.storage(c).MarkNotificationRead(userId, notificationId)
+	if err != nil {
+		if err.Error() == "notification not found" {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "notification marked as read"})
+}
+func (h *Handler) MarkAllNotificationsRead(c *gin.Context) {
+	userId, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.storage(c).MarkAllNotificationsRead(userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "notifications marked as read", "count": count})
+}
+func (h *Handler) WatchProject(c *gin.Context) {
+	h.setProjectWatch(c, true)
+}
+func (h *Handler) UnwatchProject(c *gin.Context) {
+	h.setProjectWatch(c, false)
+}
+func (h *Handler) WatchTask(c *gin.Context) {
+	h.setTaskWatch(c, true)
+}
+func (h *Handler) UnwatchTask(c *gin.Context) {
+	h.setTaskWatch(c, false)
+}
+func (h *Handler) GetComments(c *gin.Context) {
+	projectId, taskId, ok := taskParams(c)
+	if !ok {
+		return
+	}
+
+	comments, err := h.storage(c).GetCommentsByTask(projectId, taskId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, comments)
+}
+func (h *Handler) CreateComment(c *gin.Context) {
+	userId, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	projectId, taskId, ok := taskParams(c)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		Text string `json:"text" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	task, err := h.storage(c).GetTask(projectId, taskId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if task == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "task not found"})
+		return
+	}
+
+	comment := project.Comment{AuthorID: userId, Text: requestBody.Text}
+	if err := h.storage(c).InsertComment(&comment, projectId, taskId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	h.Inbox.TaskCommented(userId, task, &comment)
+
+	c.JSON(http.StatusOK, comment)
+}
+
+func (h *Handler) setProjectWatch(c *gin.Context, watch bool) {
+	userId, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	h.setWatch(c, watch, &user.Watch{UserID: userId, Kind: user.WatchProject, TargetID: projectId, ProjectID: projectId})
+}
+
+func (h *Handler) setTaskWatch(c *gin.Context, watch bool) {
+	userId, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	projectId, taskId, ok := taskParams(c)
+	if !ok {
+		return
+	}
+
+	h.setWatch(c, watch, &user.Watch{UserID: userId, Kind: user.WatchTask, TargetID: taskId, ProjectID: projectId})
+}
+
+func (h *Handler) setWatch(c *gin.Context, watch bool, w *user.Watch) {
+	var err error
+	if watch {
+		err = h.storage(c).Watch(w)
+	} else {
+		err = h.storage(c).Unwatch(w.UserID, w.Kind, w.TargetID)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err.Error() {
+		case "project not found", "task not found", "watch not found":
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"watching": watch})
+}
+
+// notifyTaskChanged сравнивает задачу до изменения с сохранённой и пишет события во входящие
+func (h *Handler) notifyTaskChanged(c *gin.Context, before *project.Task) {
+	after, err := h.storage(c).GetTask(before.ProjectID, before.ID)
+	if err != nil || after == nil {
+		return
+	}
+	notifyTaskDiff(h.Inbox.Session(), currentUserID(c), before, after)
+}
+
+// notifyTaskDiff уведомляет о различиях между задачей до и после изменения
+func notifyTaskDiff(inbox *notify.Inbox, actor ident.ID, before, after *project.Task) {
+	inbox.TaskAssigned(actor, after, notify.AddedPeople(before.Assignees(), after.Assignees()))
+	if added := notify.AddedPeople(project.Mentions(before.Description), project.Mentions(after.Description)); len(added) > 0 {
+		inbox.TaskMentioned(actor, after, added, after.Description)
+	}
+	if after.Status != before.Status {
+		inbox.TaskStatusChanged(actor, after, before.Status)
+	}
+}
+
+// currentUserID возвращает id из заголовка X-User-ID или нулевой id, если заголовка нет
+func currentUserID(c *gin.Context) ident.ID {
+	id, err := ident.Parse(c.GetHeader(userIDHeader))
+	if err != nil {
+		return ident.Nil
+	}
+	return id
+}
+
+// requireUser требует заголовок X-User-ID; при ошибке ответ уже отправлен
+func requireUser(c *gin.Context) (ident.ID, bool) {
+	id := currentUserID(c)
+	if id.IsZero() {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "missing or invalid " + userIDHeader + " header"})
+		return ident.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"tmv/ident"
+	"tmv/user"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) UpdateNotificationPrefs(c *gin.Context) {
+	userId, err := ident.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid userId format"})
+		return
+	}
+
+	existingUser, err := h.storage(c).GetUser(userId)
+	if err != nil {
+		logger(c).Error("failed to get user", "error", err)
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var prefs user.NotificationPrefs
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	for _, channel := range prefs.Channels {
+		switch channel {
+		case user.ChannelInApp, user.ChannelEmail, user.ChannelWebhook:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "unknown channel " + channel})
+			return
+		}
+		if channel == user.ChannelWebhook {
+			if u, err := url.Parse(prefs.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "invalid webhookUrl"})
+				return
+			}
+		}
+	}
+
+	existingUser.Notifications = prefs
+	if err := h.storage(c).UpdateUser(userId, &existingUser); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, existingUser.Notifications)
+}
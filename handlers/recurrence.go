@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"tmv/ident"
+	"tmv/project"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) SetTaskRecurrence(c *gin.Context) {
+	projectId, taskId, ok := taskParams(c)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		Rule string `json:"rule" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	if _, err := project.ParseRule(requestBody.Rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	h.updateRecurrence(c, projectId, taskId, requestBody.Rule)
+}
+func (h *Handler) DeleteTaskRecurrence(c *gin.Context) {
+	projectId, taskId, ok := taskParams(c)
+	if !ok {
+		return
+	}
+
+	h.updateRecurrence(c, projectId, taskId, "")
+}
+
+func (h *Handler) updateRecurrence(c *gin.Context, projectId, taskId ident.ID, rule string) {
+	err := h.storage(c).SetTaskRecurrence(projectId, taskId, rule)
+	if err != nil {
+		if err.Error() == "task not found" {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "task recurrence updated successfully"})
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/report"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetProjectBurndown(c *gin.Context) {
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	tasks, err := h.storage(c).GetTasksByProject(projectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	// По умолчанию период — от первой задачи до текущего момента
+	from := time.Now()
+	for _, t := range tasks {
+		if !t.DateCreation.IsZero() && t.DateCreation.Before(from) {
+			from = t.DateCreation
+		}
+	}
+	writeBurndown(c, tasks, from, time.Now())
+}
+func (h *Handler) GetSprintBurndown(c *gin.Context) {
+	projectId, sprintId, ok := sprintParams(c)
+	if !ok {
+		return
+	}
+
+	sprint, err := h.storage(c).GetSprint(projectId, sprintId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if sprint == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "sprint not found"})
+		return
+	}
+
+	// Без даты начала ряд пришлось бы строить от нулевого времени
+	from, to, ok := sprint.Period(time.Now())
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"message": "sprint has no start date"})
+		return
+	}
+
+	tasks, err := h.storage(c).GetTasksBySprint(projectId, sprintId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	writeBurndown(c, tasks, from, to)
+}
+func (h *Handler) GetProjectVelocity(c *gin.Context) {
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	last := 5
+	if v := c.Query("last"); v != "" {
+		last, err = strconv.Atoi(v)
+		if err != nil || last < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid last parameter"})
+			return
+		}
+	}
+
+	sprints, err := h.storage(c).GetSprintsByProject(projectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	tasks, err := h.storage(c).GetTasksByProject(projectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	velocity := report.NewVelocity(sprints, tasks, last)
+	if wantsCSV(c) {
+		writeCSV(c, "velocity.csv", report.VelocityCSV(velocity))
+		return
+	}
+	c.JSON(http.StatusOK, velocity)
+}
+func (h *Handler) GetProjectCycleTime(c *gin.Context) {
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	tasks, err := h.storage(c).GetTasksByProject(projectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	writeCycleTime(c, tasks)
+}
+func (h *Handler) GetSprintCycleTime(c *gin.Context) {
+	projectId, sprintId, ok := sprintParams(c)
+	if !ok {
+		return
+	}
+
+	tasks, err := h.storage(c).GetTasksBySprint(projectId, sprintId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	writeCycleTime(c, tasks)
+}
+func (h *Handler) GetWorkload(c *gin.Context) {
+	// Необязательный фильтр по проекту
+	projectId := ident.Nil
+	if v := c.Query("projectId"); v != "" {
+		id, err := ident.Parse(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+			return
+		}
+		projectId = id
+	}
+
+	// По умолчанию разбивка по неделям на четыре недели вперёд
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	to := from.AddDate(0, 0, 28)
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = parseReportTime(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid from parameter"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = parseReportTime(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid to parameter"})
+			return
+		}
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "to is before from"})
+		return
+	}
+
+	interval := c.DefaultQuery("interval", report.IntervalWeek)
+	if _, ok := report.PeriodFormat(interval); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid interval parameter"})
+		return
+	}
+
+	workloads, err := h.storage(c).GetWorkload(projectId, from, to, interval)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	if wantsCSV(c) {
+		writeCSV(c, "workload.csv", report.WorkloadCSV(workloads))
+		return
+	}
+	c.JSON(http.StatusOK, workloads)
+}
+
+// writeBurndown учитывает параметры from, to (RFC3339 или 2006-01-02) и interval (day или week)
+func writeBurndown(c *gin.Context, tasks []project.Task, from, to time.Time) {
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = parseReportTime(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid from parameter"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = parseReportTime(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid to parameter"})
+			return
+		}
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "to is before from"})
+		return
+	}
+
+	step := 24 * time.Hour
+	switch c.DefaultQuery("interval", "day") {
+	case "day":
+	case "week":
+		step = 7 * 24 * time.Hour
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid interval parameter"})
+		return
+	}
+
+	points := report.Burndown(tasks, from, to, step)
+	if wantsCSV(c) {
+		writeCSV(c, "burndown.csv", report.BurndownCSV(points))
+		return
+	}
+	c.JSON(http.StatusOK, points)
+}
+
+func writeCycleTime(c *gin.Context, tasks []project.Task) {
+	cycleTime := report.NewCycleTime(tasks)
+	if wantsCSV(c) {
+		writeCSV(c, "cycletime.csv", report.CycleTimeCSV(cycleTime))
+		return
+	}
+	c.JSON(http.StatusOK, cycleTime)
+}
+
+func parseReportTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
+
+// wantsCSV: ?format=csv или Accept: text/csv
+func wantsCSV(c *gin.Context) bool {
+	if format := c.Query("format"); format != "" {
+		return format == "csv"
+	}
+	return c.NegotiateFormat(gin.MIMEJSON, "text/csv") == "text/csv"
+}
+
+func writeCSV(c *gin.Context, filename string, rows [][]string) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	if err := w.WriteAll(rows); err != nil {
+		logger(c).Error("failed to write csv", "error", err)
+	}
+}
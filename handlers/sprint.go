@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) CreateSprint(c *gin.Context) {
+	var sprint project.Sprint
+
+	if err := c.BindJSON(&sprint); err != nil {
+		logger(c).Warn("failed to bind sprint", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	projectID, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	if sprint.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "sprint name is required"})
+		return
+	}
+	if !sprint.Start.IsZero() && !sprint.End.IsZero() && sprint.End.Before(sprint.Start) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "sprint end is before start"})
+		return
+	}
+
+	err = h.storage(c).InsertSprint(&sprint, projectID)
+	if err != nil {
+		c.JSON(sprintErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"sprintId":  sprint.Id,
+		"projectId": projectID.Hex(),
+	})
+}
+func (h *Handler) GetSprintsByProject(c *gin.Context) {
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	sprints, err := h.storage(c).GetSprintsByProject(projectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sprints)
+}
+func (h *Handler) GetSprint(c *gin.Context) {
+	projectId, sprintId, ok := sprintParams(c)
+	if !ok {
+		return
+	}
+
+	sprint, err := h.storage(c).GetSprint(projectId, sprintId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	if sprint == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "sprint not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sprint)
+}
+func (h *Handler) UpdateSprint(c *gin.Context) {
+	projectId, sprintId, ok := sprintParams(c)
+	if !ok {
+		return
+	}
+
+	var updateFields map[string]interface{}
+	if err := c.ShouldBindJSON(&updateFields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid sprint format"})
+		return
+	}
+
+	// Статус и итоги меняются только через start/close
+	for _, key := range []string{"_id", "projectId", "status", "startedAt", "closedAt", "carriedOver"} {
+		delete(updateFields, key)
+	}
+
+	// Даты приводятся к time.Time, чтобы сравнить их с сохранёнными и записать датами, а не строками
+	dates := map[string]*time.Time{}
+	for _, key := range []string{"start", "end"} {
+		v, ok := updateFields[key]
+		if !ok {
+			continue
+		}
+		t, ok := sprintDate(v)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid sprint " + key})
+			return
+		}
+		updateFields[key] = t
+		dates[key] = &t
+	}
+	if len(dates) > 0 {
+		current, err := h.storage(c).GetSprint(projectId, sprintId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		if current == nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "sprint not found"})
+			return
+		}
+		start, end := current.Start, current.End
+		if t, ok := dates["start"]; ok {
+			start = *t
+		}
+		if t, ok := dates["end"]; ok {
+			end = *t
+		}
+		if !start.IsZero() && !end.IsZero() && end.Before(start) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "sprint end is before start"})
+			return
+		}
+	}
+
+	err := h.storage(c).UpdateSprint(projectId, sprintId, updateFields)
+	if err != nil {
+		c.JSON(sprintErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "sprint updated successfully"})
+}
+func (h *Handler) DeleteSprint(c *gin.Context) {
+	projectId, sprintId, ok := sprintParams(c)
+	if !ok {
+		return
+	}
+
+	err := h.storage(c).DeleteSprint(projectId, sprintId)
+	if err != nil {
+		c.JSON(sprintErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "sprint deleted successfully"})
+}
+func (h *Handler) StartSprint(c *gin.Context) {
+	projectId, sprintId, ok := sprintParams(c)
+	if !ok {
+		return
+	}
+
+	err := h.storage(c).StartSprint(projectId, sprintId)
+	if err != nil {
+		c.JSON(sprintErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "sprint started"})
+}
+func (h *Handler) CloseSprint(c *gin.Context) {
+	projectId, sprintId, ok := sprintParams(c)
+	if !ok {
+		return
+	}
+
+	// Тело необязательно: без nextSprintId незавершённые задачи уходят в бэклог
+	var requestBody struct {
+		NextSprintID string `json:"nextSprintId"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+			return
+		}
+	}
+
+	nextSprintId := ident.Nil
+	if requestBody.NextSprintID != "" {
+		id, err := ident.Parse(requestBody.NextSprintID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid nextSprintId format"})
+			return
+		}
+		nextSprintId = id
+	}
+
+	carriedOver, err := h.storage(c).CloseSprint(projectId, sprintId, nextSprintId)
+	if err != nil {
+		c.JSON(sprintErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "sprint closed", "carriedOver": carriedOver})
+}
+func (h *Handler) GetSprintTasks(c *gin.Context) {
+	projectId, sprintId, ok := sprintParams(c)
+	if !ok {
+		return
+	}
+
+	tasks, err := h.storage(c).GetTasksBySprint(projectId, sprintId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tasks)
+}
+func (h *Handler) AssignSprintTasks(c *gin.Context) {
+	projectId, sprintId, ok := sprintParams(c)
+	if !ok {
+		return
+	}
+
+	h.setSprintTasks(c, projectId, sprintId)
+}
+func (h *Handler) UnassignSprintTasks(c *gin.Context) {
+	projectId, _, ok := sprintParams(c)
+	if !ok {
+		return
+	}
+
+	h.setSprintTasks(c, projectId, ident.Nil)
+}
+
+func (h *Handler) setSprintTasks(c *gin.Context, projectId, sprintId ident.ID) {
+	var taskIds []string
+	if err := c.ShouldBindJSON(&taskIds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid taskIds format"})
+		return
+	}
+
+	var objectIDs []ident.ID
+	for _, id := range taskIds {
+		objectID, err := ident.Parse(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid taskId format"})
+			return
+		}
+		objectIDs = append(objectIDs, objectID)
+	}
+
+	err := h.storage(c).AssignTasksToSprint(projectId, sprintId, objectIDs)
+	if err != nil {
+		c.JSON(sprintErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "sprint tasks updated successfully"})
+}
+
+// sprintParams разбирает projectId и sprintId; при ошибке ответ уже отправлен
+func sprintParams(c *gin.Context) (ident.ID, ident.ID, bool) {
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return ident.Nil, ident.Nil, false
+	}
+
+	sprintId, err := ident.Parse(c.Param("sprintId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid sprintId format"})
+		return ident.Nil, ident.Nil, false
+	}
+
+	return projectId, sprintId, true
+}
+
+// sprintDate разбирает дату спринта из JSON: RFC 3339 или null/пустая строка для нулевой даты
+func sprintDate(v interface{}) (time.Time, bool) {
+	switch x := v.(type) {
+	case nil:
+		return time.Time{}, true
+	case string:
+		if x == "" {
+			return time.Time{}, true
+		}
+		t, err := time.Parse(time.RFC3339Nano, x)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func sprintErrorStatus(err error) int {
+	if errors.Is(err, storage.ErrInvalidUpdate) {
+		return http.StatusBadRequest
+	}
+	switch err.Error() {
+	case "project not found", "sprint not found", "next sprint not found":
+		return http.StatusNotFound
+	case "sprint is not planned", "sprint is not active", "sprint is closed",
+		"project already has an active sprint", "next sprint must be open":
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
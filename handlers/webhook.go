@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/storage"
+	"tmv/webhook"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	var requestBody struct {
+		URL    string   `json:"url" binding:"required"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	if err := validateWebhook(requestBody.URL, requestBody.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	secret := requestBody.Secret
+	if secret == "" {
+		if secret, err = webhook.NewSecret(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+	}
+
+	w := project.Webhook{
+		URL:    requestBody.URL,
+		Secret: secret,
+		Events: requestBody.Events,
+		Active: true,
+	}
+	if err := h.storage(c).InsertWebhook(&w, projectId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Секрет возвращается только в ответе на создание
+	c.JSON(http.StatusOK, w)
+}
+func (h *Handler) GetWebhooks(c *gin.Context) {
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return
+	}
+
+	webhooks, err := h.storage(c).GetWebhooksByProject(projectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	projectId, webhookId, ok := webhookParams(c)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		URL    *string  `json:"url"`
+		Secret *string  `json:"secret"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	updateFields := bson.M{}
+	if requestBody.URL != nil {
+		if err := validateWebhookURL(*requestBody.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		updateFields["url"] = *requestBody.URL
+	}
+	if requestBody.Events != nil {
+		if err := validateWebhookEvents(requestBody.Events); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		updateFields["events"] = requestBody.Events
+	}
+	if requestBody.Secret != nil {
+		if *requestBody.Secret == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "secret must not be empty"})
+			return
+		}
+		updateFields["secret"] = *requestBody.Secret
+	}
+	if requestBody.Active != nil {
+		updateFields["active"] = *requestBody.Active
+	}
+	if len(updateFields) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "nothing to update"})
+		return
+	}
+
+	err := h.storage(c).UpdateWebhook(projectId, webhookId, updateFields)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "webhook updated successfully"})
+}
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	projectId, webhookId, ok := webhookParams(c)
+	if !ok {
+		return
+	}
+
+	err := h.storage(c).DeleteWebhook(projectId, webhookId)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "webhook deleted successfully"})
+}
+func (h *Handler) GetWebhookDeliveries(c *gin.Context) {
+	projectId, webhookId, ok := webhookParams(c)
+	if !ok {
+		return
+	}
+
+	limit := int64(50)
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid limit"})
+			return
+		}
+		limit = n
+	}
+
+	w, err := h.storage(c).GetWebhook(projectId, webhookId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if w == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "webhook not found"})
+		return
+	}
+
+	deliveries, err := h.storage(c).GetDeliveries(webhookId, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+func (h *Handler) RedeliverWebhook(c *gin.Context) {
+	projectId, webhookId, ok := webhookParams(c)
+	if !ok {
+		return
+	}
+
+	deliveryId, err := ident.Parse(c.Param("deliveryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid deliveryId format"})
+		return
+	}
+
+	delivery, err := h.Webhooks.Redeliver(c.Request.Context(), projectId, webhookId, deliveryId)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveryId": delivery.Id.Hex()})
+}
+
+// webhookParams разбирает projectId и webhookId; при ошибке ответ уже отправлен
+func webhookParams(c *gin.Context) (ident.ID, ident.ID, bool) {
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return ident.Nil, ident.Nil, false
+	}
+
+	webhookId, err := ident.Parse(c.Param("webhookId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid webhookId format"})
+		return ident.Nil, ident.Nil, false
+	}
+	return projectId, webhookId, true
+}
+
+func webhookErrorStatus(err error) int {
+	if errors.Is(err, storage.ErrInvalidUpdate) {
+		return http.StatusBadRequest
+	}
+	switch err.Error() {
+	case "webhook not found", "delivery not found":
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func validateWebhook(rawURL string, events []string) error {
+	if err := validateWebhookURL(rawURL); err != nil {
+		return err
+	}
+	return validateWebhookEvents(events)
+}
+
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook url must be an absolute http(s) url")
+	}
+	return nil
+}
+
+func validateWebhookEvents(events []string) error {
+	if len(events) == 0 {
+		return errors.New("at least one event is required")
+	}
+	for _, e := range events {
+		if !project.ValidWebhookEvent(e) {
+			return errors.New("unknown webhook event " + e)
+		}
+	}
+	return nil
+}
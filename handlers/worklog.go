@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/report"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetWorklogs(c *gin.Context) {
+	projectId, taskId, ok := taskParams(c)
+	if !ok {
+		return
+	}
+
+	worklogs, err := h.storage(c).GetWorklogsByTask(projectId, taskId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, worklogs)
+}
+func (h *Handler) CreateWorklog(c *gin.Context) {
+	projectId, taskId, ok := taskParams(c)
+	if !ok {
+		return
+	}
+
+	// duration — строка вида "1h30m"; started по умолчанию отсчитывается назад от текущего момента
+	var requestBody struct {
+		UserID   string    `json:"userId" binding:"required"`
+		Duration string    `json:"duration" binding:"required"`
+		Started  time.Time `json:"started"`
+		Note     string    `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		logger(c).Warn("failed to bind worklog", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userId, err := ident.Parse(requestBody.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid userId format"})
+		return
+	}
+
+	duration, err := time.ParseDuration(requestBody.Duration)
+	if err != nil || duration <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid duration"})
+		return
+	}
+
+	started := requestBody.Started
+	if started.IsZero() {
+		started = time.Now().Add(-duration)
+	}
+
+	worklog := project.NewWorklog(projectId, taskId, userId, started, duration, requestBody.Note)
+	err = h.storage(c).InsertWorklog(worklog, projectId, taskId)
+	if err != nil {
+		c.JSON(worklogErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, worklog)
+}
+func (h *Handler) DeleteWorklog(c *gin.Context) {
+	projectId, taskId, ok := taskParams(c)
+	if !ok {
+		return
+	}
+
+	worklogId, err := ident.Parse(c.Param("worklogId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid worklogId format"})
+		return
+	}
+
+	err = h.storage(c).DeleteWorklog(projectId, taskId, worklogId)
+	if err != nil {
+		c.JSON(worklogErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "worklog deleted successfully"})
+}
+func (h *Handler) StartTimer(c *gin.Context) {
+	projectId, taskId, ok := taskParams(c)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		UserID string `json:"userId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	userId, err := ident.Parse(requestBody.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid userId format"})
+		return
+	}
+
+	worklog, err := h.storage(c).StartTimer(projectId, taskId, userId)
+	if err != nil {
+		c.JSON(worklogErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, worklog)
+}
+func (h *Handler) StopTimer(c *gin.Context) {
+	projectId, taskId, ok := taskParams(c)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		UserID string `json:"userId" binding:"required"`
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	userId, err := ident.Parse(requestBody.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid userId format"})
+		return
+	}
+
+	worklog, err := h.storage(c).StopTimer(projectId, taskId, userId, requestBody.Note)
+	if err != nil {
+		c.JSON(worklogErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, worklog)
+}
+func (h *Handler) GetTimeReport(c *gin.Context) {
+	// Необязательные фильтры по проекту и пользователю
+	var ids [2]ident.ID
+	for i, name := range []string{"projectId", "userId"} {
+		if v := c.Query(name); v != "" {
+			id, err := ident.Parse(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "invalid " + name + " format"})
+				return
+			}
+			ids[i] = id
+		}
+	}
+
+	// По умолчанию — последние 30 дней
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = parseReportTime(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid from parameter"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = parseReportTime(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "invalid to parameter"})
+			return
+		}
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "to is before from"})
+		return
+	}
+
+	rows, err := h.storage(c).GetTimeReport(ids[0], ids[1], from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	if wantsCSV(c) {
+		writeCSV(c, "time.csv", report.TimeSpentCSV(rows))
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// taskParams разбирает projectId и taskId; при ошибке ответ уже отправлен
+func taskParams(c *gin.Context) (ident.ID, ident.ID, bool) {
+	projectId, err := ident.Parse(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid projectId format"})
+		return ident.Nil, ident.Nil, false
+	}
+
+	taskId, err := ident.Parse(c.Param("taskId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid taskId format"})
+		return ident.Nil, ident.Nil, false
+	}
+
+	return projectId, taskId, true
+}
+
+func worklogErrorStatus(err error) int {
+	switch err.Error() {
+	case "task not found", "worklog not found", "timer not running":
+		return http.StatusNotFound
+	case "timer already running":
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,231 @@
+package health
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check проверяет одну зависимость; ошибка означает, что она недоступна
+type Check func(ctx context.Context) error
+
+type check struct {
+	name     string
+	fn       Check
+	critical bool
+}
+
+// Health отвечает на проверки оркестратора: жив ли процесс, готов ли он принимать запросы,
+// и отдаёт администраторам подробное состояние. Готовность требует, чтобы все шаги запуска
+// были завершены, все критичные проверки проходили и сервер не останавливался.
+type Health struct {
+	Version string
+	Timeout time.Duration // Предел одной проверки
+
+	started time.Time
+
+	mu           sync.RWMutex
+	checks       []check
+	pending      map[string]bool // Незавершённые шаги запуска
+	shuttingDown bool
+}
+
+func New(version string) *Health {
+	return &Health{
+		Version: version,
+		Timeout: 2 * time.Second,
+		started: time.Now(),
+		pending: make(map[string]bool),
+	}
+}
+
+// AddCheck добавляет проверку. Некритичные проверки видны только в /status и не влияют на готовность.
+func (h *Health) AddCheck(name string, fn Check, critical bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, check{name: name, fn: fn, critical: critical})
+}
+
+// Starting отмечает шаг запуска, без которого сервер не готов; Done завершает его
+func (h *Health) Starting(step string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending[step] = true
+}
+
+func (h *Health) Done(step string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.pending, step)
+}
+
+// ShuttingDown переводит готовность в ошибку, чтобы балансировщик перестал слать запросы
+func (h *Health) ShuttingDown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shuttingDown = true
+}
+
+// Result — итог одной проверки
+type Result struct {
+	Name      string  `json:"name"`
+	Critical  bool    `json:"critical"`
+	Status    string  `json:"status"` // ok или fail
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// Run выполняет проверки параллельно; при onlyCritical — только критичные
+func (h *Health) Run(ctx context.Context, onlyCritical bool) []Result {
+	h.mu.RLock()
+	checks := make([]check, 0, len(h.checks))
+	for _, c := range h.checks {
+		if c.critical || !onlyCritical {
+			checks = append(checks, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.fn(ctx)
+			results[i] = Result{
+				Name:      c.name,
+				Critical:  c.critical,
+				Status:    "ok",
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				results[i].Status = "fail"
+				results[i].Error = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+// state возвращает причины неготовности, не считая проверок
+func (h *Health) state() (pending []string, shuttingDown bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	pending = []string{}
+	for step := range h.pending {
+		pending = append(pending, step)
+	}
+	sort.Strings(pending)
+	return pending, h.shuttingDown
+}
+
+// Live — /healthz: процесс жив и обслуживает HTTP, зависимости не проверяются
+func (h *Health) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready — /readyz: 200, если сервер может обслуживать запросы, иначе 503 с причинами
+func (h *Health) Ready(c *gin.Context) {
+	pending, shuttingDown := h.state()
+	var reasons []string
+	if shuttingDown {
+		reasons = append(reasons, "shutting down")
+	}
+	for _, step := range pending {
+		reasons = append(reasons, step+" not finished")
+	}
+	// Во время остановки зависимости уже не важны
+	if !shuttingDown {
+		for _, r := range h.Run(c.Request.Context(), true) {
+			if r.Status != "ok" {
+				reasons = append(reasons, r.Name+": "+r.Error)
+			}
+		}
+	}
+
+	if len(reasons) > 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "fail", "reasons": reasons})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Status — /status: версия, время работы и задержка каждой зависимости
+func (h *Health) Status(c *gin.Context) {
+	pending, shuttingDown := h.state()
+	results := h.Run(c.Request.Context(), false)
+
+	status := "ok"
+	for _, r := range results {
+		if r.Status != "ok" {
+			if r.Critical {
+				status = "fail"
+				break
+			}
+			status = "degraded"
+		}
+	}
+	if len(pending) > 0 || shuttingDown {
+		status = "fail"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":        status,
+		"version":       h.Version,
+		"revision":      revision(),
+		"goVersion":     runtime.Version(),
+		"startedAt":     h.started.UTC(),
+		"uptimeSeconds": int64(time.Since(h.started).Seconds()),
+		"goroutines":    runtime.NumGoroutine(),
+		"startup":       gin.H{"pending": pending},
+		"shuttingDown":  shuttingDown,
+		"checks":        results,
+	})
+}
+
+// RequireToken пропускает запрос только с заголовком Authorization: Bearer token
+func RequireToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "invalid status token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// revision — коммит, из которого собран бинарник, если go build записал его
+func revision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	rev, modified := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if rev != "" && modified {
+		rev += "-dirty"
+	}
+	return rev
+}
@@ -0,0 +1,163 @@
+// Package ident — идентификатор сущностей, не зависящий от хранилища.
+// Формат совпадает с ObjectID MongoDB (12 байт: время, случайная часть, счётчик),
+// поэтому уже сохранённые данные читаются без миграции.
+package ident
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// ID — идентификатор пользователя, проекта, задачи и остальных сущностей
+type ID [12]byte
+
+// Nil — нулевой идентификатор: сущность не задана
+var Nil ID
+
+// ErrInvalid — строка не является идентификатором
+var ErrInvalid = errors.New("the provided hex string is not a valid ID")
+
+var (
+	processUnique = processUniqueBytes()
+	counter       = readRandomUint32()
+)
+
+// New создаёт новый идентификатор; идентификаторы одного процесса возрастают со временем
+func New() ID {
+	return NewAt(time.Now())
+}
+
+// NewAt создаёт идентификатор с меткой времени t
+func NewAt(t time.Time) ID {
+	var id ID
+	binary.BigEndian.PutUint32(id[0:4], uint32(t.Unix()))
+	copy(id[4:9], processUnique[:])
+	n := atomic.AddUint32(&counter, 1)
+	id[9], id[10], id[11] = byte(n>>16), byte(n>>8), byte(n)
+	return id
+}
+
+// Parse разбирает идентификатор из 24 шестнадцатеричных символов
+func Parse(s string) (ID, error) {
+	var id ID
+	if len(s) != 2*len(id) {
+		return Nil, ErrInvalid
+	}
+	if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+		return Nil, ErrInvalid
+	}
+	return id, nil
+}
+
+// Timestamp возвращает время создания идентификатора
+func (id ID) Timestamp() time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint32(id[0:4])), 0).UTC()
+}
+
+func (id ID) Hex() string {
+	return hex.EncodeToString(id[:])
+}
+func (id ID) String() string {
+	return id.Hex()
+}
+func (id ID) IsZero() bool {
+	return id == Nil
+}
+
+// MarshalText и UnmarshalText позволяют использовать ID как ключ словаря в JSON
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(id.Hex()), nil
+}
+func (id *ID) UnmarshalText(b []byte) error {
+	parsed, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(id.Hex())
+}
+
+// UnmarshalJSON принимает строку из 24 шестнадцатеричных символов или {"$oid": "..."};
+// пустая строка — нулевой идентификатор, null оставляет значение без изменений
+func (id *ID) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var ext struct {
+			Oid *string `json:"$oid"`
+		}
+		if json.Unmarshal(b, &ext) != nil || ext.Oid == nil {
+			return fmt.Errorf("cannot unmarshal %s into an ID", b)
+		}
+		s = *ext.Oid
+	}
+	if s == "" {
+		*id = Nil
+		return nil
+	}
+	return id.UnmarshalText([]byte(s))
+}
+
+// MarshalBSONValue сохраняет ID как ObjectID, поэтому запросы и индексы MongoDB работают как раньше
+func (id ID) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bsontype.ObjectID, append([]byte(nil), id[:]...), nil
+}
+
+// UnmarshalBSONValue читает ObjectID, а также null и строку с шестнадцатеричной записью
+func (id *ID) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.ObjectID:
+		if len(data) != len(id) {
+			return fmt.Errorf("invalid ObjectID length %d", len(data))
+		}
+		copy(id[:], data)
+		return nil
+	case bsontype.Null, bsontype.Undefined:
+		*id = Nil
+		return nil
+	case bsontype.String:
+		// Строка BSON: длина (4 байта), символы и завершающий ноль
+		if len(data) < 5 {
+			return fmt.Errorf("invalid string length %d", len(data))
+		}
+		s := string(data[4 : len(data)-1])
+		if s == "" {
+			*id = Nil
+			return nil
+		}
+		return id.UnmarshalText([]byte(s))
+	}
+	return fmt.Errorf("cannot decode %v into an ID", t)
+}
+
+func processUniqueBytes() [5]byte {
+	var b [5]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		panic(fmt.Errorf("ident: cannot initialize process unique bytes: %w", err))
+	}
+	return b
+}
+
+func readRandomUint32() uint32 {
+	var b [4]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		panic(fmt.Errorf("ident: cannot initialize counter: %w", err))
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
@@ -0,0 +1,179 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level — уровень важности записи, значения совпадают с log/slog
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l >= LevelError:
+		return "ERROR"
+	case l >= LevelWarn:
+		return "WARN"
+	case l >= LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// ParseLevel разбирает debug, info, warn или error без учёта регистра
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// Logger пишет записи одной JSON-строкой: time, level, msg и поля в порядке добавления.
+// Поля передаются парами ключ-значение, как в log/slog.
+type Logger struct {
+	out    *output
+	level  Level
+	fields []byte // Уже закодированные поля из With, каждое с ведущей запятой
+}
+
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w}, level: level}
+}
+
+var defaultLogger = New(os.Stderr, LevelInfo)
+
+// Default возвращает журнал процесса
+func Default() *Logger {
+	return defaultLogger
+}
+
+// SetDefault заменяет журнал процесса; вызывать при запуске, до начала работы
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+// With возвращает журнал, который добавляет поля args к каждой записи
+func (l *Logger) With(args ...interface{}) *Logger {
+	child := *l
+	child.fields = appendFields(append([]byte(nil), l.fields...), args)
+	return &child
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, args ...interface{}) { l.Log(LevelDebug, msg, args...) }
+func (l *Logger) Info(msg string, args ...interface{})  { l.Log(LevelInfo, msg, args...) }
+func (l *Logger) Warn(msg string, args ...interface{})  { l.Log(LevelWarn, msg, args...) }
+func (l *Logger) Error(msg string, args ...interface{}) { l.Log(LevelError, msg, args...) }
+
+func (l *Logger) Log(level Level, msg string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	buf := make([]byte, 0, 256)
+	buf = append(buf, `{"time":`...)
+	buf = appendValue(buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf = append(buf, `,"level":`...)
+	buf = appendValue(buf, level.String())
+	buf = append(buf, `,"msg":`...)
+	buf = appendValue(buf, msg)
+	buf = append(buf, l.fields...)
+	buf = appendFields(buf, args)
+	buf = append(buf, "}\n"...)
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(buf)
+}
+
+// Writer возвращает io.Writer, который пишет каждую строку записью уровня level.
+// Нужен, чтобы направить в журнал стандартный log и библиотеки, которые пишут текст.
+func (l *Logger) Writer(level Level) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		l.Log(level, string(bytes.TrimRight(p, "\n")))
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func appendFields(buf []byte, args []interface{}) []byte {
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok || i+1 == len(args) {
+			// Значение без ключа, как и в log/slog
+			buf = append(buf, `,"!BADKEY":`...)
+			buf = appendValue(buf, args[i])
+			i--
+			continue
+		}
+		buf = append(buf, ',')
+		buf = appendValue(buf, key)
+		buf = append(buf, ':')
+		buf = appendValue(buf, args[i+1])
+	}
+	return buf
+}
+
+func appendValue(buf []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case error:
+		return appendValue(buf, v.Error())
+	case time.Duration:
+		return appendValue(buf, v.String())
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return append(buf, b...)
+}
+
+type contextKey struct{}
+
+// NewContext возвращает контекст, в котором FromContext вернёт l
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext возвращает журнал запроса из ctx или журнал процесса
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return Default()
+}
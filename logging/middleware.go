@@ -0,0 +1,158 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderRequestID — заголовок с id запроса во входящем запросе и в ответе
+const HeaderRequestID = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// Middleware присваивает запросу id (из X-Request-ID клиента или новый), кладёт в контекст
+// запроса журнал с полями request_id и trace_id и пишет строку журнала на каждый ответ.
+// В JSON-ответы с ошибкой (статус 400 и выше) добавляется поле requestId.
+// Ставится после otelgin, чтобы trace_id был уже известен. Успешные запросы к quietRoutes
+// (например, проверки оркестратора) пишутся на уровне debug.
+func Middleware(base *Logger, quietRoutes ...string) gin.HandlerFunc {
+	quiet := make(map[string]bool, len(quietRoutes))
+	for _, route := range quietRoutes {
+		quiet[route] = true
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(HeaderRequestID, id)
+
+		logger := base.With("request_id", id)
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		ctx := context.WithValue(c.Request.Context(), requestIDKey{}, id)
+		c.Request = c.Request.WithContext(NewContext(ctx, logger))
+		c.Writer = &errorBodyWriter{ResponseWriter: c.Writer, requestId: id}
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		level := LevelInfo
+		switch {
+		case quiet[route] && status < 400:
+			level = LevelDebug
+		case status >= 500:
+			level = LevelError
+		case status >= 400:
+			level = LevelWarn
+		}
+		args := []interface{}{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", route,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"bytes", c.Writer.Size(),
+			"client_ip", c.ClientIP(),
+		}
+		if errs := c.Errors.ByType(gin.ErrorTypeAny); len(errs) > 0 {
+			args = append(args, "errors", errs.String())
+		}
+		logger.Log(level, "request", args...)
+	}
+}
+
+// Recovery перехватывает панику обработчика, пишет её со стеком в журнал запроса и отвечает 500.
+// Ставится после Middleware, чтобы в записи был request_id.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+			FromContext(c.Request.Context()).Error("panic recovered", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "internal server error"})
+		}()
+		c.Next()
+	}
+}
+
+// RequestID возвращает id запроса, присвоенный Middleware, или пустую строку
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID принимает id клиента, только если он короткий и безопасен для журнала и заголовков
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// errorBodyWriter добавляет requestId в JSON-объект ответа с ошибкой.
+// c.JSON пишет тело одним вызовом Write, поэтому поле вставляется сразу после «{».
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	requestId string
+}
+
+func (w *errorBodyWriter) Write(data []byte) (int, error) {
+	if w.Status() < 400 || w.Written() || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") ||
+		len(data) < 2 || data[0] != '{' {
+		return w.ResponseWriter.Write(data)
+	}
+
+	field, _ := json.Marshal(w.requestId)
+	body := make([]byte, 0, len(data)+len(field)+16)
+	body = append(body, `{"requestId":`...)
+	body = append(body, field...)
+	if !bytes.Equal(bytes.TrimSpace(data[1:]), []byte("}")) {
+		body = append(body, ',')
+	}
+	body = append(body, data[1:]...)
+
+	if _, err := w.ResponseWriter.Write(body); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
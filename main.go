@@ -2,32 +2,209 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	"tmv/cache"
+	"tmv/config"
+	"tmv/event"
 	"tmv/handlers"
+	"tmv/health"
+	"tmv/logging"
+	"tmv/metrics"
+	"tmv/migrations"
+	"tmv/notify"
+	"tmv/scheduler"
 	"tmv/storage"
+	"tmv/tracing"
+	"tmv/user"
+	"tmv/watcher"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
+// Версия сервера для /status; задаётся при сборке: go build -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
 func main() {
-	mongoStorage, err := storage.NewMongoStorage("mongodb://localhost:27017", "tmv", "users", "projects", "tasks")
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	// Настройки: файл из -config или TMV_CONFIG, переменные TMV_*, флаги; tmv -help перечисляет все
+	cfg, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Журнал в JSON; стандартный log остаётся только для фатальных ошибок запуска и тоже пишет в JSON
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logger := logging.New(os.Stdout, level)
+	logging.SetDefault(logger)
+	log.SetFlags(0)
+	log.SetOutput(logger.Writer(logging.LevelError))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer func() {
-		if err = mongoStorage.Client.Disconnect(context.TODO()); err != nil {
-			panic(err)
+
+	// Хранилище: MongoDB или, где её нет, PostgreSQL либо SQLite; схема SQL обновляется при открытии
+	var (
+		baseStorage  storage.Storage
+		mongoStorage *storage.MongoStorage
+		ping         func(ctx context.Context) error
+	)
+	switch cfg.Storage {
+	case "postgres", "sqlite":
+		var sqlStorage *storage.SQLStorage
+		if cfg.Storage == "postgres" {
+			sqlStorage, err = storage.NewPostgresStorage(cfg.Postgres)
+		} else {
+			sqlStorage, err = storage.NewSQLiteStorage(cfg.SQLite)
 		}
-	}()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer sqlStorage.Close()
+		baseStorage, ping = sqlStorage, sqlStorage.DB.PingContext
+	default:
+		mongoStorage, err = storage.NewMongoStorage(cfg.Mongo)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			if err = mongoStorage.Client.Disconnect(context.TODO()); err != nil {
+				panic(err)
+			}
+		}()
+		baseStorage = mongoStorage
+		ping = func(ctx context.Context) error { return mongoStorage.Client.Ping(ctx, nil) }
+	}
+
+	// Вместо текстового журнала gin.Default — JSON-строка на запрос с request_id и trace_id
+	gin.DefaultWriter = logger.Writer(logging.LevelDebug)
+	router := gin.New()
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName))
+	router.Use(logging.Middleware(logger, "/healthz", "/readyz"), logging.Recovery())
+	if len(cfg.Server.CORS.AllowedOrigins) > 0 {
+		router.Use(handlers.CORS(cfg.Server.CORS))
+	}
 
-	router := gin.Default()
+	// Проверки для оркестратора: /healthz — процесс жив, /readyz — хранилище доступно и сервер не останавливается
+	probes := health.New(version)
+	probes.AddCheck(cfg.Storage, ping, true)
+	if cfg.SMTP.Addr != "" {
+		probes.AddCheck("smtp", func(ctx context.Context) error {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", cfg.SMTP.Addr)
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}, false)
+	}
+	if mongoStorage != nil {
+		// Индексы строятся в фоне: на больших коллекциях это долго, а до конца /readyz отвечает 503.
+		// Ошибка (например, повторяющиеся email) не останавливает сервер; расхождения видны в /status
+		// и в tmv indexes verify.
+		if cfg.Mongo.EnsureIndexes {
+			probes.Starting("indexes")
+			go func() {
+				defer probes.Done("indexes")
+				if err := mongoStorage.EnsureIndexes(context.Background()); err != nil {
+					logger.Error("ensure indexes", "error", err)
+					return
+				}
+				logger.Info("indexes ready")
+			}()
+		}
+		// Лишние индексы, созданные вручную, проверку не портят
+		probes.AddCheck("indexes", func(ctx context.Context) error {
+			mismatches, err := mongoStorage.VerifyIndexes(ctx)
+			if err != nil {
+				return err
+			}
+			var problems []string
+			for _, m := range mismatches {
+				if m.Problem != storage.IndexUndeclared {
+					problems = append(problems, m.String())
+				}
+			}
+			if len(problems) > 0 {
+				return errors.New(strings.Join(problems, "; "))
+			}
+			return nil
+		}, false)
+		// Миграции запускаются отдельно (tmv migrate up); неприменённые видны в /status
+		migrator := migrations.NewMigrator(mongoStorage, io.Discard)
+		probes.AddCheck("migrations", func(ctx context.Context) error {
+			pending, err := migrator.Pending(ctx)
+			if err == nil && len(pending) > 0 {
+				err = fmt.Errorf("%d pending, run tmv migrate up", len(pending))
+			}
+			return err
+		}, false)
+	}
+	router.GET("/healthz", probes.Live)
+	router.GET("/readyz", probes.Ready)
+	// /status раскрывает версии, конфигурацию проверок и состояние хранилища, поэтому без токена
+	// маршрута нет вовсе
+	if cfg.Server.StatusToken != "" {
+		router.GET("/status", health.RequireToken(cfg.Server.StatusToken), probes.Status)
+	}
 
-	handlerMongo := handlers.NewHandler(mongoStorage)
+	chain := baseStorage
+
+	// Метрики запросов и обращений к базе; бизнес-показатели пересчитываются не чаще раза в totals_max_age
+	var serverMetrics *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		serverMetrics = metrics.New()
+		router.Use(serverMetrics.Middleware())
+		instrumentedStorage := serverMetrics.InstrumentStorage(chain)
+		serverMetrics.RegisterTotals(instrumentedStorage.GetTotals, cfg.Metrics.TotalsMaxAge)
+		chain = instrumentedStorage
+	}
+
+	// Чтение пользователя, проекта и задачи кэшируется; изменения других экземпляров сбрасывает watcher или TTL
+	var cachedStorage *storage.CachedStorage
+	if cfg.Cache.Enabled {
+		cachedStorage = storage.NewCachedStorage(chain, cache.NewLRU(cfg.Cache.Size, cfg.Cache.TTL))
+		chain = cachedStorage
+	}
+
+	// Изменения пользователей, проектов и задач публикуются в шину событий через outbox
+	bus := event.NewBus()
+	eventStorage := storage.NewEventStorage(chain, bus)
+
+	// Каждый вызов хранилища из обработчиков — дочерний span запроса
+	handlerMongo := handlers.NewHandler(tracing.NewTracedStorage(eventStorage))
+	handlerMongo.Cache = cachedStorage
+	handlerMongo.StreamOrigins = cfg.Server.CORS.AllowedOrigins
+	if cfg.Features.Webhooks {
+		bus.SubscribeAsync("webhooks", "*", handlerMongo.Webhooks.HandleEvent)
+	} else {
+		// Подписки удалённых проектов иначе ждали бы доставки, которой не будет
+		bus.SubscribeAsync("webhooks", event.ProjectDeleted, handlerMongo.Webhooks.DropDeleted)
+	}
 
 	router.POST("/user", handlerMongo.CreateUser)
 	router.GET("/user/:userId", handlerMongo.GetUser)
@@ -52,10 +229,133 @@ func main() {
 	router.DELETE("/task/:projectId/:taskId", handlerMongo.DeleteTask)
 	router.DELETE("/tasks/:projectId", handlerMongo.DeleteTasks)
 	router.PUT("/projects/:projectId/task/:taskId", handlerMongo.UpdateTask)
+	router.POST("/tasks/:projectId/bulk", handlerMongo.CreateTasks)
+	router.PATCH("/tasks/:projectId/bulk", handlerMongo.UpdateTasks)
+
+	// gin не допускает разные имена wildcard на одной позиции: :userId здесь — id проекта
+	router.GET("/project/:userId/board", handlerMongo.GetBoard)
+	router.GET("/project/:userId/events", handlerMongo.ProjectEvents)
+	router.GET("/project/:userId/events/ws", handlerMongo.ProjectEventsWS)
+	router.PATCH("/projects/:projectId/task/:taskId/move", handlerMongo.MoveTask)
+
+	router.POST("/sprint/:projectId", handlerMongo.CreateSprint)
+	router.GET("/sprints/:projectId", handlerMongo.GetSprintsByProject)
+	router.GET("/sprint/:projectId/:sprintId", handlerMongo.GetSprint)
+	router.PATCH("/sprint/:projectId/:sprintId", handlerMongo.UpdateSprint)
+	router.DELETE("/sprint/:projectId/:sprintId", handlerMongo.DeleteSprint)
+	router.POST("/sprint/:projectId/:sprintId/start", handlerMongo.StartSprint)
+	router.POST("/sprint/:projectId/:sprintId/close", handlerMongo.CloseSprint)
+	router.GET("/sprint/:projectId/:sprintId/tasks", handlerMongo.GetSprintTasks)
+	router.PUT("/sprint/:projectId/:sprintId/tasks", handlerMongo.AssignSprintTasks)
+	router.DELETE("/sprint/:projectId/:sprintId/tasks", handlerMongo.UnassignSprintTasks)
+
+	router.GET("/reports/project/:projectId/burndown", handlerMongo.GetProjectBurndown)
+	router.GET("/reports/project/:projectId/velocity", handlerMongo.GetProjectVelocity)
+	router.GET("/reports/project/:projectId/cycletime", handlerMongo.GetProjectCycleTime)
+	router.GET("/reports/sprint/:projectId/:sprintId/burndown", handlerMongo.GetSprintBurndown)
+	router.GET("/reports/sprint/:projectId/:sprintId/cycletime", handlerMongo.GetSprintCycleTime)
+	router.GET("/reports/workload", handlerMongo.GetWorkload)
+	router.GET("/reports/time", handlerMongo.GetTimeReport)
+
+	router.GET("/task/:projectId/:taskId/worklogs", handlerMongo.GetWorklogs)
+	router.POST("/task/:projectId/:taskId/worklogs", handlerMongo.CreateWorklog)
+	router.DELETE("/task/:projectId/:taskId/worklogs/:worklogId", handlerMongo.DeleteWorklog)
+	router.POST("/task/:projectId/:taskId/timer/start", handlerMongo.StartTimer)
+	router.POST("/task/:projectId/:taskId/timer/stop", handlerMongo.StopTimer)
+
+	router.PUT("/task/:projectId/:taskId/recurrence", handlerMongo.SetTaskRecurrence)
+	router.DELETE("/task/:projectId/:taskId/recurrence", handlerMongo.DeleteTaskRecurrence)
+
+	router.PUT("/user/:userId/notifications", handlerMongo.UpdateNotificationPrefs)
+
+	router.GET("/me/notifications", handlerMongo.GetMyNotifications)
+	router.POST("/me/notifications/:notificationId/read", handlerMongo.MarkNotificationRead)
+	router.POST("/me/notifications/read-all", handlerMongo.MarkAllNotificationsRead)
+	router.POST("/watch/project/:projectId", handlerMongo.WatchProject)
+	router.DELETE("/watch/project/:projectId", handlerMongo.UnwatchProject)
+	router.POST("/watch/task/:projectId/:taskId", handlerMongo.WatchTask)
+	router.DELETE("/watch/task/:projectId/:taskId", handlerMongo.UnwatchTask)
+	router.GET("/task/:projectId/:taskId/comments", handlerMongo.GetComments)
+	router.POST("/task/:projectId/:taskId/comments", handlerMongo.CreateComment)
+
+	router.POST("/webhooks/:projectId", handlerMongo.CreateWebhook)
+	router.GET("/webhooks/:projectId", handlerMongo.GetWebhooks)
+	router.PATCH("/webhooks/:projectId/:webhookId", handlerMongo.UpdateWebhook)
+	router.DELETE("/webhooks/:projectId/:webhookId", handlerMongo.DeleteWebhook)
+	router.GET("/webhooks/:projectId/:webhookId/deliveries", handlerMongo.GetWebhookDeliveries)
+	router.POST("/webhooks/:projectId/:webhookId/deliveries/:deliveryId/redeliver", handlerMongo.RedeliverWebhook)
+
+	router.GET("/cache/stats", handlerMongo.GetCacheStats)
+	if serverMetrics != nil {
+		router.GET("/metrics", gin.WrapH(serverMetrics.Handler()))
+	}
+	// Подзапросы проходят через router целиком, со всеми middleware
+	router.POST("/batch", handlers.Batch(router))
 
 	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: router,
+		Addr:         cfg.Server.Addr,
+		Handler:      router,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+	// Потоки событий держат соединение открытым, без этого Shutdown ждал бы их до тайм-аута
+	srv.RegisterOnShutdown(handlerMongo.Realtime.Close)
+
+	// Фоновые задачи останавливаются вместе с сервером
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Поток событий проекта: при features.change_streams — изменения всех экземпляров через change streams,
+	// иначе (или без replica set) — только записи этого экземпляра
+	streamFromMongo := false
+	if cfg.Features.ChangeStreams {
+		changes := watcher.New(mongoStorage, cfg.Instance)
+		changes.PreImages = cfg.Features.ChangeStreamPreImages
+		if cachedStorage != nil {
+			changes.OnChange(func(ch *watcher.Change) {
+				cachedStorage.Invalidate(ch.Kind, ch.ID)
+				if ch.Kind == watcher.KindTask && !ch.ProjectID.IsZero() {
+					// Вставка и удаление задачи меняют список tasks проекта
+					cachedStorage.Invalidate(watcher.KindProject, ch.ProjectID)
+				}
+			})
+		}
+		changes.OnChange(func(ch *watcher.Change) {
+			e, err := ch.Event()
+			if err != nil {
+				logger.Error("watcher: change to event", "error", err)
+				return
+			}
+			handlerMongo.Realtime.HandleEvent(e)
+		})
+		if err := changes.Start(bgCtx); err != nil {
+			logger.Warn("change streams disabled", "error", err)
+		} else {
+			streamFromMongo = true
+		}
+	}
+	if !streamFromMongo {
+		bus.Subscribe("*", handlerMongo.Realtime.HandleEvent)
+	}
+
+	if cfg.Features.Recurrence {
+		go scheduler.NewRecurrence(eventStorage, time.Minute).Run(bgCtx)
+	}
+
+	// Напоминания о сроках: во входящие, по webhook и, если задан smtp.addr, по почте
+	if cfg.Features.Reminders {
+		dispatcher := notify.NewDispatcher()
+		dispatcher.Register(user.ChannelInApp, notify.NewInApp(eventStorage))
+		dispatcher.Register(user.ChannelWebhook, notify.NewWebhook())
+		if cfg.SMTP.Addr != "" {
+			dispatcher.Register(user.ChannelEmail, notify.NewSMTP(cfg.SMTP.Addr, cfg.SMTP.From, cfg.SMTP.Username, cfg.SMTP.Password))
+		}
+		go scheduler.NewReminders(eventStorage, dispatcher, []time.Duration{24 * time.Hour, time.Hour}, 5*time.Minute).Run(bgCtx)
+	}
+	go eventStorage.Relay.Run(bgCtx)
+	if cfg.Features.Webhooks {
+		go handlerMongo.Webhooks.Run(bgCtx)
 	}
 
 	// Канал для получения сигналов завершения
@@ -64,23 +364,38 @@ func main() {
 
 	// Запуск сервера в горутине
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.Server.TLSCertFile != "" {
+			err = srv.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("ListenAndServe(): %s", err)
 		}
 	}()
-	log.Println("Server is running on port 8080")
+	logger.Info("server is running", "addr", srv.Addr, "tls", cfg.Server.TLSCertFile != "")
 
 	// Блокируемся до получения сигнала завершения
 	<-quit
-	log.Println("Shutting down server...")
+	logger.Info("shutting down server")
+	// /readyz уже отвечает 503; пока идёт задержка, балансировщик успевает убрать экземпляр
+	probes.ShuttingDown()
+	if cfg.Server.ShutdownDelay > 0 {
+		time.Sleep(cfg.Server.ShutdownDelay)
+	}
+	stopBackground()
 
 	// Создаем контекст с тайм-аутом для завершения активных запросов
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 	// Останавливаем сервер
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %s", err)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("tracing shutdown", "error", err)
+	}
 
-	log.Println("Server exiting")
+	logger.Info("server exiting")
 }
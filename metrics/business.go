@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+	"tmv/logging"
+	"tmv/report"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	openTasksDesc = prometheus.NewDesc(namespace+"_open_tasks", "Tasks not in a terminal status.", nil, nil)
+	overdueDesc   = prometheus.NewDesc(namespace+"_overdue_tasks", "Open tasks past their deadline.", nil, nil)
+	projectsDesc  = prometheus.NewDesc(namespace+"_projects", "Projects by status.", []string{"status"}, nil)
+)
+
+// totalsCollector считает бизнес-показатели при сборе метрик. Результат запоминается
+// на maxAge, чтобы частые опросы Prometheus не нагружали базу.
+type totalsCollector struct {
+	source func(now time.Time) (*report.Totals, error)
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	totals  *report.Totals
+	fetched time.Time
+}
+
+// RegisterTotals добавляет показатели открытых и просроченных задач и проектов по статусам
+func (m *Metrics) RegisterTotals(source func(now time.Time) (*report.Totals, error), maxAge time.Duration) {
+	m.Registry.MustRegister(&totalsCollector{source: source, maxAge: maxAge})
+}
+
+func (c *totalsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- openTasksDesc
+	ch <- overdueDesc
+	ch <- projectsDesc
+}
+
+func (c *totalsCollector) Collect(ch chan<- prometheus.Metric) {
+	totals := c.current()
+	if totals == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(openTasksDesc, prometheus.GaugeValue, float64(totals.OpenTasks))
+	ch <- prometheus.MustNewConstMetric(overdueDesc, prometheus.GaugeValue, float64(totals.OverdueTasks))
+	for status, n := range totals.ProjectsByStatus {
+		ch <- prometheus.MustNewConstMetric(projectsDesc, prometheus.GaugeValue, float64(n), status)
+	}
+}
+
+func (c *totalsCollector) current() *report.Totals {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.totals != nil && now.Sub(c.fetched) < c.maxAge {
+		return c.totals
+	}
+	totals, err := c.source(now)
+	if err != nil {
+		// Отдаём прошлое значение, если оно есть: пропуск серии хуже устаревшей на минуту
+		logging.Default().Error("metrics: totals", "error", err)
+		return c.totals
+	}
+	c.totals, c.fetched = totals, now
+	return totals
+}
@@ -0,0 +1,455 @@
+package metrics
+
+import (
+	"context"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/report"
+	"tmv/storage"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// InstrumentedStorage — декоратор Storage, который измеряет длительность и ошибки каждого метода.
+// Оборачивает основное хранилище, поэтому показывает время обращений к базе без учёта кэша.
+type InstrumentedStorage struct {
+	storage.Storage
+	metrics *Metrics
+}
+
+func (m *Metrics) InstrumentStorage(inner storage.Storage) *InstrumentedStorage {
+	return &InstrumentedStorage{Storage: inner, metrics: m}
+}
+
+func (i *InstrumentedStorage) WithContext(ctx context.Context) storage.Storage {
+	return &InstrumentedStorage{Storage: storage.WithContext(i.Storage, ctx), metrics: i.metrics}
+}
+
+func (i *InstrumentedStorage) GetAllUsers() map[ident.ID]user.User {
+	start := time.Now()
+	res := i.Storage.GetAllUsers()
+	i.metrics.observeStorage("GetAllUsers", start, nil)
+	return res
+}
+func (i *InstrumentedStorage) GetUser(userId ident.ID) (user.User, error) {
+	start := time.Now()
+	res, err := i.Storage.GetUser(userId)
+	i.metrics.observeStorage("GetUser", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) InsertUser(u *user.User) error {
+	start := time.Now()
+	err := i.Storage.InsertUser(u)
+	i.metrics.observeStorage("InsertUser", start, err)
+	return err
+}
+func (i *InstrumentedStorage) UpdateUser(userId ident.ID, e *user.User) error {
+	start := time.Now()
+	err := i.Storage.UpdateUser(userId, e)
+	i.metrics.observeStorage("UpdateUser", start, err)
+	return err
+}
+func (i *InstrumentedStorage) DeleteUser(userId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.DeleteUser(userId)
+	i.metrics.observeStorage("DeleteUser", start, err)
+	return err
+}
+
+func (i *InstrumentedStorage) GetAllProjects() map[ident.ID]project.Project {
+	start := time.Now()
+	res := i.Storage.GetAllProjects()
+	i.metrics.observeStorage("GetAllProjects", start, nil)
+	return res
+}
+func (i *InstrumentedStorage) GetProject(userId, projectId ident.ID) (*project.Project, error) {
+	start := time.Now()
+	res, err := i.Storage.GetProject(userId, projectId)
+	i.metrics.observeStorage("GetProject", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) GetProjectByUser(userId ident.ID) ([]project.Project, error) {
+	start := time.Now()
+	res, err := i.Storage.GetProjectByUser(userId)
+	i.metrics.observeStorage("GetProjectByUser", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) InsertProject(p *project.Project, userId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.InsertProject(p, userId)
+	i.metrics.observeStorage("InsertProject", start, err)
+	return err
+}
+func (i *InstrumentedStorage) UpdateProject(projectID ident.ID, updateFields bson.M) error {
+	start := time.Now()
+	err := i.Storage.UpdateProject(projectID, updateFields)
+	i.metrics.observeStorage("UpdateProject", start, err)
+	return err
+}
+func (i *InstrumentedStorage) DeleteProject(projectId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.DeleteProject(projectId)
+	i.metrics.observeStorage("DeleteProject", start, err)
+	return err
+}
+func (i *InstrumentedStorage) DeleteProjects(userID ident.ID, projectIDs []ident.ID) error {
+	start := time.Now()
+	err := i.Storage.DeleteProjects(userID, projectIDs)
+	i.metrics.observeStorage("DeleteProjects", start, err)
+	return err
+}
+
+func (i *InstrumentedStorage) GetAllTasks() map[ident.ID]project.Task {
+	start := time.Now()
+	res := i.Storage.GetAllTasks()
+	i.metrics.observeStorage("GetAllTasks", start, nil)
+	return res
+}
+func (i *InstrumentedStorage) InsertTask(t *project.Task, projectId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.InsertTask(t, projectId)
+	i.metrics.observeStorage("InsertTask", start, err)
+	return err
+}
+func (i *InstrumentedStorage) GetTasksByProject(projectId ident.ID) ([]project.Task, error) {
+	start := time.Now()
+	res, err := i.Storage.GetTasksByProject(projectId)
+	i.metrics.observeStorage("GetTasksByProject", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) GetTask(projectId, taskId ident.ID) (*project.Task, error) {
+	start := time.Now()
+	res, err := i.Storage.GetTask(projectId, taskId)
+	i.metrics.observeStorage("GetTask", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) DeleteTasks(projectId ident.ID, taskIds []ident.ID) error {
+	start := time.Now()
+	err := i.Storage.DeleteTasks(projectId, taskIds)
+	i.metrics.observeStorage("DeleteTasks", start, err)
+	return err
+}
+func (i *InstrumentedStorage) UpdateTask(projectId, taskId ident.ID, updateFields bson.M) error {
+	start := time.Now()
+	err := i.Storage.UpdateTask(projectId, taskId, updateFields)
+	i.metrics.observeStorage("UpdateTask", start, err)
+	return err
+}
+func (i *InstrumentedStorage) InsertTasks(tasks []*project.Task, projectId ident.ID) ([]error, error) {
+	start := time.Now()
+	res, err := i.Storage.InsertTasks(tasks, projectId)
+	i.metrics.observeStorage("InsertTasks", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) UpdateTasks(projectId ident.ID, updates []storage.TaskUpdate) ([]error, error) {
+	start := time.Now()
+	res, err := i.Storage.UpdateTasks(projectId, updates)
+	i.metrics.observeStorage("UpdateTasks", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) DeleteTask(projectId, taskId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.DeleteTask(projectId, taskId)
+	i.metrics.observeStorage("DeleteTask", start, err)
+	return err
+}
+func (i *InstrumentedStorage) MoveTask(projectId, taskId ident.ID, status string, position int) error {
+	start := time.Now()
+	err := i.Storage.MoveTask(projectId, taskId, status, position)
+	i.metrics.observeStorage("MoveTask", start, err)
+	return err
+}
+
+func (i *InstrumentedStorage) GetSprintsByProject(projectId ident.ID) ([]project.Sprint, error) {
+	start := time.Now()
+	res, err := i.Storage.GetSprintsByProject(projectId)
+	i.metrics.observeStorage("GetSprintsByProject", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) GetSprint(projectId, sprintId ident.ID) (*project.Sprint, error) {
+	start := time.Now()
+	res, err := i.Storage.GetSprint(projectId, sprintId)
+	i.metrics.observeStorage("GetSprint", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) InsertSprint(s *project.Sprint, projectId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.InsertSprint(s, projectId)
+	i.metrics.observeStorage("InsertSprint", start, err)
+	return err
+}
+func (i *InstrumentedStorage) UpdateSprint(projectId, sprintId ident.ID, updateFields bson.M) error {
+	start := time.Now()
+	err := i.Storage.UpdateSprint(projectId, sprintId, updateFields)
+	i.metrics.observeStorage("UpdateSprint", start, err)
+	return err
+}
+func (i *InstrumentedStorage) DeleteSprint(projectId, sprintId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.DeleteSprint(projectId, sprintId)
+	i.metrics.observeStorage("DeleteSprint", start, err)
+	return err
+}
+func (i *InstrumentedStorage) StartSprint(projectId, sprintId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.StartSprint(projectId, sprintId)
+	i.metrics.observeStorage("StartSprint", start, err)
+	return err
+}
+func (i *InstrumentedStorage) CloseSprint(projectId, sprintId, nextSprintId ident.ID) (int64, error) {
+	start := time.Now()
+	res, err := i.Storage.CloseSprint(projectId, sprintId, nextSprintId)
+	i.metrics.observeStorage("CloseSprint", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) AssignTasksToSprint(projectId, sprintId ident.ID, taskIds []ident.ID) error {
+	start := time.Now()
+	err := i.Storage.AssignTasksToSprint(projectId, sprintId, taskIds)
+	i.metrics.observeStorage("AssignTasksToSprint", start, err)
+	return err
+}
+func (i *InstrumentedStorage) GetTasksBySprint(projectId, sprintId ident.ID) ([]project.Task, error) {
+	start := time.Now()
+	res, err := i.Storage.GetTasksBySprint(projectId, sprintId)
+	i.metrics.observeStorage("GetTasksBySprint", start, err)
+	return res, err
+}
+
+func (i *InstrumentedStorage) GetWorkload(projectId ident.ID, from, to time.Time, interval string) ([]report.Workload, error) {
+	start := time.Now()
+	res, err := i.Storage.GetWorkload(projectId, from, to, interval)
+	i.metrics.observeStorage("GetWorkload", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) GetTotals(now time.Time) (*report.Totals, error) {
+	start := time.Now()
+	res, err := i.Storage.GetTotals(now)
+	i.metrics.observeStorage("GetTotals", start, err)
+	return res, err
+}
+
+func (i *InstrumentedStorage) GetWorklogsByTask(projectId, taskId ident.ID) ([]project.Worklog, error) {
+	start := time.Now()
+	res, err := i.Storage.GetWorklogsByTask(projectId, taskId)
+	i.metrics.observeStorage("GetWorklogsByTask", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) InsertWorklog(w *project.Worklog, projectId, taskId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.InsertWorklog(w, projectId, taskId)
+	i.metrics.observeStorage("InsertWorklog", start, err)
+	return err
+}
+func (i *InstrumentedStorage) DeleteWorklog(projectId, taskId, worklogId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.DeleteWorklog(projectId, taskId, worklogId)
+	i.metrics.observeStorage("DeleteWorklog", start, err)
+	return err
+}
+func (i *InstrumentedStorage) StartTimer(projectId, taskId, userId ident.ID) (*project.Worklog, error) {
+	start := time.Now()
+	res, err := i.Storage.StartTimer(projectId, taskId, userId)
+	i.metrics.observeStorage("StartTimer", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) StopTimer(projectId, taskId, userId ident.ID, note string) (*project.Worklog, error) {
+	start := time.Now()
+	res, err := i.Storage.StopTimer(projectId, taskId, userId, note)
+	i.metrics.observeStorage("StopTimer", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) GetTimeReport(projectId, userId ident.ID, from, to time.Time) ([]report.TimeSpent, error) {
+	start := time.Now()
+	res, err := i.Storage.GetTimeReport(projectId, userId, from, to)
+	i.metrics.observeStorage("GetTimeReport", start, err)
+	return res, err
+}
+
+func (i *InstrumentedStorage) GetRecurringTasks() ([]project.Task, error) {
+	start := time.Now()
+	res, err := i.Storage.GetRecurringTasks()
+	i.metrics.observeStorage("GetRecurringTasks", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) SpawnOccurrence(t *project.Task) (*project.Task, error) {
+	start := time.Now()
+	res, err := i.Storage.SpawnOccurrence(t)
+	i.metrics.observeStorage("SpawnOccurrence", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) SetTaskRecurrence(projectId, taskId ident.ID, rule string) error {
+	start := time.Now()
+	err := i.Storage.SetTaskRecurrence(projectId, taskId, rule)
+	i.metrics.observeStorage("SetTaskRecurrence", start, err)
+	return err
+}
+
+func (i *InstrumentedStorage) InsertNotification(n *user.Notification) error {
+	start := time.Now()
+	err := i.Storage.InsertNotification(n)
+	i.metrics.observeStorage("InsertNotification", start, err)
+	return err
+}
+func (i *InstrumentedStorage) GetTasksDueBefore(t time.Time) ([]project.Task, error) {
+	start := time.Now()
+	res, err := i.Storage.GetTasksDueBefore(t)
+	i.metrics.observeStorage("GetTasksDueBefore", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) GetProjectsDueBefore(t time.Time) ([]project.Project, error) {
+	start := time.Now()
+	res, err := i.Storage.GetProjectsDueBefore(t)
+	i.metrics.observeStorage("GetProjectsDueBefore", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) MarkReminderSent(key string) (bool, error) {
+	start := time.Now()
+	res, err := i.Storage.MarkReminderSent(key)
+	i.metrics.observeStorage("MarkReminderSent", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) GetNotifications(userId ident.ID, unreadOnly bool, offset, limit int64) ([]user.Notification, int64, error) {
+	start := time.Now()
+	res1, res2, err := i.Storage.GetNotifications(userId, unreadOnly, offset, limit)
+	i.metrics.observeStorage("GetNotifications", start, err)
+	return res1, res2, err
+}
+func (i *InstrumentedStorage) CountUnreadNotifications(userId ident.ID) (int64, error) {
+	start := time.Now()
+	res, err := i.Storage.CountUnreadNotifications(userId)
+	i.metrics.observeStorage("CountUnreadNotifications", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) MarkNotificationRead(userId, notificationId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.MarkNotificationRead(userId, notificationId)
+	i.metrics.observeStorage("MarkNotificationRead", start, err)
+	return err
+}
+func (i *InstrumentedStorage) MarkAllNotificationsRead(userId ident.ID) (int64, error) {
+	start := time.Now()
+	res, err := i.Storage.MarkAllNotificationsRead(userId)
+	i.metrics.observeStorage("MarkAllNotificationsRead", start, err)
+	return res, err
+}
+
+func (i *InstrumentedStorage) Watch(w *user.Watch) error {
+	start := time.Now()
+	err := i.Storage.Watch(w)
+	i.metrics.observeStorage("Watch", start, err)
+	return err
+}
+func (i *InstrumentedStorage) Unwatch(userId ident.ID, kind string, targetId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.Unwatch(userId, kind, targetId)
+	i.metrics.observeStorage("Unwatch", start, err)
+	return err
+}
+func (i *InstrumentedStorage) GetWatchers(projectId, taskId ident.ID) ([]ident.ID, error) {
+	start := time.Now()
+	res, err := i.Storage.GetWatchers(projectId, taskId)
+	i.metrics.observeStorage("GetWatchers", start, err)
+	return res, err
+}
+
+func (i *InstrumentedStorage) InsertComment(cm *project.Comment, projectId, taskId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.InsertComment(cm, projectId, taskId)
+	i.metrics.observeStorage("InsertComment", start, err)
+	return err
+}
+func (i *InstrumentedStorage) GetCommentsByTask(projectId, taskId ident.ID) ([]project.Comment, error) {
+	start := time.Now()
+	res, err := i.Storage.GetCommentsByTask(projectId, taskId)
+	i.metrics.observeStorage("GetCommentsByTask", start, err)
+	return res, err
+}
+
+func (i *InstrumentedStorage) GetWebhooksByProject(projectId ident.ID) ([]project.Webhook, error) {
+	start := time.Now()
+	res, err := i.Storage.GetWebhooksByProject(projectId)
+	i.metrics.observeStorage("GetWebhooksByProject", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) GetWebhook(projectId, webhookId ident.ID) (*project.Webhook, error) {
+	start := time.Now()
+	res, err := i.Storage.GetWebhook(projectId, webhookId)
+	i.metrics.observeStorage("GetWebhook", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) InsertWebhook(w *project.Webhook, projectId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.InsertWebhook(w, projectId)
+	i.metrics.observeStorage("InsertWebhook", start, err)
+	return err
+}
+func (i *InstrumentedStorage) UpdateWebhook(projectId, webhookId ident.ID, updateFields bson.M) error {
+	start := time.Now()
+	err := i.Storage.UpdateWebhook(projectId, webhookId, updateFields)
+	i.metrics.observeStorage("UpdateWebhook", start, err)
+	return err
+}
+func (i *InstrumentedStorage) DeleteWebhook(projectId, webhookId ident.ID) error {
+	start := time.Now()
+	err := i.Storage.DeleteWebhook(projectId, webhookId)
+	i.metrics.observeStorage("DeleteWebhook", start, err)
+	return err
+}
+func (i *InstrumentedStorage) InsertDelivery(d *project.WebhookDelivery) error {
+	start := time.Now()
+	err := i.Storage.InsertDelivery(d)
+	i.metrics.observeStorage("InsertDelivery", start, err)
+	return err
+}
+func (i *InstrumentedStorage) UpdateDelivery(d *project.WebhookDelivery) error {
+	start := time.Now()
+	err := i.Storage.UpdateDelivery(d)
+	i.metrics.observeStorage("UpdateDelivery", start, err)
+	return err
+}
+func (i *InstrumentedStorage) GetDeliveries(webhookId ident.ID, limit int64) ([]project.WebhookDelivery, error) {
+	start := time.Now()
+	res, err := i.Storage.GetDeliveries(webhookId, limit)
+	i.metrics.observeStorage("GetDeliveries", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) GetDelivery(webhookId, deliveryId ident.ID) (*project.WebhookDelivery, error) {
+	start := time.Now()
+	res, err := i.Storage.GetDelivery(webhookId, deliveryId)
+	i.metrics.observeStorage("GetDelivery", start, err)
+	return res, err
+}
+func (i *InstrumentedStorage) ClaimDueDelivery(now time.Time, lease time.Duration) (*project.WebhookDelivery, error) {
+	start := time.Now()
+	res, err := i.Storage.ClaimDueDelivery(now, lease)
+	i.metrics.observeStorage("ClaimDueDelivery", start, err)
+	return res, err
+}
+
+func (i *InstrumentedStorage) InsertOutbox(r *event.Record) error {
+	start := time.Now()
+	err := i.Storage.InsertOutbox(r)
+	i.metrics.observeStorage("InsertOutbox", start, err)
+	return err
+}
+func (i *InstrumentedStorage) UpdateOutbox(r *event.Record) error {
+	start := time.Now()
+	err := i.Storage.UpdateOutbox(r)
+	i.metrics.observeStorage("UpdateOutbox", start, err)
+	return err
+}
+func (i *InstrumentedStorage) DeleteOutbox(id ident.ID) error {
+	start := time.Now()
+	err := i.Storage.DeleteOutbox(id)
+	i.metrics.observeStorage("DeleteOutbox", start, err)
+	return err
+}
+func (i *InstrumentedStorage) ClaimOutbox(now time.Time, lease time.Duration) (*event.Record, error) {
+	start := time.Now()
+	res, err := i.Storage.ClaimOutbox(now, lease)
+	i.metrics.observeStorage("ClaimOutbox", start, err)
+	return res, err
+}
@@ -0,0 +1,136 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"tmv/ident"
+	"tmv/project"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All — миграции по возрастанию версии
+var All = []Migration{
+	{Version: 1, Name: "backreference arrays", Up: backreferenceArrays},
+	{Version: 2, Name: "task status history", Up: taskStatusHistory},
+	{Version: 3, Name: "task ranks", Up: taskRanks},
+	{Version: 4, Name: "unique running timer index", Up: dropRunningIndex},
+}
+
+// notArray совпадает с отсутствующим полем и с null
+func notArray(field string) bson.D {
+	return bson.D{{Key: field, Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$type", Value: "array"}}}}}}
+}
+
+// backreferenceArrays заменяет null в User.Projects и Project.Tasks пустым массивом:
+// документы, сохранённые с nil-срезом, не принимают $addToSet при создании проекта или задачи
+func backreferenceArrays(ctx context.Context, r *Run) error {
+	err := r.UpdateMany(ctx, r.Storage.UserCollection, notArray("projects"),
+		bson.D{{Key: "$set", Value: bson.D{{Key: "projects", Value: bson.A{}}}}})
+	if err != nil {
+		return err
+	}
+	return r.UpdateMany(ctx, r.Storage.ProjectCollection, notArray("tasks"),
+		bson.D{{Key: "$set", Value: bson.D{{Key: "tasks", Value: bson.A{}}}}})
+}
+
+// taskStatusHistory начинает историю статусов задач, созданных до её появления, так же,
+// как это делает InsertTask: текущий статус с даты создания. Иначе такие задачи выпадают из отчётов.
+func taskStatusHistory(ctx context.Context, r *Run) error {
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "statusHistory", Value: bson.A{bson.D{
+			{Key: "status", Value: "$status"},
+			{Key: "at", Value: "$dateCreation"},
+		}}},
+	}}}}
+	return r.UpdateMany(ctx, r.Storage.TaskCollection, notArray("statusHistory"), update)
+}
+
+// taskRanks ставит задачи без ранга (созданные до доски) в конец их колонок в порядке создания
+func taskRanks(ctx context.Context, r *Run) error {
+	tasks := r.Storage.TaskCollection
+	unranked := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "rank", Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "rank", Value: ""}},
+	}}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "projectId", Value: 1}, {Key: "status", Value: 1}, {Key: "dateCreation", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.D{{Key: "projectId", Value: 1}, {Key: "status", Value: 1}})
+	cursor, err := tasks.Find(ctx, unranked, opts)
+	if err != nil {
+		return err
+	}
+	var found []project.Task
+	if err := cursor.All(ctx, &found); err != nil {
+		return err
+	}
+	if r.DryRun {
+		r.Logf("%s: would rank %d tasks", tasks.Name(), len(found))
+		return nil
+	}
+
+	var (
+		writes    []mongo.WriteModel
+		projectId ident.ID
+		status    string
+		rank      string
+	)
+	for i, t := range found {
+		if i == 0 || t.ProjectID != projectId || t.Status != status {
+			projectId, status = t.ProjectID, t.Status
+			if rank, err = lastRank(ctx, tasks, projectId, status); err != nil {
+				return err
+			}
+		}
+		rank = project.RankBetween(rank, "")
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: t.ID}}).
+			SetUpdate(bson.D{{Key: "$set", Value: bson.D{{Key: "rank", Value: rank}}}}))
+	}
+	if len(writes) > 0 {
+		if _, err := tasks.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+	r.Logf("%s: ranked %d tasks", tasks.Name(), len(writes))
+	return nil
+}
+
+func lastRank(ctx context.Context, tasks *mongo.Collection, projectId ident.ID, status string) (string, error) {
+	filter := bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "status", Value: status},
+		{Key: "rank", Value: bson.D{{Key: "$gt", Value: ""}}},
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "rank", Value: -1}})
+
+	var last project.Task
+	err := tasks.FindOne(ctx, filter, opts).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	return last.Rank, err
+}
+
+// dropRunningIndex удаляет неуникальный индекс userId_running, который заменил
+// userId_running_unique. Откатывать нечего: прежняя версия сервера создаст его заново.
+func dropRunningIndex(ctx context.Context, r *Run) error {
+	worklogs := r.Storage.WorklogCollection
+	if r.DryRun {
+		r.Logf("%s: would drop index userId_running", worklogs.Name())
+		return nil
+	}
+	_, err := worklogs.Indexes().DropOne(ctx, "userId_running")
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 27 { // IndexNotFound
+		r.Logf("%s: index userId_running is already gone", worklogs.Name())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.Logf("%s: dropped index userId_running", worklogs.Name())
+	return nil
+}
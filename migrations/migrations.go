@@ -0,0 +1,302 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+	"tmv/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migration — одно изменение сохранённых документов. Версии идут по возрастанию и не меняются
+// после выпуска; новая миграция добавляется в конец списка All.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, r *Run) error
+	// Down отменяет Up. nil — отменять нечего: прежние версии сервера читают данные после Up
+	// как есть, и откат только удаляет запись о миграции.
+	Down func(ctx context.Context, r *Run) error
+}
+
+// Run — окружение одного шага. При DryRun миграция ничего не пишет, а только сообщает,
+// что изменила бы; помощники ниже делают это сами.
+type Run struct {
+	Storage *storage.MongoStorage
+	DryRun  bool
+	Out     io.Writer
+}
+
+// Logf пишет строку отчёта шага
+func (r *Run) Logf(format string, args ...interface{}) {
+	fmt.Fprintf(r.Out, "  "+format+"\n", args...)
+}
+
+// UpdateMany применяет update ко всем документам filter; при DryRun только считает их
+func (r *Run) UpdateMany(ctx context.Context, c *mongo.Collection, filter, update interface{}) error {
+	if r.DryRun {
+		n, err := c.CountDocuments(ctx, filter)
+		if err != nil {
+			return err
+		}
+		r.Logf("%s: would update %d documents", c.Name(), n)
+		return nil
+	}
+	res, err := c.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	r.Logf("%s: updated %d documents", c.Name(), res.ModifiedCount)
+	return nil
+}
+
+// State — миграция и отметка о её применении
+type State struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Unknown   bool // Применена более новой версией сервера и этой неизвестна
+}
+
+type record struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+	Duration  int64     `bson:"durationMs"`
+}
+
+// Migrator применяет и откатывает миграции, храня применённые версии в MigrationCollection.
+// Одновременно запускать несколько Migrator для одной базы нельзя.
+type Migrator struct {
+	Storage    *storage.MongoStorage
+	Migrations []Migration
+	DryRun     bool
+	Out        io.Writer
+
+	records recordStore // nil — MigrationCollection хранилища
+}
+
+// recordStore хранит отметки о применённых миграциях
+type recordStore interface {
+	all(ctx context.Context) ([]record, error)
+	insert(ctx context.Context, rec record) error
+	remove(ctx context.Context, version int) error
+}
+
+type mongoRecords struct {
+	c *mongo.Collection
+}
+
+func (r mongoRecords) all(ctx context.Context) ([]record, error) {
+	cursor, err := r.c.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (r mongoRecords) insert(ctx context.Context, rec record) error {
+	_, err := r.c.InsertOne(ctx, rec)
+	return err
+}
+
+func (r mongoRecords) remove(ctx context.Context, version int) error {
+	_, err := r.c.DeleteOne(ctx, bson.D{{Key: "_id", Value: version}})
+	return err
+}
+
+func (m *Migrator) store() recordStore {
+	if m.records != nil {
+		return m.records
+	}
+	return mongoRecords{m.Storage.MigrationCollection}
+}
+
+func NewMigrator(m *storage.MongoStorage, out io.Writer) *Migrator {
+	return &Migrator{Storage: m, Migrations: All, Out: out}
+}
+
+func (m *Migrator) validate() error {
+	for i, mig := range m.Migrations {
+		if mig.Up == nil {
+			return fmt.Errorf("migration %d has no Up", mig.Version)
+		}
+		if i > 0 && mig.Version == m.Migrations[i-1].Version {
+			return fmt.Errorf("migration %d is duplicated", mig.Version)
+		}
+		if i > 0 && mig.Version < m.Migrations[i-1].Version {
+			return fmt.Errorf("migration %d is out of order", mig.Version)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]record, error) {
+	records, err := m.store().all(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]record, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+	return applied, nil
+}
+
+// Status перечисляет известные миграции и применённые версии, которых эта версия сервера не знает
+func (m *Migrator) Status(ctx context.Context) ([]State, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []State
+	for _, mig := range m.Migrations {
+		rec, ok := applied[mig.Version]
+		states = append(states, State{Version: mig.Version, Name: mig.Name, Applied: ok, AppliedAt: rec.AppliedAt})
+		delete(applied, mig.Version)
+	}
+	for _, rec := range applied {
+		states = append(states, State{Version: rec.Version, Name: rec.Name, Applied: true, AppliedAt: rec.AppliedAt, Unknown: true})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// Pending возвращает неприменённые миграции по порядку
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	states, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, st := range states {
+		if !st.Applied {
+			pending = append(pending, m.byVersion(st.Version))
+		}
+	}
+	return pending, nil
+}
+
+func (m *Migrator) byVersion(version int) Migration {
+	for _, mig := range m.Migrations {
+		if mig.Version == version {
+			return mig
+		}
+	}
+	return Migration{}
+}
+
+// checkUnknown не даёт менять базу, которую уже обновила более новая версия сервера
+func checkUnknown(states []State) error {
+	for _, st := range states {
+		if st.Unknown {
+			return fmt.Errorf("database has migration %d (%s) unknown to this version; use a newer binary", st.Version, st.Name)
+		}
+	}
+	return nil
+}
+
+// Up применяет неприменённые миграции с версией не выше target; target 0 — все.
+// Каждая миграция отмечается сразу после успеха, поэтому после ошибки повтор продолжит с неё.
+func (m *Migrator) Up(ctx context.Context, target int) error {
+	states, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if err := checkUnknown(states); err != nil {
+		return err
+	}
+
+	done := 0
+	for _, st := range states {
+		if st.Applied || (target > 0 && st.Version > target) {
+			continue
+		}
+		mig := m.byVersion(st.Version)
+		took, err := m.step(ctx, mig, mig.Up, "up")
+		if err != nil {
+			return err
+		}
+		if !m.DryRun {
+			err := m.store().insert(ctx, record{
+				Version:   mig.Version,
+				Name:      mig.Name,
+				AppliedAt: time.Now(),
+				Duration:  took.Milliseconds(),
+			})
+			if err != nil {
+				return fmt.Errorf("record migration %d: %w", mig.Version, err)
+			}
+		}
+		done++
+	}
+	if done == 0 {
+		fmt.Fprintln(m.Out, "no pending migrations")
+	}
+	return nil
+}
+
+// Down откатывает применённые миграции с версией выше target, начиная с последней
+func (m *Migrator) Down(ctx context.Context, target int) error {
+	states, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if err := checkUnknown(states); err != nil {
+		return err
+	}
+
+	done := 0
+	for i := len(states) - 1; i >= 0; i-- {
+		st := states[i]
+		if !st.Applied || st.Version <= target {
+			continue
+		}
+		mig := m.byVersion(st.Version)
+		if _, err := m.step(ctx, mig, mig.Down, "down"); err != nil {
+			return err
+		}
+		if !m.DryRun {
+			if err := m.store().remove(ctx, mig.Version); err != nil {
+				return fmt.Errorf("unrecord migration %d: %w", mig.Version, err)
+			}
+		}
+		done++
+	}
+	if done == 0 {
+		fmt.Fprintln(m.Out, "nothing to roll back")
+	}
+	return nil
+}
+
+// step выполняет Up или Down одной миграции и возвращает, сколько это заняло
+func (m *Migrator) step(ctx context.Context, mig Migration, fn func(context.Context, *Run) error, direction string) (time.Duration, error) {
+	prefix := ""
+	if m.DryRun {
+		prefix = "[dry run] "
+	}
+	fmt.Fprintf(m.Out, "%s%s %d %s\n", prefix, direction, mig.Version, mig.Name)
+	if fn == nil {
+		fmt.Fprintln(m.Out, "  nothing to undo")
+		return 0, nil
+	}
+
+	start := time.Now()
+	if err := fn(ctx, &Run{Storage: m.Storage, DryRun: m.DryRun, Out: m.Out}); err != nil {
+		return 0, fmt.Errorf("migration %d %s %s: %w", mig.Version, mig.Name, direction, err)
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,206 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRecords — отметки о миграциях в памяти вместо MigrationCollection
+type fakeRecords map[int]record
+
+func (f fakeRecords) all(context.Context) ([]record, error) {
+	var records []record
+	for _, rec := range f {
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func (f fakeRecords) insert(_ context.Context, rec record) error {
+	f[rec.Version] = rec
+	return nil
+}
+
+func (f fakeRecords) remove(_ context.Context, version int) error {
+	delete(f, version)
+	return nil
+}
+
+func (f fakeRecords) versions() []int {
+	versions := []int{}
+	for v := range f {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// newTestMigrator возвращает Migrator с миграциями 1–3 (у второй нет Down), уже применёнными
+// версиями applied и журналом вызовов Up и Down
+func newTestMigrator(applied ...int) (*Migrator, fakeRecords, *[]string) {
+	var calls []string
+	step := func(name string) func(context.Context, *Run) error {
+		return func(_ context.Context, r *Run) error {
+			call := name
+			if r.DryRun {
+				call += " (dry run)"
+			}
+			calls = append(calls, call)
+			return nil
+		}
+	}
+	records := fakeRecords{}
+	for _, v := range applied {
+		records[v] = record{Version: v, Name: fmt.Sprint("m", v), AppliedAt: time.Now()}
+	}
+	m := &Migrator{
+		Migrations: []Migration{
+			{Version: 1, Name: "m1", Up: step("up 1"), Down: step("down 1")},
+			{Version: 2, Name: "m2", Up: step("up 2")},
+			{Version: 3, Name: "m3", Up: step("up 3"), Down: step("down 3")},
+		},
+		Out:     io.Discard,
+		records: records,
+	}
+	return m, records, &calls
+}
+
+func TestValidate(t *testing.T) {
+	up := func(context.Context, *Run) error { return nil }
+	tests := []struct {
+		name       string
+		migrations []Migration
+		wantErr    string
+	}{
+		{"ordered", []Migration{{Version: 1, Up: up}, {Version: 2, Up: up}, {Version: 5, Up: up}}, ""},
+		{"empty", nil, ""},
+		{"out of order", []Migration{{Version: 2, Up: up}, {Version: 1, Up: up}}, "migration 1 is out of order"},
+		{"duplicate", []Migration{{Version: 1, Up: up}, {Version: 1, Up: up}}, "migration 1 is duplicated"},
+		{"no Up", []Migration{{Version: 1, Up: up}, {Version: 2}}, "migration 2 has no Up"},
+	}
+	for _, tt := range tests {
+		err := (&Migrator{Migrations: tt.migrations}).validate()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: validate = %v, want nil", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("%s: validate = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckUnknown(t *testing.T) {
+	if err := checkUnknown([]State{{Version: 1, Applied: true}, {Version: 2}}); err != nil {
+		t.Errorf("checkUnknown of known states = %v", err)
+	}
+	err := checkUnknown([]State{{Version: 1, Applied: true}, {Version: 7, Name: "future", Applied: true, Unknown: true}})
+	if err == nil || !strings.Contains(err.Error(), "migration 7 (future)") {
+		t.Errorf("checkUnknown = %v, want error about migration 7", err)
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	tests := []struct {
+		name        string
+		applied     []int
+		down        bool
+		target      int
+		wantCalls   []string
+		wantApplied []int
+	}{
+		{"up all", nil, false, 0, []string{"up 1", "up 2", "up 3"}, []int{1, 2, 3}},
+		{"up to target", nil, false, 2, []string{"up 1", "up 2"}, []int{1, 2}},
+		{"up skips applied", []int{1}, false, 0, []string{"up 2", "up 3"}, []int{1, 2, 3}},
+		{"up fills a gap", []int{1, 3}, false, 0, []string{"up 2"}, []int{1, 2, 3}},
+		{"up nothing pending", []int{1, 2, 3}, false, 0, nil, []int{1, 2, 3}},
+		{"down to target", []int{1, 2, 3}, true, 1, []string{"down 3"}, []int{1}},
+		{"down all", []int{1, 2, 3}, true, 0, []string{"down 3", "down 1"}, []int{}},
+		{"down skips unapplied", []int{1, 2}, true, 0, []string{"down 1"}, []int{}},
+		{"down nothing above target", []int{1}, true, 1, nil, []int{1}},
+	}
+	for _, tt := range tests {
+		m, records, calls := newTestMigrator(tt.applied...)
+		var err error
+		if tt.down {
+			err = m.Down(context.Background(), tt.target)
+		} else {
+			err = m.Up(context.Background(), tt.target)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if fmt.Sprint(*calls) != fmt.Sprint(tt.wantCalls) {
+			t.Errorf("%s: calls = %v, want %v", tt.name, *calls, tt.wantCalls)
+		}
+		if got := records.versions(); fmt.Sprint(got) != fmt.Sprint(tt.wantApplied) {
+			t.Errorf("%s: applied = %v, want %v", tt.name, got, tt.wantApplied)
+		}
+	}
+}
+
+// Миграция, применённая более новой версией сервера, блокирует и Up, и Down
+func TestUnknownAppliedVersion(t *testing.T) {
+	for _, down := range []bool{false, true} {
+		m, records, calls := newTestMigrator(1, 9)
+		var err error
+		if down {
+			err = m.Down(context.Background(), 0)
+		} else {
+			err = m.Up(context.Background(), 0)
+		}
+		if err == nil || !strings.Contains(err.Error(), "migration 9") {
+			t.Errorf("down=%t: err = %v, want unknown migration 9", down, err)
+		}
+		if len(*calls) != 0 || fmt.Sprint(records.versions()) != "[1 9]" {
+			t.Errorf("down=%t: calls = %v, applied = %v; want nothing changed", down, *calls, records.versions())
+		}
+	}
+
+	m, _, _ := newTestMigrator(1, 9)
+	states, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if last := states[len(states)-1]; last.Version != 9 || !last.Unknown || !last.Applied {
+		t.Errorf("Status last = %+v, want unknown applied 9", last)
+	}
+}
+
+// При DryRun шаги получают Run.DryRun, а отметки о миграциях не меняются
+func TestDryRun(t *testing.T) {
+	m, records, calls := newTestMigrator(1)
+	m.DryRun = true
+	if err := m.Up(context.Background(), 0); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if want := "[up 2 (dry run) up 3 (dry run)]"; fmt.Sprint(*calls) != want {
+		t.Errorf("calls = %v, want %s", *calls, want)
+	}
+	if got := records.versions(); fmt.Sprint(got) != "[1]" {
+		t.Errorf("applied after dry-run up = %v, want [1]", got)
+	}
+
+	*calls = nil
+	if err := m.Down(context.Background(), 0); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if want := "[down 1 (dry run)]"; fmt.Sprint(*calls) != want {
+		t.Errorf("calls = %v, want %s", *calls, want)
+	}
+	if got := records.versions(); fmt.Sprint(got) != "[1]" {
+		t.Errorf("applied after dry-run down = %v, want [1]", got)
+	}
+}
+
+// Список All сам проходит проверку
+func TestAllValid(t *testing.T) {
+	if err := (&Migrator{Migrations: All}).validate(); err != nil {
+		t.Fatal(err)
+	}
+}
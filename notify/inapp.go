@@ -0,0 +1,20 @@
+package notify
+
+import (
+	"tmv/storage"
+	"tmv/user"
+)
+
+// InApp кладёт уведомление во входящие пользователя
+type InApp struct {
+	Storage storage.Storage
+}
+
+func NewInApp(st storage.Storage) *InApp {
+	return &InApp{Storage: st}
+}
+
+func (i *InApp) Notify(u user.User, n *user.Notification) error {
+	n.UserID = u.Id
+	return i.Storage.InsertNotification(n)
+}
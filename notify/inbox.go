@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"tmv/ident"
+	"tmv/logging"
+	"tmv/project"
+	"tmv/storage"
+	"tmv/user"
+)
+
+// Типы событий во входящих
+const (
+	KindAssigned      = "task.assigned"
+	KindMentioned     = "task.mentioned"
+	KindStatusChanged = "task.status_changed"
+	KindCommented     = "task.commented"
+)
+
+// Inbox пишет во входящие события задач. Автор действия (actor) уведомлений о себе не получает.
+// Ошибки записи только логируются: побочный эффект не должен ломать основной запрос.
+type Inbox struct {
+	Storage storage.Storage
+
+	users *sessionUsers // Пользователи, прочитанные в рамках Session; nil — читаются на каждый вызов
+}
+
+type sessionUsers struct {
+	once sync.Once
+	idx  UserIndex
+}
+
+func NewInbox(st storage.Storage) *Inbox {
+	return &Inbox{Storage: st}
+}
+
+// Session возвращает Inbox на время одного запроса: список пользователей для поиска
+// по именам и email читается не больше одного раза, сколько бы задач запрос ни затронул
+func (i *Inbox) Session() *Inbox {
+	return &Inbox{Storage: i.Storage, users: &sessionUsers{}}
+}
+
+func (i *Inbox) userIndex() UserIndex {
+	if i.users == nil {
+		return NewUserIndex(i.Storage.GetAllUsers())
+	}
+	i.users.once.Do(func() {
+		i.users.idx = NewUserIndex(i.Storage.GetAllUsers())
+	})
+	return i.users.idx
+}
+
+// TaskAssigned уведомляет людей, только что ставших ответственными или исполнителями
+func (i *Inbox) TaskAssigned(actor ident.ID, t *project.Task, people []string) {
+	if len(people) == 0 {
+		return
+	}
+	users := i.userIndex().Resolve(people)
+	i.send(actor, ids(users), t, KindAssigned, fmt.Sprintf("Вас назначили на задачу «%s»", t.Name), "")
+}
+
+// TaskMentioned уведомляет упомянутых (см. project.Mentions) и возвращает их id; text попадает в уведомление
+func (i *Inbox) TaskMentioned(actor ident.ID, t *project.Task, mentions []string, text string) []ident.ID {
+	if len(mentions) == 0 {
+		return nil
+	}
+	mentioned := ids(i.userIndex().Resolve(mentions))
+	i.send(actor, mentioned, t, KindMentioned, fmt.Sprintf("Вас упомянули в задаче «%s»", t.Name), text)
+	return mentioned
+}
+
+// TaskStatusChanged уведомляет подписчиков задачи и её проекта
+func (i *Inbox) TaskStatusChanged(actor ident.ID, t *project.Task, oldStatus string) {
+	watchers, err := i.Storage.GetWatchers(t.ProjectID, t.ID)
+	if err != nil {
+		logging.Default().Error("inbox: get watchers", "error", err)
+		return
+	}
+	i.send(actor, watchers, t, KindStatusChanged,
+		fmt.Sprintf("Задача «%s»: статус изменён", t.Name),
+		fmt.Sprintf("%s → %s", oldStatus, t.Status))
+}
+
+// TaskCommented уведомляет упомянутых в комментарии и подписчиков; упомянутые получают одно уведомление
+func (i *Inbox) TaskCommented(actor ident.ID, t *project.Task, cm *project.Comment) {
+	mentioned := i.TaskMentioned(actor, t, project.Mentions(cm.Text), cm.Text)
+
+	watchers, err := i.Storage.GetWatchers(t.ProjectID, t.ID)
+	if err != nil {
+		logging.Default().Error("inbox: get watchers", "error", err)
+		return
+	}
+	skip := make(map[ident.ID]bool)
+	for _, id := range mentioned {
+		skip[id] = true
+	}
+	var recipients []ident.ID
+	for _, id := range watchers {
+		if !skip[id] {
+			recipients = append(recipients, id)
+		}
+	}
+	i.send(actor, recipients, t, KindCommented, fmt.Sprintf("Новый комментарий к задаче «%s»", t.Name), cm.Text)
+}
+
+func (i *Inbox) send(actor ident.ID, recipients []ident.ID, t *project.Task, kind, title, message string) {
+	for _, id := range recipients {
+		if id == actor {
+			continue
+		}
+		n := &user.Notification{
+			UserID:    id,
+			Kind:      kind,
+			Title:     title,
+			Message:   message,
+			ProjectID: t.ProjectID,
+			TaskID:    t.ID,
+		}
+		if err := i.Storage.InsertNotification(n); err != nil {
+			logging.Default().Error("inbox: notify", "user_id", id.Hex(), "error", err)
+		}
+	}
+}
+
+// AddedPeople возвращает людей из after, которых не было в before (без учёта регистра)
+func AddedPeople(before, after []string) []string {
+	had := make(map[string]bool)
+	for _, p := range before {
+		had[strings.ToLower(p)] = true
+	}
+	var added []string
+	for _, p := range after {
+		if !had[strings.ToLower(p)] {
+			added = append(added, p)
+		}
+	}
+	return added
+}
+
+func ids(users []user.User) []ident.ID {
+	out := make([]ident.ID, 0, len(users))
+	for _, u := range users {
+		out = append(out, u.Id)
+	}
+	return out
+}
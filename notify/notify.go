@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"tmv/user"
+)
+
+// Notifier доставляет уведомление пользователю по одному каналу
+type Notifier interface {
+	Notify(u user.User, n *user.Notification) error
+}
+
+// Dispatcher рассылает уведомление по каналам, выбранным пользователем
+type Dispatcher struct {
+	Notifiers map[string]Notifier
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{Notifiers: make(map[string]Notifier)}
+}
+
+// Register подключает канал; каналы без подключённого Notifier пропускаются
+func (d *Dispatcher) Register(channel string, n Notifier) {
+	d.Notifiers[channel] = n
+}
+
+// Send доставляет уведомление по всем каналам пользователя. Ошибка одного канала
+// не мешает остальным, ошибки возвращаются вместе.
+func (d *Dispatcher) Send(u user.User, n *user.Notification) error {
+	var errs []string
+	for _, channel := range u.NotificationChannels() {
+		notifier, ok := d.Notifiers[channel]
+		if !ok {
+			continue
+		}
+		// Каждому каналу своя копия, чтобы канал не менял уведомление для следующих
+		copied := *n
+		if err := notifier.Notify(u, &copied); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", channel, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"tmv/user"
+)
+
+// SMTP отправляет уведомление письмом на User.Email
+type SMTP struct {
+	Addr     string // host:port
+	From     string
+	Username string // пустой — без авторизации
+	Password string
+}
+
+func NewSMTP(addr, from, username, password string) *SMTP {
+	return &SMTP{Addr: addr, From: from, Username: username, Password: password}
+}
+
+func (s *SMTP) Notify(u user.User, n *user.Notification) error {
+	if u.Email == "" {
+		return errors.New("user has no email")
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// Переводы строк в заголовках недопустимы: они позволили бы подставить свои заголовки
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(n.Title)
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		s.From, u.Email, subject, n.Message)
+
+	return smtp.SendMail(s.Addr, auth, s.From, []string{u.Email}, []byte(msg))
+}
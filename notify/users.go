@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"strings"
+	"tmv/ident"
+	"tmv/user"
+)
+
+// UserIndex сопоставляет строки Responsible/Performers и упоминания пользователям по email или имени
+type UserIndex map[string]user.User
+
+func NewUserIndex(users map[ident.ID]user.User) UserIndex {
+	idx := make(UserIndex)
+	for _, u := range users {
+		if u.Name != "" {
+			idx[strings.ToLower(u.Name)] = u
+		}
+	}
+	// Email приоритетнее имени при совпадении, поэтому заполняется вторым проходом
+	for _, u := range users {
+		if u.Email != "" {
+			idx[strings.ToLower(u.Email)] = u
+		}
+	}
+	return idx
+}
+
+// Resolve возвращает найденных пользователей без повторов; неизвестные строки пропускаются
+func (idx UserIndex) Resolve(people []string) []user.User {
+	var users []user.User
+	seen := make(map[ident.ID]bool)
+	for _, p := range people {
+		u, ok := idx[strings.ToLower(strings.TrimSpace(p))]
+		if !ok || seen[u.Id] {
+			continue
+		}
+		seen[u.Id] = true
+		users = append(users, u)
+	}
+	return users
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"tmv/user"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Webhook отправляет уведомление JSON-запросом на адрес из настроек пользователя
+type Webhook struct {
+	Client *http.Client
+}
+
+func NewWebhook() *Webhook {
+	return &Webhook{Client: &http.Client{Timeout: 10 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)}}
+}
+
+func (w *Webhook) Notify(u user.User, n *user.Notification) error {
+	if u.Notifications.WebhookURL == "" {
+		return errors.New("user has no webhook url")
+	}
+
+	n.UserID = u.Id
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.Client.Post(u.Notifications.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
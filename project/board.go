@@ -0,0 +1,62 @@
+package project
+
+import "sort"
+
+// Column — колонка доски: задачи одного статуса в ручном порядке
+type Column struct {
+	Status string `json:"status"`
+	Tasks  []Task `json:"tasks"`
+}
+
+// Board — канбан-доска проекта
+type Board struct {
+	ProjectID string   `json:"projectId"`
+	Columns   []Column `json:"columns"`
+}
+
+// SortByRank упорядочивает задачи по рангу, при равных рангах — по дате создания
+func SortByRank(tasks []Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].Rank != tasks[j].Rank {
+			return tasks[i].Rank < tasks[j].Rank
+		}
+		return tasks[i].DateCreation.Before(tasks[j].DateCreation)
+	})
+}
+
+// NewBoard группирует задачи по статусу. Колонки из statuses идут первыми и в заданном порядке
+// (даже если пустые), остальные статусы добавляются следом в алфавитном порядке.
+func NewBoard(projectID string, tasks []Task, statuses []string) *Board {
+	byStatus := make(map[string][]Task)
+	for _, t := range tasks {
+		byStatus[t.Status] = append(byStatus[t.Status], t)
+	}
+
+	order := make([]string, 0, len(byStatus)+len(statuses))
+	seen := make(map[string]bool)
+	for _, s := range statuses {
+		if !seen[s] {
+			seen[s] = true
+			order = append(order, s)
+		}
+	}
+	var rest []string
+	for s := range byStatus {
+		if !seen[s] {
+			rest = append(rest, s)
+		}
+	}
+	sort.Strings(rest)
+	order = append(order, rest...)
+
+	board := &Board{ProjectID: projectID, Columns: make([]Column, 0, len(order))}
+	for _, s := range order {
+		column := byStatus[s]
+		if column == nil {
+			column = []Task{}
+		}
+		SortByRank(column)
+		board.Columns = append(board.Columns, Column{Status: s, Tasks: column})
+	}
+	return board
+}
@@ -0,0 +1,37 @@
+package project
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"tmv/ident"
+)
+
+// Comment — комментарий к задаче
+type Comment struct {
+	Id           ident.ID  `bson:"_id,omitempty" json:"id"`
+	ProjectID    ident.ID  `bson:"projectId" json:"projectId"`       // Идентификатор проекта
+	TaskID       ident.ID  `bson:"taskId" json:"taskId"`             // Идентификатор задачи
+	AuthorID     ident.ID  `bson:"authorId" json:"authorId"`         // Автор комментария
+	Text         string    `bson:"text" json:"text"`                 // Текст, может содержать @упоминания
+	DateCreation time.Time `bson:"dateCreation" json:"dateCreation"` // Дата создания
+}
+
+// Упоминание: @имя или @адрес@почты
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])@([\p{L}\p{N}._%+\-]+(?:@[\p{L}\p{N}.\-]+)?)`)
+
+// Mentions возвращает упомянутых в тексте без символа @ и без повторов
+func Mentions(text string) []string {
+	var mentions []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(m[1], ".")
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		mentions = append(mentions, name)
+	}
+	return mentions
+}
@@ -0,0 +1,29 @@
+package project
+
+import "strings"
+
+// People возвращает ответственного и исполнителей (строка через запятую) без повторов и пустых значений
+func People(responsible, performers string) []string {
+	var people []string
+	seen := make(map[string]bool)
+	for _, p := range append([]string{responsible}, strings.Split(performers, ",")...) {
+		p = strings.TrimSpace(p)
+		key := strings.ToLower(p)
+		if p == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		people = append(people, p)
+	}
+	return people
+}
+
+// Assignees — ответственный и исполнители задачи
+func (t *Task) Assignees() []string {
+	return People(t.Responsible, t.Performers)
+}
+
+// Assignees — ответственный и исполнители проекта
+func (p *Project) Assignees() []string {
+	return People(p.Responsible, p.Performers)
+}
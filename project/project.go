@@ -2,29 +2,28 @@ package project
 
 import (
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"tmv/ident"
 )
 
 type Project struct {
-	Id           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	UserID       primitive.ObjectID   `bson:"userId" json:"userId"`
-	Name         string               `bson:"name" json:"name"`                 // Название проекта
-	Descript     string               `bson:"description" json:"description"`   // Описание проекта
-	Priority     int                  `bson:"priority" json:"priority"`         // Приоритет проекта (от 1 до 10)
-	Author       string               `bson:"author" json:"author"`             // Автор
-	Responsible  string               `bson:"responsible" json:"responsible"`   // Ответственный
-	Performers   string               `bson:"performers" json:"performers"`     // Исполнители
-	DateCreation time.Time            `bson:"dateCreation" json:"dateCreation"` // Дата создания
-	Deadline     time.Time            `bson:"deadline" json:"deadline"`         // Планируемая дата окончания
-	Guests       string               `bson:"guests" json:"guests"`             // Гости
-	Tasks        []primitive.ObjectID `bson:"tasks" json:"tasks"`               // Задачи
-	Status       string               `bson:"status" json:"status"`
+	Id           ident.ID   `bson:"_id,omitempty" json:"id"`
+	UserID       ident.ID   `bson:"userId" json:"userId"`
+	Name         string     `bson:"name" json:"name"`                 // Название проекта
+	Descript     string     `bson:"description" json:"description"`   // Описание проекта
+	Priority     int        `bson:"priority" json:"priority"`         // Приоритет проекта (от 1 до 10)
+	Author       string     `bson:"author" json:"author"`             // Автор
+	Responsible  string     `bson:"responsible" json:"responsible"`   // Ответственный
+	Performers   string     `bson:"performers" json:"performers"`     // Исполнители
+	DateCreation time.Time  `bson:"dateCreation" json:"dateCreation"` // Дата создания
+	Deadline     time.Time  `bson:"deadline" json:"deadline"`         // Планируемая дата окончания
+	Guests       string     `bson:"guests" json:"guests"`             // Гости
+	Tasks        []ident.ID `bson:"tasks" json:"tasks"`               // Задачи
+	Status       string     `bson:"status" json:"status"`
 }
 
-func NewProject(userId primitive.ObjectID, name, desc string, priority int, author, responsible, performers string, deadline time.Time, guests string, tasks []primitive.ObjectID, status string) *Project {
+func NewProject(userId ident.ID, name, desc string, priority int, author, responsible, performers string, deadline time.Time, guests string, tasks []ident.ID, status string) *Project {
 	return &Project{
-		Id:           primitive.NewObjectID(),
+		Id:           ident.New(),
 		UserID:       userId,
 		Name:         name,
 		Descript:     desc,
@@ -0,0 +1,144 @@
+package project
+
+import (
+	"strings"
+	"tmv/ident"
+)
+
+// Алфавит рангов: порядок символов совпадает с лексикографическим порядком строк
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// RankBetween возвращает ранг, который при строковом сравнении лежит строго между prev и next.
+// Пустой prev означает начало колонки, пустой next — её конец. Выдаваемые ранги не оканчиваются
+// на "0", поэтому перед любым из них остаётся место.
+//
+// Ранги с символами вне алфавита (записанные в обход хранилища) считаются отсутствующими.
+// Если между prev и next места нет (next — это prev, дополненный нулями, или пара перепутана),
+// новый ранг ставится сразу после prev.
+func RankBetween(prev, next string) string {
+	if !validRank(prev) {
+		prev = ""
+	}
+	if !validRank(next) {
+		next = ""
+	}
+	// Хвостовые нули next не дают места: между "a" и "a0" строк нет
+	if bound := strings.TrimRight(next, "0"); next != "" && (bound == "" || prev >= bound) {
+		next = ""
+	} else {
+		next = bound
+	}
+	return rankMidpoint(prev, next)
+}
+
+func validRank(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(rankDigits, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// rankMidpoint ищет строку между a и b (b пусто — без верхней границы).
+// a < b, b не оканчивается на "0", оба состоят из символов алфавита.
+func rankMidpoint(a, b string) string {
+	if b != "" {
+		// Общий префикс (недостающие символы a считаем нулями)
+		n := 0
+		for n < len(b) && rankDigitAt(a, n) == rankDigitAt(b, n) {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + rankMidpoint(rest, b[n:])
+		}
+	}
+
+	da := rankDigitAt(a, 0)
+	db := len(rankDigits)
+	if b != "" {
+		db = rankDigitAt(b, 0)
+	}
+	if db-da > 1 {
+		return string(rankDigits[(da+db)/2])
+	}
+	// Соседние символы: укорачиваем b или уходим на разряд глубже после a
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(rankDigits[da]) + rankMidpoint(rest, "")
+}
+
+func rankDigitAt(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	return strings.IndexByte(rankDigits, s[i])
+}
+
+// PlaceRank возвращает ранг задачи, которую ставят в колонку column (упорядоченную SortByRank,
+// без самой задачи) на позицию position; позиция вне колонки означает её конец.
+// Если между соседями места нет — ранги равны, перепутаны или испорчены, — колонка
+// перенумеровывается: rerank содержит новые ранги задач column, иначе он nil.
+func PlaceRank(column []Task, position int) (rank string, rerank map[ident.ID]string) {
+	if position < 0 || position > len(column) {
+		position = len(column)
+	}
+	var prev, next string
+	if position > 0 {
+		prev = column[position-1].Rank
+	}
+	if position < len(column) {
+		next = column[position].Rank
+	}
+	rank = RankBetween(prev, next)
+	if (position == 0 || rank > prev) && (position == len(column) || rank < next) {
+		return rank, nil
+	}
+
+	ranks := spreadRanks(len(column) + 1)
+	rerank = make(map[ident.ID]string, len(column))
+	for i, t := range column {
+		if i < position {
+			rerank[t.ID] = ranks[i]
+		} else {
+			rerank[t.ID] = ranks[i+1]
+		}
+	}
+	return ranks[position], rerank
+}
+
+// spreadRanks возвращает n возрастающих рангов одной длины, равномерно разнесённых по алфавиту,
+// чтобы между любыми соседями осталось место
+func spreadRanks(n int) []string {
+	base := len(rankDigits)
+	width, capacity := 1, base
+	for capacity < 2*(n+1) {
+		width++
+		capacity *= base
+	}
+	// Шаг не меньше 2: ранг, оканчивающийся на "0", можно сдвинуть на единицу без столкновения
+	step := capacity / (n + 1)
+	ranks := make([]string, n)
+	for i := range ranks {
+		v := (i + 1) * step
+		if v%base == 0 {
+			v++
+		}
+		digits := make([]byte, width)
+		for j := width - 1; j >= 0; j-- {
+			digits[j] = rankDigits[v%base]
+			v /= base
+		}
+		ranks[i] = string(digits)
+	}
+	return ranks
+}
@@ -0,0 +1,154 @@
+package project
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"tmv/ident"
+)
+
+func TestRankBetween(t *testing.T) {
+	tests := []struct{ prev, next string }{
+		{"", ""},
+		{"", "i"},
+		{"i", ""},
+		{"a", "b"},
+		{"a", "a1"},
+		{"a", "a01"},
+		{"0", "1"},
+		{"", "01"},
+		{"", "a0"},
+		{"z", ""},
+		{"zz", ""},
+		{"y", "z"},
+		{"az", "b"},
+		{"0i", "1"},
+	}
+	for _, tt := range tests {
+		got := RankBetween(tt.prev, tt.next)
+		if got <= tt.prev || (tt.next != "" && got >= tt.next) {
+			t.Errorf("RankBetween(%q, %q) = %q, not between", tt.prev, tt.next, got)
+		}
+		if strings.HasSuffix(got, "0") {
+			t.Errorf("RankBetween(%q, %q) = %q ends with 0", tt.prev, tt.next, got)
+		}
+	}
+}
+
+func TestRankBetweenNoRoom(t *testing.T) {
+	// Перед "0" и между "a" и "a00" строк нет: ранг ставится после prev, без паники
+	for _, tt := range []struct{ prev, next string }{
+		{"", "0"},
+		{"", "000"},
+		{"a", "a00"},
+		{"b", "a"},
+		{"a", "a"},
+	} {
+		got := RankBetween(tt.prev, tt.next)
+		if got <= tt.prev || !validRank(got) {
+			t.Errorf("RankBetween(%q, %q) = %q, want a valid rank after prev", tt.prev, tt.next, got)
+		}
+	}
+}
+
+func TestRankBetweenInvalidAlphabet(t *testing.T) {
+	for _, tt := range []struct{ prev, next string }{
+		{"-", "0"},
+		{"", "-"},
+		{"A", "B"},
+		{"a", "a~"},
+		{"ж", ""},
+	} {
+		got := RankBetween(tt.prev, tt.next)
+		if got == "" || !validRank(got) {
+			t.Errorf("RankBetween(%q, %q) = %q, want a valid rank", tt.prev, tt.next, got)
+		}
+	}
+}
+
+// Многократные вставки в случайные места колонки сохраняют порядок
+func TestRankBetweenRepeated(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	column := []string{RankBetween("", "")}
+	for i := 0; i < 2000; i++ {
+		pos := rng.Intn(len(column) + 1)
+		var prev, next string
+		if pos > 0 {
+			prev = column[pos-1]
+		}
+		if pos < len(column) {
+			next = column[pos]
+		}
+		r := RankBetween(prev, next)
+		if r <= prev || (next != "" && r >= next) {
+			t.Fatalf("RankBetween(%q, %q) = %q, not between", prev, next, r)
+		}
+		column = append(column[:pos], append([]string{r}, column[pos:]...)...)
+	}
+}
+
+func TestPlaceRank(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranks    []string
+		position int
+		rerank   bool
+	}{
+		{"empty column", nil, 0, false},
+		{"between distinct", []string{"a", "c"}, 1, false},
+		{"end", []string{"a", "c"}, -1, false},
+		{"between tied", []string{"i", "i", "i"}, 1, true},
+		{"before tied", []string{"i", "i"}, 0, false},
+		{"after tied", []string{"i", "i"}, 2, false},
+		{"before trailing zeros", []string{"a", "a00"}, 1, true},
+		{"between unranked", []string{"", "", "i"}, 1, true},
+		{"after invalid alphabet", []string{"A", "a", "b"}, 1, true},
+	}
+	for _, tt := range tests {
+		column := make([]Task, len(tt.ranks))
+		for i, r := range tt.ranks {
+			column[i] = Task{ID: ident.New(), Rank: r}
+		}
+		rank, rerank := PlaceRank(column, tt.position)
+		if (rerank != nil) != tt.rerank {
+			t.Errorf("%s: rerank = %v, want rebalance %t", tt.name, rerank, tt.rerank)
+		}
+
+		// Перемещённая задача встаёт между соседями, а перенумерованная колонка строго возрастает
+		position := tt.position
+		if position < 0 {
+			position = len(column)
+		}
+		var got []string
+		for i, task := range column {
+			if i == position {
+				got = append(got, rank)
+			}
+			r := task.Rank
+			if nr, ok := rerank[task.ID]; ok {
+				r = nr
+			}
+			got = append(got, r)
+		}
+		if position == len(column) {
+			got = append(got, rank)
+		}
+		for i := 1; i < len(got); i++ {
+			if (rerank != nil || i == position || i == position+1) && got[i-1] >= got[i] {
+				t.Errorf("%s: ranks %q are out of order at %d", tt.name, got, i)
+				break
+			}
+		}
+	}
+}
+
+func TestSpreadRanks(t *testing.T) {
+	for _, n := range []int{1, 17, 35, 36, 1000} {
+		ranks := spreadRanks(n)
+		for i, r := range ranks {
+			if !validRank(r) || strings.HasSuffix(r, "0") || (i > 0 && ranks[i-1] >= r) {
+				t.Fatalf("spreadRanks(%d)[%d] = %q: want increasing valid ranks without trailing 0", n, i, r)
+			}
+		}
+	}
+}
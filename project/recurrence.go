@@ -0,0 +1,349 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"tmv/ident"
+)
+
+// Частоты RRULE (RFC 5545), которые мы поддерживаем
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+	FreqYearly  = "YEARLY"
+)
+
+// Recurrence — правило повторения задачи и её место в серии
+type Recurrence struct {
+	Rule       string    `bson:"rule" json:"rule"`             // RRULE, например FREQ=WEEKLY;BYDAY=MO
+	Start      time.Time `bson:"start" json:"start"`           // Опорная дата серии (DTSTART)
+	SeriesID   ident.ID  `bson:"seriesId" json:"seriesId"`     // Первая задача серии
+	Occurrence int       `bson:"occurrence" json:"occurrence"` // Номер вхождения, с единицы
+	Spawned    bool      `bson:"spawned" json:"spawned"`       // Следующее вхождение уже создано
+}
+
+// Rule — разобранное подмножество RRULE: FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT, UNTIL
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+}
+
+// Верхние границы INTERVAL и COUNT: правило приходит от клиента
+const (
+	maxRuleInterval = 1000
+	maxRuleCount    = 1000
+)
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// ParseRule разбирает строку RRULE (с префиксом "RRULE:" или без него)
+func ParseRule(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("empty recurrence rule")
+	}
+
+	r := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("invalid rrule part %q", part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case FreqDaily, FreqWeekly, FreqMonthly, FreqYearly:
+				r.Freq = value
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxRuleInterval {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxRuleCount {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseRuleTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q", value)
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, ok := weekdayCodes[code]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY %q", code)
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "WKST":
+			if value != "MO" {
+				return nil, errors.New("only WKST=MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rrule part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, errors.New("COUNT and UNTIL are mutually exclusive")
+	}
+	return r, nil
+}
+
+func parseRuleTime(v string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", v); err == nil {
+		return t, nil
+	}
+	return time.Parse("20060102", v)
+}
+
+// Next возвращает первое вхождение серии, начатой в start, строго после after.
+// Время суток берётся из start; false — серия закончилась по UNTIL или правилу нечему соответствовать.
+func (r *Rule) Next(start, after time.Time) (time.Time, bool) {
+	if after.Before(start) {
+		after = start.Add(-time.Nanosecond)
+	}
+	after = after.In(start.Location())
+
+	// Перебираем периоды серии (дни, недели, месяцы, годы с шагом INTERVAL), начиная с периода after.
+	// Календарь повторяется за 400 лет, поэтому за цикл без совпадений совпадений уже не будет.
+	first := r.periodIndex(start, after)
+	limit := r.periodCycle()
+	for k := first; k <= first+limit; k++ {
+		for _, day := range r.periodDays(start, k) {
+			if !day.After(after) || !r.matchesDay(start, day) {
+				continue
+			}
+			if !r.Until.IsZero() && day.After(r.Until) {
+				return time.Time{}, false
+			}
+			return day, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// periodIndex — номер периода серии, в который попадает t (отсчёт от периода start)
+func (r *Rule) periodIndex(start, t time.Time) int {
+	var n int
+	switch r.Freq {
+	case FreqDaily:
+		n = civilDays(start, t)
+	case FreqWeekly:
+		n = floorDiv(civilDays(weekStart(start), weekStart(t)), 7)
+	case FreqMonthly:
+		n = (t.Year()-start.Year())*12 + int(t.Month()-start.Month())
+	case FreqYearly:
+		n = t.Year() - start.Year()
+	}
+	if n < 0 {
+		return 0
+	}
+	return floorDiv(n, r.Interval)
+}
+
+// periodCycle — через сколько периодов повторяется календарь (400 лет) при шаге INTERVAL
+func (r *Rule) periodCycle() int {
+	cycle := 0
+	switch r.Freq {
+	case FreqDaily:
+		cycle = 146097
+	case FreqWeekly:
+		// В каждой неделе есть все дни недели
+		return 1
+	case FreqMonthly:
+		cycle = 400 * 12
+	case FreqYearly:
+		cycle = 400
+	}
+	return cycle / gcd(cycle, r.Interval)
+}
+
+// periodDays возвращает по порядку дни k-го периода серии со временем суток из start
+func (r *Rule) periodDays(start time.Time, k int) []time.Time {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+
+	step := k * r.Interval
+	switch r.Freq {
+	case FreqDaily:
+		return []time.Time{at(start.Year(), start.Month(), start.Day()+step)}
+	case FreqWeekly:
+		ws := weekStart(start)
+		days := make([]time.Time, 7)
+		for i := range days {
+			days[i] = at(ws.Year(), ws.Month(), ws.Day()+7*step+i)
+		}
+		return days
+	}
+
+	month := at(start.Year(), start.Month()+time.Month(step), 1)
+	if r.Freq == FreqYearly {
+		month = at(start.Year()+step, start.Month(), 1)
+	}
+	last := time.Date(month.Year(), month.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	days := make([]time.Time, last)
+	for i := range days {
+		days[i] = at(month.Year(), month.Month(), i+1)
+	}
+	return days
+}
+
+// matchesDay проверяет день внутри подходящего периода по BYDAY и BYMONTHDAY
+func (r *Rule) matchesDay(start, day time.Time) bool {
+	switch r.Freq {
+	case FreqDaily:
+		return (len(r.ByDay) == 0 || r.hasWeekday(day)) && (len(r.ByMonthDay) == 0 || r.hasMonthDay(day))
+	case FreqWeekly:
+		if len(r.ByDay) == 0 {
+			return day.Weekday() == start.Weekday()
+		}
+		return r.hasWeekday(day)
+	}
+	return r.matchesDayOfMonth(start, day)
+}
+
+func (r *Rule) matchesDayOfMonth(start, day time.Time) bool {
+	switch {
+	case len(r.ByMonthDay) > 0:
+		return r.hasMonthDay(day) && (len(r.ByDay) == 0 || r.hasWeekday(day))
+	case len(r.ByDay) > 0:
+		return r.hasWeekday(day)
+	}
+	return day.Day() == start.Day()
+}
+
+func (r *Rule) hasWeekday(day time.Time) bool {
+	for _, d := range r.ByDay {
+		if d == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) hasMonthDay(day time.Time) bool {
+	// Отрицательные значения отсчитываются от конца месяца: -1 — последний день
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	for _, n := range r.ByMonthDay {
+		if n == day.Day() || (n < 0 && last+n+1 == day.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+// civilDays — разница в календарных днях без учёта часовых переходов
+func civilDays(a, b time.Time) int {
+	da := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	db := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
+
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7 // понедельник — 0
+	return t.AddDate(0, 0, -offset)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// NextOccurrence строит следующее вхождение повторяющейся задачи.
+// false — у задачи нет правила или серия закончилась по COUNT/UNTIL.
+func (t *Task) NextOccurrence() (*Task, bool) {
+	if t.Recurrence == nil {
+		return nil, false
+	}
+	rule, err := ParseRule(t.Recurrence.Rule)
+	if err != nil {
+		return nil, false
+	}
+	if rule.Count > 0 && t.Recurrence.Occurrence >= rule.Count {
+		return nil, false
+	}
+
+	// Следующий срок отсчитывается от текущего срока, а при его отсутствии — от опорной даты серии
+	after := t.Deadline
+	if after.IsZero() {
+		after = t.Recurrence.Start
+	}
+	deadline, ok := rule.Next(t.Recurrence.Start, after)
+	if !ok {
+		return nil, false
+	}
+
+	// Новое вхождение начинает в исходном статусе серии
+	status := t.Status
+	if len(t.StatusHistory) > 0 {
+		status = t.StatusHistory[0].Status
+	}
+
+	next := NewTask(t.ProjectID, t.Name, t.Description, t.Priority, t.Author, t.Responsible, t.Performers, deadline, t.Guests, status)
+	next.Estimate = t.Estimate
+	next.Recurrence = &Recurrence{
+		Rule:       t.Recurrence.Rule,
+		Start:      t.Recurrence.Start,
+		SeriesID:   t.Recurrence.SeriesID,
+		Occurrence: t.Recurrence.Occurrence + 1,
+	}
+	return next, true
+}
+
+// RecurrenceDue сообщает, пора ли создавать следующее вхождение:
+// текущее завершено или его срок уже наступил
+func (t *Task) RecurrenceDue(now time.Time) bool {
+	if t.Recurrence == nil || t.Recurrence.Spawned {
+		return false
+	}
+	return IsTerminal(t.Status) || (!t.Deadline.IsZero() && !now.Before(t.Deadline))
+}
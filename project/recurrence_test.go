@@ -0,0 +1,128 @@
+package project
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	valid := []string{
+		"FREQ=DAILY",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR",
+		"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=1,-1",
+		"FREQ=YEARLY;COUNT=5",
+		"FREQ=DAILY;UNTIL=20300101",
+		"FREQ=WEEKLY;INTERVAL=1000;COUNT=1000;WKST=MO",
+	}
+	for _, s := range valid {
+		if _, err := ParseRule(s); err != nil {
+			t.Errorf("ParseRule(%q): %v", s, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=MONTHLY;INTERVAL=1001",
+		"FREQ=MONTHLY;INTERVAL=1000000;BYMONTHDAY=31;BYDAY=MO",
+		"FREQ=DAILY;COUNT=1001",
+		"FREQ=DAILY;COUNT=2;UNTIL=20300101",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=WEEKLY;WKST=SU",
+		"FREQ=DAILY;BYHOUR=9",
+	}
+	for _, s := range invalid {
+		if _, err := ParseRule(s); err == nil {
+			t.Errorf("ParseRule(%q): expected error", s)
+		}
+	}
+}
+
+func TestRuleNext(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 9, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		rule  string
+		start time.Time
+		after time.Time
+		want  time.Time
+	}{
+		{"FREQ=DAILY", date(2024, 1, 1), date(2024, 1, 1), date(2024, 1, 2)},
+		{"FREQ=DAILY;INTERVAL=3", date(2024, 1, 1), date(2024, 1, 5), date(2024, 1, 7)},
+		// До начала серии первое вхождение — сама опорная дата
+		{"FREQ=DAILY", date(2024, 1, 1), date(2023, 6, 1), date(2024, 1, 1)},
+		{"FREQ=DAILY;BYDAY=SA,SU", date(2024, 1, 1), date(2024, 1, 1), date(2024, 1, 6)},
+		{"FREQ=WEEKLY", date(2024, 1, 3), date(2024, 1, 3), date(2024, 1, 10)},
+		{"FREQ=WEEKLY;BYDAY=MO,FR", date(2024, 1, 1), date(2024, 1, 2), date(2024, 1, 5)},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO", date(2024, 1, 1), date(2024, 1, 1), date(2024, 1, 15)},
+		{"FREQ=MONTHLY", date(2024, 1, 15), date(2024, 1, 15), date(2024, 2, 15)},
+		// 31-го числа нет в феврале и апреле
+		{"FREQ=MONTHLY", date(2024, 1, 31), date(2024, 1, 31), date(2024, 3, 31)},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", date(2024, 1, 31), date(2024, 1, 31), date(2024, 2, 29)},
+		{"FREQ=MONTHLY;INTERVAL=3;BYDAY=MO", date(2024, 1, 1), date(2024, 1, 29), date(2024, 4, 1)},
+		{"FREQ=YEARLY", date(2024, 2, 29), date(2024, 2, 29), date(2028, 2, 29)},
+		{"FREQ=YEARLY;INTERVAL=1000", date(2024, 2, 29), date(2024, 2, 29), date(3024, 2, 29)},
+		{"FREQ=MONTHLY;INTERVAL=1000;BYMONTHDAY=31;BYDAY=MO", date(2024, 1, 1), date(2024, 1, 1), date(2524, 1, 31)},
+	}
+	for _, tt := range tests {
+		r, err := ParseRule(tt.rule)
+		if err != nil {
+			t.Fatalf("ParseRule(%q): %v", tt.rule, err)
+		}
+		got, ok := r.Next(tt.start, tt.after)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%s: Next(%v, %v) = %v, %v; want %v", tt.rule, tt.start, tt.after, got, ok, tt.want)
+		}
+	}
+}
+
+func TestRuleNextEnds(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	r, _ := ParseRule("FREQ=WEEKLY;UNTIL=20240110")
+	if got, ok := r.Next(start, start.AddDate(0, 0, 7)); ok {
+		t.Errorf("UNTIL: got %v, want end of series", got)
+	}
+
+	// Правилу не соответствует ни один день: поиск должен завершиться, а не крутиться
+	for _, s := range []string{
+		"FREQ=DAILY;INTERVAL=7;BYDAY=TU",
+		"FREQ=MONTHLY;BYMONTHDAY=30;BYDAY=MO,TU,WE,TH,FR,SA,SU;INTERVAL=12",
+		"FREQ=YEARLY;INTERVAL=4;BYMONTHDAY=30",
+	} {
+		r, err := ParseRule(s)
+		if err != nil {
+			t.Fatalf("ParseRule(%q): %v", s, err)
+		}
+		begin := time.Now()
+		start := time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC)
+		if got, ok := r.Next(start, start); ok {
+			t.Errorf("%s: got %v, want no occurrence", s, got)
+		}
+		if d := time.Since(begin); d > 2*time.Second {
+			t.Errorf("%s: Next took %v", s, d)
+		}
+	}
+}
+
+func TestNextOccurrenceCount(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	task := Task{
+		Deadline:   start,
+		Status:     "todo",
+		Recurrence: &Recurrence{Rule: "FREQ=DAILY;COUNT=2", Start: start, Occurrence: 1},
+	}
+
+	next, ok := task.NextOccurrence()
+	if !ok || !next.Deadline.Equal(start.AddDate(0, 0, 1)) || next.Recurrence.Occurrence != 2 {
+		t.Fatalf("first NextOccurrence = %+v, %v", next, ok)
+	}
+	if _, ok := next.NextOccurrence(); ok {
+		t.Error("series should end after COUNT occurrences")
+	}
+}
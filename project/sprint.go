@@ -0,0 +1,60 @@
+package project
+
+import (
+	"time"
+	"tmv/ident"
+)
+
+// Статусы спринта
+const (
+	SprintPlanned = "planned"
+	SprintActive  = "active"
+	SprintClosed  = "closed"
+)
+
+type Sprint struct {
+	Id           ident.ID  `bson:"_id,omitempty" json:"id"`
+	ProjectID    ident.ID  `bson:"projectId" json:"projectId"`       // Идентификатор проекта
+	Name         string    `bson:"name" json:"name"`                 // Название спринта или вехи
+	Goal         string    `bson:"goal" json:"goal"`                 // Цель спринта
+	Start        time.Time `bson:"start" json:"start"`               // Плановая дата начала
+	End          time.Time `bson:"end" json:"end"`                   // Плановая дата окончания
+	Status       string    `bson:"status" json:"status"`             // planned, active или closed
+	DateCreation time.Time `bson:"dateCreation" json:"dateCreation"` // Дата создания
+	StartedAt    time.Time `bson:"startedAt" json:"startedAt"`       // Фактическое начало
+	ClosedAt     time.Time `bson:"closedAt" json:"closedAt"`         // Фактическое закрытие
+	CarriedOver  int64     `bson:"carriedOver" json:"carriedOver"`   // Сколько незавершённых задач перенесено при закрытии
+}
+
+func NewSprint(projectID ident.ID, name, goal string, start, end time.Time) *Sprint {
+	return &Sprint{
+		Id:           ident.New(),
+		ProjectID:    projectID,
+		Name:         name,
+		Goal:         goal,
+		Start:        start,
+		End:          end,
+		Status:       SprintPlanned,
+		DateCreation: time.Now(),
+	}
+}
+
+// Period возвращает период спринта для отчётов: фактические даты, если они есть, иначе плановые.
+// Незакрытый спринт без даты окончания и активный спринт, чей срок ещё не наступил, длятся до now.
+// false — у спринта нет даты начала, и период построить не из чего.
+func (s *Sprint) Period(now time.Time) (from, to time.Time, ok bool) {
+	from, to = s.StartedAt, s.ClosedAt
+	if from.IsZero() {
+		from = s.Start
+	}
+	if from.IsZero() {
+		return time.Time{}, time.Time{}, false
+	}
+	if to.IsZero() {
+		to = s.End
+	}
+	if to.IsZero() || (s.Status == SprintActive && now.Before(to)) {
+		to = now
+	}
+	return from, to, true
+}
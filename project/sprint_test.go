@@ -0,0 +1,33 @@
+package project
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSprintPeriod(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	start, end := now.Add(-5*day), now.Add(5*day)
+
+	tests := []struct {
+		name     string
+		sprint   Sprint
+		from, to time.Time
+		ok       bool
+	}{
+		{"planned", Sprint{Status: SprintPlanned, Start: start, End: end}, start, end, true},
+		{"active before end", Sprint{Status: SprintActive, Start: start, End: end, StartedAt: start.Add(day)}, start.Add(day), now, true},
+		{"active past end", Sprint{Status: SprintActive, Start: start, End: now.Add(-day)}, start, now.Add(-day), true},
+		{"closed", Sprint{Status: SprintClosed, Start: start, End: end, StartedAt: start, ClosedAt: now.Add(-day)}, start, now.Add(-day), true},
+		{"no end", Sprint{Status: SprintPlanned, Start: start}, start, now, true},
+		{"no start", Sprint{Status: SprintPlanned, End: end}, time.Time{}, time.Time{}, false},
+		{"no dates", Sprint{Status: SprintPlanned}, time.Time{}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		from, to, ok := tt.sprint.Period(now)
+		if ok != tt.ok || !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("%s: Period = %v, %v, %t; want %v, %v, %t", tt.name, from, to, ok, tt.from, tt.to, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package project
+
+import "strings"
+
+// TerminalStatuses — статусы, в которых задача считается завершённой
+var TerminalStatuses = []string{"done", "closed", "completed", "cancelled"}
+
+// IsTerminal сообщает, завершена ли задача с данным статусом (без учёта регистра)
+func IsTerminal(status string) bool {
+	for _, s := range TerminalStatuses {
+		if strings.EqualFold(strings.TrimSpace(status), s) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,28 +2,65 @@ package project
 
 import (
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"tmv/ident"
 )
 
 type Task struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"` // Уникальный идентификатор задачи
-	ProjectID    primitive.ObjectID `bson:"projectId" json:"projectId"`        // Идентификатор проекта
-	Name         string             `bson:"name" json:"name"`                  // Название задачи
-	Description  string             `bson:"description" json:"description"`    // Описание задачи
-	Priority     int                `bson:"priority" json:"priority"`          // Приоритет задачи (от 1 до 10)
-	Author       string             `bson:"author" json:"author"`              // Автор
-	Responsible  string             `bson:"responsible" json:"responsible"`    // Ответственный
-	Performers   string             `bson:"performers" json:"performers"`      // Исполнители
-	DateCreation time.Time          `bson:"dateCreation" json:"dateCreation"`  // Дата создания
-	Deadline     time.Time          `bson:"deadline" json:"deadline"`          // Планируемая дата окончания
-	Guests       string             `bson:"guests" json:"guests"`              // Гости
-	Status       string             `bson:"status" json:"status"`              // Статус задачи
+	ID           ident.ID  `bson:"_id,omitempty" json:"id,omitempty"` // Уникальный идентификатор задачи
+	ProjectID    ident.ID  `bson:"projectId" json:"projectId"`        // Идентификатор проекта
+	Name         string    `bson:"name" json:"name"`                  // Название задачи
+	Description  string    `bson:"description" json:"description"`    // Описание задачи
+	Priority     int       `bson:"priority" json:"priority"`          // Приоритет задачи (от 1 до 10)
+	Author       string    `bson:"author" json:"author"`              // Автор
+	Responsible  string    `bson:"responsible" json:"responsible"`    // Ответственный
+	Performers   string    `bson:"performers" json:"performers"`      // Исполнители
+	DateCreation time.Time `bson:"dateCreation" json:"dateCreation"`  // Дата создания
+	Deadline     time.Time `bson:"deadline" json:"deadline"`          // Планируемая дата окончания
+	Guests       string    `bson:"guests" json:"guests"`              // Гости
+	Status       string    `bson:"status" json:"status"`              // Статус задачи
+	Rank         string    `bson:"rank" json:"rank"`                  // Позиция задачи в колонке доски
+	SprintID     ident.ID  `bson:"sprintId" json:"sprintId"`          // Спринт или веха (нулевой id — бэклог)
+	Estimate     float64   `bson:"estimate" json:"estimate"`          // Исходная оценка в часах (необязательная)
+	Remaining    float64   `bson:"remaining" json:"remaining"`        // Оставшаяся оценка в часах
+
+	StatusHistory []StatusChange `bson:"statusHistory" json:"statusHistory"`               // Смены статуса, ведёт хранилище
+	Recurrence    *Recurrence    `bson:"recurrence,omitempty" json:"recurrence,omitempty"` // Правило повторения
+}
+
+// StatusChange — момент перехода задачи в статус
+type StatusChange struct {
+	Status string    `bson:"status" json:"status"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// CompletedAt возвращает момент последнего перехода в завершающий статус,
+// если задача завершена на момент at. Для задач без истории используется DateCreation.
+func (t *Task) CompletedAt(at time.Time) (time.Time, bool) {
+	status, since := t.StatusAt(at)
+	if !IsTerminal(status) {
+		return time.Time{}, false
+	}
+	return since, true
+}
+
+// StatusAt возвращает статус задачи на момент at и время, с которого он действует
+func (t *Task) StatusAt(at time.Time) (string, time.Time) {
+	if len(t.StatusHistory) == 0 {
+		return t.Status, t.DateCreation
+	}
+	status, since := "", time.Time{}
+	for _, ch := range t.StatusHistory {
+		if ch.At.After(at) {
+			break
+		}
+		status, since = ch.Status, ch.At
+	}
+	return status, since
 }
 
-func NewTask(projectID primitive.ObjectID, name, description string, priority int, author, responsible, performers string, deadline time.Time, guests, status string) *Task {
+func NewTask(projectID ident.ID, name, description string, priority int, author, responsible, performers string, deadline time.Time, guests, status string) *Task {
 	return &Task{
-		ID:           primitive.NewObjectID(),
+		ID:           ident.New(),
 		ProjectID:    projectID,
 		Name:         name,
 		Description:  description,
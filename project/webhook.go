@@ -0,0 +1,90 @@
+package project
+
+import (
+	"strings"
+	"time"
+	"tmv/ident"
+)
+
+// События, на которые можно подписать webhook
+const (
+	EventTaskCreated    = "task.created"
+	EventTaskUpdated    = "task.updated"
+	EventTaskDeleted    = "task.deleted"
+	EventProjectCreated = "project.created"
+	EventProjectUpdated = "project.updated"
+	EventProjectDeleted = "project.deleted"
+)
+
+var webhookEvents = []string{
+	EventTaskCreated, EventTaskUpdated, EventTaskDeleted,
+	EventProjectCreated, EventProjectUpdated, EventProjectDeleted,
+}
+
+// Статусы доставки webhook
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook — подписка проекта на события
+type Webhook struct {
+	Id           ident.ID  `bson:"_id,omitempty" json:"id"`
+	ProjectID    ident.ID  `bson:"projectId" json:"projectId"`       // Идентификатор проекта
+	URL          string    `bson:"url" json:"url"`                   // Куда отправлять
+	Secret       string    `bson:"secret" json:"secret,omitempty"`   // Ключ HMAC, показывается только при создании
+	Events       []string  `bson:"events" json:"events"`             // Типы событий: task.created, task.*, *
+	Active       bool      `bson:"active" json:"active"`             // Выключенные подписки не получают событий
+	DateCreation time.Time `bson:"dateCreation" json:"dateCreation"` // Дата создания
+	// Проект удалён; подписка живёт, пока не доставлены её последние события, включая project.deleted
+	ProjectDeleted bool `bson:"projectDeleted,omitempty" json:"-"`
+}
+
+// WebhookDelivery — одна доставка события одной подписке вместе с журналом попыток
+type WebhookDelivery struct {
+	Id           ident.ID          `bson:"_id,omitempty" json:"id"`
+	WebhookID    ident.ID          `bson:"webhookId" json:"webhookId"`       // Подписка
+	ProjectID    ident.ID          `bson:"projectId" json:"projectId"`       // Идентификатор проекта
+	EventID      string            `bson:"eventId" json:"eventId"`           // Общий для всех доставок одного события
+	Event        string            `bson:"event" json:"event"`               // Тип события
+	Payload      string            `bson:"payload" json:"payload"`           // Тело запроса как есть
+	Status       string            `bson:"status" json:"status"`             // pending, succeeded или failed
+	Attempts     []DeliveryAttempt `bson:"attempts" json:"attempts"`         // Журнал попыток
+	NextAttempt  time.Time         `bson:"nextAttempt" json:"nextAttempt"`   // Когда пробовать снова
+	DateCreation time.Time         `bson:"dateCreation" json:"dateCreation"` // Дата создания
+	Trace        map[string]string `bson:"trace,omitempty" json:"-"`         // traceparent операции, породившей доставку
+}
+
+type DeliveryAttempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"statusCode" json:"statusCode"` // 0 — ответа не было
+	Error      string    `bson:"error" json:"error"`
+	DurationMs int64     `bson:"durationMs" json:"durationMs"`
+}
+
+// ValidWebhookEvent проверяет тип события или шаблон подписки
+func ValidWebhookEvent(pattern string) bool {
+	if pattern == "*" || pattern == "task.*" || pattern == "project.*" {
+		return true
+	}
+	for _, e := range webhookEvents {
+		if e == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Wants сообщает, подписан ли webhook на событие
+func (w *Webhook) Wants(event string) bool {
+	if !w.Active {
+		return false
+	}
+	for _, p := range w.Events {
+		if p == "*" || p == event || (strings.HasSuffix(p, ".*") && strings.HasPrefix(event, strings.TrimSuffix(p, "*"))) {
+			return true
+		}
+	}
+	return false
+}
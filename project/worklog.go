@@ -0,0 +1,40 @@
+package project
+
+import (
+	"time"
+	"tmv/ident"
+)
+
+// Worklog — запись о затраченном времени. Запущенный таймер — запись с Running и нулевым Ended.
+type Worklog struct {
+	Id           ident.ID  `bson:"_id,omitempty" json:"id"`
+	ProjectID    ident.ID  `bson:"projectId" json:"projectId"`       // Идентификатор проекта
+	TaskID       ident.ID  `bson:"taskId" json:"taskId"`             // Идентификатор задачи
+	UserID       ident.ID  `bson:"userId" json:"userId"`             // Кто работал
+	Started      time.Time `bson:"started" json:"started"`           // Начало работы
+	Ended        time.Time `bson:"ended" json:"ended"`               // Окончание работы
+	Duration     int64     `bson:"duration" json:"duration"`         // Длительность в секундах
+	Note         string    `bson:"note" json:"note"`                 // Комментарий
+	Running      bool      `bson:"running" json:"running"`           // Таймер ещё идёт
+	Consumed     float64   `bson:"consumed" json:"consumed"`         // Сколько часов запись списала с оставшейся оценки задачи
+	DateCreation time.Time `bson:"dateCreation" json:"dateCreation"` // Дата создания записи
+}
+
+func NewWorklog(projectID, taskID, userID ident.ID, started time.Time, duration time.Duration, note string) *Worklog {
+	return &Worklog{
+		Id:           ident.New(),
+		ProjectID:    projectID,
+		TaskID:       taskID,
+		UserID:       userID,
+		Started:      started,
+		Ended:        started.Add(duration),
+		Duration:     int64(duration / time.Second),
+		Note:         note,
+		DateCreation: time.Now(),
+	}
+}
+
+// Hours возвращает длительность записи в часах
+func (w *Worklog) Hours() float64 {
+	return float64(w.Duration) / 3600
+}
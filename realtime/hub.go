@@ -0,0 +1,170 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+)
+
+// Hub раздаёт события проекта открытым SSE- и WebSocket-соединениям.
+// Последние History событий проекта хранятся в памяти для продолжения по Last-Event-ID, пока
+// у проекта есть подписчики и ещё IdleTTL после ухода последнего: дольше отключённый клиент
+// перечитывает состояние целиком.
+type Hub struct {
+	History int           // Сколько последних событий проекта помнить
+	Buffer  int           // Очередь одного подписчика; медленный подписчик отключается
+	IdleTTL time.Duration // Сколько хранить историю проекта без подписчиков
+
+	mu        sync.Mutex
+	projects  map[ident.ID]*room
+	lastSweep time.Time
+	closed    bool
+}
+
+type room struct {
+	history   []*event.Event
+	subs      map[*Subscription]struct{}
+	idleSince time.Time // Когда ушёл последний подписчик
+}
+
+// Subscription — подписка одного соединения. C закрывается, когда хаб отключает подписчика.
+type Subscription struct {
+	C <-chan *event.Event
+
+	c         chan *event.Event
+	projectId ident.ID
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		History:  256,
+		Buffer:   64,
+		IdleTTL:  10 * time.Minute,
+		projects: make(map[ident.ID]*room),
+	}
+}
+
+// HandleEvent — синхронный подписчик шины событий
+func (h *Hub) HandleEvent(e *event.Event) error {
+	if e.ProjectID.IsZero() {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	now := time.Now()
+	h.evictIdle(now)
+
+	// История нужна только для переподключения, поэтому проекты без комнаты её не копят
+	r, ok := h.projects[e.ProjectID]
+	if !ok {
+		return nil
+	}
+	r.history = append(r.history, e)
+	if len(r.history) > h.History {
+		r.history = r.history[len(r.history)-h.History:]
+	}
+
+	for sub := range r.subs {
+		select {
+		case sub.c <- e:
+		default:
+			// Не ждём медленного клиента: он переподключится с Last-Event-ID
+			r.drop(sub, now)
+		}
+	}
+	return nil
+}
+
+// Subscribe подписывает на события проекта. Если задан lastEventId, возвращает события после него;
+// false — такого события уже нет в истории и клиенту нужно перечитать состояние целиком.
+func (h *Hub) Subscribe(projectId ident.ID, lastEventId string) (*Subscription, []*event.Event, bool) {
+	c := make(chan *event.Event, h.Buffer)
+	sub := &Subscription{C: c, c: c, projectId: projectId}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c)
+		return sub, nil, true
+	}
+	h.evictIdle(time.Now())
+
+	r := h.room(projectId)
+	r.subs[sub] = struct{}{}
+
+	if lastEventId == "" {
+		return sub, nil, true
+	}
+	for i := len(r.history) - 1; i >= 0; i-- {
+		if r.history[i].ID.Hex() == lastEventId {
+			backlog := make([]*event.Event, len(r.history)-i-1)
+			copy(backlog, r.history[i+1:])
+			return sub, backlog, true
+		}
+	}
+	return sub, nil, false
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.projects[sub.projectId]
+	if !ok {
+		return
+	}
+	if _, ok := r.subs[sub]; ok {
+		r.drop(sub, time.Now())
+	}
+}
+
+// Close отключает всех подписчиков, чтобы открытые потоки не задерживали остановку сервера
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, r := range h.projects {
+		for sub := range r.subs {
+			delete(r.subs, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// evictIdle удаляет комнаты, оставшиеся без подписчиков дольше IdleTTL.
+// Все комнаты обходятся не чаще четырёх раз за IdleTTL.
+func (h *Hub) evictIdle(now time.Time) {
+	if now.Sub(h.lastSweep) < h.IdleTTL/4 {
+		return
+	}
+	h.lastSweep = now
+	for id, r := range h.projects {
+		if len(r.subs) == 0 && now.Sub(r.idleSince) >= h.IdleTTL {
+			delete(h.projects, id)
+		}
+	}
+}
+
+func (h *Hub) room(projectId ident.ID) *room {
+	r, ok := h.projects[projectId]
+	if !ok {
+		r = &room{subs: make(map[*Subscription]struct{})}
+		h.projects[projectId] = r
+	}
+	return r
+}
+
+// drop отключает подписчика; с уходом последнего начинается отсчёт IdleTTL
+func (r *room) drop(sub *Subscription, now time.Time) {
+	delete(r.subs, sub)
+	close(sub.c)
+	if len(r.subs) == 0 {
+		r.idleSince = now
+	}
+}
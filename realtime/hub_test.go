@@ -0,0 +1,62 @@
+package realtime
+
+import (
+	"testing"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+)
+
+func TestHubResumesFromHistory(t *testing.T) {
+	h := NewHub()
+	projectId := ident.New()
+	sub, _, _ := h.Subscribe(projectId, "")
+
+	first := event.New("task.created", projectId, nil)
+	second := event.New("task.updated", projectId, nil)
+	for _, e := range []*event.Event{first, second} {
+		if err := h.HandleEvent(e); err != nil {
+			t.Fatalf("HandleEvent: %v", err)
+		}
+	}
+	h.Unsubscribe(sub)
+
+	// Переподключение до истечения IdleTTL продолжает с Last-Event-ID
+	sub, backlog, ok := h.Subscribe(projectId, first.ID.Hex())
+	if !ok || len(backlog) != 1 || backlog[0] != second {
+		t.Fatalf("Subscribe after reconnect = %v, %v; want [%s]", backlog, ok, second.ID.Hex())
+	}
+	h.Unsubscribe(sub)
+}
+
+func TestHubEvictsIdleRooms(t *testing.T) {
+	h := NewHub()
+	h.IdleTTL = time.Minute
+	idle, busy := ident.New(), ident.New()
+
+	sub, _, _ := h.Subscribe(idle, "")
+	last := event.New("task.created", idle, nil)
+	h.HandleEvent(last)
+	h.Unsubscribe(sub)
+	h.Subscribe(busy, "")
+
+	// События проектов без подписчиков не заводят комнат
+	h.HandleEvent(event.New("task.created", ident.New(), nil))
+	if n := len(h.projects); n != 2 {
+		t.Fatalf("rooms = %d, want 2", n)
+	}
+
+	h.mu.Lock()
+	h.evictIdle(time.Now().Add(2 * time.Minute))
+	_, idleKept := h.projects[idle]
+	_, busyKept := h.projects[busy]
+	h.mu.Unlock()
+	if idleKept || !busyKept {
+		t.Errorf("after IdleTTL: idle room kept = %v, busy room kept = %v; want false, true", idleKept, busyKept)
+	}
+
+	// Вытесненная история не найдена: клиент перечитывает состояние целиком
+	if _, _, ok := h.Subscribe(idle, last.ID.Hex()); ok {
+		t.Error("Subscribe with Last-Event-ID after eviction: want false")
+	}
+}
@@ -0,0 +1,80 @@
+package report
+
+import (
+	"strconv"
+	"time"
+	"tmv/project"
+)
+
+// BurnPoint — точка burndown/burnup на момент Date
+type BurnPoint struct {
+	Date      time.Time `json:"date"`
+	Scope     int       `json:"scope"`     // Задач существует (линия объёма burnup)
+	Completed int       `json:"completed"` // Из них завершено
+	Remaining int       `json:"remaining"` // Осталось (burndown)
+	Ideal     float64   `json:"ideal"`     // Идеальная линия burndown
+}
+
+// Burndown строит ряд от from до to с шагом step. Последняя точка всегда приходится на to.
+func Burndown(tasks []project.Task, from, to time.Time, step time.Duration) []BurnPoint {
+	if step <= 0 || to.Before(from) {
+		return []BurnPoint{}
+	}
+	if n := to.Sub(from) / step; n >= MaxPoints {
+		step = to.Sub(from) / (MaxPoints - 1)
+	}
+
+	var points []BurnPoint
+	for at := from; ; at = at.Add(step) {
+		if at.After(to) {
+			at = to
+		}
+		points = append(points, burnPointAt(tasks, at))
+		if !at.Before(to) {
+			break
+		}
+	}
+
+	// Идеальная линия: от остатка в начале периода до нуля в конце
+	start := float64(points[0].Remaining)
+	total := to.Sub(from).Seconds()
+	for i := range points {
+		if total == 0 {
+			points[i].Ideal = 0
+			continue
+		}
+		done := points[i].Date.Sub(from).Seconds() / total
+		points[i].Ideal = round(start * (1 - done))
+	}
+	return points
+}
+
+func burnPointAt(tasks []project.Task, at time.Time) BurnPoint {
+	p := BurnPoint{Date: at}
+	for i := range tasks {
+		if tasks[i].DateCreation.After(at) {
+			continue
+		}
+		p.Scope++
+		if _, ok := tasks[i].CompletedAt(at); ok {
+			p.Completed++
+		}
+	}
+	p.Remaining = p.Scope - p.Completed
+	return p
+}
+
+// BurndownCSV возвращает строки CSV вместе с заголовком
+func BurndownCSV(points []BurnPoint) [][]string {
+	rows := [][]string{{"date", "scope", "completed", "remaining", "ideal"}}
+	for _, p := range points {
+		rows = append(rows, []string{
+			formatTime(p.Date),
+			strconv.Itoa(p.Scope),
+			strconv.Itoa(p.Completed),
+			strconv.Itoa(p.Remaining),
+			formatFloat(p.Ideal),
+		})
+	}
+	return rows
+}
@@ -0,0 +1,74 @@
+package report
+
+import (
+	"sort"
+	"strconv"
+	"time"
+	"tmv/project"
+)
+
+type CycleTime struct {
+	LeadTime  Percentiles            `json:"leadTime"`  // От создания до завершения
+	CycleTime Percentiles            `json:"cycleTime"` // От первой смены статуса до завершения
+	ByStatus  map[string]Percentiles `json:"byStatus"`  // Время пребывания в каждом статусе
+}
+
+// NewCycleTime считает длительности по истории статусов. В ByStatus попадают
+// только завершившиеся отрезки, текущий статус задачи не учитывается.
+func NewCycleTime(tasks []project.Task) CycleTime {
+	var lead, cycle []time.Duration
+	inStatus := make(map[string][]time.Duration)
+
+	for i := range tasks {
+		history := tasks[i].StatusHistory
+		for j := 0; j+1 < len(history); j++ {
+			inStatus[history[j].Status] = append(inStatus[history[j].Status], history[j+1].At.Sub(history[j].At))
+		}
+
+		doneAt, ok := tasks[i].CompletedAt(time.Now())
+		if !ok {
+			continue
+		}
+		lead = append(lead, doneAt.Sub(tasks[i].DateCreation))
+		if len(history) > 1 {
+			cycle = append(cycle, doneAt.Sub(history[1].At))
+		}
+	}
+
+	ct := CycleTime{
+		LeadTime:  NewPercentiles(lead),
+		CycleTime: NewPercentiles(cycle),
+		ByStatus:  make(map[string]Percentiles, len(inStatus)),
+	}
+	for status, durations := range inStatus {
+		ct.ByStatus[status] = NewPercentiles(durations)
+	}
+	return ct
+}
+
+// CycleTimeCSV возвращает строки CSV вместе с заголовком, длительности в часах
+func CycleTimeCSV(ct CycleTime) [][]string {
+	rows := [][]string{{"metric", "count", "p50", "p75", "p90", "p95", "max"}}
+	row := func(name string, p Percentiles) []string {
+		return []string{
+			name,
+			strconv.Itoa(p.Count),
+			formatFloat(p.P50),
+			formatFloat(p.P75),
+			formatFloat(p.P90),
+			formatFloat(p.P95),
+			formatFloat(p.Max),
+		}
+	}
+	rows = append(rows, row("leadTime", ct.LeadTime), row("cycleTime", ct.CycleTime))
+
+	statuses := make([]string, 0, len(ct.ByStatus))
+	for s := range ct.ByStatus {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	for _, s := range statuses {
+		rows = append(rows, row("status:"+s, ct.ByStatus[s]))
+	}
+	return rows
+}
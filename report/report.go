@@ -0,0 +1,64 @@
+package report
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Максимальное число точек во временном ряду
+const MaxPoints = 1000
+
+// Percentiles — распределение длительностей в часах
+type Percentiles struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50"`
+	P75   float64 `json:"p75"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	Max   float64 `json:"max"`
+}
+
+// NewPercentiles считает перцентили методом ближайшего ранга
+func NewPercentiles(durations []time.Duration) Percentiles {
+	if len(durations) == 0 {
+		return Percentiles{}
+	}
+	hours := make([]float64, len(durations))
+	for i, d := range durations {
+		hours[i] = d.Hours()
+	}
+	sort.Float64s(hours)
+
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p/100*float64(len(hours)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return round(hours[i])
+	}
+	return Percentiles{
+		Count: len(hours),
+		P50:   rank(50),
+		P75:   rank(75),
+		P90:   rank(90),
+		P95:   rank(95),
+		Max:   round(hours[len(hours)-1]),
+	}
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
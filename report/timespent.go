@@ -0,0 +1,35 @@
+package report
+
+import (
+	"strconv"
+	"tmv/ident"
+)
+
+// TimeSpent — затраченное время одного пользователя на одну задачу
+type TimeSpent struct {
+	UserID    ident.ID `bson:"userId" json:"userId"`
+	UserName  string   `bson:"userName" json:"userName"`
+	ProjectID ident.ID `bson:"projectId" json:"projectId"`
+	TaskID    ident.ID `bson:"taskId" json:"taskId"`
+	TaskName  string   `bson:"taskName" json:"taskName"`
+	Seconds   int64    `bson:"seconds" json:"seconds"`
+	Hours     float64  `bson:"-" json:"hours"`
+	Entries   int      `bson:"entries" json:"entries"` // Число записей журнала
+}
+
+// TimeSpentCSV возвращает строки CSV вместе с заголовком
+func TimeSpentCSV(rows []TimeSpent) [][]string {
+	out := [][]string{{"userId", "userName", "projectId", "taskId", "taskName", "hours", "entries"}}
+	for _, r := range rows {
+		out = append(out, []string{
+			r.UserID.Hex(),
+			r.UserName,
+			r.ProjectID.Hex(),
+			r.TaskID.Hex(),
+			r.TaskName,
+			formatFloat(round(r.Hours)),
+			strconv.Itoa(r.Entries),
+		})
+	}
+	return out
+}
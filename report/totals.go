@@ -0,0 +1,8 @@
+package report
+
+// Totals — сводные показатели по всем проектам
+type Totals struct {
+	OpenTasks        int64            `json:"openTasks"`
+	OverdueTasks     int64            `json:"overdueTasks"`
+	ProjectsByStatus map[string]int64 `json:"projectsByStatus"`
+}
@@ -0,0 +1,84 @@
+package report
+
+import (
+	"sort"
+	"strconv"
+	"time"
+	"tmv/project"
+)
+
+// SprintVelocity — результат одного закрытого спринта
+type SprintVelocity struct {
+	SprintID  string    `json:"sprintId"`
+	Name      string    `json:"name"`
+	Start     time.Time `json:"start"`
+	ClosedAt  time.Time `json:"closedAt"`
+	Committed int64     `json:"committed"` // Завершено плюс перенесено при закрытии
+	Completed int64     `json:"completed"`
+}
+
+type Velocity struct {
+	Sprints []SprintVelocity `json:"sprints"`
+	Average float64          `json:"average"` // Среднее число завершённых задач за спринт
+}
+
+// NewVelocity считает скорость по последним last закрытым спринтам (0 — по всем).
+// Завершённые задачи остаются в своём спринте, незавершённые при закрытии уходят из него.
+func NewVelocity(sprints []project.Sprint, tasks []project.Task, last int) Velocity {
+	completed := make(map[string]int64)
+	for _, t := range tasks {
+		if !t.SprintID.IsZero() && project.IsTerminal(t.Status) {
+			completed[t.SprintID.Hex()]++
+		}
+	}
+
+	var closed []project.Sprint
+	for _, s := range sprints {
+		if s.Status == project.SprintClosed {
+			closed = append(closed, s)
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool { return closed[i].ClosedAt.Before(closed[j].ClosedAt) })
+	if last > 0 && len(closed) > last {
+		closed = closed[len(closed)-last:]
+	}
+
+	v := Velocity{Sprints: make([]SprintVelocity, 0, len(closed))}
+	var sum int64
+	for _, s := range closed {
+		done := completed[s.Id.Hex()]
+		start := s.StartedAt
+		if start.IsZero() {
+			start = s.Start
+		}
+		v.Sprints = append(v.Sprints, SprintVelocity{
+			SprintID:  s.Id.Hex(),
+			Name:      s.Name,
+			Start:     start,
+			ClosedAt:  s.ClosedAt,
+			Committed: done + s.CarriedOver,
+			Completed: done,
+		})
+		sum += done
+	}
+	if len(closed) > 0 {
+		v.Average = round(float64(sum) / float64(len(closed)))
+	}
+	return v
+}
+
+// VelocityCSV возвращает строки CSV вместе с заголовком
+func VelocityCSV(v Velocity) [][]string {
+	rows := [][]string{{"sprintId", "name", "start", "closedAt", "committed", "completed"}}
+	for _, s := range v.Sprints {
+		rows = append(rows, []string{
+			s.SprintID,
+			s.Name,
+			formatTime(s.Start),
+			formatTime(s.ClosedAt),
+			strconv.FormatInt(s.Committed, 10),
+			strconv.FormatInt(s.Completed, 10),
+		})
+	}
+	return rows
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Интервалы разбивки нагрузки по срокам
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// Workload — открытые задачи одного пользователя по всем проектам
+type Workload struct {
+	User        string           `bson:"_id" json:"user"`
+	OpenTasks   int              `bson:"openTasks" json:"openTasks"`
+	Responsible int              `bson:"responsible" json:"responsible"` // Из них пользователь ответственный
+	Performer   int              `bson:"performer" json:"performer"`     // Из них пользователь исполнитель
+	Estimate    float64          `bson:"estimate" json:"estimate"`       // Сумма оценок в часах
+	Weighted    float64          `bson:"weighted" json:"weighted"`       // Сумма приоритет × оценка (оценка по умолчанию 1)
+	Overdue     int              `bson:"overdue" json:"overdue"`
+	Breakdown   []WorkloadBucket `bson:"breakdown" json:"breakdown"` // По срокам внутри запрошенного периода
+}
+
+type WorkloadBucket struct {
+	Period   string  `bson:"period" json:"period"`
+	Tasks    int     `bson:"tasks" json:"tasks"`
+	Weighted float64 `bson:"weighted" json:"weighted"`
+	Overdue  int     `bson:"overdue" json:"overdue"`
+}
+
+// PeriodFormat возвращает формат $dateToString для интервала разбивки
+func PeriodFormat(interval string) (string, bool) {
+	switch interval {
+	case IntervalDay:
+		return "%Y-%m-%d", true
+	case IntervalWeek:
+		return "%G-W%V", true
+	case IntervalMonth:
+		return "%Y-%m", true
+	}
+	return "", false
+}
+
+// SortBuckets упорядочивает разбивку по периоду
+func (w *Workload) SortBuckets() {
+	sort.Slice(w.Breakdown, func(i, j int) bool { return w.Breakdown[i].Period < w.Breakdown[j].Period })
+}
+
+// WorkloadCSV возвращает строки CSV вместе с заголовком: итог по пользователю и строки разбивки
+func WorkloadCSV(workloads []Workload) [][]string {
+	rows := [][]string{{"user", "period", "openTasks", "responsible", "performer", "estimate", "weighted", "overdue"}}
+	for _, w := range workloads {
+		rows = append(rows, []string{
+			w.User,
+			"total",
+			strconv.Itoa(w.OpenTasks),
+			strconv.Itoa(w.Responsible),
+			strconv.Itoa(w.Performer),
+			formatFloat(w.Estimate),
+			formatFloat(w.Weighted),
+			strconv.Itoa(w.Overdue),
+		})
+		for _, b := range w.Breakdown {
+			rows = append(rows, []string{w.User, b.Period, strconv.Itoa(b.Tasks), "", "", "", formatFloat(b.Weighted), strconv.Itoa(b.Overdue)})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+	"tmv/logging"
+	"tmv/storage"
+)
+
+// Recurrence периодически создаёт следующие вхождения повторяющихся задач
+type Recurrence struct {
+	Storage  storage.Storage
+	Interval time.Duration
+}
+
+func NewRecurrence(st storage.Storage, interval time.Duration) *Recurrence {
+	return &Recurrence{Storage: st, Interval: interval}
+}
+
+// Run выполняет проход сразу и затем каждые Interval, пока не отменён ctx
+func (r *Recurrence) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.RunOnce(time.Now()); err != nil {
+			logging.Default().Error("recurrence scheduler", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce создаёт вхождения для задач, которые завершены или чей срок наступил на момент now
+func (r *Recurrence) RunOnce(now time.Time) error {
+	tasks, err := r.Storage.GetRecurringTasks()
+	if err != nil {
+		return err
+	}
+
+	for i := range tasks {
+		if !tasks[i].RecurrenceDue(now) {
+			continue
+		}
+		next, err := r.Storage.SpawnOccurrence(&tasks[i])
+		if err != nil {
+			// Ошибка одной задачи не останавливает остальные
+			logging.Default().Error("recurrence scheduler", "task_id", tasks[i].ID.Hex(), "error", err)
+			continue
+		}
+		if next != nil {
+			logging.Default().Info("recurrence scheduler: occurrence spawned", "task_id", tasks[i].ID.Hex(), "occurrence_id", next.ID.Hex(), "deadline", next.Deadline)
+		}
+	}
+	return nil
+}
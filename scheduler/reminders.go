@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"tmv/ident"
+	"tmv/logging"
+	"tmv/notify"
+	"tmv/project"
+	"tmv/storage"
+	"tmv/user"
+)
+
+// Reminders напоминает ответственным и исполнителям о приближающихся и просроченных сроках
+type Reminders struct {
+	Storage    storage.Storage
+	Dispatcher *notify.Dispatcher
+	Windows    []time.Duration // За сколько до срока напоминать, например 24h и 1h
+	Interval   time.Duration
+}
+
+func NewReminders(st storage.Storage, d *notify.Dispatcher, windows []time.Duration, interval time.Duration) *Reminders {
+	w := append([]time.Duration(nil), windows...)
+	sort.Slice(w, func(i, j int) bool { return w[i] < w[j] })
+	return &Reminders{Storage: st, Dispatcher: d, Windows: w, Interval: interval}
+}
+
+// Run выполняет проход сразу и затем каждые Interval, пока не отменён ctx
+func (r *Reminders) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.RunOnce(time.Now()); err != nil {
+			logging.Default().Error("reminder scheduler", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reminder — одно событие о сроке до разрешения получателей
+type reminder struct {
+	entity    string // task или project
+	id        ident.ID
+	projectId ident.ID
+	taskId    ident.ID
+	name      string
+	deadline  time.Time
+	people    []string
+}
+
+// RunOnce рассылает напоминания на момент now
+func (r *Reminders) RunOnce(now time.Time) error {
+	horizon := now
+	if len(r.Windows) > 0 {
+		horizon = now.Add(r.Windows[len(r.Windows)-1])
+	}
+
+	tasks, err := r.Storage.GetTasksDueBefore(horizon)
+	if err != nil {
+		return err
+	}
+	projects, err := r.Storage.GetProjectsDueBefore(horizon)
+	if err != nil {
+		return err
+	}
+
+	var reminders []reminder
+	for i := range tasks {
+		t := &tasks[i]
+		if project.IsTerminal(t.Status) {
+			continue
+		}
+		reminders = append(reminders, reminder{"task", t.ID, t.ProjectID, t.ID, t.Name, t.Deadline, t.Assignees()})
+	}
+	for i := range projects {
+		p := &projects[i]
+		if project.IsTerminal(p.Status) {
+			continue
+		}
+		reminders = append(reminders, reminder{"project", p.Id, p.Id, ident.Nil, p.Name, p.Deadline, p.Assignees()})
+	}
+	if len(reminders) == 0 {
+		return nil
+	}
+
+	users := notify.NewUserIndex(r.Storage.GetAllUsers())
+	for _, rem := range reminders {
+		kind, window := r.classify(now, rem.deadline)
+		for _, u := range users.Resolve(rem.people) {
+			if u.Notifications.Disabled {
+				continue
+			}
+
+			// Ключ включает срок: после переноса срока напоминание придёт снова
+			key := fmt.Sprintf("%s:%s:%s:%d:%s", rem.entity, rem.id.Hex(), window, rem.deadline.Unix(), u.Id.Hex())
+			fresh, err := r.Storage.MarkReminderSent(key)
+			if err != nil {
+				logging.Default().Error("reminder scheduler", "error", err)
+				continue
+			}
+			if !fresh {
+				continue
+			}
+
+			n := &user.Notification{
+				Kind:      rem.entity + "." + kind,
+				Title:     reminderTitle(rem, kind),
+				Message:   fmt.Sprintf("Срок: %s", rem.deadline.Format("02.01.2006 15:04")),
+				ProjectID: rem.projectId,
+				TaskID:    rem.taskId,
+			}
+			if err := r.Dispatcher.Send(u, n); err != nil {
+				logging.Default().Error("reminder scheduler: notify", "user_id", u.Id.Hex(), "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// classify выбирает самое узкое окно, в которое попадает срок; просроченные — overdue
+func (r *Reminders) classify(now, deadline time.Time) (kind, window string) {
+	if !deadline.After(now) {
+		return "overdue", "overdue"
+	}
+	left := deadline.Sub(now)
+	for _, w := range r.Windows {
+		if left <= w {
+			return "due_soon", w.String()
+		}
+	}
+	return "due_soon", r.Windows[len(r.Windows)-1].String()
+}
+
+func reminderTitle(rem reminder, kind string) string {
+	what := "Задача"
+	if rem.entity == "project" {
+		what = "Проект"
+	}
+	if kind == "overdue" {
+		return fmt.Sprintf("%s «%s» просрочена", what, rem.name)
+	}
+	return fmt.Sprintf("%s «%s»: приближается срок", what, rem.name)
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"errors"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrTaskNotFound — ошибка элемента пакета UpdateTasks, для которого нет задачи в проекте
+var ErrTaskNotFound = errors.New("task not found")
+
+// InsertTasks вставляет задачи проекта одним BulkWrite и добавляет их в проект одним $addToSet/$each.
+// Ошибки отдельных задач возвращаются по их позициям в пакете (nil — задача вставлена);
+// error — пакет не выполнен целиком.
+func (m *MongoStorage) InsertTasks(tasks []*project.Task, projectId ident.ID) ([]error, error) {
+	errs := make([]error, len(tasks))
+	if len(tasks) == 0 {
+		return errs, nil
+	}
+
+	var projectDoc bson.M
+	err := m.ProjectCollection.FindOne(m.opContext(), bson.D{{Key: "_id", Value: projectId}}).Decode(&projectDoc)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("project not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Новые задачи встают в конец колонок своих статусов в порядке пакета
+	lastRanks := make(map[string]string)
+	models := make([]mongo.WriteModel, len(tasks))
+	for i, t := range tasks {
+		t.ID = ident.New()
+		t.ProjectID = projectId
+		if t.DateCreation.IsZero() {
+			t.DateCreation = time.Now()
+		}
+		if t.Remaining == 0 {
+			t.Remaining = t.Estimate
+		}
+		// История статусов ведётся только хранилищем
+		t.StatusHistory = []project.StatusChange{{Status: t.Status, At: t.DateCreation}}
+		if t.Recurrence != nil {
+			t.Recurrence.Spawned = false
+			startRecurrence(t)
+		}
+
+		last, ok := lastRanks[t.Status]
+		if !ok {
+			if last, err = m.lastRank(projectId, t.Status); err != nil {
+				return nil, err
+			}
+		}
+		t.Rank = project.RankBetween(last, "")
+		lastRanks[t.Status] = t.Rank
+
+		models[i] = mongo.NewInsertOneModel().SetDocument(t)
+	}
+
+	// Неупорядоченная запись: ошибка одной задачи не останавливает остальные
+	_, err = m.TaskCollection.BulkWrite(m.opContext(), models, options.BulkWrite().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, we := range bulkErr.WriteErrors {
+			errs[we.Index] = we
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	inserted := make([]ident.ID, 0, len(tasks))
+	for i, t := range tasks {
+		if errs[i] == nil {
+			inserted = append(inserted, t.ID)
+		}
+	}
+	if len(inserted) == 0 {
+		return errs, nil
+	}
+
+	filter := bson.D{{Key: "_id", Value: projectId}}
+	if v, ok := projectDoc["tasks"]; !ok || v == nil {
+		// Если поле tasks не существует, инициализируем его как пустой массив
+		_, err = m.ProjectCollection.UpdateOne(
+			m.opContext(),
+			bson.D{{Key: "_id", Value: projectId}, {Key: "tasks", Value: nil}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "tasks", Value: []ident.ID{}}}}},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = m.ProjectCollection.UpdateOne(
+		m.opContext(),
+		filter,
+		bson.D{
+			{Key: "$addToSet", Value: bson.D{{Key: "tasks", Value: bson.D{{Key: "$each", Value: inserted}}}}},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// UpdateTasks применяет частичные обновления задач проекта одним BulkWrite. Задачи, которой нет
+// в проекте, соответствует ErrTaskNotFound; error — пакет не выполнен целиком.
+// Id в пакете не должны повторяться.
+func (m *MongoStorage) UpdateTasks(projectId ident.ID, updates []TaskUpdate) ([]error, error) {
+	errs := make([]error, len(updates))
+	if len(updates) == 0 {
+		return errs, nil
+	}
+
+	ids := make([]ident.ID, len(updates))
+	for i, u := range updates {
+		ids[i] = u.ID
+	}
+
+	// Текущие статусы нужны, чтобы пополнять историю только при смене статуса
+	filter := bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}},
+	}
+	opts := options.Find().SetProjection(bson.D{{Key: "status", Value: 1}})
+	cursor, err := m.TaskCollection.Find(m.opContext(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var current []project.Task
+	if err := cursor.All(m.opContext(), &current); err != nil {
+		return nil, err
+	}
+	statuses := make(map[ident.ID]string, len(current))
+	for _, t := range current {
+		statuses[t.ID] = t.Status
+	}
+
+	var models []mongo.WriteModel
+	var positions []int                  // Позиция в пакете для каждой модели
+	lastRanks := make(map[string]string) // Последний ранг колонки с учётом задач пакета
+	for i, u := range updates {
+		status, ok := statuses[u.ID]
+		if !ok {
+			errs[i] = ErrTaskNotFound
+			continue
+		}
+
+		// История статусов и повторение меняются только через отдельные методы, ранг — только через MoveTask
+		delete(u.Fields, "statusHistory")
+		delete(u.Fields, "recurrence")
+		delete(u.Fields, "rank")
+		fields, err := NormalizeTaskUpdate(u.Fields)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		update := bson.D{{Key: "$set", Value: fields}}
+		if s, ok := fields["status"].(string); ok && s != status {
+			// В новой колонке задача встаёт последней, как при создании
+			last, ok := lastRanks[s]
+			if !ok {
+				if last, err = m.lastRank(projectId, s); err != nil {
+					return nil, err
+				}
+			}
+			fields["rank"] = project.RankBetween(last, "")
+			lastRanks[s] = fields["rank"].(string)
+			update = append(update, statusHistoryPush(s))
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: u.ID}, {Key: "projectId", Value: projectId}}).
+			SetUpdate(update))
+		positions = append(positions, i)
+	}
+	if len(models) == 0 {
+		return errs, nil
+	}
+
+	_, err = m.TaskCollection.BulkWrite(m.opContext(), models, options.BulkWrite().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, we := range bulkErr.WriteErrors {
+			errs[positions[we.Index]] = we
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
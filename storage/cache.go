@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"tmv/cache"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Префиксы ключей кэша совпадают с видами сущностей change stream: user, project, task
+const (
+	cacheUser    = "user"
+	cacheProject = "project"
+	cacheTask    = "task"
+)
+
+// CachedStorage — декоратор Storage, который кэширует чтение одной сущности
+// (GetUser, GetProject, GetTask) и сбрасывает записи при изменениях через него.
+// Изменения, сделанные другими экземплярами, сбрасываются через Invalidate или по TTL.
+type CachedStorage struct {
+	Storage
+	Cache cache.Store
+
+	counters *cacheCounters // Общие для всех копий из WithContext
+}
+
+type cacheCounters struct {
+	hits   uint64
+	misses uint64
+	gen    uint64 // Растёт при каждом сбросе; чтение, пересёкшееся со сбросом, не попадает в кэш
+}
+
+func NewCachedStorage(inner Storage, store cache.Store) *CachedStorage {
+	return &CachedStorage{Storage: inner, Cache: store, counters: &cacheCounters{}}
+}
+
+// WithContext возвращает копию с тем же кэшем, которая обращается к хранилищу в контексте ctx
+func (s *CachedStorage) WithContext(ctx context.Context) Storage {
+	bound := *s
+	bound.Storage = WithContext(s.Storage, ctx)
+	return &bound
+}
+
+func cacheKey(kind string, id ident.ID) string {
+	return kind + ":" + id.Hex()
+}
+
+// Invalidate сбрасывает запись сущности kind (user, project или task)
+func (s *CachedStorage) Invalidate(kind string, id ident.ID) {
+	s.forget(kind, id)
+}
+
+// Stats возвращает статистику попаданий с момента запуска
+func (s *CachedStorage) Stats() cache.Stats {
+	stats := cache.Stats{
+		Hits:    atomic.LoadUint64(&s.counters.hits),
+		Misses:  atomic.LoadUint64(&s.counters.misses),
+		Entries: s.Cache.Len(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	if lru, ok := s.Cache.(interface{ Evictions() uint64 }); ok {
+		stats.Evictions = lru.Evictions()
+	}
+	return stats
+}
+
+func (s *CachedStorage) lookup(kind string, id ident.ID) (interface{}, bool) {
+	v, ok := s.Cache.Get(cacheKey(kind, id))
+	if ok {
+		atomic.AddUint64(&s.counters.hits, 1)
+	} else {
+		atomic.AddUint64(&s.counters.misses, 1)
+	}
+	return v, ok
+}
+
+// store кладёт прочитанное значение, если с начала чтения (gen) ничего не сбрасывалось
+func (s *CachedStorage) store(kind string, id ident.ID, gen uint64, value interface{}) {
+	if atomic.LoadUint64(&s.counters.gen) == gen {
+		s.Cache.Set(cacheKey(kind, id), value)
+	}
+}
+
+func (s *CachedStorage) forget(kind string, ids ...ident.ID) {
+	atomic.AddUint64(&s.counters.gen, 1)
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = cacheKey(kind, id)
+	}
+	s.Cache.Delete(keys...)
+}
+
+func (s *CachedStorage) forgetAll(kind string) {
+	atomic.AddUint64(&s.counters.gen, 1)
+	s.Cache.DeletePrefix(kind + ":")
+}
+
+// GetUser, GetProject и GetTask хранят в кэше значения, а не указатели,
+// поэтому вызывающий код получает копию и не может изменить закэшированную запись
+func (s *CachedStorage) GetUser(userId ident.ID) (user.User, error) {
+	if v, ok := s.lookup(cacheUser, userId); ok {
+		return v.(user.User), nil
+	}
+	gen := atomic.LoadUint64(&s.counters.gen)
+	u, err := s.Storage.GetUser(userId)
+	if err != nil {
+		return u, err
+	}
+	s.store(cacheUser, userId, gen, u)
+	return u, nil
+}
+func (s *CachedStorage) GetProject(userId, projectId ident.ID) (*project.Project, error) {
+	if v, ok := s.lookup(cacheProject, projectId); ok {
+		p := v.(project.Project)
+		// Проект ищется по владельцу, как и в основном хранилище
+		if p.UserID != userId {
+			return nil, fmt.Errorf("проект не найден")
+		}
+		return &p, nil
+	}
+	gen := atomic.LoadUint64(&s.counters.gen)
+	p, err := s.Storage.GetProject(userId, projectId)
+	if err != nil {
+		return nil, err
+	}
+	s.store(cacheProject, projectId, gen, *p)
+	return p, nil
+}
+func (s *CachedStorage) GetTask(projectId, taskId ident.ID) (*project.Task, error) {
+	if v, ok := s.lookup(cacheTask, taskId); ok {
+		t := v.(project.Task)
+		if t.ProjectID != projectId {
+			return nil, nil
+		}
+		return &t, nil
+	}
+	gen := atomic.LoadUint64(&s.counters.gen)
+	t, err := s.Storage.GetTask(projectId, taskId)
+	if err != nil || t == nil {
+		return t, err
+	}
+	s.store(cacheTask, taskId, gen, *t)
+	return t, nil
+}
+
+func (s *CachedStorage) UpdateUser(userId ident.ID, u *user.User) error {
+	defer s.forget(cacheUser, userId)
+	return s.Storage.UpdateUser(userId, u)
+}
+
+// Удаление пользователя или проекта уносит их проекты и задачи (см. ON DELETE CASCADE в SQL).
+// Какие именно, знает только основное хранилище, поэтому дочерние записи сбрасываются целиком.
+func (s *CachedStorage) DeleteUser(userId ident.ID) error {
+	defer s.forgetAll(cacheTask)
+	defer s.forgetAll(cacheProject)
+	defer s.forget(cacheUser, userId)
+	return s.Storage.DeleteUser(userId)
+}
+
+func (s *CachedStorage) InsertProject(p *project.Project, userId ident.ID) error {
+	// Проект добавляется в список projects пользователя
+	defer s.forget(cacheUser, userId)
+	return s.Storage.InsertProject(p, userId)
+}
+func (s *CachedStorage) UpdateProject(projectId ident.ID, updateFields bson.M) error {
+	defer s.forget(cacheProject, projectId)
+	return s.Storage.UpdateProject(projectId, updateFields)
+}
+func (s *CachedStorage) DeleteProject(projectId ident.ID) error {
+	// Владелец проекта известен только основному хранилищу, поэтому сбрасываются все пользователи
+	defer s.forgetAll(cacheUser)
+	defer s.forgetAll(cacheTask)
+	defer s.forget(cacheProject, projectId)
+	return s.Storage.DeleteProject(projectId)
+}
+func (s *CachedStorage) DeleteProjects(userId ident.ID, projectIds []ident.ID) error {
+	defer s.forget(cacheUser, userId)
+	defer s.forgetAll(cacheTask)
+	defer s.forget(cacheProject, projectIds...)
+	return s.Storage.DeleteProjects(userId, projectIds)
+}
+
+// Вставка и удаление задач меняют список tasks проекта
+func (s *CachedStorage) InsertTask(t *project.Task, projectId ident.ID) error {
+	defer s.forget(cacheProject, projectId)
+	return s.Storage.InsertTask(t, projectId)
+}
+func (s *CachedStorage) DeleteTask(projectId, taskId ident.ID) error {
+	defer s.forget(cacheProject, projectId)
+	defer s.forget(cacheTask, taskId)
+	return s.Storage.DeleteTask(projectId, taskId)
+}
+func (s *CachedStorage) DeleteTasks(projectId ident.ID, taskIds []ident.ID) error {
+	defer s.forget(cacheProject, projectId)
+	defer s.forget(cacheTask, taskIds...)
+	return s.Storage.DeleteTasks(projectId, taskIds)
+}
+func (s *CachedStorage) InsertTasks(tasks []*project.Task, projectId ident.ID) ([]error, error) {
+	defer s.forget(cacheProject, projectId)
+	return s.Storage.InsertTasks(tasks, projectId)
+}
+func (s *CachedStorage) UpdateTasks(projectId ident.ID, updates []TaskUpdate) ([]error, error) {
+	ids := make([]ident.ID, len(updates))
+	for i, u := range updates {
+		ids[i] = u.ID
+	}
+	defer s.forget(cacheTask, ids...)
+	return s.Storage.UpdateTasks(projectId, updates)
+}
+func (s *CachedStorage) UpdateTask(projectId, taskId ident.ID, updateFields bson.M) error {
+	defer s.forget(cacheTask, taskId)
+	return s.Storage.UpdateTask(projectId, taskId, updateFields)
+}
+func (s *CachedStorage) MoveTask(projectId, taskId ident.ID, status string, position int) error {
+	defer s.forget(cacheTask, taskId)
+	return s.Storage.MoveTask(projectId, taskId, status, position)
+}
+func (s *CachedStorage) SpawnOccurrence(t *project.Task) (*project.Task, error) {
+	defer s.forget(cacheProject, t.ProjectID)
+	defer s.forget(cacheTask, t.ID)
+	return s.Storage.SpawnOccurrence(t)
+}
+func (s *CachedStorage) SetTaskRecurrence(projectId, taskId ident.ID, rule string) error {
+	defer s.forget(cacheTask, taskId)
+	return s.Storage.SetTaskRecurrence(projectId, taskId, rule)
+}
+
+// Спринты и учёт времени меняют sprintId и remaining у задач
+func (s *CachedStorage) AssignTasksToSprint(projectId, sprintId ident.ID, taskIds []ident.ID) error {
+	defer s.forget(cacheTask, taskIds...)
+	return s.Storage.AssignTasksToSprint(projectId, sprintId, taskIds)
+}
+func (s *CachedStorage) CloseSprint(projectId, sprintId, nextSprintId ident.ID) (int64, error) {
+	defer s.forgetAll(cacheTask)
+	return s.Storage.CloseSprint(projectId, sprintId, nextSprintId)
+}
+func (s *CachedStorage) DeleteSprint(projectId, sprintId ident.ID) error {
+	defer s.forgetAll(cacheTask)
+	return s.Storage.DeleteSprint(projectId, sprintId)
+}
+func (s *CachedStorage) InsertWorklog(w *project.Worklog, projectId, taskId ident.ID) error {
+	defer s.forget(cacheTask, taskId)
+	return s.Storage.InsertWorklog(w, projectId, taskId)
+}
+func (s *CachedStorage) DeleteWorklog(projectId, taskId, worklogId ident.ID) error {
+	defer s.forget(cacheTask, taskId)
+	return s.Storage.DeleteWorklog(projectId, taskId, worklogId)
+}
+func (s *CachedStorage) StopTimer(projectId, taskId, userId ident.ID, note string) (*project.Worklog, error) {
+	defer s.forget(cacheTask, taskId)
+	return s.Storage.StopTimer(projectId, taskId, userId, note)
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"tmv/ident"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Удаление в MongoDB повторяет ON DELETE CASCADE схемы SQL: с пользователем уходят его проекты
+// и уведомления, с проектом — задачи, спринты, списания и комментарии, с задачей — её списания
+// и комментарии. Вебхуки удалённого проекта только помечаются: их удалит диспетчер, когда
+// доставит project.deleted.
+
+// deleteUserData удаляет проекты и уведомления пользователя
+func (m *MongoStorage) deleteUserData(userId ident.ID) error {
+	ids, err := m.findIDs(m.ProjectCollection, bson.D{{Key: "userId", Value: userId}})
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		if _, err := m.ProjectCollection.DeleteMany(m.opContext(), inIDs("_id", ids)); err != nil {
+			return err
+		}
+	}
+	if err := m.deleteProjectData(ids); err != nil {
+		return err
+	}
+
+	_, err = m.NotificationCollection.DeleteMany(m.opContext(), bson.D{{Key: "userId", Value: userId}})
+	return err
+}
+
+// deleteProjectData удаляет всё, что принадлежит удалённым проектам
+func (m *MongoStorage) deleteProjectData(projectIDs []ident.ID) error {
+	if len(projectIDs) == 0 {
+		return nil
+	}
+	filter := inIDs("projectId", projectIDs)
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "projectDeleted", Value: true}}}}
+	if _, err := m.WebhookCollection.UpdateMany(m.opContext(), filter, update); err != nil {
+		return err
+	}
+
+	for _, c := range []*mongo.Collection{m.CommentCollection, m.WorklogCollection, m.SprintCollection, m.TaskCollection} {
+		if _, err := c.DeleteMany(m.opContext(), filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteTaskData удаляет списания и комментарии удалённых задач проекта
+func (m *MongoStorage) deleteTaskData(projectId ident.ID, taskIDs []ident.ID) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+	filter := append(bson.D{{Key: "projectId", Value: projectId}}, inIDs("taskId", taskIDs)...)
+	for _, c := range []*mongo.Collection{m.CommentCollection, m.WorklogCollection} {
+		if _, err := c.DeleteMany(m.opContext(), filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findIDs возвращает id документов коллекции, подходящих под filter
+func (m *MongoStorage) findIDs(c *mongo.Collection, filter interface{}) ([]ident.ID, error) {
+	cursor, err := c.Find(m.opContext(), filter, options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID ident.ID `bson:"_id"`
+	}
+	if err := cursor.All(m.opContext(), &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]ident.ID, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids, nil
+}
+
+func inIDs(field string, ids []ident.ID) bson.D {
+	return bson.D{{Key: field, Value: bson.D{{Key: "$in", Value: ids}}}}
+}
@@ -0,0 +1,133 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"tmv/cache"
+	"tmv/config"
+	"tmv/project"
+	"tmv/storage"
+	"tmv/storage/storagetest"
+	"tmv/user"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewMemoryStorage()
+	})
+}
+
+// Кэш не должен отдавать записи, которые изменились или удалились через него
+func TestCachedStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewCachedStorage(storage.NewMemoryStorage(), cache.NewLRU(1000, time.Hour))
+	})
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		st, err := storage.NewSQLiteStorage(config.SQLite{Path: filepath.Join(t.TempDir(), "tmv.db")})
+		if err != nil {
+			t.Fatalf("NewSQLiteStorage: %v", err)
+		}
+		t.Cleanup(func() { st.Close() })
+		return st
+	})
+}
+
+// TestMongoStorage нужен запущенный mongod: адрес берётся из TMV_TEST_MONGO_URI,
+// по умолчанию localhost. Каждый подтест работает в своей базе, которая потом удаляется.
+func TestMongoStorage(t *testing.T) {
+	cfg := config.Default().Mongo
+	if uri := os.Getenv("TMV_TEST_MONGO_URI"); uri != "" {
+		cfg.URI = uri
+	}
+	cfg.ConnectTimeout = 2 * time.Second
+	cfg.ServerSelectionTimeout = 2 * time.Second
+
+	probe, err := storage.NewMongoStorage(cfg)
+	if err != nil {
+		t.Skipf("MongoDB is not available at %s: %v", cfg.URI, err)
+	}
+	probe.Client.Disconnect(context.Background())
+
+	prefix := fmt.Sprintf("tmv_test_%d", time.Now().UnixNano())
+	n := 0
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		n++
+		dbCfg := cfg
+		dbCfg.Database = fmt.Sprintf("%s_%d", prefix, n)
+		st, err := storage.NewMongoStorage(dbCfg)
+		if err != nil {
+			t.Fatalf("NewMongoStorage: %v", err)
+		}
+		t.Cleanup(func() {
+			st.Client.Database(dbCfg.Database).Drop(context.Background())
+			st.Client.Disconnect(context.Background())
+		})
+		// Уникальность email и единственный идущий таймер обеспечивают индексы
+		if err := st.EnsureIndexes(context.Background()); err != nil {
+			t.Fatalf("EnsureIndexes: %v", err)
+		}
+		return st
+	})
+}
+
+// Равные ранги через API не получить: их оставляют записи в обход хранилища и старые версии.
+// MoveTask между такими соседями перенумеровывает колонку.
+func TestSQLiteMoveTaskTiedRanks(t *testing.T) {
+	st, err := storage.NewSQLiteStorage(config.SQLite{Path: filepath.Join(t.TempDir(), "tmv.db")})
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	defer st.Close()
+
+	u := user.NewUser("Ann", "dev", 30, 1000, "", nil)
+	if err := st.InsertUser(u); err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	p := project.NewProject(u.Id, "Board", "desc", 5, "author", "resp", "perf", time.Time{}, "", nil, "open")
+	if err := st.InsertProject(p, u.Id); err != nil {
+		t.Fatalf("InsertProject: %v", err)
+	}
+	var tasks []*project.Task
+	for i, name := range []string{"A", "B", "C"} {
+		task := project.NewTask(p.Id, name, "", 1, "", "", "", time.Time{}, "", "todo")
+		task.DateCreation = time.Now().Add(time.Duration(i) * time.Second)
+		if err := st.InsertTask(task, p.Id); err != nil {
+			t.Fatalf("InsertTask: %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+	res, err := st.DB.Exec("UPDATE tasks SET rank = 'i' WHERE project_id = ?", p.Id.Hex())
+	if err != nil {
+		t.Fatalf("tie ranks: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Fatalf("tied %d ranks, want 3", n)
+	}
+
+	// C встаёт между A и B
+	if err := st.MoveTask(p.Id, tasks[2].ID, "todo", 1); err != nil {
+		t.Fatalf("MoveTask: %v", err)
+	}
+	column, err := st.GetTasksByProject(p.Id)
+	if err != nil {
+		t.Fatalf("GetTasksByProject: %v", err)
+	}
+	project.SortByRank(column)
+	var order []string
+	for i, task := range column {
+		order = append(order, task.Name)
+		if i > 0 && column[i-1].Rank >= task.Rank {
+			t.Errorf("rank %q of %s is not after %q", task.Rank, task.Name, column[i-1].Rank)
+		}
+	}
+	if fmt.Sprint(order) != "[A C B]" {
+		t.Errorf("column order = %v, want [A C B]", order)
+	}
+}
@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"context"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+	"tmv/logging"
+	"tmv/project"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// EventStorage — декоратор Storage, который публикует доменные события о пользователях,
+// проектах и задачах. Перед записью событие сохраняется в outbox как намерение, после
+// успешной записи оно подтверждается и отдаётся шине. Если процесс упадёт между записью
+// и подтверждением, ретранслятор через Grace всё равно доставит событие с данными намерения,
+// поэтому асинхронные подписчики должны перечитывать состояние и быть идемпотентными.
+type EventStorage struct {
+	Storage
+	Bus   *event.Bus
+	Relay *event.Relay
+	Grace time.Duration // Сколько ждать подтверждения записи, прежде чем доставлять намерение
+
+	ctx context.Context // Контекст запроса, из которого в события попадает трасса
+}
+
+func NewEventStorage(inner Storage, bus *event.Bus) *EventStorage {
+	return &EventStorage{
+		Storage: inner,
+		Bus:     bus,
+		Relay:   event.NewRelay(inner, bus),
+		Grace:   time.Minute,
+	}
+}
+
+// WithContext возвращает копию, которая пишет в контексте ctx и передаёт его трассу в события
+func (s *EventStorage) WithContext(ctx context.Context) Storage {
+	bound := *s
+	bound.Storage = WithContext(s.Storage, ctx)
+	bound.ctx = ctx
+	return &bound
+}
+
+// record сохраняет намерения, выполняет write и подтверждает события, которые вернул write.
+// Намерения, не попавшие в ответ write, и все намерения при ошибке записи удаляются.
+func (s *EventStorage) record(intents []*event.Event, write func() ([]*event.Event, error)) error {
+	records := make([]*event.Record, 0, len(intents))
+	for _, e := range intents {
+		if s.ctx != nil {
+			e.SetTrace(s.ctx)
+		}
+		rec, err := event.NewRecord(e, time.Now().Add(s.Grace))
+		if err == nil {
+			err = s.Storage.InsertOutbox(rec)
+		}
+		if err != nil {
+			s.discard(records)
+			return err
+		}
+		records = append(records, rec)
+	}
+
+	events, err := write()
+	if err != nil {
+		s.discard(records)
+		return err
+	}
+
+	committed := make(map[ident.ID]*event.Event, len(events))
+	for _, e := range events {
+		committed[e.ID] = e
+	}
+	for _, rec := range records {
+		e, ok := committed[rec.Id]
+		if !ok {
+			s.discard([]*event.Record{rec})
+			continue
+		}
+
+		rec.ProjectID = e.ProjectID
+		rec.NextAttempt = time.Now()
+		if err := rec.SetPayload(e); err != nil {
+			logging.FromContext(s.ctx).Error("event payload", "event_id", rec.Id.Hex(), "error", err)
+		}
+		if err := s.Storage.UpdateOutbox(rec); err != nil {
+			// Запись останется намерением и будет доставлена после Grace
+			logging.FromContext(s.ctx).Error("commit outbox record", "event_id", rec.Id.Hex(), "error", err)
+		}
+		s.Bus.Publish(e)
+	}
+	if len(events) > 0 {
+		s.Relay.Wake()
+	}
+	return nil
+}
+
+func (s *EventStorage) discard(records []*event.Record) {
+	for _, rec := range records {
+		if err := s.Storage.DeleteOutbox(rec.Id); err != nil {
+			logging.FromContext(s.ctx).Error("discard outbox record", "event_id", rec.Id.Hex(), "error", err)
+		}
+	}
+}
+
+// afterTask подставляет в событие задачу в том виде, в котором она сохранена
+func (s *EventStorage) afterTask(e *event.Event) []*event.Event {
+	payload := e.Data.(*event.TaskPayload)
+	if t, err := s.Storage.GetTask(payload.ProjectID, payload.TaskID); err == nil && t != nil {
+		payload.Task = t
+	}
+	return []*event.Event{e}
+}
+
+func (s *EventStorage) InsertUser(u *user.User) error {
+	payload := &event.UserPayload{User: u}
+	e := event.New(event.UserCreated, ident.Nil, payload)
+
+	return s.record([]*event.Event{e}, func() ([]*event.Event, error) {
+		if err := s.Storage.InsertUser(u); err != nil {
+			return nil, err
+		}
+		payload.UserID = u.Id
+		return []*event.Event{e}, nil
+	})
+}
+func (s *EventStorage) UpdateUser(userId ident.ID, u *user.User) error {
+	payload := &event.UserPayload{UserID: userId, User: u}
+	e := event.New(event.UserUpdated, ident.Nil, payload)
+
+	return s.record([]*event.Event{e}, func() ([]*event.Event, error) {
+		if err := s.Storage.UpdateUser(userId, u); err != nil {
+			return nil, err
+		}
+		if after, err := s.Storage.GetUser(userId); err == nil {
+			payload.User = &after
+		}
+		return []*event.Event{e}, nil
+	})
+}
+
+// DeleteUser публикует user.deleted, а перед ним — project.deleted и task.deleted для всего,
+// что удаляется вместе с пользователем
+func (s *EventStorage) DeleteUser(userId ident.ID) error {
+	projects, err := s.Storage.GetProjectByUser(userId)
+	if err != nil {
+		return err
+	}
+	projectIds := make([]ident.ID, len(projects))
+	for i := range projects {
+		projectIds[i] = projects[i].Id
+	}
+	events, err := s.projectsDeleted(projectIds)
+	if err != nil {
+		return err
+	}
+	events = append(events, event.New(event.UserDeleted, ident.Nil, &event.UserPayload{UserID: userId}))
+
+	return s.record(events, func() ([]*event.Event, error) {
+		return events, s.Storage.DeleteUser(userId)
+	})
+}
+
+func (s *EventStorage) InsertProject(p *project.Project, userId ident.ID) error {
+	payload := &event.ProjectPayload{Project: p}
+	e := event.New(event.ProjectCreated, ident.Nil, payload)
+
+	return s.record([]*event.Event{e}, func() ([]*event.Event, error) {
+		if err := s.Storage.InsertProject(p, userId); err != nil {
+			return nil, err
+		}
+		e.ProjectID, payload.ProjectID = p.Id, p.Id
+		return []*event.Event{e}, nil
+	})
+}
+func (s *EventStorage) UpdateProject(projectId ident.ID, updateFields bson.M) error {
+	e := event.New(event.ProjectUpdated, projectId, &event.ProjectPayload{ProjectID: projectId, Changes: updateFields})
+
+	return s.record([]*event.Event{e}, func() ([]*event.Event, error) {
+		return []*event.Event{e}, s.Storage.UpdateProject(projectId, updateFields)
+	})
+}
+func (s *EventStorage) DeleteProject(projectId ident.ID) error {
+	events, err := s.projectsDeleted([]ident.ID{projectId})
+	if err != nil {
+		return err
+	}
+
+	return s.record(events, func() ([]*event.Event, error) {
+		return events, s.Storage.DeleteProject(projectId)
+	})
+}
+func (s *EventStorage) DeleteProjects(userId ident.ID, projectIds []ident.ID) error {
+	events, err := s.projectsDeleted(projectIds)
+	if err != nil {
+		return err
+	}
+
+	return s.record(events, func() ([]*event.Event, error) {
+		return events, s.Storage.DeleteProjects(userId, projectIds)
+	})
+}
+
+// projectsDeleted собирает события каскадного удаления проектов: task.deleted для каждой
+// задачи и затем project.deleted, чтобы подписчикам не приходилось выводить удалённых потомков
+func (s *EventStorage) projectsDeleted(projectIds []ident.ID) ([]*event.Event, error) {
+	var events []*event.Event
+	for _, projectId := range projectIds {
+		tasks, err := s.Storage.GetTasksByProject(projectId)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tasks {
+			events = append(events, event.New(event.TaskDeleted, projectId, &event.TaskPayload{ProjectID: projectId, TaskID: t.ID}))
+		}
+		events = append(events, event.New(event.ProjectDeleted, projectId, &event.ProjectPayload{ProjectID: projectId}))
+	}
+	return events, nil
+}
+
+func (s *EventStorage) InsertTask(t *project.Task, projectId ident.ID) error {
+	payload := &event.TaskPayload{ProjectID: projectId, Task: t}
+	e := event.New(event.TaskCreated, projectId, payload)
+
+	return s.record([]*event.Event{e}, func() ([]*event.Event, error) {
+		if err := s.Storage.InsertTask(t, projectId); err != nil {
+			return nil, err
+		}
+		payload.TaskID = t.ID
+		return []*event.Event{e}, nil
+	})
+}
+func (s *EventStorage) UpdateTask(projectId, taskId ident.ID, updateFields bson.M) error {
+	e := event.New(event.TaskUpdated, projectId, &event.TaskPayload{ProjectID: projectId, TaskID: taskId, Changes: updateFields})
+
+	return s.record([]*event.Event{e}, func() ([]*event.Event, error) {
+		if err := s.Storage.UpdateTask(projectId, taskId, updateFields); err != nil {
+			return nil, err
+		}
+		return s.afterTask(e), nil
+	})
+}
+func (s *EventStorage) MoveTask(projectId, taskId ident.ID, status string, position int) error {
+	changes := bson.M{"status": status, "position": position}
+	e := event.New(event.TaskUpdated, projectId, &event.TaskPayload{ProjectID: projectId, TaskID: taskId, Changes: changes})
+
+	return s.record([]*event.Event{e}, func() ([]*event.Event, error) {
+		if err := s.Storage.MoveTask(projectId, taskId, status, position); err != nil {
+			return nil, err
+		}
+		return s.afterTask(e), nil
+	})
+}
+func (s *EventStorage) DeleteTask(projectId, taskId ident.ID) error {
+	e := event.New(event.TaskDeleted, projectId, &event.TaskPayload{ProjectID: projectId, TaskID: taskId})
+
+	return s.record([]*event.Event{e}, func() ([]*event.Event, error) {
+		return []*event.Event{e}, s.Storage.DeleteTask(projectId, taskId)
+	})
+}
+func (s *EventStorage) DeleteTasks(projectId ident.ID, taskIds []ident.ID) error {
+	events := make([]*event.Event, len(taskIds))
+	for i, id := range taskIds {
+		events[i] = event.New(event.TaskDeleted, projectId, &event.TaskPayload{ProjectID: projectId, TaskID: id})
+	}
+
+	return s.record(events, func() ([]*event.Event, error) {
+		return events, s.Storage.DeleteTasks(projectId, taskIds)
+	})
+}
+
+// InsertTasks публикует task.created для каждой вставленной задачи пакета
+func (s *EventStorage) InsertTasks(tasks []*project.Task, projectId ident.ID) ([]error, error) {
+	events := make([]*event.Event, len(tasks))
+	for i, t := range tasks {
+		events[i] = event.New(event.TaskCreated, projectId, &event.TaskPayload{ProjectID: projectId, Task: t})
+	}
+
+	var errs []error
+	err := s.record(events, func() ([]*event.Event, error) {
+		var err error
+		if errs, err = s.Storage.InsertTasks(tasks, projectId); err != nil {
+			return nil, err
+		}
+		var committed []*event.Event
+		for i, e := range events {
+			if errs[i] == nil {
+				e.Data.(*event.TaskPayload).TaskID = tasks[i].ID
+				committed = append(committed, e)
+			}
+		}
+		return committed, nil
+	})
+	return errs, err
+}
+
+// UpdateTasks публикует task.updated для каждой обновлённой задачи пакета
+func (s *EventStorage) UpdateTasks(projectId ident.ID, updates []TaskUpdate) ([]error, error) {
+	events := make([]*event.Event, len(updates))
+	for i, u := range updates {
+		events[i] = event.New(event.TaskUpdated, projectId, &event.TaskPayload{ProjectID: projectId, TaskID: u.ID, Changes: u.Fields})
+	}
+
+	var errs []error
+	err := s.record(events, func() ([]*event.Event, error) {
+		var err error
+		if errs, err = s.Storage.UpdateTasks(projectId, updates); err != nil {
+			return nil, err
+		}
+		var committed []*event.Event
+		for i, e := range events {
+			if errs[i] == nil {
+				committed = append(committed, s.afterTask(e)...)
+			}
+		}
+		return committed, nil
+	})
+	return errs, err
+}
+func (s *EventStorage) SpawnOccurrence(t *project.Task) (*project.Task, error) {
+	payload := &event.TaskPayload{ProjectID: t.ProjectID}
+	e := event.New(event.TaskCreated, t.ProjectID, payload)
+
+	var next *project.Task
+	err := s.record([]*event.Event{e}, func() ([]*event.Event, error) {
+		var err error
+		if next, err = s.Storage.SpawnOccurrence(t); err != nil || next == nil {
+			// Вхождение не создано — событие отменяется
+			return nil, err
+		}
+		payload.TaskID, payload.Task = next.ID, next
+		return []*event.Event{e}, nil
+	})
+	return next, err
+}
+func (s *EventStorage) SetTaskRecurrence(projectId, taskId ident.ID, rule string) error {
+	changes := bson.M{"recurrence": rule}
+	e := event.New(event.TaskUpdated, projectId, &event.TaskPayload{ProjectID: projectId, TaskID: taskId, Changes: changes})
+
+	return s.record([]*event.Event{e}, func() ([]*event.Event, error) {
+		if err := s.Storage.SetTaskRecurrence(projectId, taskId, rule); err != nil {
+			return nil, err
+		}
+		return s.afterTask(e), nil
+	})
+}
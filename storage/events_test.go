@@ -0,0 +1,64 @@
+package storage_test
+
+import (
+	"testing"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/storage"
+	"tmv/user"
+)
+
+// Каскадное удаление публикует события для всех удалённых проектов и задач
+func TestEventStorageCascadeEvents(t *testing.T) {
+	bus := event.NewBus()
+	var got []string
+	bus.Subscribe("*", func(e *event.Event) error {
+		got = append(got, e.Type+" "+e.ProjectID.Hex())
+		return nil
+	})
+	st := storage.NewEventStorage(storage.NewMemoryStorage(), bus)
+
+	u := user.NewUser("Ann", "dev", 30, 1000, "", nil)
+	if err := st.InsertUser(u); err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	newProject := func(name string) *project.Project {
+		p := project.NewProject(u.Id, name, "desc", 5, "author", "resp", "perf", time.Time{}, "", nil, "open")
+		if err := st.InsertProject(p, u.Id); err != nil {
+			t.Fatalf("InsertProject: %v", err)
+		}
+		task := project.NewTask(p.Id, "Design", "desc", 3, "author", "resp", "perf", time.Time{}, "", "todo")
+		if err := st.InsertTask(task, p.Id); err != nil {
+			t.Fatalf("InsertTask: %v", err)
+		}
+		return p
+	}
+	first, second := newProject("Board"), newProject("Roadmap")
+
+	check := func(name string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s: events = %v, want %v", name, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: events = %v, want %v", name, got, want)
+				return
+			}
+		}
+	}
+
+	got = nil
+	if err := st.DeleteProject(first.Id); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	check("DeleteProject", "task.deleted "+first.Id.Hex(), "project.deleted "+first.Id.Hex())
+
+	got = nil
+	if err := st.DeleteUser(u.Id); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	check("DeleteUser", "task.deleted "+second.Id.Hex(), "project.deleted "+second.Id.Hex(), "user.deleted "+ident.Nil.Hex())
+}
@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrEmailTaken — пользователь с таким email уже есть
+var ErrEmailTaken = errors.New("email is already in use")
+
+// Index — индекс, который нужен запросам хранилища. Имя задаётся явно: по нему
+// проверка находит индекс в базе и отличает его от созданных вручную.
+type Index struct {
+	Collection string
+	Name       string
+	Keys       bson.D
+	Unique     bool
+	Sparse     bool
+	Partial    bson.D // partialFilterExpression
+}
+
+func (i Index) model() mongo.IndexModel {
+	opts := options.Index().SetName(i.Name)
+	if i.Unique {
+		opts.SetUnique(true)
+	}
+	if i.Sparse {
+		opts.SetSparse(true)
+	}
+	if i.Partial != nil {
+		opts.SetPartialFilterExpression(i.Partial)
+	}
+	return mongo.IndexModel{Keys: i.Keys, Options: opts}
+}
+
+func asc(fields ...string) bson.D {
+	keys := make(bson.D, len(fields))
+	for i, f := range fields {
+		keys[i] = bson.E{Key: f, Value: 1}
+	}
+	return keys
+}
+
+// collections возвращает коллекции хранилища по имени
+func (m *MongoStorage) collections() map[string]*mongo.Collection {
+	all := make(map[string]*mongo.Collection)
+	for _, c := range []*mongo.Collection{
+		m.UserCollection, m.ProjectCollection, m.TaskCollection, m.SprintCollection, m.WorklogCollection,
+		m.NotificationCollection, m.ReminderCollection, m.CommentCollection, m.WatchCollection,
+		m.WebhookCollection, m.DeliveryCollection, m.OutboxCollection, m.ResumeTokenCollection, m.MigrationCollection,
+	} {
+		all[c.Name()] = c
+	}
+	return all
+}
+
+// Indexes перечисляет индексы, которые хранилище создаёт при запуске
+func (m *MongoStorage) Indexes() []Index {
+	return []Index{
+		// Пустой email не участвует в уникальности: он есть у пользователей, созданных без него
+		{Collection: m.UserCollection.Name(), Name: "email_unique", Keys: asc("email"), Unique: true,
+			Partial: bson.D{{Key: "email", Value: bson.D{{Key: "$gt", Value: ""}}}}},
+
+		{Collection: m.ProjectCollection.Name(), Name: "userId", Keys: asc("userId")},
+
+		// Префикс projectId обслуживает и список задач проекта, и колонку доски по рангу
+		{Collection: m.TaskCollection.Name(), Name: "projectId_status_rank", Keys: asc("projectId", "status", "rank")},
+		{Collection: m.TaskCollection.Name(), Name: "projectId_sprintId", Keys: asc("projectId", "sprintId")},
+		{Collection: m.TaskCollection.Name(), Name: "deadline", Keys: asc("deadline")},
+		{Collection: m.TaskCollection.Name(), Name: "recurrence_spawned", Keys: asc("recurrence.spawned"), Sparse: true},
+
+		{Collection: m.SprintCollection.Name(), Name: "projectId_start", Keys: asc("projectId", "start")},
+
+		{Collection: m.WorklogCollection.Name(), Name: "projectId_taskId_started", Keys: asc("projectId", "taskId", "started")},
+		// У пользователя может идти только один таймер: второй StartTimer не пройдёт индекс
+		{Collection: m.WorklogCollection.Name(), Name: "userId_running_unique", Keys: asc("userId", "running"), Unique: true,
+			Partial: bson.D{{Key: "running", Value: true}}},
+
+		{Collection: m.NotificationCollection.Name(), Name: "userId_dateCreation", Keys: bson.D{
+			{Key: "userId", Value: 1}, {Key: "dateCreation", Value: -1}, {Key: "_id", Value: -1},
+		}},
+
+		{Collection: m.CommentCollection.Name(), Name: "projectId_taskId_dateCreation", Keys: asc("projectId", "taskId", "dateCreation")},
+
+		{Collection: m.WatchCollection.Name(), Name: "userId_kind_targetId_unique", Keys: asc("userId", "kind", "targetId"), Unique: true},
+		{Collection: m.WatchCollection.Name(), Name: "kind_targetId", Keys: asc("kind", "targetId")},
+
+		{Collection: m.WebhookCollection.Name(), Name: "projectId", Keys: asc("projectId")},
+
+		{Collection: m.DeliveryCollection.Name(), Name: "webhookId_dateCreation", Keys: bson.D{
+			{Key: "webhookId", Value: 1}, {Key: "dateCreation", Value: -1},
+		}},
+		{Collection: m.DeliveryCollection.Name(), Name: "status_nextAttempt", Keys: asc("status", "nextAttempt")},
+
+		{Collection: m.OutboxCollection.Name(), Name: "failed_nextAttempt", Keys: asc("failed", "nextAttempt", "_id")},
+	}
+}
+
+// EnsureIndexes создаёт недостающие индексы. Уже существующие с тем же определением
+// MongoDB пропускает, поэтому вызов безопасно повторять при каждом запуске.
+// Ошибка одной коллекции не мешает остальным; возвращаются все ошибки сразу.
+func (m *MongoStorage) EnsureIndexes(ctx context.Context) error {
+	byCollection := make(map[string][]mongo.IndexModel)
+	var names []string
+	for _, idx := range m.Indexes() {
+		if _, ok := byCollection[idx.Collection]; !ok {
+			names = append(names, idx.Collection)
+		}
+		byCollection[idx.Collection] = append(byCollection[idx.Collection], idx.model())
+	}
+
+	collections := m.collections()
+	var problems []string
+	for _, name := range names {
+		if _, err := collections[name].Indexes().CreateMany(ctx, byCollection[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("create indexes: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// IndexInfo — индекс, найденный в базе
+type IndexInfo struct {
+	Collection string
+	Name       string
+	Keys       bson.D
+	Unique     bool
+	Sparse     bool
+	Partial    bson.D
+	Declared   bool // Есть в Indexes
+}
+
+type indexDocument struct {
+	Name    string `bson:"name"`
+	Keys    bson.D `bson:"key"`
+	Unique  bool   `bson:"unique"`
+	Sparse  bool   `bson:"sparse"`
+	Partial bson.D `bson:"partialFilterExpression"`
+}
+
+// ListIndexes возвращает индексы всех коллекций хранилища, кроме обязательного _id_
+func (m *MongoStorage) ListIndexes(ctx context.Context) ([]IndexInfo, error) {
+	declared := make(map[string]bool)
+	for _, idx := range m.Indexes() {
+		declared[idx.Collection+"."+idx.Name] = true
+	}
+
+	collections := m.collections()
+	names := make([]string, 0, len(collections))
+	for name := range collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var indexes []IndexInfo
+	for _, name := range names {
+		cursor, err := collections[name].Indexes().List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		var docs []indexDocument
+		if err := cursor.All(ctx, &docs); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, d := range docs {
+			if d.Name == "_id_" {
+				continue
+			}
+			indexes = append(indexes, IndexInfo{
+				Collection: name,
+				Name:       d.Name,
+				Keys:       d.Keys,
+				Unique:     d.Unique,
+				Sparse:     d.Sparse,
+				Partial:    d.Partial,
+				Declared:   declared[name+"."+d.Name],
+			})
+		}
+	}
+	return indexes, nil
+}
+
+// Виды расхождений индексов с объявленными
+const (
+	IndexMissing    = "missing"
+	IndexDiffers    = "definition differs"
+	IndexUndeclared = "not declared"
+)
+
+// IndexMismatch — расхождение одного индекса с объявленными
+type IndexMismatch struct {
+	Collection string
+	Name       string
+	Problem    string // IndexMissing, IndexDiffers или IndexUndeclared
+}
+
+func (m IndexMismatch) String() string {
+	return m.Collection + "." + m.Name + ": " + m.Problem
+}
+
+// VerifyIndexes сравнивает индексы в базе с объявленными: отсутствующие, отличающиеся
+// определением и лишние. Пустой список — всё совпадает.
+func (m *MongoStorage) VerifyIndexes(ctx context.Context) ([]IndexMismatch, error) {
+	existing, err := m.ListIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]IndexInfo, len(existing))
+	for _, info := range existing {
+		found[info.Collection+"."+info.Name] = info
+	}
+
+	var mismatches []IndexMismatch
+	for _, idx := range m.Indexes() {
+		info, ok := found[idx.Collection+"."+idx.Name]
+		if !ok {
+			mismatches = append(mismatches, IndexMismatch{idx.Collection, idx.Name, IndexMissing})
+			continue
+		}
+		if !sameIndex(idx, info) {
+			mismatches = append(mismatches, IndexMismatch{idx.Collection, idx.Name, IndexDiffers})
+		}
+	}
+	for _, info := range existing {
+		if !info.Declared {
+			mismatches = append(mismatches, IndexMismatch{info.Collection, info.Name, IndexUndeclared})
+		}
+	}
+	return mismatches, nil
+}
+
+func sameIndex(idx Index, info IndexInfo) bool {
+	if idx.Unique != info.Unique || idx.Sparse != info.Sparse {
+		return false
+	}
+	// Значения ключей приходят из базы как int32 или double, поэтому сравниваются как текст
+	return fmt.Sprint(keyValues(idx.Keys)) == fmt.Sprint(keyValues(info.Keys)) &&
+		fmt.Sprint(idx.Partial) == fmt.Sprint(info.Partial)
+}
+
+func keyValues(keys bson.D) []string {
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = fmt.Sprintf("%s:%v", k.Key, k.Value)
+	}
+	return values
+}
+
+// DropIndex удаляет индекс name из коллекции collection
+func (m *MongoStorage) DropIndex(ctx context.Context, collection, name string) error {
+	c, ok := m.collections()[collection]
+	if !ok {
+		return fmt.Errorf("unknown collection %q", collection)
+	}
+	_, err := c.Indexes().DropOne(ctx, name)
+	return err
+}
@@ -1,57 +1,572 @@
 package storage
 
-// import (
-// 	"errors"
-// 	"sync"
-// 	"tmv/user"
-// )
-
-// type MemoryStorage struct {
-// 	Counter int
-// 	Data    map[int]user.User
-// 	sync.Mutex
-// }
-
-// func NewMemoryStorage() *MemoryStorage {
-// 	return &MemoryStorage{
-// 		Counter: 1,
-// 		Data:    make(map[int]user.User),
-// 	}
-// }
-
-// func (m *MemoryStorage) GetAll() map[int]user.User {
-// 	m.Lock()
-// 	defer m.Unlock()
-
-// 	return m.Data
-// }
-// func (m *MemoryStorage) Get(id int) (user.User, error) {
-// 	m.Lock()
-// 	defer m.Unlock()
-// 	user, ok := m.Data[id]
-// 	if !ok {
-// 		return user, errors.New("user not found")
-// 	}
-// 	return user, nil
-// }
-
-// func (m *MemoryStorage) Insert(e *user.User) {
-// 	m.Lock()
-// 	defer m.Unlock()
-// 	e.UserId = m.Counter
-
-// 	m.Data[e.UserId] = *e
-// 	m.Counter++
-// }
-// func (m *MemoryStorage) Update(id int, e *user.User) {
-// 	m.Lock()
-// 	defer m.Unlock()
-
-// 	m.Data[id] = *e
-// }
-// func (m *MemoryStorage) Delete(id int) {
-// 	m.Lock()
-// 	defer m.Unlock()
-
-// 	delete(m.Data, id)
-// }
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MemoryStorage — хранилище в памяти процесса для тестов и запуска без базы.
+// Документы хранятся в BSON, как в MongoStorage: чтение всегда отдаёт копию, время
+// округляется до миллисекунд, а частичное обновление ведёт себя как $set.
+// Списки проектов пользователя и задач проекта выводятся из самих проектов и задач.
+type MemoryStorage struct {
+	mu sync.Mutex
+
+	users         *memCollection
+	projects      *memCollection
+	tasks         *memCollection
+	sprints       *memCollection
+	worklogs      *memCollection
+	notifications *memCollection
+	comments      *memCollection
+	watches       *memCollection
+	webhooks      *memCollection
+	deliveries    *memCollection
+	outbox        *memCollection
+	reminders     map[string]time.Time
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		users:         newMemCollection(),
+		projects:      newMemCollection(),
+		tasks:         newMemCollection(),
+		sprints:       newMemCollection(),
+		worklogs:      newMemCollection(),
+		notifications: newMemCollection(),
+		comments:      newMemCollection(),
+		watches:       newMemCollection(),
+		webhooks:      newMemCollection(),
+		deliveries:    newMemCollection(),
+		outbox:        newMemCollection(),
+		reminders:     make(map[string]time.Time),
+	}
+}
+
+// memCollection — документы одной коллекции в порядке вставки
+type memCollection struct {
+	order []ident.ID
+	docs  map[ident.ID]bson.Raw
+}
+
+func newMemCollection() *memCollection {
+	return &memCollection{docs: make(map[ident.ID]bson.Raw)}
+}
+
+// put вставляет документ или заменяет существующий
+func (c *memCollection) put(id ident.ID, v interface{}) error {
+	doc, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.docs[id]; !ok {
+		c.order = append(c.order, id)
+	}
+	c.docs[id] = doc
+	return nil
+}
+
+// get читает документ в out; false — документа нет
+func (c *memCollection) get(id ident.ID, out interface{}) (bool, error) {
+	doc, ok := c.docs[id]
+	if !ok {
+		return false, nil
+	}
+	return true, bson.Unmarshal(doc, out)
+}
+
+func (c *memCollection) remove(id ident.ID) bool {
+	if _, ok := c.docs[id]; !ok {
+		return false
+	}
+	delete(c.docs, id)
+	for i, v := range c.order {
+		if v == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// each передаёт документы fn в порядке вставки
+func (c *memCollection) each(fn func(doc bson.Raw) error) error {
+	for _, id := range c.order {
+		if err := fn(c.docs[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set применяет частичное обновление, как $set в MongoDB, и перечитывает документ в out.
+// Значение не того типа отклоняется с ErrInvalidUpdate, неизвестные поля отбрасываются.
+// false — документа нет.
+func (c *memCollection) set(id ident.ID, fields bson.M, out interface{}) (bool, error) {
+	doc, ok := c.docs[id]
+	if !ok {
+		return false, nil
+	}
+	if _, ok := fields["_id"]; ok {
+		return false, fmt.Errorf("%w: field \"_id\" cannot be updated", ErrInvalidUpdate)
+	}
+
+	var m bson.M
+	if err := bson.Unmarshal(doc, &m); err != nil {
+		return false, err
+	}
+	for k, v := range fields {
+		m[k] = v
+	}
+	updated, err := bson.Marshal(m)
+	if err == nil {
+		err = bson.Unmarshal(updated, out)
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidUpdate, err)
+	}
+	return true, c.put(id, out)
+}
+
+func idLess(a, b ident.ID) bool {
+	return bytes.Compare(a[:], b[:]) < 0
+}
+
+// memChildIDs собирает id документов коллекции по родителю из поля parentKey:
+// задачи по проектам или проекты по пользователям
+func memChildIDs(c *memCollection, parentKey string) (map[ident.ID][]ident.ID, error) {
+	children := make(map[ident.ID][]ident.ID)
+	err := c.each(func(doc bson.Raw) error {
+		parent, err := docID(doc, parentKey)
+		if err != nil {
+			return err
+		}
+		id, err := docID(doc, "_id")
+		if err != nil {
+			return err
+		}
+		children[parent] = append(children[parent], id)
+		return nil
+	})
+	return children, err
+}
+
+// docID читает идентификатор из поля документа; отсутствующее поле — нулевой id
+func docID(doc bson.Raw, key string) (ident.ID, error) {
+	var id ident.ID
+	v := doc.Lookup(key)
+	if v.Type == 0 {
+		return id, nil
+	}
+	return id, id.UnmarshalBSONValue(v.Type, v.Value)
+}
+
+func (m *MemoryStorage) findUsers(match func(u *user.User) bool) ([]user.User, error) {
+	projects, err := memChildIDs(m.projects, "userId")
+	if err != nil {
+		return nil, err
+	}
+	var users []user.User
+	err = m.users.each(func(doc bson.Raw) error {
+		var u user.User
+		if err := bson.Unmarshal(doc, &u); err != nil {
+			return err
+		}
+		if match == nil || match(&u) {
+			u.Projects = projects[u.Id]
+			users = append(users, u)
+		}
+		return nil
+	})
+	return users, err
+}
+
+// emailTaken повторяет частичный уникальный индекс email_unique: пустой email не участвует
+func (m *MemoryStorage) emailTaken(email string, except ident.ID) (bool, error) {
+	if email == "" {
+		return false, nil
+	}
+	users, err := m.findUsers(func(u *user.User) bool { return u.Email == email && u.Id != except })
+	return len(users) > 0, err
+}
+
+func (m *MemoryStorage) GetAllUsers() map[ident.ID]user.User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := make(map[ident.ID]user.User)
+	list, err := m.findUsers(nil)
+	if err != nil {
+		return users // return empty map if there's an error
+	}
+	for _, u := range list {
+		users[u.Id] = u
+	}
+	return users
+}
+func (m *MemoryStorage) GetUser(userId ident.ID) (user.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users, err := m.findUsers(func(u *user.User) bool { return u.Id == userId })
+	if err != nil {
+		return user.User{}, err
+	}
+	if len(users) == 0 {
+		return user.User{}, errors.New("user not found")
+	}
+	return users[0], nil
+}
+func (m *MemoryStorage) InsertUser(u *user.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	taken, err := m.emailTaken(u.Email, ident.Nil)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	u.Id = ident.New()
+	return m.users.put(u.Id, u)
+}
+
+// UpdateUser перезаписывает поля пользователя; список проектов следует из самих проектов и здесь не меняется
+func (m *MemoryStorage) UpdateUser(userId ident.ID, e *user.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users.docs[userId]; !ok {
+		return nil
+	}
+	taken, err := m.emailTaken(e.Email, userId)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	updated := *e
+	updated.Id = userId
+	updated.Projects = nil
+	return m.users.put(userId, &updated)
+}
+
+// DeleteUser удаляет пользователя вместе с его проектами и уведомлениями
+func (m *MemoryStorage) DeleteUser(userId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users.remove(userId)
+	return m.removeUserData(userId)
+}
+
+func (m *MemoryStorage) findProjects(match func(p *project.Project) bool) ([]project.Project, error) {
+	tasks, err := memChildIDs(m.tasks, "projectId")
+	if err != nil {
+		return nil, err
+	}
+	var projects []project.Project
+	err = m.projects.each(func(doc bson.Raw) error {
+		var p project.Project
+		if err := bson.Unmarshal(doc, &p); err != nil {
+			return err
+		}
+		if match == nil || match(&p) {
+			p.Tasks = tasks[p.Id]
+			projects = append(projects, p)
+		}
+		return nil
+	})
+	return projects, err
+}
+
+func (m *MemoryStorage) GetAllProjects() map[ident.ID]project.Project {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	projects := make(map[ident.ID]project.Project)
+	list, err := m.findProjects(nil)
+	if err != nil {
+		return projects // return empty map if there's an error
+	}
+	for _, p := range list {
+		projects[p.Id] = p
+	}
+	return projects
+}
+func (m *MemoryStorage) GetProjectByUser(userId ident.ID) ([]project.Project, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findProjects(func(p *project.Project) bool { return p.UserID == userId })
+}
+func (m *MemoryStorage) GetProject(userId, projectId ident.ID) (*project.Project, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	projects, err := m.findProjects(func(p *project.Project) bool { return p.Id == projectId && p.UserID == userId })
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, fmt.Errorf("проект не найден")
+	}
+	return &projects[0], nil
+}
+
+// DeleteProject удаляет проект вместе с его задачами, спринтами и прочими данными
+func (m *MemoryStorage) DeleteProject(id ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.projects.remove(id) {
+		return errors.New("project not found")
+	}
+	return m.removeProjectData([]ident.ID{id})
+}
+
+// DeleteProjects удаляет проекты по id; как и в MongoDB, владелец проектов не проверяется
+func (m *MemoryStorage) DeleteProjects(userID ident.ID, projectIDs []ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range projectIDs {
+		m.projects.remove(id)
+	}
+	return m.removeProjectData(projectIDs)
+}
+func (m *MemoryStorage) UpdateProject(projectID ident.ID, updateFields bson.M) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.projects.set(projectID, updateFields, &project.Project{})
+	return err
+}
+func (m *MemoryStorage) InsertProject(p *project.Project, userID ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users.docs[userID]; !ok {
+		return errors.New("user not found")
+	}
+
+	p.Id = ident.New()
+	p.UserID = userID
+	return m.projects.put(p.Id, p)
+}
+
+func (m *MemoryStorage) findTasks(match func(t *project.Task) bool) ([]project.Task, error) {
+	var tasks []project.Task
+	err := m.tasks.each(func(doc bson.Raw) error {
+		var t project.Task
+		if err := bson.Unmarshal(doc, &t); err != nil {
+			return err
+		}
+		if match == nil || match(&t) {
+			tasks = append(tasks, t)
+		}
+		return nil
+	})
+	return tasks, err
+}
+
+func (m *MemoryStorage) GetAllTasks() map[ident.ID]project.Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tasks := make(map[ident.ID]project.Task)
+	list, err := m.findTasks(nil)
+	if err != nil {
+		return tasks // return empty map if there's an error
+	}
+	for _, t := range list {
+		tasks[t.ID] = t
+	}
+	return tasks
+}
+func (m *MemoryStorage) GetTasksByProject(projectId ident.ID) ([]project.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findTasks(func(t *project.Task) bool { return t.ProjectID == projectId })
+}
+func (m *MemoryStorage) InsertTask(t *project.Task, projectId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertTask(t, projectId)
+}
+func (m *MemoryStorage) insertTask(t *project.Task, projectId ident.ID) error {
+	if _, ok := m.projects.docs[projectId]; !ok {
+		return errors.New("project not found")
+	}
+
+	t.ID = ident.New()
+	t.ProjectID = projectId
+	if t.DateCreation.IsZero() {
+		t.DateCreation = time.Now()
+	}
+	if t.Remaining == 0 {
+		t.Remaining = t.Estimate
+	}
+	// История статусов ведётся только хранилищем
+	t.StatusHistory = []project.StatusChange{{Status: t.Status, At: t.DateCreation}}
+	if t.Recurrence != nil {
+		t.Recurrence.Spawned = false
+		startRecurrence(t)
+	}
+
+	// Новая задача встаёт в конец колонки своего статуса
+	lastRank, err := m.lastRank(projectId, t.Status)
+	if err != nil {
+		return err
+	}
+	t.Rank = project.RankBetween(lastRank, "")
+
+	return m.tasks.put(t.ID, t)
+}
+func (m *MemoryStorage) GetTask(projectId, taskId ident.ID) (*project.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.getTask(projectId, taskId)
+}
+
+// getTask возвращает задачу проекта; nil — задачи нет
+func (m *MemoryStorage) getTask(projectId, taskId ident.ID) (*project.Task, error) {
+	var t project.Task
+	found, err := m.tasks.get(taskId, &t)
+	if err != nil || !found || t.ProjectID != projectId {
+		return nil, err
+	}
+	return &t, nil
+}
+func (m *MemoryStorage) DeleteTask(projectId, taskId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deleteTasks(projectId, []ident.ID{taskId})
+}
+func (m *MemoryStorage) DeleteTasks(projectId ident.ID, taskIds []ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deleteTasks(projectId, taskIds)
+}
+func (m *MemoryStorage) deleteTasks(projectId ident.ID, taskIds []ident.ID) error {
+	var removed []ident.ID
+	for _, id := range taskIds {
+		task, err := m.getTask(projectId, id)
+		if err != nil {
+			return err
+		}
+		if task != nil {
+			m.tasks.remove(id)
+			removed = append(removed, id)
+		}
+	}
+	return m.removeTaskData(removed)
+}
+func (m *MemoryStorage) UpdateTask(projectId, taskId ident.ID, updateFields bson.M) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.updateTask(projectId, taskId, updateFields)
+	return err
+}
+
+// updateTask применяет частичное обновление и пополняет историю при смене статуса; false — задачи нет
+func (m *MemoryStorage) updateTask(projectId, taskId ident.ID, updateFields bson.M) (bool, error) {
+	// История статусов и повторение меняются только через отдельные методы, ранг — только через MoveTask
+	delete(updateFields, "statusHistory")
+	delete(updateFields, "recurrence")
+	delete(updateFields, "rank")
+	updateFields, err := NormalizeTaskUpdate(updateFields)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := m.getTask(projectId, taskId)
+	if err != nil || current == nil {
+		return false, err
+	}
+	if status, ok := updateFields["status"].(string); ok && status != current.Status {
+		// В новой колонке задача встаёт последней, как при создании
+		last, err := m.lastRank(projectId, status)
+		if err != nil {
+			return false, err
+		}
+		updateFields["rank"] = project.RankBetween(last, "")
+	}
+
+	var t project.Task
+	if _, err := m.tasks.set(taskId, updateFields, &t); err != nil {
+		return false, err
+	}
+	if t.Status != current.Status {
+		t.StatusHistory = append(t.StatusHistory, project.StatusChange{Status: t.Status, At: time.Now()})
+		return true, m.tasks.put(taskId, &t)
+	}
+	return true, nil
+}
+func (m *MemoryStorage) MoveTask(projectId, taskId ident.ID, status string, position int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Задачи целевой колонки в текущем порядке, без перемещаемой
+	column, err := m.findTasks(func(t *project.Task) bool {
+		return t.ProjectID == projectId && t.Status == status && t.ID != taskId
+	})
+	if err != nil {
+		return err
+	}
+	project.SortByRank(column)
+	rank, rerank := project.PlaceRank(column, position)
+
+	t, err := m.getTask(projectId, taskId)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return errors.New("task not found")
+	}
+	if t.Status != status {
+		t.StatusHistory = append(t.StatusHistory, project.StatusChange{Status: status, At: time.Now()})
+	}
+	t.Status = status
+	t.Rank = rank
+	if err := m.tasks.put(taskId, t); err != nil {
+		return err
+	}
+	for id, rank := range rerank {
+		if _, err := m.tasks.set(id, bson.M{"rank": rank}, &project.Task{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (m *MemoryStorage) lastRank(projectId ident.ID, status string) (string, error) {
+	column, err := m.findTasks(func(t *project.Task) bool { return t.ProjectID == projectId && t.Status == status })
+	if err != nil {
+		return "", err
+	}
+	var last string
+	for _, t := range column {
+		if t.Rank > last {
+			last = t.Rank
+		}
+	}
+	return last, nil
+}
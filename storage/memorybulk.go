@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"errors"
+	"tmv/ident"
+	"tmv/project"
+)
+
+// InsertTasks вставляет задачи проекта под одной блокировкой
+func (m *MemoryStorage) InsertTasks(tasks []*project.Task, projectId ident.ID) ([]error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.projects.docs[projectId]; !ok {
+		return nil, errors.New("project not found")
+	}
+	errs := make([]error, len(tasks))
+	for i, t := range tasks {
+		errs[i] = m.insertTask(t, projectId)
+	}
+	return errs, nil
+}
+
+// UpdateTasks применяет частичные обновления задач проекта; отсутствующей задаче соответствует ErrTaskNotFound
+func (m *MemoryStorage) UpdateTasks(projectId ident.ID, updates []TaskUpdate) ([]error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errs := make([]error, len(updates))
+	for i, u := range updates {
+		found, err := m.updateTask(projectId, u.ID, u.Fields)
+		if err == nil && !found {
+			err = ErrTaskNotFound
+		}
+		errs[i] = err
+	}
+	return errs, nil
+}
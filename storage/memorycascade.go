@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"tmv/ident"
+	"tmv/project"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Каскадное удаление: дочерние документы уходят вместе с родителем, как и в MongoStorage;
+// вебхуки удалённого проекта только помечаются до доставки project.deleted
+
+// removeUserData удаляет проекты и уведомления пользователя
+func (m *MemoryStorage) removeUserData(userId ident.ID) error {
+	projects, err := m.removeChildren(m.projects, "userId", []ident.ID{userId})
+	if err != nil {
+		return err
+	}
+	if err := m.removeProjectData(projects); err != nil {
+		return err
+	}
+	_, err = m.removeChildren(m.notifications, "userId", []ident.ID{userId})
+	return err
+}
+
+// removeProjectData удаляет всё, что принадлежит удалённым проектам
+func (m *MemoryStorage) removeProjectData(projectIDs []ident.ID) error {
+	webhooks, err := memChildIDs(m.webhooks, "projectId")
+	if err != nil {
+		return err
+	}
+	for _, projectId := range projectIDs {
+		for _, id := range webhooks[projectId] {
+			if _, err := m.webhooks.set(id, bson.M{"projectDeleted": true}, &project.Webhook{}); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range []*memCollection{m.comments, m.worklogs, m.sprints, m.tasks} {
+		if _, err := m.removeChildren(c, "projectId", projectIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTaskData удаляет списания и комментарии удалённых задач
+func (m *MemoryStorage) removeTaskData(taskIDs []ident.ID) error {
+	for _, c := range []*memCollection{m.comments, m.worklogs} {
+		if _, err := m.removeChildren(c, "taskId", taskIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeChildren удаляет документы коллекции, у которых поле parentKey — один из parents,
+// и возвращает их id
+func (m *MemoryStorage) removeChildren(c *memCollection, parentKey string, parents []ident.ID) ([]ident.ID, error) {
+	if len(parents) == 0 {
+		return nil, nil
+	}
+	children, err := memChildIDs(c, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	var removed []ident.ID
+	for _, parent := range parents {
+		for _, id := range children[parent] {
+			c.remove(id)
+			removed = append(removed, id)
+		}
+	}
+	return removed, nil
+}
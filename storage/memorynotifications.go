@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (m *MemoryStorage) findNotifications(match func(n *user.Notification) bool) ([]user.Notification, error) {
+	notifications := []user.Notification{}
+	err := m.notifications.each(func(doc bson.Raw) error {
+		var n user.Notification
+		if err := bson.Unmarshal(doc, &n); err != nil {
+			return err
+		}
+		if match == nil || match(&n) {
+			notifications = append(notifications, n)
+		}
+		return nil
+	})
+	return notifications, err
+}
+
+func (m *MemoryStorage) InsertNotification(n *user.Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n.Id = ident.New()
+	if n.DateCreation.IsZero() {
+		n.DateCreation = time.Now()
+	}
+	return m.notifications.put(n.Id, n)
+}
+
+// isDueBefore — срок задан и наступает не позже t; нулевой срок (0001-01-01) означает, что срока нет
+func isDueBefore(deadline, t time.Time) bool {
+	return deadline.After(time.Unix(0, 0)) && !deadline.After(t)
+}
+
+// GetTasksDueBefore возвращает задачи со сроком не позже t (включая просроченные)
+func (m *MemoryStorage) GetTasksDueBefore(t time.Time) ([]project.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findTasks(func(task *project.Task) bool { return isDueBefore(task.Deadline, t) })
+}
+
+// GetProjectsDueBefore возвращает проекты со сроком не позже t (включая просроченные)
+func (m *MemoryStorage) GetProjectsDueBefore(t time.Time) ([]project.Project, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findProjects(func(p *project.Project) bool { return isDueBefore(p.Deadline, t) })
+}
+
+// MarkReminderSent отмечает напоминание с ключом key как отправленное; false — оно уже было отправлено
+func (m *MemoryStorage) MarkReminderSent(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.reminders[key]; ok {
+		return false, nil
+	}
+	m.reminders[key] = time.Now()
+	return true, nil
+}
+
+// GetNotifications возвращает страницу входящих пользователя, новые сверху, и общее число записей
+func (m *MemoryStorage) GetNotifications(userId ident.ID, unreadOnly bool, offset, limit int64) ([]user.Notification, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	notifications, err := m.findNotifications(func(n *user.Notification) bool {
+		return n.UserID == userId && !(unreadOnly && n.Read)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		a, b := notifications[i], notifications[j]
+		if !a.DateCreation.Equal(b.DateCreation) {
+			return a.DateCreation.After(b.DateCreation)
+		}
+		return idLess(b.Id, a.Id)
+	})
+
+	total := int64(len(notifications))
+	if offset > total {
+		offset = total
+	}
+	page := notifications[offset:]
+	// limit 0, как и в MongoDB, — без ограничения
+	if limit > 0 && limit < int64(len(page)) {
+		page = page[:limit]
+	}
+	return page, total, nil
+}
+func (m *MemoryStorage) CountUnreadNotifications(userId ident.ID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unread, err := m.findNotifications(func(n *user.Notification) bool { return n.UserID == userId && !n.Read })
+	return int64(len(unread)), err
+}
+func (m *MemoryStorage) MarkNotificationRead(userId, notificationId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n user.Notification
+	found, err := m.notifications.get(notificationId, &n)
+	if err != nil {
+		return err
+	}
+	if !found || n.UserID != userId {
+		return errors.New("notification not found")
+	}
+	n.Read = true
+	return m.notifications.put(n.Id, &n)
+}
+func (m *MemoryStorage) MarkAllNotificationsRead(userId ident.ID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unread, err := m.findNotifications(func(n *user.Notification) bool { return n.UserID == userId && !n.Read })
+	if err != nil {
+		return 0, err
+	}
+	for i := range unread {
+		unread[i].Read = true
+		if err := m.notifications.put(unread[i].Id, &unread[i]); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(unread)), nil
+}
+
+func (m *MemoryStorage) findWatches(match func(w *user.Watch) bool) ([]user.Watch, error) {
+	var watches []user.Watch
+	err := m.watches.each(func(doc bson.Raw) error {
+		var w user.Watch
+		if err := bson.Unmarshal(doc, &w); err != nil {
+			return err
+		}
+		if match(&w) {
+			watches = append(watches, w)
+		}
+		return nil
+	})
+	return watches, err
+}
+
+// Watch подписывает пользователя на проект или задачу; повторная подписка ничего не меняет
+func (m *MemoryStorage) Watch(w *user.Watch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if w.Kind == user.WatchTask {
+		t, err := m.getTask(w.ProjectID, w.TargetID)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return errors.New("task not found")
+		}
+	} else if _, ok := m.projects.docs[w.TargetID]; !ok {
+		return errors.New("project not found")
+	}
+
+	existing, err := m.findWatches(func(x *user.Watch) bool {
+		return x.UserID == w.UserID && x.Kind == w.Kind && x.TargetID == w.TargetID
+	})
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	watch := *w
+	watch.Id = ident.New()
+	watch.DateCreation = time.Now()
+	return m.watches.put(watch.Id, &watch)
+}
+func (m *MemoryStorage) Unwatch(userId ident.ID, kind string, targetId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, err := m.findWatches(func(w *user.Watch) bool {
+		return w.UserID == userId && w.Kind == kind && w.TargetID == targetId
+	})
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return errors.New("watch not found")
+	}
+	for _, w := range existing {
+		m.watches.remove(w.Id)
+	}
+	return nil
+}
+
+// GetWatchers возвращает подписчиков задачи и её проекта без повторов
+func (m *MemoryStorage) GetWatchers(projectId, taskId ident.ID) ([]ident.ID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	watches, err := m.findWatches(func(w *user.Watch) bool {
+		return (w.Kind == user.WatchProject && w.TargetID == projectId) || (w.Kind == user.WatchTask && w.TargetID == taskId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[ident.ID]bool)
+	var ids []ident.ID
+	for _, w := range watches {
+		if !seen[w.UserID] {
+			seen[w.UserID] = true
+			ids = append(ids, w.UserID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return idLess(ids[i], ids[j]) })
+	return ids, nil
+}
+
+func (m *MemoryStorage) InsertComment(cm *project.Comment, projectId, taskId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkTask(projectId, taskId); err != nil {
+		return err
+	}
+
+	cm.Id = ident.New()
+	cm.ProjectID = projectId
+	cm.TaskID = taskId
+	if cm.DateCreation.IsZero() {
+		cm.DateCreation = time.Now()
+	}
+	return m.comments.put(cm.Id, cm)
+}
+func (m *MemoryStorage) GetCommentsByTask(projectId, taskId ident.ID) ([]project.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comments := []project.Comment{}
+	err := m.comments.each(func(doc bson.Raw) error {
+		var cm project.Comment
+		if err := bson.Unmarshal(doc, &cm); err != nil {
+			return err
+		}
+		if cm.ProjectID == projectId && cm.TaskID == taskId {
+			comments = append(comments, cm)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].DateCreation.Before(comments[j].DateCreation) })
+	return comments, nil
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"sort"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (m *MemoryStorage) InsertOutbox(r *event.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.outbox.put(r.Id, r)
+}
+
+// UpdateOutbox сохраняет данные, список обработавших подписчиков и время следующей попытки
+func (m *MemoryStorage) UpdateOutbox(r *event.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stored event.Record
+	found, err := m.outbox.get(r.Id, &stored)
+	if err != nil || !found {
+		return err
+	}
+	stored.ProjectID = r.ProjectID
+	stored.Payload = r.Payload
+	stored.Done = r.Done
+	stored.Attempts = r.Attempts
+	stored.LastError = r.LastError
+	stored.Failed = r.Failed
+	stored.NextAttempt = r.NextAttempt
+	return m.outbox.put(r.Id, &stored)
+}
+func (m *MemoryStorage) DeleteOutbox(id ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.outbox.remove(id)
+	return nil
+}
+
+// ClaimOutbox забирает самую старую запись, чья очередь наступила к now, и откладывает её на lease.
+// nil — записей нет.
+func (m *MemoryStorage) ClaimOutbox(now time.Time, lease time.Duration) (*event.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []event.Record
+	err := m.outbox.each(func(doc bson.Raw) error {
+		var r event.Record
+		if err := bson.Unmarshal(doc, &r); err != nil {
+			return err
+		}
+		if !r.Failed && !r.NextAttempt.After(now) {
+			due = append(due, r)
+		}
+		return nil
+	})
+	if err != nil || len(due) == 0 {
+		return nil, err
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttempt.Equal(due[j].NextAttempt) {
+			return due[i].NextAttempt.Before(due[j].NextAttempt)
+		}
+		return idLess(due[i].Id, due[j].Id)
+	})
+
+	r := due[0]
+	r.NextAttempt = now.Add(lease)
+	if err := m.outbox.put(r.Id, &r); err != nil {
+		return nil, err
+	}
+	var claimed event.Record
+	if _, err := m.outbox.get(r.Id, &claimed); err != nil {
+		return nil, err
+	}
+	return &claimed, nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"tmv/ident"
+	"tmv/project"
+)
+
+// GetRecurringTasks возвращает повторяющиеся задачи, для которых следующее вхождение ещё не создано
+func (m *MemoryStorage) GetRecurringTasks() ([]project.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findTasks(func(t *project.Task) bool { return t.Recurrence != nil && !t.Recurrence.Spawned })
+}
+
+// SpawnOccurrence создаёт следующее вхождение серии; nil — создавать нечего
+func (m *MemoryStorage) SpawnOccurrence(t *project.Task) (*project.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stored project.Task
+	found, err := m.tasks.get(t.ID, &stored)
+	if err != nil {
+		return nil, err
+	}
+	if !found || stored.Recurrence == nil || stored.Recurrence.Spawned {
+		return nil, nil
+	}
+
+	// Отметка ставится после вставки: при ошибке серия продолжится на следующем проходе
+	// Если серия закончилась по COUNT или UNTIL, next == nil и задача просто помечается
+	next, ok := t.NextOccurrence()
+	if ok {
+		if err := m.insertTask(next, t.ProjectID); err != nil {
+			return nil, err
+		}
+	}
+
+	stored.Recurrence.Spawned = true
+	if err := m.tasks.put(stored.ID, &stored); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// SetTaskRecurrence задаёт правило повторения задачи; пустое правило отключает повторение
+func (m *MemoryStorage) SetTaskRecurrence(projectId, taskId ident.ID, rule string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, err := m.getTask(projectId, taskId)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return errors.New("task not found")
+	}
+
+	if rule == "" {
+		task.Recurrence = nil
+	} else {
+		if task.Recurrence == nil {
+			task.Recurrence = &project.Recurrence{}
+		}
+		task.Recurrence.Rule = rule
+		startRecurrence(task)
+	}
+	return m.tasks.put(taskId, task)
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"errors"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/report"
+)
+
+// GetWorkload агрегирует открытые задачи по ответственным и исполнителям, как конвейер MongoDB в reports.go
+func (m *MemoryStorage) GetWorkload(projectId ident.ID, from, to time.Time, interval string) ([]report.Workload, error) {
+	if _, ok := report.PeriodFormat(interval); !ok {
+		return nil, errors.New("invalid interval")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tasks, err := m.findTasks(func(t *project.Task) bool { return projectId.IsZero() || t.ProjectID == projectId })
+	if err != nil {
+		return nil, err
+	}
+	return aggregateWorkload(tasks, from, to, interval, time.Now()), nil
+}
+
+// GetTotals считает открытые и просроченные задачи и проекты по статусам
+func (m *MemoryStorage) GetTotals(now time.Time) (*report.Totals, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totals := &report.Totals{ProjectsByStatus: map[string]int64{}}
+
+	tasks, err := m.findTasks(func(t *project.Task) bool { return !project.IsTerminal(t.Status) })
+	if err != nil {
+		return nil, err
+	}
+	epoch := time.Unix(0, 0)
+	for _, t := range tasks {
+		totals.OpenTasks++
+		if t.Deadline.After(epoch) && t.Deadline.Before(now) {
+			totals.OverdueTasks++
+		}
+	}
+
+	projects, err := m.findProjects(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range projects {
+		totals.ProjectsByStatus[p.Status]++
+	}
+	return totals, nil
+}
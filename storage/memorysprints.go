@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (m *MemoryStorage) findSprints(match func(s *project.Sprint) bool) ([]project.Sprint, error) {
+	var sprints []project.Sprint
+	err := m.sprints.each(func(doc bson.Raw) error {
+		var s project.Sprint
+		if err := bson.Unmarshal(doc, &s); err != nil {
+			return err
+		}
+		if match == nil || match(&s) {
+			sprints = append(sprints, s)
+		}
+		return nil
+	})
+	return sprints, err
+}
+
+func (m *MemoryStorage) GetSprintsByProject(projectId ident.ID) ([]project.Sprint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sprints, err := m.findSprints(func(s *project.Sprint) bool { return s.ProjectID == projectId })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(sprints, func(i, j int) bool { return sprints[i].Start.Before(sprints[j].Start) })
+	return sprints, nil
+}
+func (m *MemoryStorage) GetSprint(projectId, sprintId ident.ID) (*project.Sprint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.getSprint(projectId, sprintId)
+}
+
+// getSprint возвращает спринт проекта; nil — спринта нет
+func (m *MemoryStorage) getSprint(projectId, sprintId ident.ID) (*project.Sprint, error) {
+	var s project.Sprint
+	found, err := m.sprints.get(sprintId, &s)
+	if err != nil || !found || s.ProjectID != projectId {
+		return nil, err
+	}
+	return &s, nil
+}
+func (m *MemoryStorage) InsertSprint(s *project.Sprint, projectId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Спринт можно создать только в существующем проекте
+	if _, ok := m.projects.docs[projectId]; !ok {
+		return errors.New("project not found")
+	}
+
+	s.Id = ident.New()
+	s.ProjectID = projectId
+	s.Status = project.SprintPlanned
+	if s.DateCreation.IsZero() {
+		s.DateCreation = time.Now()
+	}
+	return m.sprints.put(s.Id, s)
+}
+func (m *MemoryStorage) UpdateSprint(projectId, sprintId ident.ID, updateFields bson.M) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, err := m.getSprint(projectId, sprintId)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errors.New("sprint not found")
+	}
+	if updateFields, err = normalizeUpdate(sprintUpdatable, updateFields); err != nil {
+		return err
+	}
+	_, err = m.sprints.set(sprintId, updateFields, &project.Sprint{})
+	return err
+}
+func (m *MemoryStorage) DeleteSprint(projectId, sprintId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sprint, err := m.getSprint(projectId, sprintId)
+	if err != nil {
+		return err
+	}
+	if sprint == nil {
+		return errors.New("sprint not found")
+	}
+	m.sprints.remove(sprintId)
+
+	// Задачи удалённого спринта возвращаются в бэклог
+	tasks, err := m.findTasks(func(t *project.Task) bool { return t.ProjectID == projectId && t.SprintID == sprintId })
+	if err != nil {
+		return err
+	}
+	return m.setTasksSprint(tasks, ident.Nil)
+}
+func (m *MemoryStorage) StartSprint(projectId, sprintId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// В проекте может идти только один спринт
+	active, err := m.findSprints(func(s *project.Sprint) bool {
+		return s.ProjectID == projectId && s.Status == project.SprintActive
+	})
+	if err != nil {
+		return err
+	}
+	if len(active) > 0 {
+		return errors.New("project already has an active sprint")
+	}
+
+	sprint, err := m.getSprint(projectId, sprintId)
+	if err != nil {
+		return err
+	}
+	if sprint == nil {
+		return errors.New("sprint not found")
+	}
+	if sprint.Status != project.SprintPlanned {
+		return errors.New("sprint is not planned")
+	}
+	sprint.Status = project.SprintActive
+	sprint.StartedAt = time.Now()
+	return m.sprints.put(sprintId, sprint)
+}
+func (m *MemoryStorage) CloseSprint(projectId, sprintId, nextSprintId ident.ID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Незавершённые задачи переносятся в следующий спринт или, если он не указан, в бэклог
+	if !nextSprintId.IsZero() {
+		next, err := m.getSprint(projectId, nextSprintId)
+		if err != nil {
+			return 0, err
+		}
+		if next == nil {
+			return 0, errors.New("next sprint not found")
+		}
+		if next.Status == project.SprintClosed || next.Id == sprintId {
+			return 0, errors.New("next sprint must be open")
+		}
+	}
+
+	sprint, err := m.getSprint(projectId, sprintId)
+	if err != nil {
+		return 0, err
+	}
+	if sprint == nil {
+		return 0, errors.New("sprint not found")
+	}
+	if sprint.Status != project.SprintActive {
+		return 0, errors.New("sprint is not active")
+	}
+
+	unfinished, err := m.findTasks(func(t *project.Task) bool {
+		return t.ProjectID == projectId && t.SprintID == sprintId && !project.IsTerminal(t.Status)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sprint.Status = project.SprintClosed
+	sprint.ClosedAt = time.Now()
+	sprint.CarriedOver = int64(len(unfinished))
+	if err := m.sprints.put(sprintId, sprint); err != nil {
+		return 0, err
+	}
+	if err := m.setTasksSprint(unfinished, nextSprintId); err != nil {
+		return 0, err
+	}
+	return int64(len(unfinished)), nil
+}
+func (m *MemoryStorage) AssignTasksToSprint(projectId, sprintId ident.ID, taskIds []ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Нулевой sprintId снимает задачи со спринта
+	if !sprintId.IsZero() {
+		sprint, err := m.getSprint(projectId, sprintId)
+		if err != nil {
+			return err
+		}
+		if sprint == nil {
+			return errors.New("sprint not found")
+		}
+		if sprint.Status == project.SprintClosed {
+			return errors.New("sprint is closed")
+		}
+	}
+
+	ids := make(map[ident.ID]bool, len(taskIds))
+	for _, id := range taskIds {
+		ids[id] = true
+	}
+	tasks, err := m.findTasks(func(t *project.Task) bool { return t.ProjectID == projectId && ids[t.ID] })
+	if err != nil {
+		return err
+	}
+	return m.setTasksSprint(tasks, sprintId)
+}
+func (m *MemoryStorage) GetTasksBySprint(projectId, sprintId ident.ID) ([]project.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findTasks(func(t *project.Task) bool { return t.ProjectID == projectId && t.SprintID == sprintId })
+}
+
+func (m *MemoryStorage) setTasksSprint(tasks []project.Task, sprintId ident.ID) error {
+	for i := range tasks {
+		tasks[i].SprintID = sprintId
+		if err := m.tasks.put(tasks[i].ID, &tasks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (m *MemoryStorage) GetWebhooksByProject(projectId ident.ID) ([]project.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhooks := []project.Webhook{}
+	err := m.webhooks.each(func(doc bson.Raw) error {
+		var w project.Webhook
+		if err := bson.Unmarshal(doc, &w); err != nil {
+			return err
+		}
+		if w.ProjectID == projectId {
+			webhooks = append(webhooks, w)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+func (m *MemoryStorage) GetWebhook(projectId, webhookId ident.ID) (*project.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.getWebhook(projectId, webhookId)
+}
+
+// getWebhook возвращает подписку проекта; nil — подписки нет
+func (m *MemoryStorage) getWebhook(projectId, webhookId ident.ID) (*project.Webhook, error) {
+	var w project.Webhook
+	found, err := m.webhooks.get(webhookId, &w)
+	if err != nil || !found || w.ProjectID != projectId {
+		return nil, err
+	}
+	return &w, nil
+}
+func (m *MemoryStorage) InsertWebhook(w *project.Webhook, projectId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Id = ident.New()
+	w.ProjectID = projectId
+	if w.DateCreation.IsZero() {
+		w.DateCreation = time.Now()
+	}
+	return m.webhooks.put(w.Id, w)
+}
+func (m *MemoryStorage) UpdateWebhook(projectId, webhookId ident.ID, updateFields bson.M) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, err := m.getWebhook(projectId, webhookId)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errors.New("webhook not found")
+	}
+	_, err = m.webhooks.set(webhookId, updateFields, &project.Webhook{})
+	return err
+}
+func (m *MemoryStorage) DeleteWebhook(projectId, webhookId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, err := m.getWebhook(projectId, webhookId)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errors.New("webhook not found")
+	}
+	m.webhooks.remove(webhookId)
+
+	// Журнал доставок удалённой подписки больше не нужен
+	deliveries, err := m.findDeliveries(func(d *project.WebhookDelivery) bool { return d.WebhookID == webhookId })
+	for _, d := range deliveries {
+		m.deliveries.remove(d.Id)
+	}
+	return err
+}
+
+func (m *MemoryStorage) findDeliveries(match func(d *project.WebhookDelivery) bool) ([]project.WebhookDelivery, error) {
+	deliveries := []project.WebhookDelivery{}
+	err := m.deliveries.each(func(doc bson.Raw) error {
+		var d project.WebhookDelivery
+		if err := bson.Unmarshal(doc, &d); err != nil {
+			return err
+		}
+		if match(&d) {
+			deliveries = append(deliveries, d)
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func (m *MemoryStorage) InsertDelivery(d *project.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d.Id = ident.New()
+	if d.DateCreation.IsZero() {
+		d.DateCreation = time.Now()
+	}
+	return m.deliveries.put(d.Id, d)
+}
+
+// UpdateDelivery сохраняет статус, журнал попыток и время следующей попытки
+func (m *MemoryStorage) UpdateDelivery(d *project.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stored project.WebhookDelivery
+	found, err := m.deliveries.get(d.Id, &stored)
+	if err != nil || !found {
+		return err
+	}
+	stored.Status = d.Status
+	stored.Attempts = d.Attempts
+	stored.NextAttempt = d.NextAttempt
+	return m.deliveries.put(d.Id, &stored)
+}
+func (m *MemoryStorage) GetDeliveries(webhookId ident.ID, limit int64) ([]project.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries, err := m.findDeliveries(func(d *project.WebhookDelivery) bool { return d.WebhookID == webhookId })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool { return deliveries[i].DateCreation.After(deliveries[j].DateCreation) })
+	if limit > 0 && limit < int64(len(deliveries)) {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+func (m *MemoryStorage) GetDelivery(webhookId, deliveryId ident.ID) (*project.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, err := m.getDelivery(deliveryId)
+	if err != nil || d == nil || d.WebhookID != webhookId {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ClaimDueDelivery забирает одну доставку, чья попытка назначена не позже now, и откладывает
+// её следующую попытку на lease. nil — доставлять нечего.
+func (m *MemoryStorage) ClaimDueDelivery(now time.Time, lease time.Duration) (*project.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due, err := m.findDeliveries(func(d *project.WebhookDelivery) bool {
+		return d.Status == project.DeliveryPending && !d.NextAttempt.After(now)
+	})
+	if err != nil || len(due) == 0 {
+		return nil, err
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttempt.Before(due[j].NextAttempt) })
+
+	d := due[0]
+	d.NextAttempt = now.Add(lease)
+	if err := m.deliveries.put(d.Id, &d); err != nil {
+		return nil, err
+	}
+	return m.getDelivery(d.Id)
+}
+
+// getDelivery возвращает доставку по id; nil — доставки нет
+func (m *MemoryStorage) getDelivery(id ident.ID) (*project.WebhookDelivery, error) {
+	var d project.WebhookDelivery
+	found, err := m.deliveries.get(id, &d)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &d, nil
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/report"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (m *MemoryStorage) findWorklogs(match func(w *project.Worklog) bool) ([]project.Worklog, error) {
+	var worklogs []project.Worklog
+	err := m.worklogs.each(func(doc bson.Raw) error {
+		var w project.Worklog
+		if err := bson.Unmarshal(doc, &w); err != nil {
+			return err
+		}
+		if match == nil || match(&w) {
+			worklogs = append(worklogs, w)
+		}
+		return nil
+	})
+	return worklogs, err
+}
+
+func (m *MemoryStorage) GetWorklogsByTask(projectId, taskId ident.ID) ([]project.Worklog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	worklogs, err := m.findWorklogs(func(w *project.Worklog) bool { return w.ProjectID == projectId && w.TaskID == taskId })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(worklogs, func(i, j int) bool { return worklogs[i].Started.Before(worklogs[j].Started) })
+	return worklogs, nil
+}
+func (m *MemoryStorage) InsertWorklog(w *project.Worklog, projectId, taskId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkTask(projectId, taskId); err != nil {
+		return err
+	}
+
+	w.Id = ident.New()
+	w.ProjectID = projectId
+	w.TaskID = taskId
+	w.Running = false
+	if w.DateCreation.IsZero() {
+		w.DateCreation = time.Now()
+	}
+
+	// Списанное время уменьшает оставшуюся оценку задачи
+	consumed, err := m.consumeRemaining(taskId, w.Hours())
+	if err != nil {
+		return err
+	}
+	w.Consumed = consumed
+	return m.worklogs.put(w.Id, w)
+}
+func (m *MemoryStorage) DeleteWorklog(projectId, taskId, worklogId ident.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var w project.Worklog
+	found, err := m.worklogs.get(worklogId, &w)
+	if err != nil {
+		return err
+	}
+	if !found || w.ProjectID != projectId || w.TaskID != taskId {
+		return errors.New("worklog not found")
+	}
+	m.worklogs.remove(worklogId)
+
+	// Возвращаем в оставшуюся оценку то, что запись с неё списала
+	return m.restoreRemaining(taskId, w.Consumed)
+}
+func (m *MemoryStorage) StartTimer(projectId, taskId, userId ident.ID) (*project.Worklog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkTask(projectId, taskId); err != nil {
+		return nil, err
+	}
+
+	// У пользователя может идти только один таймер
+	running, err := m.findWorklogs(func(w *project.Worklog) bool { return w.UserID == userId && w.Running })
+	if err != nil {
+		return nil, err
+	}
+	if len(running) > 0 {
+		return nil, errors.New("timer already running")
+	}
+
+	w := project.NewWorklog(projectId, taskId, userId, time.Now(), 0, "")
+	w.Ended = time.Time{}
+	w.Running = true
+	if err := m.worklogs.put(w.Id, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+func (m *MemoryStorage) StopTimer(projectId, taskId, userId ident.ID, note string) (*project.Worklog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running, err := m.findWorklogs(func(w *project.Worklog) bool {
+		return w.ProjectID == projectId && w.TaskID == taskId && w.UserID == userId && w.Running
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(running) == 0 {
+		return nil, errors.New("timer not running")
+	}
+
+	w := running[0]
+	w.Ended = time.Now()
+	w.Duration = int64(w.Ended.Sub(w.Started) / time.Second)
+	w.Running = false
+	if note != "" {
+		w.Note = note
+	}
+	if w.Consumed, err = m.consumeRemaining(taskId, w.Hours()); err != nil {
+		return nil, err
+	}
+	if err := m.worklogs.put(w.Id, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// GetTimeReport суммирует завершённые записи по пользователю и задаче.
+// Нулевые projectId и userId означают отсутствие фильтра.
+func (m *MemoryStorage) GetTimeReport(projectId, userId ident.ID, from, to time.Time) ([]report.TimeSpent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	worklogs, err := m.findWorklogs(func(w *project.Worklog) bool {
+		return !w.Running && !w.Started.Before(from) && !w.Started.After(to) &&
+			(projectId.IsZero() || w.ProjectID == projectId) &&
+			(userId.IsZero() || w.UserID == userId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ user, project, task ident.ID }
+	index := make(map[key]int)
+	rows := []report.TimeSpent{}
+	for _, w := range worklogs {
+		k := key{w.UserID, w.ProjectID, w.TaskID}
+		i, ok := index[k]
+		if !ok {
+			i = len(rows)
+			index[k] = i
+			rows = append(rows, report.TimeSpent{UserID: w.UserID, ProjectID: w.ProjectID, TaskID: w.TaskID})
+		}
+		rows[i].Seconds += w.Duration
+		rows[i].Entries++
+	}
+
+	for i := range rows {
+		var u struct {
+			Name string `bson:"name"`
+		}
+		if _, err := m.users.get(rows[i].UserID, &u); err != nil {
+			return nil, err
+		}
+		var t struct {
+			Name string `bson:"name"`
+		}
+		if _, err := m.tasks.get(rows[i].TaskID, &t); err != nil {
+			return nil, err
+		}
+		rows[i].UserName = u.Name
+		rows[i].TaskName = t.Name
+		rows[i].Hours = float64(rows[i].Seconds) / 3600
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].UserName != rows[j].UserName {
+			return rows[i].UserName < rows[j].UserName
+		}
+		return rows[i].Seconds > rows[j].Seconds
+	})
+	return rows, nil
+}
+
+func (m *MemoryStorage) checkTask(projectId, taskId ident.ID) error {
+	task, err := m.getTask(projectId, taskId)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return errors.New("task not found")
+	}
+	return nil
+}
+
+// consumeRemaining уменьшает оставшуюся оценку на hours, не опуская её ниже нуля, и возвращает,
+// сколько часов списано на самом деле
+func (m *MemoryStorage) consumeRemaining(taskId ident.ID, hours float64) (float64, error) {
+	if hours <= 0 {
+		return 0, nil
+	}
+	var t project.Task
+	found, err := m.tasks.get(taskId, &t)
+	if err != nil || !found {
+		return 0, err
+	}
+	consumed := math.Min(math.Max(t.Remaining, 0), hours)
+	if consumed == 0 {
+		return 0, nil
+	}
+	t.Remaining -= consumed
+	return consumed, m.tasks.put(taskId, &t)
+}
+
+// restoreRemaining возвращает в оставшуюся оценку часы, которые списала удалённая запись
+func (m *MemoryStorage) restoreRemaining(taskId ident.ID, hours float64) error {
+	if hours <= 0 {
+		return nil
+	}
+	var t project.Task
+	found, err := m.tasks.get(taskId, &t)
+	if err != nil || !found {
+		return err
+	}
+	t.Remaining += hours
+	return m.tasks.put(taskId, &t)
+}
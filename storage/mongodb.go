@@ -2,16 +2,21 @@ package storage
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"os"
 	"time"
+	"tmv/config"
+	"tmv/ident"
 	"tmv/project"
 	"tmv/user"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 type MongoStorage struct {
@@ -19,13 +24,52 @@ type MongoStorage struct {
 	UserCollection    *mongo.Collection
 	ProjectCollection *mongo.Collection
 	TaskCollection    *mongo.Collection
+	SprintCollection  *mongo.Collection
+	WorklogCollection *mongo.Collection
+
+	NotificationCollection *mongo.Collection
+	ReminderCollection     *mongo.Collection
+	CommentCollection      *mongo.Collection
+	WatchCollection        *mongo.Collection
+
+	WebhookCollection  *mongo.Collection
+	DeliveryCollection *mongo.Collection
+
+	OutboxCollection      *mongo.Collection
+	ResumeTokenCollection *mongo.Collection
+	MigrationCollection   *mongo.Collection
+
+	ctx context.Context // Контекст запросов, см. WithContext
 }
 
-func NewMongoStorage(uri string, dbName string, userCollectionName, projectCollectionName, taskCollectionName string) (*MongoStorage, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func NewMongoStorage(cfg config.Mongo) (*MongoStorage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancel()
 
-	clientOptions := options.Client().ApplyURI(uri)
+	// Каждая команда MongoDB становится дочерним span-ом запроса, в контексте которого выполнена
+	clientOptions := options.Client().ApplyURI(cfg.URI).SetMonitor(otelmongo.NewMonitor()).
+		SetMinPoolSize(cfg.MinPoolSize).
+		SetMaxPoolSize(cfg.MaxPoolSize).
+		SetConnectTimeout(cfg.ConnectTimeout).
+		SetServerSelectionTimeout(cfg.ServerSelectionTimeout)
+	if cfg.Timeout > 0 {
+		clientOptions.SetTimeout(cfg.Timeout)
+	}
+	if cfg.Username != "" {
+		clientOptions.SetAuth(options.Credential{
+			Username:   cfg.Username,
+			Password:   cfg.Password,
+			AuthSource: cfg.AuthSource,
+		})
+	}
+	if cfg.TLS {
+		tlsConfig, err := mongoTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		return nil, err
@@ -36,28 +80,80 @@ func NewMongoStorage(uri string, dbName string, userCollectionName, projectColle
 		return nil, err
 	}
 
-	userCollection := client.Database(dbName).Collection(userCollectionName)
-	taskCollection := client.Database(dbName).Collection(taskCollectionName)
-	projectCollection := client.Database(dbName).Collection(projectCollectionName)
-
+	db := client.Database(cfg.Database)
+	names := cfg.Collections
 	return &MongoStorage{
 		Client:            client,
-		UserCollection:    userCollection,
-		ProjectCollection: projectCollection,
-		TaskCollection:    taskCollection,
+		UserCollection:    db.Collection(names.Users),
+		ProjectCollection: db.Collection(names.Projects),
+		TaskCollection:    db.Collection(names.Tasks),
+		SprintCollection:  db.Collection(names.Sprints),
+		WorklogCollection: db.Collection(names.Worklogs),
+
+		NotificationCollection: db.Collection(names.Notifications),
+		ReminderCollection:     db.Collection(names.Reminders),
+		CommentCollection:      db.Collection(names.Comments),
+		WatchCollection:        db.Collection(names.Watches),
+
+		WebhookCollection:  db.Collection(names.Webhooks),
+		DeliveryCollection: db.Collection(names.WebhookDeliveries),
+
+		OutboxCollection:      db.Collection(names.Outbox),
+		ResumeTokenCollection: db.Collection(names.ResumeTokens),
+		MigrationCollection:   db.Collection(names.Migrations),
 	}, nil
 }
 
-func (m *MongoStorage) GetAllUsers() map[primitive.ObjectID]user.User {
-	users := make(map[primitive.ObjectID]user.User)
+func mongoTLSConfig(cfg config.Mongo) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecure,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", cfg.TLSCAFile)
+		}
+	}
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// WithContext возвращает копию хранилища, которая выполняет запросы в контексте ctx:
+// так команды к базе попадают в трассировку запроса и отменяются вместе с ним
+func (m *MongoStorage) WithContext(ctx context.Context) Storage {
+	bound := *m
+	bound.ctx = ctx
+	return &bound
+}
 
-	cursor, err := m.UserCollection.Find(context.TODO(), bson.D{})
+func (m *MongoStorage) opContext() context.Context {
+	if m.ctx == nil {
+		return context.TODO()
+	}
+	return m.ctx
+}
+
+func (m *MongoStorage) GetAllUsers() map[ident.ID]user.User {
+	users := make(map[ident.ID]user.User)
+
+	cursor, err := m.UserCollection.Find(m.opContext(), bson.D{})
 	if err != nil {
 		return users // return empty map if there's an error
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(m.opContext())
 
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(m.opContext()) {
 		var us user.User
 		err := cursor.Decode(&us)
 		if err != nil {
@@ -68,11 +164,11 @@ func (m *MongoStorage) GetAllUsers() map[primitive.ObjectID]user.User {
 
 	return users
 }
-func (m *MongoStorage) GetUser(userId primitive.ObjectID) (user.User, error) {
+func (m *MongoStorage) GetUser(userId ident.ID) (user.User, error) {
 	var usr user.User
 
 	filter := bson.D{{Key: "_id", Value: userId}}
-	err := m.UserCollection.FindOne(context.TODO(), filter).Decode(&usr)
+	err := m.UserCollection.FindOne(m.opContext(), filter).Decode(&usr)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return usr, errors.New("user not found")
@@ -83,35 +179,46 @@ func (m *MongoStorage) GetUser(userId primitive.ObjectID) (user.User, error) {
 	return usr, nil
 }
 func (m *MongoStorage) InsertUser(u *user.User) error {
-	u.Id = primitive.NewObjectID()
+	u.Id = ident.New()
 
-	_, err := m.UserCollection.InsertOne(context.TODO(), u)
+	_, err := m.UserCollection.InsertOne(m.opContext(), u)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailTaken
+	}
 	return err
 }
-func (m *MongoStorage) UpdateUser(userId primitive.ObjectID, e *user.User) error {
+func (m *MongoStorage) UpdateUser(userId ident.ID, e *user.User) error {
 	filter := bson.D{{Key: "_id", Value: userId}}
 	update := bson.D{{Key: "$set", Value: e}}
 
-	_, err := m.UserCollection.UpdateOne(context.TODO(), filter, update)
+	_, err := m.UserCollection.UpdateOne(m.opContext(), filter, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailTaken
+	}
 	return err
 }
-func (m *MongoStorage) DeleteUser(userId primitive.ObjectID) error {
+
+// DeleteUser удаляет пользователя и всё, что ему принадлежит (см. deleteUserData)
+func (m *MongoStorage) DeleteUser(userId ident.ID) error {
 	filter := bson.D{{Key: "_id", Value: userId}}
 
-	_, err := m.UserCollection.DeleteOne(context.TODO(), filter)
-	return err
+	_, err := m.UserCollection.DeleteOne(m.opContext(), filter)
+	if err != nil {
+		return err
+	}
+	return m.deleteUserData(userId)
 }
 
-func (m *MongoStorage) GetAllProjects() map[primitive.ObjectID]project.Project {
-	projects := make(map[primitive.ObjectID]project.Project)
+func (m *MongoStorage) GetAllProjects() map[ident.ID]project.Project {
+	projects := make(map[ident.ID]project.Project)
 
-	cursor, err := m.ProjectCollection.Find(context.TODO(), bson.D{})
+	cursor, err := m.ProjectCollection.Find(m.opContext(), bson.D{})
 	if err != nil {
 		return projects // return empty map if there's an error
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(m.opContext())
 
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(m.opContext()) {
 		var proj project.Project
 		err := cursor.Decode(&proj)
 		if err != nil {
@@ -121,21 +228,21 @@ func (m *MongoStorage) GetAllProjects() map[primitive.ObjectID]project.Project {
 	}
 	return projects
 }
-func (m *MongoStorage) GetProjectByUser(userId primitive.ObjectID) ([]project.Project, error) {
+func (m *MongoStorage) GetProjectByUser(userId ident.ID) ([]project.Project, error) {
 	var projects []project.Project
 
 	// Создаем фильтр для поиска проектов по userId
 	filter := bson.D{{Key: "userId", Value: userId}}
 
 	// Выполняем запрос к коллекции проектов
-	cursor, err := m.ProjectCollection.Find(context.TODO(), filter)
+	cursor, err := m.ProjectCollection.Find(m.opContext(), filter)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(m.opContext())
 
 	// Обрабатываем результаты запроса
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(m.opContext()) {
 		var proj project.Project
 		if err := cursor.Decode(&proj); err != nil {
 			return nil, err
@@ -151,7 +258,7 @@ func (m *MongoStorage) GetProjectByUser(userId primitive.ObjectID) ([]project.Pr
 	// Возвращаем результаты
 	return projects, nil
 }
-func (m *MongoStorage) GetProject(userId, projectId primitive.ObjectID) (*project.Project, error) {
+func (m *MongoStorage) GetProject(userId, projectId ident.ID) (*project.Project, error) {
 	var proj project.Project
 
 	// Создаем фильтр для поиска проекта по userId и projectId
@@ -161,7 +268,7 @@ func (m *MongoStorage) GetProject(userId, projectId primitive.ObjectID) (*projec
 	}
 
 	// Выполняем запрос к коллекции проектов
-	err := m.ProjectCollection.FindOne(context.TODO(), filter).Decode(&proj)
+	err := m.ProjectCollection.FindOne(m.opContext(), filter).Decode(&proj)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, fmt.Errorf("проект не найден")
@@ -172,15 +279,17 @@ func (m *MongoStorage) GetProject(userId, projectId primitive.ObjectID) (*projec
 	// Возвращаем найденный проект
 	return &proj, nil
 }
-func (m *MongoStorage) DeleteProject(id primitive.ObjectID) error {
+
+// DeleteProject удаляет проект вместе с его задачами, спринтами и прочими данными
+func (m *MongoStorage) DeleteProject(id ident.ID) error {
 	// Найти проект по ID, чтобы получить userID
 	var project project.Project
-	err := m.ProjectCollection.FindOne(context.TODO(), bson.D{{Key: "_id", Value: id}}).Decode(&project)
+	err := m.ProjectCollection.FindOne(m.opContext(), bson.D{{Key: "_id", Value: id}}).Decode(&project)
 	if err != nil {
 		return err
 	}
 	// Удалить проект из коллекции проектов
-	_, err = m.ProjectCollection.DeleteOne(context.TODO(), bson.D{{Key: "_id", Value: id}})
+	_, err = m.ProjectCollection.DeleteOne(m.opContext(), bson.D{{Key: "_id", Value: id}})
 	if err != nil {
 		return err
 	}
@@ -192,17 +301,18 @@ func (m *MongoStorage) DeleteProject(id primitive.ObjectID) error {
 		}},
 	}
 
-	_, err = m.UserCollection.UpdateOne(context.TODO(), filter, update)
+	_, err = m.UserCollection.UpdateOne(m.opContext(), filter, update)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// Задачи, спринты и прочие данные проекта
+	return m.deleteProjectData([]ident.ID{id})
 }
-func (m *MongoStorage) DeleteProjects(userID primitive.ObjectID, projectIDs []primitive.ObjectID) error {
+func (m *MongoStorage) DeleteProjects(userID ident.ID, projectIDs []ident.ID) error {
 	// Удалить проекты из коллекции проектов
 	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: projectIDs}}}}
-	_, err := m.ProjectCollection.DeleteMany(context.TODO(), filter)
+	_, err := m.ProjectCollection.DeleteMany(m.opContext(), filter)
 	if err != nil {
 		return err
 	}
@@ -215,28 +325,28 @@ func (m *MongoStorage) DeleteProjects(userID primitive.ObjectID, projectIDs []pr
 		}},
 	}
 
-	_, err = m.UserCollection.UpdateOne(context.TODO(), userFilter, update)
+	_, err = m.UserCollection.UpdateOne(m.opContext(), userFilter, update)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return m.deleteProjectData(projectIDs)
 }
-func (m *MongoStorage) UpdateProject(projectID primitive.ObjectID, updateFields bson.M) error {
+func (m *MongoStorage) UpdateProject(projectID ident.ID, updateFields bson.M) error {
 	filter := bson.D{{Key: "_id", Value: projectID}}
 	update := bson.D{{Key: "$set", Value: updateFields}}
 
-	_, err := m.ProjectCollection.UpdateOne(context.TODO(), filter, update)
+	_, err := m.ProjectCollection.UpdateOne(m.opContext(), filter, update)
 	return err
 }
-func (m *MongoStorage) InsertProject(p *project.Project, userID primitive.ObjectID) error {
-	// Генерируем новый ObjectID для проекта
-	p.Id = primitive.NewObjectID()
-	// Присваиваем ObjectID пользователя проекту
+func (m *MongoStorage) InsertProject(p *project.Project, userID ident.ID) error {
+	// Генерируем новый идентификатор для проекта
+	p.Id = ident.New()
+	// Присваиваем идентификатор пользователя проекту
 	p.UserID = userID
 
 	// Вставляем документ проекта в коллекцию проектов (ProjectCollection)
-	_, err := m.ProjectCollection.InsertOne(context.TODO(), p)
+	_, err := m.ProjectCollection.InsertOne(m.opContext(), p)
 	if err != nil {
 		return err
 	}
@@ -246,7 +356,7 @@ func (m *MongoStorage) InsertProject(p *project.Project, userID primitive.Object
 	filter := bson.D{{Key: "_id", Value: userID}}
 
 	// Проверяем, существует ли поле projects
-	userUpdateResult := m.UserCollection.FindOne(context.TODO(), filter)
+	userUpdateResult := m.UserCollection.FindOne(m.opContext(), filter)
 
 	var userDoc map[string]interface{}
 	err = userUpdateResult.Decode(&userDoc)
@@ -257,10 +367,10 @@ func (m *MongoStorage) InsertProject(p *project.Project, userID primitive.Object
 	if _, ok := userDoc["projects"]; !ok {
 		// Если поле projects не существует, инициализируем его как пустой массив
 		_, err = m.UserCollection.UpdateOne(
-			context.TODO(),
+			m.opContext(),
 			filter,
 			bson.D{
-				{Key: "$set", Value: bson.D{{Key: "projects", Value: []primitive.ObjectID{}}}},
+				{Key: "$set", Value: bson.D{{Key: "projects", Value: []ident.ID{}}}},
 			},
 		)
 		if err != nil {
@@ -269,7 +379,7 @@ func (m *MongoStorage) InsertProject(p *project.Project, userID primitive.Object
 	}
 	// Добавляем новый проект в массив projects
 	_, err = m.UserCollection.UpdateOne(
-		context.TODO(),
+		m.opContext(),
 		filter,
 		bson.D{
 			{Key: "$addToSet", Value: bson.D{{Key: "projects", Value: p.Id}}},
@@ -282,17 +392,17 @@ func (m *MongoStorage) InsertProject(p *project.Project, userID primitive.Object
 	return nil
 }
 
-func (m *MongoStorage) GetTasksByProject(projectId primitive.ObjectID) ([]project.Task, error) {
+func (m *MongoStorage) GetTasksByProject(projectId ident.ID) ([]project.Task, error) {
 	var tasks []project.Task
 	filter := bson.D{{Key: "projectId", Value: projectId}}
 
-	cursor, err := m.TaskCollection.Find(context.TODO(), filter)
+	cursor, err := m.TaskCollection.Find(m.opContext(), filter)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(m.opContext())
 
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(m.opContext()) {
 		var task project.Task
 		if err := cursor.Decode(&task); err != nil {
 			return nil, err
@@ -306,18 +416,37 @@ func (m *MongoStorage) GetTasksByProject(projectId primitive.ObjectID) ([]projec
 
 	return tasks, nil
 }
-func (m *MongoStorage) InsertTask(t *project.Task, projectId primitive.ObjectID) error {
+func (m *MongoStorage) InsertTask(t *project.Task, projectId ident.ID) error {
 
-	t.ID = primitive.NewObjectID()
+	t.ID = ident.New()
 	t.ProjectID = projectId
+	if t.DateCreation.IsZero() {
+		t.DateCreation = time.Now()
+	}
+	if t.Remaining == 0 {
+		t.Remaining = t.Estimate
+	}
+	// История статусов ведётся только хранилищем
+	t.StatusHistory = []project.StatusChange{{Status: t.Status, At: t.DateCreation}}
+	if t.Recurrence != nil {
+		t.Recurrence.Spawned = false
+		startRecurrence(t)
+	}
+
+	// Новая задача встаёт в конец колонки своего статуса
+	lastRank, err := m.lastRank(projectId, t.Status)
+	if err != nil {
+		return err
+	}
+	t.Rank = project.RankBetween(lastRank, "")
 
-	_, err := m.TaskCollection.InsertOne(context.TODO(), t)
+	_, err = m.TaskCollection.InsertOne(m.opContext(), t)
 	if err != nil {
 		return err
 	}
 	filter := bson.D{{Key: "_id", Value: projectId}}
 
-	projectUpdateResult := m.ProjectCollection.FindOne(context.TODO(), filter)
+	projectUpdateResult := m.ProjectCollection.FindOne(m.opContext(), filter)
 
 	var projectDoc map[string]interface{}
 	err = projectUpdateResult.Decode(&projectDoc)
@@ -328,10 +457,10 @@ func (m *MongoStorage) InsertTask(t *project.Task, projectId primitive.ObjectID)
 	if _, ok := projectDoc["tasks"]; !ok || projectDoc["tasks"] == nil {
 		// Если поле tasks не существует, инициализируем его как пустой массив
 		_, err = m.ProjectCollection.UpdateOne(
-			context.TODO(),
+			m.opContext(),
 			filter,
 			bson.D{
-				{Key: "$set", Value: bson.D{{Key: "tasks", Value: []primitive.ObjectID{}}}},
+				{Key: "$set", Value: bson.D{{Key: "tasks", Value: []ident.ID{}}}},
 			},
 		)
 		if err != nil {
@@ -341,7 +470,7 @@ func (m *MongoStorage) InsertTask(t *project.Task, projectId primitive.ObjectID)
 
 	// Добавляем новый проект в массив tasks
 	_, err = m.ProjectCollection.UpdateOne(
-		context.TODO(),
+		m.opContext(),
 		filter,
 		bson.D{
 			{Key: "$addToSet", Value: bson.D{{Key: "tasks", Value: t.ID}}},
@@ -352,7 +481,7 @@ func (m *MongoStorage) InsertTask(t *project.Task, projectId primitive.ObjectID)
 	}
 	return nil
 }
-func (m *MongoStorage) GetTask(projectId, taskId primitive.ObjectID) (*project.Task, error) {
+func (m *MongoStorage) GetTask(projectId, taskId ident.ID) (*project.Task, error) {
 	// Фильтр для поиска задачи по taskId и projectId
 	filter := bson.D{
 		{Key: "_id", Value: taskId},
@@ -360,7 +489,7 @@ func (m *MongoStorage) GetTask(projectId, taskId primitive.ObjectID) (*project.T
 	}
 
 	var task project.Task
-	err := m.TaskCollection.FindOne(context.TODO(), filter).Decode(&task)
+	err := m.TaskCollection.FindOne(m.opContext(), filter).Decode(&task)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, nil
@@ -370,16 +499,16 @@ func (m *MongoStorage) GetTask(projectId, taskId primitive.ObjectID) (*project.T
 
 	return &task, nil
 }
-func (m *MongoStorage) GetAllTasks() map[primitive.ObjectID]project.Task {
-	tasks := make(map[primitive.ObjectID]project.Task)
+func (m *MongoStorage) GetAllTasks() map[ident.ID]project.Task {
+	tasks := make(map[ident.ID]project.Task)
 
-	cursor, err := m.TaskCollection.Find(context.TODO(), bson.D{})
+	cursor, err := m.TaskCollection.Find(m.opContext(), bson.D{})
 	if err != nil {
 		return tasks // return empty map if there's an error
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(m.opContext())
 
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(m.opContext()) {
 		var task project.Task
 		err := cursor.Decode(&task)
 		if err != nil {
@@ -389,14 +518,14 @@ func (m *MongoStorage) GetAllTasks() map[primitive.ObjectID]project.Task {
 	}
 	return tasks
 }
-func (m *MongoStorage) DeleteTask(projectId, taskId primitive.ObjectID) error {
+func (m *MongoStorage) DeleteTask(projectId, taskId ident.ID) error {
 	filter := bson.D{
 		{Key: "_id", Value: taskId},
 		{Key: "projectId", Value: projectId},
 	}
 
 	// Удаление задачи из коллекции задач
-	_, err := m.TaskCollection.DeleteOne(context.TODO(), filter)
+	_, err := m.TaskCollection.DeleteOne(m.opContext(), filter)
 	if err != nil {
 		return err
 	}
@@ -405,14 +534,14 @@ func (m *MongoStorage) DeleteTask(projectId, taskId primitive.ObjectID) error {
 	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "tasks", Value: taskId}}}}
 
 	// Удаление ID задачи из массива tasks в проекте
-	_, err = m.ProjectCollection.UpdateOne(context.TODO(), projectFilter, update)
+	_, err = m.ProjectCollection.UpdateOne(m.opContext(), projectFilter, update)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return m.deleteTaskData(projectId, []ident.ID{taskId})
 }
-func (m *MongoStorage) DeleteTasks(projectId primitive.ObjectID, taskIds []primitive.ObjectID) error {
+func (m *MongoStorage) DeleteTasks(projectId ident.ID, taskIds []ident.ID) error {
 	// Фильтр для удаления задач по projectId и массиву taskIds
 	filter := bson.D{
 		{Key: "projectId", Value: projectId},
@@ -420,7 +549,7 @@ func (m *MongoStorage) DeleteTasks(projectId primitive.ObjectID, taskIds []primi
 	}
 
 	// Удаление задач из коллекции задач
-	_, err := m.TaskCollection.DeleteMany(context.TODO(), filter)
+	_, err := m.TaskCollection.DeleteMany(m.opContext(), filter)
 	if err != nil {
 		return err
 	}
@@ -430,20 +559,134 @@ func (m *MongoStorage) DeleteTasks(projectId primitive.ObjectID, taskIds []primi
 	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "tasks", Value: bson.D{{Key: "$in", Value: taskIds}}}}}}
 
 	// Удаление ID задач из массива tasks в проекте
-	_, err = m.ProjectCollection.UpdateOne(context.TODO(), projectFilter, update)
+	_, err = m.ProjectCollection.UpdateOne(m.opContext(), projectFilter, update)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return m.deleteTaskData(projectId, taskIds)
 }
-func (m *MongoStorage) UpdateTask(projectId, taskId primitive.ObjectID, updateFields bson.M) error {
+func (m *MongoStorage) UpdateTask(projectId, taskId ident.ID, updateFields bson.M) error {
 	filter := bson.D{
 		{Key: "_id", Value: taskId},
 		{Key: "projectId", Value: projectId},
 	}
+	// История статусов и повторение меняются только через отдельные методы, ранг — только через MoveTask
+	delete(updateFields, "statusHistory")
+	delete(updateFields, "recurrence")
+	delete(updateFields, "rank")
+	updateFields, err := NormalizeTaskUpdate(updateFields)
+	if err != nil {
+		return err
+	}
+	if len(updateFields) == 0 {
+		return nil
+	}
 	update := bson.D{{Key: "$set", Value: updateFields}}
 
-	_, err := m.TaskCollection.UpdateOne(context.TODO(), filter, update)
+	if status, ok := updateFields["status"].(string); ok {
+		current, err := m.GetTask(projectId, taskId)
+		if err != nil {
+			return err
+		}
+		if current != nil && current.Status != status {
+			// В новой колонке задача встаёт последней, как при создании
+			last, err := m.lastRank(projectId, status)
+			if err != nil {
+				return err
+			}
+			updateFields["rank"] = project.RankBetween(last, "")
+			update = append(update, statusHistoryPush(status))
+		}
+	}
+
+	_, err = m.TaskCollection.UpdateOne(m.opContext(), filter, update)
+	return err
+}
+
+func (m *MongoStorage) MoveTask(projectId, taskId ident.ID, status string, position int) error {
+	// Задачи целевой колонки в текущем порядке, без перемещаемой
+	filter := bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "status", Value: status},
+		{Key: "_id", Value: bson.D{{Key: "$ne", Value: taskId}}},
+	}
+	cursor, err := m.TaskCollection.Find(m.opContext(), filter)
+	if err != nil {
+		return err
+	}
+	var column []project.Task
+	if err := cursor.All(m.opContext(), &column); err != nil {
+		return err
+	}
+	project.SortByRank(column)
+	rank, rerank := project.PlaceRank(column, position)
+
+	current, err := m.GetTask(projectId, taskId)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errors.New("task not found")
+	}
+
+	// Статус и ранг меняются одной операцией, чтобы задача не оказалась в чужой колонке
+	taskFilter := bson.D{
+		{Key: "_id", Value: taskId},
+		{Key: "projectId", Value: projectId},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: status},
+		{Key: "rank", Value: rank},
+	}}}
+	if current.Status != status {
+		update = append(update, statusHistoryPush(status))
+	}
+
+	res, err := m.TaskCollection.UpdateOne(m.opContext(), taskFilter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("task not found")
+	}
+	return m.rerankTasks(projectId, rerank)
+}
+
+// rerankTasks записывает ранги перенумерованной колонки
+func (m *MongoStorage) rerankTasks(projectId ident.ID, rerank map[ident.ID]string) error {
+	if len(rerank) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(rerank))
+	for id, rank := range rerank {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: id}, {Key: "projectId", Value: projectId}}).
+			SetUpdate(bson.D{{Key: "$set", Value: bson.D{{Key: "rank", Value: rank}}}}))
+	}
+	_, err := m.TaskCollection.BulkWrite(m.opContext(), models, options.BulkWrite().SetOrdered(false))
 	return err
 }
+func (m *MongoStorage) lastRank(projectId ident.ID, status string) (string, error) {
+	filter := bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "status", Value: status},
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "rank", Value: -1}})
+
+	var last project.Task
+	err := m.TaskCollection.FindOne(m.opContext(), filter, opts).Decode(&last)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", nil
+		}
+		return "", err
+	}
+	return last.Rank, nil
+}
+
+func statusHistoryPush(status string) bson.E {
+	return bson.E{Key: "$push", Value: bson.D{
+		{Key: "statusHistory", Value: project.StatusChange{Status: status, At: time.Now()}},
+	}}
+}
@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"errors"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (m *MongoStorage) InsertNotification(n *user.Notification) error {
+	n.Id = ident.New()
+	if n.DateCreation.IsZero() {
+		n.DateCreation = time.Now()
+	}
+
+	_, err := m.NotificationCollection.InsertOne(m.opContext(), n)
+	return err
+}
+
+// GetTasksDueBefore возвращает задачи со сроком не позже t (включая просроченные)
+func (m *MongoStorage) GetTasksDueBefore(t time.Time) ([]project.Task, error) {
+	var tasks []project.Task
+
+	cursor, err := m.TaskCollection.Find(m.opContext(), dueBeforeFilter(t))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(m.opContext())
+
+	for cursor.Next(m.opContext()) {
+		var task project.Task
+		if err := cursor.Decode(&task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// GetProjectsDueBefore возвращает проекты со сроком не позже t (включая просроченные)
+func (m *MongoStorage) GetProjectsDueBefore(t time.Time) ([]project.Project, error) {
+	var projects []project.Project
+
+	cursor, err := m.ProjectCollection.Find(m.opContext(), dueBeforeFilter(t))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(m.opContext())
+
+	for cursor.Next(m.opContext()) {
+		var proj project.Project
+		if err := cursor.Decode(&proj); err != nil {
+			return nil, err
+		}
+		projects = append(projects, proj)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+// MarkReminderSent атомарно отмечает напоминание с ключом key как отправленное.
+// false — напоминание уже было отправлено ранее, в том числе другим экземпляром сервера.
+func (m *MongoStorage) MarkReminderSent(key string) (bool, error) {
+	_, err := m.ReminderCollection.InsertOne(m.opContext(), bson.D{
+		{Key: "_id", Value: key},
+		{Key: "sentAt", Value: time.Now()},
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func dueBeforeFilter(t time.Time) bson.D {
+	// Нулевой срок (0001-01-01) означает, что срок не задан
+	return bson.D{{Key: "deadline", Value: bson.D{
+		{Key: "$gt", Value: time.Unix(0, 0)},
+		{Key: "$lte", Value: t},
+	}}}
+}
+
+// GetNotifications возвращает страницу входящих пользователя, новые сверху, и общее число записей
+func (m *MongoStorage) GetNotifications(userId ident.ID, unreadOnly bool, offset, limit int64) ([]user.Notification, int64, error) {
+	filter := bson.D{{Key: "userId", Value: userId}}
+	if unreadOnly {
+		filter = append(filter, bson.E{Key: "read", Value: false})
+	}
+
+	total, err := m.NotificationCollection.CountDocuments(m.opContext(), filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "dateCreation", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := m.NotificationCollection.Find(m.opContext(), filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	notifications := []user.Notification{}
+	if err := cursor.All(m.opContext(), &notifications); err != nil {
+		return nil, 0, err
+	}
+	return notifications, total, nil
+}
+func (m *MongoStorage) CountUnreadNotifications(userId ident.ID) (int64, error) {
+	return m.NotificationCollection.CountDocuments(m.opContext(), bson.D{
+		{Key: "userId", Value: userId},
+		{Key: "read", Value: false},
+	})
+}
+func (m *MongoStorage) MarkNotificationRead(userId, notificationId ident.ID) error {
+	filter := bson.D{
+		{Key: "_id", Value: notificationId},
+		{Key: "userId", Value: userId},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "read", Value: true}}}}
+
+	res, err := m.NotificationCollection.UpdateOne(m.opContext(), filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("notification not found")
+	}
+	return nil
+}
+func (m *MongoStorage) MarkAllNotificationsRead(userId ident.ID) (int64, error) {
+	filter := bson.D{
+		{Key: "userId", Value: userId},
+		{Key: "read", Value: false},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "read", Value: true}}}}
+
+	res, err := m.NotificationCollection.UpdateMany(m.opContext(), filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// Watch подписывает пользователя на проект или задачу; повторная подписка ничего не меняет
+func (m *MongoStorage) Watch(w *user.Watch) error {
+	if err := m.checkWatchTarget(w); err != nil {
+		return err
+	}
+
+	filter := bson.D{
+		{Key: "userId", Value: w.UserID},
+		{Key: "kind", Value: w.Kind},
+		{Key: "targetId", Value: w.TargetID},
+	}
+	update := bson.D{{Key: "$setOnInsert", Value: bson.D{
+		{Key: "projectId", Value: w.ProjectID},
+		{Key: "dateCreation", Value: time.Now()},
+	}}}
+
+	_, err := m.WatchCollection.UpdateOne(m.opContext(), filter, update, options.Update().SetUpsert(true))
+	return err
+}
+func (m *MongoStorage) Unwatch(userId ident.ID, kind string, targetId ident.ID) error {
+	filter := bson.D{
+		{Key: "userId", Value: userId},
+		{Key: "kind", Value: kind},
+		{Key: "targetId", Value: targetId},
+	}
+
+	res, err := m.WatchCollection.DeleteOne(m.opContext(), filter)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errors.New("watch not found")
+	}
+	return nil
+}
+
+// checkWatchTarget проверяет, что проект или задача подписки существуют
+func (m *MongoStorage) checkWatchTarget(w *user.Watch) error {
+	coll, filter, missing := m.ProjectCollection, bson.D{{Key: "_id", Value: w.TargetID}}, "project not found"
+	if w.Kind == user.WatchTask {
+		coll, missing = m.TaskCollection, "task not found"
+		filter = append(filter, bson.E{Key: "projectId", Value: w.ProjectID})
+	}
+	n, err := coll.CountDocuments(m.opContext(), filter)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New(missing)
+	}
+	return nil
+}
+
+// GetWatchers возвращает подписчиков задачи и её проекта без повторов
+func (m *MongoStorage) GetWatchers(projectId, taskId ident.ID) ([]ident.ID, error) {
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "kind", Value: user.WatchProject}, {Key: "targetId", Value: projectId}},
+		bson.D{{Key: "kind", Value: user.WatchTask}, {Key: "targetId", Value: taskId}},
+	}}}
+
+	values, err := m.WatchCollection.Distinct(m.opContext(), "userId", filter)
+	if err != nil {
+		return nil, err
+	}
+	// Distinct возвращает значения без типа поля, поэтому ObjectID приводится к ident.ID здесь
+	var ids []ident.ID
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, ident.ID(id))
+		}
+	}
+	return ids, nil
+}
+
+func (m *MongoStorage) InsertComment(cm *project.Comment, projectId, taskId ident.ID) error {
+	if err := m.checkTask(projectId, taskId); err != nil {
+		return err
+	}
+
+	cm.Id = ident.New()
+	cm.ProjectID = projectId
+	cm.TaskID = taskId
+	if cm.DateCreation.IsZero() {
+		cm.DateCreation = time.Now()
+	}
+
+	_, err := m.CommentCollection.InsertOne(m.opContext(), cm)
+	return err
+}
+func (m *MongoStorage) GetCommentsByTask(projectId, taskId ident.ID) ([]project.Comment, error) {
+	filter := bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "taskId", Value: taskId},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "dateCreation", Value: 1}})
+
+	cursor, err := m.CommentCollection.Find(m.opContext(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	comments := []project.Comment{}
+	if err := cursor.All(m.opContext(), &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"time"
+	"tmv/event"
+	"tmv/ident"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (m *MongoStorage) InsertOutbox(r *event.Record) error {
+	_, err := m.OutboxCollection.InsertOne(m.opContext(), r)
+	return err
+}
+
+// UpdateOutbox сохраняет данные, список обработавших подписчиков и время следующей попытки
+func (m *MongoStorage) UpdateOutbox(r *event.Record) error {
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "projectId", Value: r.ProjectID},
+		{Key: "payload", Value: r.Payload},
+		{Key: "done", Value: r.Done},
+		{Key: "attempts", Value: r.Attempts},
+		{Key: "lastError", Value: r.LastError},
+		{Key: "failed", Value: r.Failed},
+		{Key: "nextAttempt", Value: r.NextAttempt},
+	}}}
+
+	_, err := m.OutboxCollection.UpdateOne(m.opContext(), bson.D{{Key: "_id", Value: r.Id}}, update)
+	return err
+}
+func (m *MongoStorage) DeleteOutbox(id ident.ID) error {
+	_, err := m.OutboxCollection.DeleteOne(m.opContext(), bson.D{{Key: "_id", Value: id}})
+	return err
+}
+
+// ClaimOutbox забирает самую старую запись, чья очередь наступила к now, и откладывает
+// её на lease, чтобы другой экземпляр сервера не взял её одновременно. nil — записей нет.
+func (m *MongoStorage) ClaimOutbox(now time.Time, lease time.Duration) (*event.Record, error) {
+	filter := bson.D{
+		{Key: "failed", Value: false},
+		{Key: "nextAttempt", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "nextAttempt", Value: now.Add(lease)}}}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttempt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var r event.Record
+	err := m.OutboxCollection.FindOneAndUpdate(m.opContext(), filter, update, opts).Decode(&r)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetRecurringTasks возвращает повторяющиеся задачи, для которых следующее вхождение ещё не создано
+func (m *MongoStorage) GetRecurringTasks() ([]project.Task, error) {
+	var tasks []project.Task
+	filter := bson.D{
+		{Key: "recurrence", Value: bson.D{{Key: "$type", Value: "object"}}},
+		{Key: "recurrence.spawned", Value: false},
+	}
+
+	cursor, err := m.TaskCollection.Find(m.opContext(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(m.opContext())
+
+	for cursor.Next(m.opContext()) {
+		var task project.Task
+		if err := cursor.Decode(&task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// SpawnOccurrence создаёт следующее вхождение серии. Задача сначала помечается как обработанная,
+// поэтому при нескольких экземплярах сервера вхождение создаётся один раз; если вставка не удалась,
+// отметка снимается и серия будет продолжена на следующем проходе. nil — создавать нечего.
+func (m *MongoStorage) SpawnOccurrence(t *project.Task) (*project.Task, error) {
+	filter := bson.D{
+		{Key: "_id", Value: t.ID},
+		{Key: "recurrence.spawned", Value: false},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "recurrence.spawned", Value: true}}}}
+
+	res, err := m.TaskCollection.UpdateOne(m.opContext(), filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if res.ModifiedCount == 0 {
+		return nil, nil
+	}
+
+	next, ok := t.NextOccurrence()
+	if !ok {
+		// Серия закончилась по COUNT или UNTIL
+		return nil, nil
+	}
+	if err := m.InsertTask(next, t.ProjectID); err != nil {
+		reset := bson.D{{Key: "$set", Value: bson.D{{Key: "recurrence.spawned", Value: false}}}}
+		if _, resetErr := m.TaskCollection.UpdateOne(m.opContext(), bson.D{{Key: "_id", Value: t.ID}}, reset); resetErr != nil {
+			return nil, fmt.Errorf("%w; reset spawned flag: %v", err, resetErr)
+		}
+		return nil, err
+	}
+	return next, nil
+}
+
+// SetTaskRecurrence задаёт правило повторения задачи; пустое правило отключает повторение
+func (m *MongoStorage) SetTaskRecurrence(projectId, taskId ident.ID, rule string) error {
+	task, err := m.GetTask(projectId, taskId)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return errors.New("task not found")
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: taskId},
+		{Key: "projectId", Value: projectId},
+	}
+	var update bson.D
+	if rule == "" {
+		update = bson.D{{Key: "$unset", Value: bson.D{{Key: "recurrence", Value: ""}}}}
+	} else {
+		if task.Recurrence == nil {
+			task.Recurrence = &project.Recurrence{}
+		}
+		task.Recurrence.Rule = rule
+		startRecurrence(task)
+		update = bson.D{{Key: "$set", Value: bson.D{{Key: "recurrence", Value: task.Recurrence}}}}
+	}
+
+	_, err = m.TaskCollection.UpdateOne(m.opContext(), filter, update)
+	return err
+}
+
+// startRecurrence заполняет поля серии, если задача её открывает
+func startRecurrence(t *project.Task) {
+	r := t.Recurrence
+	if r.SeriesID.IsZero() {
+		r.SeriesID = t.ID
+	}
+	if r.Occurrence == 0 {
+		r.Occurrence = 1
+	}
+	if r.Start.IsZero() {
+		r.Start = t.Deadline
+	}
+	if r.Start.IsZero() {
+		r.Start = time.Now()
+	}
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"errors"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/report"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetWorkload агрегирует открытые задачи по ответственным и исполнителям.
+// Нулевой projectId означает все проекты; разбивка строится по срокам задач внутри [from, to].
+func (m *MongoStorage) GetWorkload(projectId ident.ID, from, to time.Time, interval string) ([]report.Workload, error) {
+	format, ok := report.PeriodFormat(interval)
+	if !ok {
+		return nil, errors.New("invalid interval")
+	}
+	now := time.Now()
+
+	match := openTasksFilter()
+	if !projectId.IsZero() {
+		match = append(match, bson.E{Key: "projectId", Value: projectId})
+	}
+
+	// Performers хранится строкой через запятую
+	performers := bson.D{{Key: "$map", Value: bson.D{
+		{Key: "input", Value: bson.D{{Key: "$split", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$performers", ""}}}, ","}}}},
+		{Key: "as", Value: "p"},
+		{Key: "in", Value: bson.D{
+			{Key: "user", Value: bson.D{{Key: "$trim", Value: bson.D{{Key: "input", Value: "$$p"}}}}},
+			{Key: "role", Value: "performer"},
+		}},
+	}}}
+	responsible := bson.A{bson.D{
+		{Key: "user", Value: bson.D{{Key: "$trim", Value: bson.D{{Key: "input", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$responsible", ""}}}}}}}},
+		{Key: "role", Value: "responsible"},
+	}}
+
+	hasDeadline := bson.D{{Key: "$gt", Value: bson.A{"$deadline", time.Unix(0, 0)}}}
+	inRange := bson.D{{Key: "$and", Value: bson.A{
+		hasDeadline,
+		bson.D{{Key: "$gte", Value: bson.A{"$deadline", from}}},
+		bson.D{{Key: "$lte", Value: bson.A{"$deadline", to}}},
+	}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "priority", Value: 1},
+			{Key: "estimate", Value: 1},
+			{Key: "deadline", Value: 1},
+			{Key: "assignees", Value: bson.D{{Key: "$concatArrays", Value: bson.A{responsible, performers}}}},
+		}}},
+		{{Key: "$unwind", Value: "$assignees"}},
+		{{Key: "$match", Value: bson.D{{Key: "assignees.user", Value: bson.D{{Key: "$ne", Value: ""}}}}}},
+		// Пользователь, который одновременно ответственный и исполнитель, считается один раз
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "task", Value: "$_id"}, {Key: "user", Value: "$assignees.user"}}},
+			{Key: "roles", Value: bson.D{{Key: "$addToSet", Value: "$assignees.role"}}},
+			{Key: "priority", Value: bson.D{{Key: "$first", Value: "$priority"}}},
+			{Key: "estimate", Value: bson.D{{Key: "$first", Value: "$estimate"}}},
+			{Key: "deadline", Value: bson.D{{Key: "$first", Value: "$deadline"}}},
+		}}},
+		{{Key: "$addFields", Value: bson.D{
+			{Key: "estimate", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$estimate", 0}}}},
+			{Key: "weight", Value: bson.D{{Key: "$multiply", Value: bson.A{
+				bson.D{{Key: "$max", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$priority", 0}}}, 1}}},
+				bson.D{{Key: "$cond", Value: bson.A{bson.D{{Key: "$gt", Value: bson.A{"$estimate", 0}}}, "$estimate", 1}}},
+			}}}},
+			{Key: "overdue", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$and", Value: bson.A{hasDeadline, bson.D{{Key: "$lt", Value: bson.A{"$deadline", now}}}}}}, 1, 0,
+			}}}},
+			{Key: "period", Value: bson.D{{Key: "$cond", Value: bson.A{
+				inRange,
+				bson.D{{Key: "$dateToString", Value: bson.D{{Key: "format", Value: format}, {Key: "date", Value: "$deadline"}}}},
+				nil,
+			}}}},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "user", Value: "$_id.user"}, {Key: "period", Value: "$period"}}},
+			{Key: "tasks", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "responsible", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{bson.D{{Key: "$in", Value: bson.A{"responsible", "$roles"}}}, 1, 0}}}}}},
+			{Key: "performer", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{bson.D{{Key: "$in", Value: bson.A{"performer", "$roles"}}}, 1, 0}}}}}},
+			{Key: "estimate", Value: bson.D{{Key: "$sum", Value: "$estimate"}}},
+			{Key: "weighted", Value: bson.D{{Key: "$sum", Value: "$weight"}}},
+			{Key: "overdue", Value: bson.D{{Key: "$sum", Value: "$overdue"}}},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$_id.user"},
+			{Key: "openTasks", Value: bson.D{{Key: "$sum", Value: "$tasks"}}},
+			{Key: "responsible", Value: bson.D{{Key: "$sum", Value: "$responsible"}}},
+			{Key: "performer", Value: bson.D{{Key: "$sum", Value: "$performer"}}},
+			{Key: "estimate", Value: bson.D{{Key: "$sum", Value: "$estimate"}}},
+			{Key: "weighted", Value: bson.D{{Key: "$sum", Value: "$weighted"}}},
+			{Key: "overdue", Value: bson.D{{Key: "$sum", Value: "$overdue"}}},
+			{Key: "breakdown", Value: bson.D{{Key: "$push", Value: bson.D{
+				{Key: "period", Value: "$_id.period"},
+				{Key: "tasks", Value: "$tasks"},
+				{Key: "weighted", Value: "$weighted"},
+				{Key: "overdue", Value: "$overdue"},
+			}}}},
+		}}},
+		{{Key: "$addFields", Value: bson.D{{Key: "breakdown", Value: bson.D{{Key: "$filter", Value: bson.D{
+			{Key: "input", Value: "$breakdown"},
+			{Key: "cond", Value: bson.D{{Key: "$ne", Value: bson.A{"$$this.period", nil}}}},
+		}}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "weighted", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	cursor, err := m.TaskCollection.Aggregate(m.opContext(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	workloads := []report.Workload{}
+	if err := cursor.All(m.opContext(), &workloads); err != nil {
+		return nil, err
+	}
+	for i := range workloads {
+		workloads[i].SortBuckets()
+	}
+	return workloads, nil
+}
+
+// openTasksFilter отбирает открытые задачи: статус не входит в завершающие (без учёта регистра и пробелов)
+func openTasksFilter() bson.D {
+	return bson.D{{Key: "$expr", Value: bson.D{{Key: "$not", Value: bson.A{
+		bson.D{{Key: "$in", Value: bson.A{
+			bson.D{{Key: "$toLower", Value: bson.D{{Key: "$trim", Value: bson.D{{Key: "input", Value: "$status"}}}}}},
+			project.TerminalStatuses,
+		}}},
+	}}}}}
+}
+
+// GetTotals считает открытые и просроченные задачи и проекты по статусам
+func (m *MongoStorage) GetTotals(now time.Time) (*report.Totals, error) {
+	totals := &report.Totals{ProjectsByStatus: map[string]int64{}}
+
+	open, err := m.TaskCollection.CountDocuments(m.opContext(), openTasksFilter())
+	if err != nil {
+		return nil, err
+	}
+	totals.OpenTasks = open
+
+	overdue := append(openTasksFilter(), bson.E{Key: "deadline", Value: bson.D{
+		{Key: "$gt", Value: time.Unix(0, 0)},
+		{Key: "$lt", Value: now},
+	}})
+	totals.OverdueTasks, err = m.TaskCollection.CountDocuments(m.opContext(), overdue)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$status"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+	cursor, err := m.ProjectCollection.Aggregate(m.opContext(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err := cursor.All(m.opContext(), &groups); err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		totals.ProjectsByStatus[g.Status] += g.Count
+	}
+	return totals, nil
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetResumeToken возвращает сохранённый токен change stream; nil — потока ещё не было
+func (m *MongoStorage) GetResumeToken(stream string) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := m.ResumeTokenCollection.FindOne(m.opContext(), bson.D{{Key: "_id", Value: stream}}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+// SaveResumeToken запоминает позицию change stream
+func (m *MongoStorage) SaveResumeToken(stream string, token bson.Raw) error {
+	filter := bson.D{{Key: "_id", Value: stream}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "token", Value: token},
+		{Key: "updatedAt", Value: time.Now()},
+	}}}
+	_, err := m.ResumeTokenCollection.UpdateOne(m.opContext(), filter, update, options.Update().SetUpsert(true))
+	return err
+}
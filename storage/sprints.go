@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"errors"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (m *MongoStorage) GetSprintsByProject(projectId ident.ID) ([]project.Sprint, error) {
+	var sprints []project.Sprint
+	filter := bson.D{{Key: "projectId", Value: projectId}}
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}})
+
+	cursor, err := m.SprintCollection.Find(m.opContext(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(m.opContext())
+
+	for cursor.Next(m.opContext()) {
+		var sprint project.Sprint
+		if err := cursor.Decode(&sprint); err != nil {
+			return nil, err
+		}
+		sprints = append(sprints, sprint)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return sprints, nil
+}
+func (m *MongoStorage) GetSprint(projectId, sprintId ident.ID) (*project.Sprint, error) {
+	filter := bson.D{
+		{Key: "_id", Value: sprintId},
+		{Key: "projectId", Value: projectId},
+	}
+
+	var sprint project.Sprint
+	err := m.SprintCollection.FindOne(m.opContext(), filter).Decode(&sprint)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &sprint, nil
+}
+func (m *MongoStorage) InsertSprint(s *project.Sprint, projectId ident.ID) error {
+	s.Id = ident.New()
+	s.ProjectID = projectId
+	s.Status = project.SprintPlanned
+	if s.DateCreation.IsZero() {
+		s.DateCreation = time.Now()
+	}
+
+	// Спринт можно создать только в существующем проекте
+	count, err := m.ProjectCollection.CountDocuments(m.opContext(), bson.D{{Key: "_id", Value: projectId}})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("project not found")
+	}
+
+	_, err = m.SprintCollection.InsertOne(m.opContext(), s)
+	return err
+}
+func (m *MongoStorage) UpdateSprint(projectId, sprintId ident.ID, updateFields bson.M) error {
+	// Статус и итоги меняются только через StartSprint и CloseSprint
+	updateFields, err := normalizeUpdate(sprintUpdatable, updateFields)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: sprintId},
+		{Key: "projectId", Value: projectId},
+	}
+	update := bson.D{{Key: "$set", Value: updateFields}}
+
+	res, err := m.SprintCollection.UpdateOne(m.opContext(), filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("sprint not found")
+	}
+	return nil
+}
+func (m *MongoStorage) DeleteSprint(projectId, sprintId ident.ID) error {
+	filter := bson.D{
+		{Key: "_id", Value: sprintId},
+		{Key: "projectId", Value: projectId},
+	}
+
+	res, err := m.SprintCollection.DeleteOne(m.opContext(), filter)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errors.New("sprint not found")
+	}
+
+	// Задачи удалённого спринта возвращаются в бэклог
+	return m.setTasksSprint(bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "sprintId", Value: sprintId},
+	}, ident.Nil)
+}
+func (m *MongoStorage) StartSprint(projectId, sprintId ident.ID) error {
+	// В проекте может идти только один спринт
+	active, err := m.SprintCollection.CountDocuments(m.opContext(), bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "status", Value: project.SprintActive},
+	})
+	if err != nil {
+		return err
+	}
+	if active > 0 {
+		return errors.New("project already has an active sprint")
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: sprintId},
+		{Key: "projectId", Value: projectId},
+		{Key: "status", Value: project.SprintPlanned},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: project.SprintActive},
+		{Key: "startedAt", Value: time.Now()},
+	}}}
+
+	res, err := m.SprintCollection.UpdateOne(m.opContext(), filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return m.sprintStateError(projectId, sprintId, "sprint is not planned")
+	}
+	return nil
+}
+func (m *MongoStorage) CloseSprint(projectId, sprintId, nextSprintId ident.ID) (int64, error) {
+	// Незавершённые задачи переносятся в следующий спринт или, если он не указан, в бэклог
+	if !nextSprintId.IsZero() {
+		next, err := m.GetSprint(projectId, nextSprintId)
+		if err != nil {
+			return 0, err
+		}
+		if next == nil {
+			return 0, errors.New("next sprint not found")
+		}
+		if next.Status == project.SprintClosed || next.Id == sprintId {
+			return 0, errors.New("next sprint must be open")
+		}
+	}
+
+	tasks, err := m.GetTasksBySprint(projectId, sprintId)
+	if err != nil {
+		return 0, err
+	}
+	var unfinished []ident.ID
+	for _, t := range tasks {
+		if !project.IsTerminal(t.Status) {
+			unfinished = append(unfinished, t.ID)
+		}
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: sprintId},
+		{Key: "projectId", Value: projectId},
+		{Key: "status", Value: project.SprintActive},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: project.SprintClosed},
+		{Key: "closedAt", Value: time.Now()},
+		{Key: "carriedOver", Value: int64(len(unfinished))},
+	}}}
+
+	res, err := m.SprintCollection.UpdateOne(m.opContext(), filter, update)
+	if err != nil {
+		return 0, err
+	}
+	if res.MatchedCount == 0 {
+		return 0, m.sprintStateError(projectId, sprintId, "sprint is not active")
+	}
+	if len(unfinished) == 0 {
+		return 0, nil
+	}
+
+	err = m.setTasksSprint(bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "_id", Value: bson.D{{Key: "$in", Value: unfinished}}},
+	}, nextSprintId)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(unfinished)), nil
+}
+func (m *MongoStorage) AssignTasksToSprint(projectId, sprintId ident.ID, taskIds []ident.ID) error {
+	// Нулевой sprintId снимает задачи со спринта
+	if !sprintId.IsZero() {
+		sprint, err := m.GetSprint(projectId, sprintId)
+		if err != nil {
+			return err
+		}
+		if sprint == nil {
+			return errors.New("sprint not found")
+		}
+		if sprint.Status == project.SprintClosed {
+			return errors.New("sprint is closed")
+		}
+	}
+
+	return m.setTasksSprint(bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "_id", Value: bson.D{{Key: "$in", Value: taskIds}}},
+	}, sprintId)
+}
+func (m *MongoStorage) GetTasksBySprint(projectId, sprintId ident.ID) ([]project.Task, error) {
+	var tasks []project.Task
+	filter := bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "sprintId", Value: sprintId},
+	}
+
+	cursor, err := m.TaskCollection.Find(m.opContext(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(m.opContext())
+
+	for cursor.Next(m.opContext()) {
+		var task project.Task
+		if err := cursor.Decode(&task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+func (m *MongoStorage) setTasksSprint(filter bson.D, sprintId ident.ID) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "sprintId", Value: sprintId}}}}
+
+	_, err := m.TaskCollection.UpdateMany(m.opContext(), filter, update)
+	return err
+}
+
+// sprintStateError различает отсутствующий спринт и спринт в неподходящем статусе
+func (m *MongoStorage) sprintStateError(projectId, sprintId ident.ID, stateMsg string) error {
+	sprint, err := m.GetSprint(projectId, sprintId)
+	if err != nil {
+		return err
+	}
+	if sprint == nil {
+		return errors.New("sprint not found")
+	}
+	return errors.New(stateMsg)
+}
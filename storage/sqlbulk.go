@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"errors"
+	"tmv/ident"
+	"tmv/project"
+)
+
+// InsertTasks вставляет задачи проекта в одной транзакции: пакет записывается целиком или не
+// записывается совсем, поэтому ошибки отдельных задач всегда nil.
+func (s *SQLStorage) InsertTasks(tasks []*project.Task, projectId ident.ID) ([]error, error) {
+	errs := make([]error, len(tasks))
+	err := s.inTx(func(tx *SQLStorage) error {
+		n, err := tx.count("SELECT COUNT(*) FROM projects WHERE id = $1", projectId)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errors.New("project not found")
+		}
+
+		for _, t := range tasks {
+			if err := tx.insertTask(t, projectId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// UpdateTasks применяет частичные обновления задач проекта в одной транзакции. Отсутствующая
+// задача и недопустимое обновление — ошибки отдельных элементов: они выявляются до записи
+// и не прерывают транзакцию. Прочие ошибки откатывают пакет целиком.
+func (s *SQLStorage) UpdateTasks(projectId ident.ID, updates []TaskUpdate) ([]error, error) {
+	errs := make([]error, len(updates))
+	err := s.inTx(func(tx *SQLStorage) error {
+		for i, u := range updates {
+			found, err := tx.updateTask(projectId, u.ID, u.Fields)
+			if errors.Is(err, ErrInvalidUpdate) {
+				errs[i] = err
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !found {
+				errs[i] = ErrTaskNotFound
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"errors"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/user"
+)
+
+const notificationColumns = "id, user_id, kind, title, message, project_id, task_id, read, date_creation"
+
+func (s *SQLStorage) InsertNotification(n *user.Notification) error {
+	n.Id = ident.New()
+	if n.DateCreation.IsZero() {
+		n.DateCreation = time.Now()
+	}
+
+	_, err := s.exec("INSERT INTO notifications ("+notificationColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		n.Id, n.UserID, n.Kind, n.Title, n.Message, nullID(n.ProjectID), nullID(n.TaskID), n.Read, n.DateCreation)
+	if sqlViolation(err) == violationForeignKey {
+		return errors.New("user not found")
+	}
+	return err
+}
+
+// Нулевой срок означает, что срок не задан; в SQL это NULL, а дата до 1970 — как в MongoDB — тоже не срок
+const dueBefore = " WHERE deadline > $1 AND deadline <= $2"
+
+// GetTasksDueBefore возвращает задачи со сроком не позже t (включая просроченные)
+func (s *SQLStorage) GetTasksDueBefore(t time.Time) ([]project.Task, error) {
+	return s.queryTasks(dueBefore, time.Unix(0, 0), t)
+}
+
+// GetProjectsDueBefore возвращает проекты со сроком не позже t (включая просроченные)
+func (s *SQLStorage) GetProjectsDueBefore(t time.Time) ([]project.Project, error) {
+	return s.queryProjects(dueBefore, time.Unix(0, 0), t)
+}
+
+// MarkReminderSent атомарно отмечает напоминание с ключом key как отправленное.
+// false — напоминание уже было отправлено ранее, в том числе другим экземпляром сервера.
+func (s *SQLStorage) MarkReminderSent(key string) (bool, error) {
+	res, err := s.exec("INSERT INTO reminders (key, sent_at) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING", key, time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetNotifications возвращает страницу входящих пользователя, новые сверху, и общее число записей
+func (s *SQLStorage) GetNotifications(userId ident.ID, unreadOnly bool, offset, limit int64) ([]user.Notification, int64, error) {
+	where := " WHERE user_id = $1"
+	if unreadOnly {
+		where += " AND NOT read"
+	}
+
+	total, err := s.count("SELECT COUNT(*) FROM notifications"+where, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// limit 0, как и в MongoDB, — без ограничения: в PostgreSQL это LIMIT NULL, в SQLite LIMIT -1
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	} else if s.dialect == sqliteDialect {
+		limitArg = -1
+	}
+	rows, err := s.query("SELECT "+notificationColumns+" FROM notifications"+where+
+		" ORDER BY date_creation DESC, id DESC LIMIT $2 OFFSET $3", userId, limitArg, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	notifications := []user.Notification{}
+	for rows.Next() {
+		var n user.Notification
+		err := rows.Scan(scanID{&n.Id}, scanID{&n.UserID}, &n.Kind, &n.Title, &n.Message,
+			scanID{&n.ProjectID}, scanID{&n.TaskID}, &n.Read, scanTime{&n.DateCreation})
+		if err != nil {
+			return nil, 0, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, total, rows.Err()
+}
+func (s *SQLStorage) CountUnreadNotifications(userId ident.ID) (int64, error) {
+	return s.count("SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND NOT read", userId)
+}
+func (s *SQLStorage) MarkNotificationRead(userId, notificationId ident.ID) error {
+	res, err := s.exec("UPDATE notifications SET read = TRUE WHERE id = $1 AND user_id = $2", notificationId, userId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("notification not found")
+	}
+	return nil
+}
+func (s *SQLStorage) MarkAllNotificationsRead(userId ident.ID) (int64, error) {
+	res, err := s.exec("UPDATE notifications SET read = TRUE WHERE user_id = $1 AND NOT read", userId)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Watch подписывает пользователя на проект или задачу; повторная подписка ничего не меняет
+func (s *SQLStorage) Watch(w *user.Watch) error {
+	query, missing := "SELECT COUNT(*) FROM projects WHERE id = $1", "project not found"
+	args := []interface{}{w.TargetID}
+	if w.Kind == user.WatchTask {
+		query, missing = "SELECT COUNT(*) FROM tasks WHERE id = $1 AND project_id = $2", "task not found"
+		args = append(args, w.ProjectID)
+	}
+	n, err := s.count(query, args...)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New(missing)
+	}
+
+	_, err = s.exec(`INSERT INTO watches (id, user_id, kind, target_id, project_id, date_creation)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (user_id, kind, target_id) DO NOTHING`,
+		ident.New(), w.UserID, w.Kind, w.TargetID, nullID(w.ProjectID), time.Now())
+	return err
+}
+func (s *SQLStorage) Unwatch(userId ident.ID, kind string, targetId ident.ID) error {
+	res, err := s.exec("DELETE FROM watches WHERE user_id = $1 AND kind = $2 AND target_id = $3", userId, kind, targetId)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New("watch not found")
+	}
+	return nil
+}
+
+// GetWatchers возвращает подписчиков задачи и её проекта без повторов
+func (s *SQLStorage) GetWatchers(projectId, taskId ident.ID) ([]ident.ID, error) {
+	rows, err := s.query(`SELECT DISTINCT user_id FROM watches
+		WHERE (kind = $1 AND target_id = $2) OR (kind = $3 AND target_id = $4) ORDER BY user_id`,
+		user.WatchProject, projectId, user.WatchTask, taskId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []ident.ID
+	for rows.Next() {
+		var id ident.ID
+		if err := rows.Scan(scanID{&id}); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *SQLStorage) InsertComment(cm *project.Comment, projectId, taskId ident.ID) error {
+	if err := s.checkTask(projectId, taskId); err != nil {
+		return err
+	}
+
+	cm.Id = ident.New()
+	cm.ProjectID = projectId
+	cm.TaskID = taskId
+	if cm.DateCreation.IsZero() {
+		cm.DateCreation = time.Now()
+	}
+
+	_, err := s.exec("INSERT INTO comments (id, project_id, task_id, author_id, text, date_creation) VALUES ($1, $2, $3, $4, $5, $6)",
+		cm.Id, cm.ProjectID, cm.TaskID, nullID(cm.AuthorID), cm.Text, cm.DateCreation)
+	if sqlViolation(err) == violationForeignKey {
+		return errors.New("task not found")
+	}
+	return err
+}
+func (s *SQLStorage) GetCommentsByTask(projectId, taskId ident.ID) ([]project.Comment, error) {
+	rows, err := s.query(`SELECT id, project_id, task_id, author_id, text, date_creation FROM comments
+		WHERE project_id = $1 AND task_id = $2 ORDER BY date_creation, id`, projectId, taskId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []project.Comment{}
+	for rows.Next() {
+		var cm project.Comment
+		err := rows.Scan(scanID{&cm.Id}, scanID{&cm.ProjectID}, scanID{&cm.TaskID}, scanID{&cm.AuthorID}, &cm.Text, scanTime{&cm.DateCreation})
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, cm)
+	}
+	return comments, rows.Err()
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"time"
+	"tmv/event"
+	"tmv/ident"
+)
+
+const outboxColumns = "id, type, project_id, occurred_at, payload, done, attempts, last_error, failed, next_attempt, trace"
+
+func (s *SQLStorage) InsertOutbox(r *event.Record) error {
+	_, err := s.exec("INSERT INTO outbox ("+outboxColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		r.Id, r.Type, nullID(r.ProjectID), r.OccurredAt, []byte(r.Payload), toJSON(r.Done), r.Attempts,
+		r.LastError, r.Failed, r.NextAttempt, traceValue(r.Trace))
+	return err
+}
+
+// UpdateOutbox сохраняет данные, список обработавших подписчиков и время следующей попытки
+func (s *SQLStorage) UpdateOutbox(r *event.Record) error {
+	_, err := s.exec(`UPDATE outbox SET project_id = $1, payload = $2, done = $3, attempts = $4, last_error = $5,
+		failed = $6, next_attempt = $7 WHERE id = $8`,
+		nullID(r.ProjectID), []byte(r.Payload), toJSON(r.Done), r.Attempts, r.LastError, r.Failed, r.NextAttempt, r.Id)
+	return err
+}
+func (s *SQLStorage) DeleteOutbox(id ident.ID) error {
+	_, err := s.exec("DELETE FROM outbox WHERE id = $1", id)
+	return err
+}
+
+// ClaimOutbox забирает самую старую запись, чья очередь наступила к now, и откладывает
+// её на lease, чтобы другой экземпляр сервера не взял её одновременно. nil — записей нет.
+func (s *SQLStorage) ClaimOutbox(now time.Time, lease time.Duration) (*event.Record, error) {
+	rows, err := s.query(`UPDATE outbox SET next_attempt = $1
+		WHERE id = (SELECT id FROM outbox WHERE NOT failed AND next_attempt <= $2
+			ORDER BY next_attempt, id LIMIT 1`+s.dialect.skipLocked+`)
+		RETURNING `+outboxColumns, now.Add(lease), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var (
+		r       event.Record
+		payload []byte
+	)
+	err = rows.Scan(scanID{&r.Id}, &r.Type, scanID{&r.ProjectID}, scanTime{&r.OccurredAt}, &payload, scanJSON{&r.Done},
+		&r.Attempts, &r.LastError, &r.Failed, scanTime{&r.NextAttempt}, scanJSON{&r.Trace})
+	if err != nil {
+		return nil, err
+	}
+	r.Payload = payload
+	return &r, nil
+}
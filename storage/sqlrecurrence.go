@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"tmv/ident"
+	"tmv/project"
+)
+
+// GetRecurringTasks возвращает повторяющиеся задачи, для которых следующее вхождение ещё не создано
+func (s *SQLStorage) GetRecurringTasks() ([]project.Task, error) {
+	return s.queryTasks(" WHERE recurrence_rule IS NOT NULL AND NOT recurrence_spawned")
+}
+
+// SpawnOccurrence создаёт следующее вхождение серии. Задача сначала помечается как обработанная,
+// поэтому при нескольких экземплярах сервера вхождение создаётся один раз; nil — создавать нечего.
+func (s *SQLStorage) SpawnOccurrence(t *project.Task) (*project.Task, error) {
+	var next *project.Task
+	err := s.inTx(func(tx *SQLStorage) error {
+		res, err := tx.exec("UPDATE tasks SET recurrence_spawned = TRUE WHERE id = $1 AND recurrence_rule IS NOT NULL AND NOT recurrence_spawned", t.ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+
+		occurrence, ok := t.NextOccurrence()
+		if !ok {
+			// Серия закончилась по COUNT или UNTIL
+			return nil
+		}
+		if err := tx.InsertTask(occurrence, t.ProjectID); err != nil {
+			return err
+		}
+		next = occurrence
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// SetTaskRecurrence задаёт правило повторения задачи; пустое правило отключает повторение
+func (s *SQLStorage) SetTaskRecurrence(projectId, taskId ident.ID, rule string) error {
+	return s.inTx(func(tx *SQLStorage) error {
+		task, err := tx.GetTask(projectId, taskId)
+		if err != nil {
+			return err
+		}
+		if task == nil {
+			return errors.New("task not found")
+		}
+
+		if rule == "" {
+			task.Recurrence = nil
+		} else {
+			if task.Recurrence == nil {
+				task.Recurrence = &project.Recurrence{}
+			}
+			task.Recurrence.Rule = rule
+			startRecurrence(task)
+		}
+
+		args := append(recurrenceValues(task.Recurrence), taskId, projectId)
+		_, err = tx.exec(`UPDATE tasks SET recurrence_rule = $1, recurrence_start = $2, recurrence_series_id = $3,
+			recurrence_occurrence = $4, recurrence_spawned = $5 WHERE id = $6 AND project_id = $7`, args...)
+		return err
+	})
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/report"
+)
+
+// GetWorkload агрегирует открытые задачи по ответственным и исполнителям так же, как конвейер
+// MongoDB в reports.go, но в Go: разбор performers и роли переносимо в SQL не выразить.
+func (s *SQLStorage) GetWorkload(projectId ident.ID, from, to time.Time, interval string) ([]report.Workload, error) {
+	if _, ok := report.PeriodFormat(interval); !ok {
+		return nil, errors.New("invalid interval")
+	}
+
+	query := "SELECT priority, estimate, deadline, responsible, performers, status FROM tasks"
+	var args []interface{}
+	if !projectId.IsZero() {
+		query += " WHERE project_id = $1"
+		args = append(args, projectId)
+	}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []project.Task
+	for rows.Next() {
+		var t project.Task
+		if err := rows.Scan(&t.Priority, &t.Estimate, scanTime{&t.Deadline}, &t.Responsible, &t.Performers, &t.Status); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return aggregateWorkload(tasks, from, to, interval, time.Now()), nil
+}
+
+// openTasksWhere отбирает открытые задачи: статус не входит в завершающие (без учёта регистра и пробелов)
+func openTasksWhere() (string, []interface{}) {
+	args := make([]interface{}, len(project.TerminalStatuses))
+	for i, status := range project.TerminalStatuses {
+		args[i] = status
+	}
+	return " WHERE LOWER(TRIM(status)) NOT IN (" + placeholders(1, len(args)) + ")", args
+}
+
+// GetTotals считает открытые и просроченные задачи и проекты по статусам
+func (s *SQLStorage) GetTotals(now time.Time) (*report.Totals, error) {
+	totals := &report.Totals{ProjectsByStatus: map[string]int64{}}
+
+	where, args := openTasksWhere()
+	open, err := s.count("SELECT COUNT(*) FROM tasks"+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	totals.OpenTasks = open
+
+	n := len(args)
+	args = append(args, time.Unix(0, 0), now)
+	totals.OverdueTasks, err = s.count(fmt.Sprintf("SELECT COUNT(*) FROM tasks%s AND deadline > $%d AND deadline < $%d", where, n+1, n+2), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.query("SELECT status, COUNT(*) FROM projects GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			status string
+			count  int64
+		)
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		totals.ProjectsByStatus[status] += count
+	}
+	return totals, rows.Err()
+}
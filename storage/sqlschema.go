@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// schemaMigration — версия схемы SQL-хранилища. Версии не меняются после выпуска; изменение
+// схемы добавляется новой версией в конец sqlSchema. В DDL вместо типов, различающихся
+// между PostgreSQL и SQLite, стоят подстановки {id}, {time} и т. п., см. sqlDialect.
+type schemaMigration struct {
+	Version    int
+	Name       string
+	Statements []string
+}
+
+var sqlSchema = []schemaMigration{
+	{1, "initial schema", []string{
+		`CREATE TABLE users (
+			id {id} PRIMARY KEY,
+			name TEXT NOT NULL DEFAULT '',
+			work TEXT NOT NULL DEFAULT '',
+			age INTEGER NOT NULL DEFAULT 0,
+			salary INTEGER NOT NULL DEFAULT 0,
+			email TEXT NOT NULL DEFAULT '',
+			notify_disabled BOOLEAN NOT NULL DEFAULT FALSE,
+			notify_channels TEXT,
+			notify_webhook_url TEXT NOT NULL DEFAULT ''
+		)`,
+		// Пустой email не участвует в уникальности: он есть у пользователей, созданных без него
+		`CREATE UNIQUE INDEX users_email_unique ON users (email) WHERE email <> ''`,
+
+		`CREATE TABLE projects (
+			id {id} PRIMARY KEY,
+			user_id {id} NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			name TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			priority INTEGER NOT NULL DEFAULT 0,
+			author TEXT NOT NULL DEFAULT '',
+			responsible TEXT NOT NULL DEFAULT '',
+			performers TEXT NOT NULL DEFAULT '',
+			date_creation {time},
+			deadline {time},
+			guests TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX projects_user_id ON projects (user_id)`,
+		`CREATE INDEX projects_deadline ON projects (deadline)`,
+
+		`CREATE TABLE sprints (
+			id {id} PRIMARY KEY,
+			project_id {id} NOT NULL REFERENCES projects (id) ON DELETE CASCADE,
+			name TEXT NOT NULL DEFAULT '',
+			goal TEXT NOT NULL DEFAULT '',
+			starts_at {time},
+			ends_at {time},
+			status TEXT NOT NULL,
+			date_creation {time},
+			started_at {time},
+			closed_at {time},
+			carried_over {bigint} NOT NULL DEFAULT 0
+		)`,
+		`CREATE INDEX sprints_project_id_starts_at ON sprints (project_id, starts_at)`,
+		// В проекте может идти только один спринт
+		`CREATE UNIQUE INDEX sprints_one_active ON sprints (project_id) WHERE status = 'active'`,
+
+		`CREATE TABLE tasks (
+			id {id} PRIMARY KEY,
+			project_id {id} NOT NULL REFERENCES projects (id) ON DELETE CASCADE,
+			name TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			priority INTEGER NOT NULL DEFAULT 0,
+			author TEXT NOT NULL DEFAULT '',
+			responsible TEXT NOT NULL DEFAULT '',
+			performers TEXT NOT NULL DEFAULT '',
+			date_creation {time},
+			deadline {time},
+			guests TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT '',
+			rank {rank} NOT NULL DEFAULT '',
+			-- Задачи удалённого спринта возвращаются в бэклог
+			sprint_id {id} REFERENCES sprints (id) ON DELETE SET NULL,
+			estimate {float} NOT NULL DEFAULT 0,
+			remaining {float} NOT NULL DEFAULT 0,
+			recurrence_rule TEXT,
+			recurrence_start {time},
+			recurrence_series_id {id},
+			recurrence_occurrence INTEGER,
+			recurrence_spawned BOOLEAN
+		)`,
+		`CREATE INDEX tasks_project_id_status_rank ON tasks (project_id, status, rank)`,
+		`CREATE INDEX tasks_sprint_id ON tasks (sprint_id)`,
+		`CREATE INDEX tasks_deadline ON tasks (deadline)`,
+		`CREATE INDEX tasks_recurrence_pending ON tasks (recurrence_spawned) WHERE recurrence_rule IS NOT NULL`,
+
+		`CREATE TABLE task_status_changes (
+			task_id {id} NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+			seq INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			at {time} NOT NULL,
+			PRIMARY KEY (task_id, seq)
+		)`,
+
+		`CREATE TABLE worklogs (
+			id {id} PRIMARY KEY,
+			project_id {id} NOT NULL REFERENCES projects (id) ON DELETE CASCADE,
+			task_id {id} NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+			user_id {id} NOT NULL,
+			started {time} NOT NULL,
+			ended {time},
+			duration {bigint} NOT NULL DEFAULT 0,
+			note TEXT NOT NULL DEFAULT '',
+			running BOOLEAN NOT NULL DEFAULT FALSE,
+			date_creation {time},
+			consumed {float} NOT NULL DEFAULT 0
+		)`,
+		`CREATE INDEX worklogs_task_id_started ON worklogs (task_id, started)`,
+		`CREATE INDEX worklogs_started ON worklogs (started)`,
+		// У пользователя может идти только один таймер
+		`CREATE UNIQUE INDEX worklogs_one_running ON worklogs (user_id) WHERE running`,
+
+		`CREATE TABLE notifications (
+			id {id} PRIMARY KEY,
+			user_id {id} NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			kind TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL DEFAULT '',
+			project_id {id},
+			task_id {id},
+			read BOOLEAN NOT NULL DEFAULT FALSE,
+			date_creation {time} NOT NULL
+		)`,
+		`CREATE INDEX notifications_user_id_date_creation ON notifications (user_id, date_creation DESC, id DESC)`,
+
+		`CREATE TABLE reminders (
+			key TEXT PRIMARY KEY,
+			sent_at {time} NOT NULL
+		)`,
+
+		`CREATE TABLE comments (
+			id {id} PRIMARY KEY,
+			project_id {id} NOT NULL REFERENCES projects (id) ON DELETE CASCADE,
+			task_id {id} NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+			author_id {id},
+			text TEXT NOT NULL DEFAULT '',
+			date_creation {time} NOT NULL
+		)`,
+		`CREATE INDEX comments_task_id_date_creation ON comments (task_id, date_creation)`,
+
+		`CREATE TABLE watches (
+			id {id} PRIMARY KEY,
+			user_id {id} NOT NULL,
+			kind TEXT NOT NULL,
+			target_id {id} NOT NULL,
+			project_id {id},
+			date_creation {time} NOT NULL,
+			UNIQUE (user_id, kind, target_id)
+		)`,
+		`CREATE INDEX watches_kind_target_id ON watches (kind, target_id)`,
+
+		// Подписки переживают удаление проекта до доставки project.deleted, поэтому project_id
+		// без внешнего ключа, а удаление проекта только выставляет project_deleted
+		`CREATE TABLE webhooks (
+			id {id} PRIMARY KEY,
+			project_id {id} NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL DEFAULT '',
+			events TEXT NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			date_creation {time} NOT NULL,
+			project_deleted BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		`CREATE INDEX webhooks_project_id ON webhooks (project_id)`,
+
+		`CREATE TABLE webhook_deliveries (
+			id {id} PRIMARY KEY,
+			webhook_id {id} NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+			project_id {id},
+			event_id TEXT NOT NULL DEFAULT '',
+			event TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			attempts TEXT,
+			next_attempt {time},
+			date_creation {time} NOT NULL,
+			trace TEXT
+		)`,
+		`CREATE INDEX webhook_deliveries_webhook_id_date_creation ON webhook_deliveries (webhook_id, date_creation DESC)`,
+		`CREATE INDEX webhook_deliveries_status_next_attempt ON webhook_deliveries (status, next_attempt)`,
+
+		// События переживают удаление проекта, поэтому project_id без внешнего ключа
+		`CREATE TABLE outbox (
+			id {id} PRIMARY KEY,
+			type TEXT NOT NULL,
+			project_id {id},
+			occurred_at {time} NOT NULL,
+			payload {blob},
+			done TEXT,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			failed BOOLEAN NOT NULL DEFAULT FALSE,
+			next_attempt {time} NOT NULL,
+			trace TEXT
+		)`,
+		`CREATE INDEX outbox_failed_next_attempt ON outbox (failed, next_attempt, id)`,
+	}},
+}
+
+// migrateSchema применяет неприменённые версии sqlSchema, каждую в своей транзакции.
+// Схема, обновлённая более новой версией сервера, не трогается, а считается ошибкой.
+func (s *SQLStorage) migrateSchema(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, s.dialect.types.Replace(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at {time} NOT NULL
+	)`))
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	latest := sqlSchema[len(sqlSchema)-1].Version
+	current, err := s.schemaVersion(ctx, s.DB)
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than %d supported by this version; use a newer binary", current, latest)
+	}
+
+	for _, m := range sqlSchema {
+		if m.Version <= current {
+			continue
+		}
+		if err := s.applySchema(ctx, m); err != nil {
+			return fmt.Errorf("schema version %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStorage) applySchema(ctx context.Context, m schemaMigration) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Другой экземпляр мог применить версию, пока этот ждал блокировку
+	if s.dialect.lockSchema != "" {
+		if _, err := tx.ExecContext(ctx, s.dialect.lockSchema); err != nil {
+			return err
+		}
+	}
+	current, err := s.schemaVersion(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if current >= m.Version {
+		return nil
+	}
+
+	for _, stmt := range m.Statements {
+		if _, err := tx.ExecContext(ctx, s.dialect.types.Replace(stmt)); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+		m.Version, m.Name, s.dialect.time(time.Now()))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SchemaVersion возвращает последнюю применённую версию схемы
+func (s *SQLStorage) SchemaVersion(ctx context.Context) (int, error) {
+	return s.schemaVersion(ctx, s.DB)
+}
+
+func (s *SQLStorage) schemaVersion(ctx context.Context, q sqlQuerier) (int, error) {
+	var version sql.NullInt64
+	if err := q.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const sprintColumns = "id, project_id, name, goal, starts_at, ends_at, status, date_creation, started_at, closed_at, carried_over"
+
+func (s *SQLStorage) querySprints(where string, args ...interface{}) ([]project.Sprint, error) {
+	// Спринты без даты начала идут первыми, как нулевая дата в MongoDB; PostgreSQL сам ставит NULL в конец
+	rows, err := s.query("SELECT "+sprintColumns+" FROM sprints"+where+" ORDER BY starts_at IS NOT NULL, starts_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sprints []project.Sprint
+	for rows.Next() {
+		var sp project.Sprint
+		err := rows.Scan(scanID{&sp.Id}, scanID{&sp.ProjectID}, &sp.Name, &sp.Goal, scanTime{&sp.Start}, scanTime{&sp.End},
+			&sp.Status, scanTime{&sp.DateCreation}, scanTime{&sp.StartedAt}, scanTime{&sp.ClosedAt}, &sp.CarriedOver)
+		if err != nil {
+			return nil, err
+		}
+		sprints = append(sprints, sp)
+	}
+	return sprints, rows.Err()
+}
+
+func (s *SQLStorage) GetSprintsByProject(projectId ident.ID) ([]project.Sprint, error) {
+	return s.querySprints(" WHERE project_id = $1", projectId)
+}
+func (s *SQLStorage) GetSprint(projectId, sprintId ident.ID) (*project.Sprint, error) {
+	sprints, err := s.querySprints(" WHERE id = $1 AND project_id = $2", sprintId, projectId)
+	if err != nil {
+		return nil, err
+	}
+	if len(sprints) == 0 {
+		return nil, nil
+	}
+	return &sprints[0], nil
+}
+func (s *SQLStorage) InsertSprint(sp *project.Sprint, projectId ident.ID) error {
+	sp.Id = ident.New()
+	sp.ProjectID = projectId
+	sp.Status = project.SprintPlanned
+	if sp.DateCreation.IsZero() {
+		sp.DateCreation = time.Now()
+	}
+
+	_, err := s.exec("INSERT INTO sprints ("+sprintColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		sp.Id, sp.ProjectID, sp.Name, sp.Goal, nullTime(sp.Start), nullTime(sp.End), sp.Status,
+		sp.DateCreation, nullTime(sp.StartedAt), nullTime(sp.ClosedAt), sp.CarriedOver)
+	// Спринт можно создать только в существующем проекте
+	if sqlViolation(err) == violationForeignKey {
+		return errors.New("project not found")
+	}
+	return err
+}
+func (s *SQLStorage) UpdateSprint(projectId, sprintId ident.ID, updateFields bson.M) error {
+	n, err := s.update("sprints", sprintUpdatable, updateFields, "id = $1 AND project_id = $2", sprintId, projectId)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("sprint not found")
+	}
+	return nil
+}
+
+// DeleteSprint удаляет спринт; его задачи возвращаются в бэклог (ON DELETE SET NULL)
+func (s *SQLStorage) DeleteSprint(projectId, sprintId ident.ID) error {
+	res, err := s.exec("DELETE FROM sprints WHERE id = $1 AND project_id = $2", sprintId, projectId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("sprint not found")
+	}
+	return nil
+}
+func (s *SQLStorage) StartSprint(projectId, sprintId ident.ID) error {
+	res, err := s.exec("UPDATE sprints SET status = $1, started_at = $2 WHERE id = $3 AND project_id = $4 AND status = $5",
+		project.SprintActive, time.Now(), sprintId, projectId, project.SprintPlanned)
+	// Второй активный спринт не пропускает уникальный индекс sprints_one_active
+	if sqlViolation(err) == violationUnique {
+		return errors.New("project already has an active sprint")
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return s.sprintStateError(projectId, sprintId, "sprint is not planned")
+	}
+	return nil
+}
+func (s *SQLStorage) CloseSprint(projectId, sprintId, nextSprintId ident.ID) (int64, error) {
+	var carried int64
+	err := s.inTx(func(tx *SQLStorage) error {
+		// Незавершённые задачи переносятся в следующий спринт или, если он не указан, в бэклог
+		if !nextSprintId.IsZero() {
+			next, err := tx.GetSprint(projectId, nextSprintId)
+			if err != nil {
+				return err
+			}
+			if next == nil {
+				return errors.New("next sprint not found")
+			}
+			if next.Status == project.SprintClosed || next.Id == sprintId {
+				return errors.New("next sprint must be open")
+			}
+		}
+
+		tasks, err := tx.GetTasksBySprint(projectId, sprintId)
+		if err != nil {
+			return err
+		}
+		var unfinished []ident.ID
+		for _, t := range tasks {
+			if !project.IsTerminal(t.Status) {
+				unfinished = append(unfinished, t.ID)
+			}
+		}
+
+		res, err := tx.exec("UPDATE sprints SET status = $1, closed_at = $2, carried_over = $3 WHERE id = $4 AND project_id = $5 AND status = $6",
+			project.SprintClosed, time.Now(), int64(len(unfinished)), sprintId, projectId, project.SprintActive)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return tx.sprintStateError(projectId, sprintId, "sprint is not active")
+		}
+
+		carried = int64(len(unfinished))
+		return tx.setTasksSprint(projectId, unfinished, nextSprintId)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return carried, nil
+}
+func (s *SQLStorage) AssignTasksToSprint(projectId, sprintId ident.ID, taskIds []ident.ID) error {
+	// Нулевой sprintId снимает задачи со спринта
+	if !sprintId.IsZero() {
+		sprint, err := s.GetSprint(projectId, sprintId)
+		if err != nil {
+			return err
+		}
+		if sprint == nil {
+			return errors.New("sprint not found")
+		}
+		if sprint.Status == project.SprintClosed {
+			return errors.New("sprint is closed")
+		}
+	}
+
+	return s.setTasksSprint(projectId, taskIds, sprintId)
+}
+
+// GetTasksBySprint возвращает задачи спринта; нулевой sprintId — задачи бэклога
+func (s *SQLStorage) GetTasksBySprint(projectId, sprintId ident.ID) ([]project.Task, error) {
+	if sprintId.IsZero() {
+		return s.queryTasks(" WHERE project_id = $1 AND sprint_id IS NULL", projectId)
+	}
+	return s.queryTasks(" WHERE project_id = $1 AND sprint_id = $2", projectId, sprintId)
+}
+
+func (s *SQLStorage) setTasksSprint(projectId ident.ID, taskIds []ident.ID, sprintId ident.ID) error {
+	for start := 0; start < len(taskIds); start += sqlChunk {
+		chunk := taskIds[start:minInt(start+sqlChunk, len(taskIds))]
+		args := append([]interface{}{nullID(sprintId), projectId}, idArgs(chunk)...)
+		_, err := s.exec("UPDATE tasks SET sprint_id = $1 WHERE project_id = $2 AND id IN ("+placeholders(3, len(chunk))+")", args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sprintStateError различает отсутствующий спринт и спринт в неподходящем статусе
+func (s *SQLStorage) sprintStateError(projectId, sprintId ident.ID, stateMsg string) error {
+	var status string
+	err := s.queryRow("SELECT status FROM sprints WHERE id = $1 AND project_id = $2", sprintId, projectId).Scan(&status)
+	if err == sql.ErrNoRows {
+		return errors.New("sprint not found")
+	}
+	if err != nil {
+		return err
+	}
+	return errors.New(stateMsg)
+}
@@ -0,0 +1,905 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"tmv/config"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/user"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLStorage — хранилище в PostgreSQL или SQLite через database/sql. Схема создаётся и
+// обновляется при открытии, см. sqlschema.go. Списки User.Projects и Project.Tasks не хранятся,
+// а собираются по внешним ключам projects.user_id и tasks.project_id.
+type SQLStorage struct {
+	DB      *sql.DB
+	dialect *sqlDialect
+
+	tx  *sql.Tx         // Транзакция, в которой выполняются запросы, см. inTx
+	ctx context.Context // Контекст запросов, см. WithContext
+}
+
+// sqlDialect — различия PostgreSQL и SQLite, которые касаются хранилища
+type sqlDialect struct {
+	name       string
+	types      *strings.Replacer // Подставляет типы столбцов в DDL схемы
+	skipLocked string            // Окончание подзапроса захвата строки
+	lockSchema string            // Не даёт двум экземплярам обновлять схему одновременно
+	time       func(t time.Time) interface{}
+}
+
+var postgresDialect = &sqlDialect{
+	name: "postgres",
+	types: strings.NewReplacer(
+		"{id}", "VARCHAR(24)",
+		"{time}", "TIMESTAMPTZ",
+		"{float}", "DOUBLE PRECISION",
+		"{bigint}", "BIGINT",
+		"{blob}", "BYTEA",
+		// Ранги сравниваются побайтно, как в MongoDB
+		"{rank}", `TEXT COLLATE "C"`,
+	),
+	skipLocked: " FOR UPDATE SKIP LOCKED",
+	lockSchema: "LOCK TABLE schema_migrations IN EXCLUSIVE MODE",
+	time:       func(t time.Time) interface{} { return t.UTC() },
+}
+
+// В SQLite время хранится текстом фиксированной ширины в UTC: так строки сравниваются как моменты
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000000-07:00"
+
+var sqliteDialect = &sqlDialect{
+	name: "sqlite",
+	types: strings.NewReplacer(
+		"{id}", "TEXT",
+		"{time}", "TIMESTAMP",
+		"{float}", "REAL",
+		"{bigint}", "INTEGER",
+		"{blob}", "BLOB",
+		"{rank}", "TEXT",
+	),
+	time: func(t time.Time) interface{} { return t.UTC().Format(sqliteTimeLayout) },
+}
+
+func NewPostgresStorage(cfg config.Postgres) (*SQLStorage, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return openSQLStorage(db, postgresDialect)
+}
+
+func NewSQLiteStorage(cfg config.SQLite) (*SQLStorage, error) {
+	// Внешние ключи в SQLite по умолчанию выключены; busy_timeout ждёт блокировку другого процесса вместо ошибки
+	dsn := "file:" + cfg.Path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite допускает одного писателя: с одним соединением запросы сервера не мешают друг другу
+	db.SetMaxOpenConns(1)
+	return openSQLStorage(db, sqliteDialect)
+}
+
+func openSQLStorage(db *sql.DB, dialect *sqlDialect) (*SQLStorage, error) {
+	s := &SQLStorage{DB: db, dialect: dialect}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := s.migrateSchema(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Dialect возвращает postgres или sqlite
+func (s *SQLStorage) Dialect() string {
+	return s.dialect.name
+}
+
+func (s *SQLStorage) Close() error {
+	return s.DB.Close()
+}
+
+// WithContext возвращает копию хранилища, которая выполняет запросы в контексте ctx
+func (s *SQLStorage) WithContext(ctx context.Context) Storage {
+	bound := *s
+	bound.ctx = ctx
+	return &bound
+}
+
+func (s *SQLStorage) opContext() context.Context {
+	if s.ctx == nil {
+		return context.TODO()
+	}
+	return s.ctx
+}
+
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *SQLStorage) conn() sqlQuerier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.DB
+}
+
+func (s *SQLStorage) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.conn().ExecContext(s.opContext(), query, s.args(args)...)
+}
+
+func (s *SQLStorage) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.conn().QueryContext(s.opContext(), query, s.args(args)...)
+}
+
+func (s *SQLStorage) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.conn().QueryRowContext(s.opContext(), query, s.args(args)...)
+}
+
+// count выполняет запрос вида SELECT COUNT(*)
+func (s *SQLStorage) count(query string, args ...interface{}) (int64, error) {
+	var n int64
+	err := s.queryRow(query, args...).Scan(&n)
+	return n, err
+}
+
+// inTx выполняет fn в транзакции; вложенный вызов использует уже открытую.
+// Внутри fn запросы идут только через переданную копию: у SQLite одно соединение, и запрос
+// мимо транзакции ждал бы её окончания вечно.
+func (s *SQLStorage) inTx(fn func(tx *SQLStorage) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.DB.BeginTx(s.opContext(), nil)
+	if err != nil {
+		return err
+	}
+	bound := *s
+	bound.tx = tx
+	if err := fn(&bound); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// args приводит идентификаторы и время к виду, в котором они хранятся
+func (s *SQLStorage) args(args []interface{}) []interface{} {
+	for i, a := range args {
+		switch v := a.(type) {
+		case ident.ID:
+			args[i] = v.Hex()
+		case time.Time:
+			args[i] = s.dialect.time(v)
+		}
+	}
+	return args
+}
+
+// nullID сохраняет нулевой идентификатор как NULL: так на него не действует внешний ключ
+func nullID(id ident.ID) interface{} {
+	if id.IsZero() {
+		return nil
+	}
+	return id
+}
+
+// nullTime сохраняет нулевое время (срок не задан) как NULL
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// toJSON кодирует списки и словари для текстовых столбцов; типы моделей кодируются без ошибок
+func toJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// scanID читает идентификатор; NULL — нулевой идентификатор
+type scanID struct{ id *ident.ID }
+
+func (d scanID) Scan(v interface{}) error {
+	var hex string
+	switch x := v.(type) {
+	case nil:
+		*d.id = ident.Nil
+		return nil
+	case string:
+		hex = x
+	case []byte:
+		hex = string(x)
+	default:
+		return fmt.Errorf("cannot scan %T into id", v)
+	}
+	id, err := ident.Parse(strings.TrimSpace(hex))
+	if err != nil {
+		return err
+	}
+	*d.id = id
+	return nil
+}
+
+// scanTime читает время в UTC; NULL — нулевое время
+type scanTime struct{ t *time.Time }
+
+func (d scanTime) Scan(v interface{}) error {
+	var text string
+	switch x := v.(type) {
+	case nil:
+		*d.t = time.Time{}
+		return nil
+	case time.Time:
+		*d.t = x.UTC()
+		return nil
+	case string:
+		text = x
+	case []byte:
+		text = string(x)
+	default:
+		return fmt.Errorf("cannot scan %T into time", v)
+	}
+	t, err := time.Parse(sqliteTimeLayout, text)
+	if err != nil {
+		return err
+	}
+	*d.t = t.UTC()
+	return nil
+}
+
+// scanJSON читает текстовый столбец, заполненный toJSON; NULL оставляет значение как есть
+type scanJSON struct{ v interface{} }
+
+func (d scanJSON) Scan(v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(x), d.v)
+	case []byte:
+		return json.Unmarshal(x, d.v)
+	}
+	return fmt.Errorf("cannot scan %T into json", v)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Виды нарушений ограничений, которые хранилище превращает в свои ошибки
+const (
+	violationUnique     = "unique"
+	violationForeignKey = "foreign key"
+)
+
+func sqlViolation(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505":
+			return violationUnique
+		case "23503":
+			return violationForeignKey
+		}
+	}
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) {
+		switch liteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return violationUnique
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return violationForeignKey
+		}
+	}
+	return ""
+}
+
+// placeholders возвращает n параметров подряд, начиная с $first
+func placeholders(first, n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", first+i)
+	}
+	return strings.Join(params, ", ")
+}
+
+func idArgs(ids []ident.ID) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+// Столько идентификаторов передаётся в одном IN; у обеих баз предел числа параметров
+const sqlChunk = 500
+
+// childIDs собирает идентификаторы строк table по родителю в столбце parentColumn.
+// parents == nil — по всем родителям.
+func (s *SQLStorage) childIDs(table, parentColumn string, parents []ident.ID) (map[ident.ID][]ident.ID, error) {
+	children := make(map[ident.ID][]ident.ID)
+	collect := func(where string, args []interface{}) error {
+		rows, err := s.query("SELECT "+parentColumn+", id FROM "+table+where+" ORDER BY id", args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var parent, child ident.ID
+			if err := rows.Scan(scanID{&parent}, scanID{&child}); err != nil {
+				return err
+			}
+			children[parent] = append(children[parent], child)
+		}
+		return rows.Err()
+	}
+
+	if parents == nil {
+		return children, collect("", nil)
+	}
+	for start := 0; start < len(parents); start += sqlChunk {
+		chunk := parents[start:minInt(start+sqlChunk, len(parents))]
+		if err := collect(" WHERE "+parentColumn+" IN ("+placeholders(1, len(chunk))+")", idArgs(chunk)); err != nil {
+			return nil, err
+		}
+	}
+	return children, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+const userColumns = "id, name, work, age, salary, email, notify_disabled, notify_channels, notify_webhook_url"
+
+func scanUser(row rowScanner) (user.User, error) {
+	var u user.User
+	err := row.Scan(scanID{&u.Id}, &u.Name, &u.Work, &u.Age, &u.Salary, &u.Email,
+		&u.Notifications.Disabled, scanJSON{&u.Notifications.Channels}, &u.Notifications.WebhookURL)
+	return u, err
+}
+
+func (s *SQLStorage) queryUsers(where string, args ...interface{}) ([]user.User, error) {
+	rows, err := s.query("SELECT "+userColumns+" FROM users"+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []user.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var ids []ident.ID
+	if where != "" {
+		ids = make([]ident.ID, len(users))
+		for i, u := range users {
+			ids[i] = u.Id
+		}
+	}
+	projects, err := s.childIDs("projects", "user_id", ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		users[i].Projects = projects[users[i].Id]
+	}
+	return users, nil
+}
+
+func (s *SQLStorage) GetAllUsers() map[ident.ID]user.User {
+	users := make(map[ident.ID]user.User)
+
+	list, err := s.queryUsers("")
+	if err != nil {
+		return users // return empty map if there's an error
+	}
+	for _, u := range list {
+		users[u.Id] = u
+	}
+	return users
+}
+func (s *SQLStorage) GetUser(userId ident.ID) (user.User, error) {
+	users, err := s.queryUsers(" WHERE id = $1", userId)
+	if err != nil {
+		return user.User{}, err
+	}
+	if len(users) == 0 {
+		return user.User{}, errors.New("user not found")
+	}
+	return users[0], nil
+}
+func (s *SQLStorage) InsertUser(u *user.User) error {
+	u.Id = ident.New()
+
+	_, err := s.exec("INSERT INTO users ("+userColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		u.Id, u.Name, u.Work, u.Age, u.Salary, u.Email,
+		u.Notifications.Disabled, toJSON(u.Notifications.Channels), u.Notifications.WebhookURL)
+	if sqlViolation(err) == violationUnique {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// UpdateUser перезаписывает поля пользователя; список проектов следует из самих проектов и здесь не меняется
+func (s *SQLStorage) UpdateUser(userId ident.ID, e *user.User) error {
+	_, err := s.exec(`UPDATE users SET name = $1, work = $2, age = $3, salary = $4, email = $5,
+		notify_disabled = $6, notify_channels = $7, notify_webhook_url = $8 WHERE id = $9`,
+		e.Name, e.Work, e.Age, e.Salary, e.Email,
+		e.Notifications.Disabled, toJSON(e.Notifications.Channels), e.Notifications.WebhookURL, userId)
+	if sqlViolation(err) == violationUnique {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// DeleteUser удаляет пользователя вместе с его проектами и их задачами (ON DELETE CASCADE);
+// вебхуки проектов, как и в DeleteProject, только помечаются project_deleted
+func (s *SQLStorage) DeleteUser(userId ident.ID) error {
+	return s.inTx(func(tx *SQLStorage) error {
+		_, err := tx.exec("UPDATE webhooks SET project_deleted = TRUE WHERE project_id IN (SELECT id FROM projects WHERE user_id = $1)", userId)
+		if err == nil {
+			_, err = tx.exec("DELETE FROM users WHERE id = $1", userId)
+		}
+		return err
+	})
+}
+
+const projectColumns = "id, user_id, name, description, priority, author, responsible, performers, date_creation, deadline, guests, status"
+
+func (s *SQLStorage) queryProjects(where string, args ...interface{}) ([]project.Project, error) {
+	rows, err := s.query("SELECT "+projectColumns+" FROM projects"+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []project.Project
+	for rows.Next() {
+		var p project.Project
+		err := rows.Scan(scanID{&p.Id}, scanID{&p.UserID}, &p.Name, &p.Descript, &p.Priority, &p.Author,
+			&p.Responsible, &p.Performers, scanTime{&p.DateCreation}, scanTime{&p.Deadline}, &p.Guests, &p.Status)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var ids []ident.ID
+	if where != "" {
+		ids = make([]ident.ID, len(projects))
+		for i, p := range projects {
+			ids[i] = p.Id
+		}
+	}
+	tasks, err := s.childIDs("tasks", "project_id", ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range projects {
+		projects[i].Tasks = tasks[projects[i].Id]
+	}
+	return projects, nil
+}
+
+func (s *SQLStorage) GetAllProjects() map[ident.ID]project.Project {
+	projects := make(map[ident.ID]project.Project)
+
+	list, err := s.queryProjects("")
+	if err != nil {
+		return projects // return empty map if there's an error
+	}
+	for _, p := range list {
+		projects[p.Id] = p
+	}
+	return projects
+}
+func (s *SQLStorage) GetProjectByUser(userId ident.ID) ([]project.Project, error) {
+	return s.queryProjects(" WHERE user_id = $1", userId)
+}
+func (s *SQLStorage) GetProject(userId, projectId ident.ID) (*project.Project, error) {
+	projects, err := s.queryProjects(" WHERE id = $1 AND user_id = $2", projectId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, fmt.Errorf("проект не найден")
+	}
+	return &projects[0], nil
+}
+
+// DeleteProject удаляет проект; вебхуки проекта помечаются project_deleted и удаляются
+// диспетчером после доставки project.deleted
+func (s *SQLStorage) DeleteProject(id ident.ID) error {
+	return s.inTx(func(tx *SQLStorage) error {
+		res, err := tx.exec("DELETE FROM projects WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return errors.New("project not found")
+		}
+		_, err = tx.exec("UPDATE webhooks SET project_deleted = TRUE WHERE project_id = $1", id)
+		return err
+	})
+}
+
+// DeleteProjects удаляет проекты по id; как и в MongoDB, владелец проектов не проверяется
+func (s *SQLStorage) DeleteProjects(userID ident.ID, projectIDs []ident.ID) error {
+	if len(projectIDs) == 0 {
+		return nil
+	}
+	return s.inTx(func(tx *SQLStorage) error {
+		in := placeholders(1, len(projectIDs))
+		_, err := tx.exec("DELETE FROM projects WHERE id IN ("+in+")", idArgs(projectIDs)...)
+		if err == nil {
+			_, err = tx.exec("UPDATE webhooks SET project_deleted = TRUE WHERE project_id IN ("+in+")", idArgs(projectIDs)...)
+		}
+		return err
+	})
+}
+func (s *SQLStorage) UpdateProject(projectID ident.ID, updateFields bson.M) error {
+	_, err := s.update("projects", projectUpdatable, updateFields, "id = $1", projectID)
+	return err
+}
+func (s *SQLStorage) InsertProject(p *project.Project, userID ident.ID) error {
+	p.Id = ident.New()
+	p.UserID = userID
+	p.Tasks = nil
+
+	_, err := s.exec("INSERT INTO projects ("+projectColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
+		p.Id, p.UserID, p.Name, p.Descript, p.Priority, p.Author, p.Responsible, p.Performers,
+		p.DateCreation, nullTime(p.Deadline), p.Guests, p.Status)
+	if sqlViolation(err) == violationForeignKey {
+		return errors.New("user not found")
+	}
+	return err
+}
+
+const taskColumns = "id, project_id, name, description, priority, author, responsible, performers, date_creation, deadline, guests, " +
+	"status, rank, sprint_id, estimate, remaining, " +
+	"recurrence_rule, recurrence_start, recurrence_series_id, recurrence_occurrence, recurrence_spawned"
+
+func scanTask(row rowScanner) (project.Task, error) {
+	var (
+		t          project.Task
+		rule       sql.NullString
+		start      time.Time
+		seriesID   ident.ID
+		occurrence sql.NullInt64
+		spawned    sql.NullBool
+	)
+	err := row.Scan(scanID{&t.ID}, scanID{&t.ProjectID}, &t.Name, &t.Description, &t.Priority, &t.Author,
+		&t.Responsible, &t.Performers, scanTime{&t.DateCreation}, scanTime{&t.Deadline}, &t.Guests,
+		&t.Status, &t.Rank, scanID{&t.SprintID}, &t.Estimate, &t.Remaining,
+		&rule, scanTime{&start}, scanID{&seriesID}, &occurrence, &spawned)
+	if err != nil {
+		return t, err
+	}
+	if rule.Valid {
+		t.Recurrence = &project.Recurrence{
+			Rule:       rule.String,
+			Start:      start,
+			SeriesID:   seriesID,
+			Occurrence: int(occurrence.Int64),
+			Spawned:    spawned.Bool,
+		}
+	}
+	return t, nil
+}
+
+// recurrenceValues — значения столбцов recurrence_* для задачи; без повторения все NULL
+func recurrenceValues(r *project.Recurrence) []interface{} {
+	if r == nil {
+		return []interface{}{nil, nil, nil, nil, nil}
+	}
+	return []interface{}{r.Rule, nullTime(r.Start), nullID(r.SeriesID), r.Occurrence, r.Spawned}
+}
+
+func (s *SQLStorage) queryTasks(where string, args ...interface{}) ([]project.Task, error) {
+	rows, err := s.query("SELECT "+taskColumns+" FROM tasks"+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []project.Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := s.attachHistory(tasks, where == ""); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// attachHistory заполняет StatusHistory задач; all — задачи выбраны все, фильтр по id не нужен
+func (s *SQLStorage) attachHistory(tasks []project.Task, all bool) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	index := make(map[ident.ID]int, len(tasks))
+	ids := make([]ident.ID, len(tasks))
+	for i, t := range tasks {
+		index[t.ID] = i
+		ids[i] = t.ID
+	}
+
+	collect := func(where string, args []interface{}) error {
+		rows, err := s.query("SELECT task_id, status, at FROM task_status_changes"+where+" ORDER BY task_id, seq", args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				taskID ident.ID
+				change project.StatusChange
+			)
+			if err := rows.Scan(scanID{&taskID}, &change.Status, scanTime{&change.At}); err != nil {
+				return err
+			}
+			if i, ok := index[taskID]; ok {
+				tasks[i].StatusHistory = append(tasks[i].StatusHistory, change)
+			}
+		}
+		return rows.Err()
+	}
+
+	if all {
+		return collect("", nil)
+	}
+	for start := 0; start < len(ids); start += sqlChunk {
+		chunk := ids[start:minInt(start+sqlChunk, len(ids))]
+		if err := collect(" WHERE task_id IN ("+placeholders(1, len(chunk))+")", idArgs(chunk)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushStatus добавляет переход в историю статусов задачи
+func (s *SQLStorage) pushStatus(taskId ident.ID, status string, at time.Time) error {
+	_, err := s.exec(`INSERT INTO task_status_changes (task_id, seq, status, at)
+		SELECT $1, COALESCE(MAX(seq), 0) + 1, $2, $3 FROM task_status_changes WHERE task_id = $4`,
+		taskId, status, at, taskId)
+	return err
+}
+
+func (s *SQLStorage) GetTasksByProject(projectId ident.ID) ([]project.Task, error) {
+	return s.queryTasks(" WHERE project_id = $1", projectId)
+}
+func (s *SQLStorage) InsertTask(t *project.Task, projectId ident.ID) error {
+	return s.inTx(func(tx *SQLStorage) error {
+		return tx.insertTask(t, projectId)
+	})
+}
+
+// insertTask вставляет задачу с историей статусов; вызывается внутри транзакции
+func (s *SQLStorage) insertTask(t *project.Task, projectId ident.ID) error {
+	t.ID = ident.New()
+	t.ProjectID = projectId
+	if t.DateCreation.IsZero() {
+		t.DateCreation = time.Now()
+	}
+	if t.Remaining == 0 {
+		t.Remaining = t.Estimate
+	}
+	// История статусов ведётся только хранилищем
+	t.StatusHistory = []project.StatusChange{{Status: t.Status, At: t.DateCreation}}
+	if t.Recurrence != nil {
+		t.Recurrence.Spawned = false
+		startRecurrence(t)
+	}
+
+	// Новая задача встаёт в конец колонки своего статуса
+	lastRank, err := s.lastRank(projectId, t.Status)
+	if err != nil {
+		return err
+	}
+	t.Rank = project.RankBetween(lastRank, "")
+
+	args := []interface{}{t.ID, t.ProjectID, t.Name, t.Description, t.Priority, t.Author, t.Responsible, t.Performers,
+		t.DateCreation, nullTime(t.Deadline), t.Guests, t.Status, t.Rank, nullID(t.SprintID), t.Estimate, t.Remaining}
+	args = append(args, recurrenceValues(t.Recurrence)...)
+	_, err = s.exec("INSERT INTO tasks ("+taskColumns+") VALUES ("+placeholders(1, len(args))+")", args...)
+	if sqlViolation(err) == violationForeignKey {
+		return errors.New("project not found")
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.exec("INSERT INTO task_status_changes (task_id, seq, status, at) VALUES ($1, 1, $2, $3)",
+		t.ID, t.Status, t.DateCreation)
+	return err
+}
+func (s *SQLStorage) GetTask(projectId, taskId ident.ID) (*project.Task, error) {
+	tasks, err := s.queryTasks(" WHERE id = $1 AND project_id = $2", taskId, projectId)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, nil
+	}
+	return &tasks[0], nil
+}
+func (s *SQLStorage) GetAllTasks() map[ident.ID]project.Task {
+	tasks := make(map[ident.ID]project.Task)
+
+	list, err := s.queryTasks("")
+	if err != nil {
+		return tasks // return empty map if there's an error
+	}
+	for _, t := range list {
+		tasks[t.ID] = t
+	}
+	return tasks
+}
+func (s *SQLStorage) DeleteTask(projectId, taskId ident.ID) error {
+	_, err := s.exec("DELETE FROM tasks WHERE id = $1 AND project_id = $2", taskId, projectId)
+	return err
+}
+func (s *SQLStorage) DeleteTasks(projectId ident.ID, taskIds []ident.ID) error {
+	if len(taskIds) == 0 {
+		return nil
+	}
+	args := append([]interface{}{projectId}, idArgs(taskIds)...)
+	_, err := s.exec("DELETE FROM tasks WHERE project_id = $1 AND id IN ("+placeholders(2, len(taskIds))+")", args...)
+	return err
+}
+func (s *SQLStorage) UpdateTask(projectId, taskId ident.ID, updateFields bson.M) error {
+	return s.inTx(func(tx *SQLStorage) error {
+		_, err := tx.updateTask(projectId, taskId, updateFields)
+		return err
+	})
+}
+
+// updateTask применяет частичное обновление и пополняет историю при смене статуса; вызывается
+// внутри транзакции. false — задачи нет. Ошибка ErrInvalidUpdate возвращается до записи.
+func (s *SQLStorage) updateTask(projectId, taskId ident.ID, updateFields bson.M) (bool, error) {
+	// История статусов и повторение меняются только через отдельные методы, ранг — только через MoveTask
+	delete(updateFields, "statusHistory")
+	delete(updateFields, "recurrence")
+	delete(updateFields, "rank")
+
+	var current, last string
+	status, changesStatus := updateFields["status"].(string)
+	if changesStatus {
+		err := s.queryRow("SELECT status FROM tasks WHERE id = $1 AND project_id = $2", taskId, projectId).Scan(&current)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if current != status {
+			if last, err = s.lastRank(projectId, status); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	n, err := s.update("tasks", taskUpdatable, updateFields, "id = $1 AND project_id = $2", taskId, projectId)
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if changesStatus && current != status {
+		// В новой колонке задача встаёт последней, как при создании
+		if _, err := s.exec("UPDATE tasks SET rank = $1 WHERE id = $2", project.RankBetween(last, ""), taskId); err != nil {
+			return false, err
+		}
+		return true, s.pushStatus(taskId, status, time.Now())
+	}
+	return true, nil
+}
+
+func (s *SQLStorage) MoveTask(projectId, taskId ident.ID, status string, position int) error {
+	return s.inTx(func(tx *SQLStorage) error {
+		// Задачи целевой колонки в текущем порядке, без перемещаемой
+		column, err := tx.queryColumn(projectId, status, taskId)
+		if err != nil {
+			return err
+		}
+		project.SortByRank(column)
+		rank, rerank := project.PlaceRank(column, position)
+
+		var current string
+		err = tx.queryRow("SELECT status FROM tasks WHERE id = $1 AND project_id = $2", taskId, projectId).Scan(&current)
+		if err == sql.ErrNoRows {
+			return errors.New("task not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("UPDATE tasks SET status = $1, rank = $2 WHERE id = $3 AND project_id = $4",
+			status, rank, taskId, projectId)
+		if err != nil {
+			return err
+		}
+		// Между соседями не было места: колонка получила новые ранги
+		for id, rank := range rerank {
+			if _, err := tx.exec("UPDATE tasks SET rank = $1 WHERE id = $2", rank, id); err != nil {
+				return err
+			}
+		}
+		if current != status {
+			return tx.pushStatus(taskId, status, time.Now())
+		}
+		return nil
+	})
+}
+
+// queryColumn возвращает id, ранги и даты создания задач колонки status, кроме exclude:
+// этого достаточно SortByRank
+func (s *SQLStorage) queryColumn(projectId ident.ID, status string, exclude ident.ID) ([]project.Task, error) {
+	rows, err := s.query("SELECT id, rank, date_creation FROM tasks WHERE project_id = $1 AND status = $2 AND id <> $3 ORDER BY id",
+		projectId, status, exclude)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var column []project.Task
+	for rows.Next() {
+		var t project.Task
+		if err := rows.Scan(scanID{&t.ID}, &t.Rank, scanTime{&t.DateCreation}); err != nil {
+			return nil, err
+		}
+		column = append(column, t)
+	}
+	return column, rows.Err()
+}
+
+func (s *SQLStorage) lastRank(projectId ident.ID, status string) (string, error) {
+	var rank sql.NullString
+	err := s.queryRow("SELECT MAX(rank) FROM tasks WHERE project_id = $1 AND status = $2", projectId, status).Scan(&rank)
+	return rank.String, err
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"tmv/ident"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrInvalidUpdate — частичное обновление содержит поле, которое нельзя менять, или значение не того типа.
+// Для задач и спринтов все хранилища проверяют поля по одному списку (taskUpdatable,
+// sprintUpdatable); в остальных сущностях MongoDB записала бы такое поле как есть,
+// а SQL-хранилище отказывает.
+var ErrInvalidUpdate = errors.New("invalid update")
+
+// Типы значений столбцов, доступных частичному обновлению
+const (
+	kindString = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindTime    // Нулевое время и пустая строка — NULL
+	kindID      // Нулевой id и пустая строка — NULL
+	kindStrings // Список строк в JSON
+)
+
+type updatableColumn struct {
+	name string
+	kind int
+}
+
+// Поля документов MongoDB, которые можно менять через $set, и соответствующие им столбцы.
+// Идентификаторы, владельцы и вычисляемые списки сюда не входят.
+var (
+	projectUpdatable = map[string]updatableColumn{
+		"name":         {"name", kindString},
+		"description":  {"description", kindString},
+		"priority":     {"priority", kindInt},
+		"author":       {"author", kindString},
+		"responsible":  {"responsible", kindString},
+		"performers":   {"performers", kindString},
+		"dateCreation": {"date_creation", kindTime},
+		"deadline":     {"deadline", kindTime},
+		"guests":       {"guests", kindString},
+		"status":       {"status", kindString},
+	}
+	taskUpdatable = map[string]updatableColumn{
+		"name":         {"name", kindString},
+		"description":  {"description", kindString},
+		"priority":     {"priority", kindInt},
+		"author":       {"author", kindString},
+		"responsible":  {"responsible", kindString},
+		"performers":   {"performers", kindString},
+		"dateCreation": {"date_creation", kindTime},
+		"deadline":     {"deadline", kindTime},
+		"guests":       {"guests", kindString},
+		"status":       {"status", kindString},
+		"sprintId":     {"sprint_id", kindID},
+		"estimate":     {"estimate", kindFloat},
+		"remaining":    {"remaining", kindFloat},
+	}
+	sprintUpdatable = map[string]updatableColumn{
+		"name":  {"name", kindString},
+		"goal":  {"goal", kindString},
+		"start": {"starts_at", kindTime},
+		"end":   {"ends_at", kindTime},
+	}
+	webhookUpdatable = map[string]updatableColumn{
+		"url":    {"url", kindString},
+		"secret": {"secret", kindString},
+		"events": {"events", kindStrings},
+		"active": {"active", kindBool},
+	}
+)
+
+// update выполняет $set из fields над строками table, отобранными where с параметрами whereArgs.
+// Имена столбцов берутся только из columns, значения передаются параметрами. Пустой fields
+// ничего не меняет; возвращается число затронутых строк.
+func (s *SQLStorage) update(table string, columns map[string]updatableColumn, fields bson.M, where string, whereArgs ...interface{}) (int64, error) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	// Порядок полей не влияет на результат, но одинаковый текст запроса проще читать в журнале
+	sort.Strings(keys)
+
+	args := append([]interface{}{}, whereArgs...)
+	var set []string
+	for _, key := range keys {
+		col, value, err := updateColumn(columns, key, fields[key])
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, value)
+		set = append(set, fmt.Sprintf("%s = $%d", col.name, len(args)))
+	}
+
+	if len(set) == 0 {
+		return s.count("SELECT COUNT(*) FROM "+table+" WHERE "+where, whereArgs...)
+	}
+	res, err := s.exec("UPDATE "+table+" SET "+strings.Join(set, ", ")+" WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// NormalizeTaskUpdate проверяет частичное обновление задачи — только разрешённые поля и значения
+// подходящего типа — и возвращает его со значениями, приведёнными к типам полей документа
+// (time.Time, ident.ID, int64…). Ошибка оборачивает ErrInvalidUpdate.
+func NormalizeTaskUpdate(fields bson.M) (bson.M, error) {
+	return normalizeUpdate(taskUpdatable, fields)
+}
+
+// normalizeUpdate приводит значения fields к типам полей из columns для $set в документах
+func normalizeUpdate(columns map[string]updatableColumn, fields bson.M) (bson.M, error) {
+	normalized := make(bson.M, len(fields))
+	for key, v := range fields {
+		col, ok := columns[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: field %q cannot be updated", ErrInvalidUpdate, key)
+		}
+		value, err := docValue(col.kind, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidUpdate, key, err)
+		}
+		normalized[key] = value
+	}
+	return normalized, nil
+}
+
+// updateColumn находит столбец поля key и приводит значение к его типу
+func updateColumn(columns map[string]updatableColumn, key string, v interface{}) (updatableColumn, interface{}, error) {
+	col, ok := columns[key]
+	if !ok {
+		return col, nil, fmt.Errorf("%w: field %q cannot be updated", ErrInvalidUpdate, key)
+	}
+	value, err := updateValue(col.kind, v)
+	if err != nil {
+		return col, nil, fmt.Errorf("%w: %s: %v", ErrInvalidUpdate, key, err)
+	}
+	return col, value, nil
+}
+
+// updateValue приводит значение из bson.M к значению столбца: нулевые время и id — NULL,
+// списки — JSON
+func updateValue(kind int, v interface{}) (interface{}, error) {
+	value, err := docValue(kind, v)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case kindTime:
+		return nullTime(value.(time.Time)), nil
+	case kindID:
+		return nullID(value.(ident.ID)), nil
+	case kindStrings:
+		return toJSON(value.([]string)), nil
+	}
+	return value, nil
+}
+
+// docValue приводит значение из bson.M к типу поля документа. Значения приходят и из JSON
+// (числа — float64, время и id — строки), и из кода (int, time.Time, ident.ID).
+// null, как при чтении документа MongoDB в структуру, даёт нулевое значение.
+func docValue(kind int, v interface{}) (interface{}, error) {
+	switch kind {
+	case kindString:
+		switch x := v.(type) {
+		case nil:
+			return "", nil
+		case string:
+			return x, nil
+		}
+	case kindInt:
+		switch x := v.(type) {
+		case nil:
+			return int64(0), nil
+		case int:
+			return int64(x), nil
+		case int32:
+			return int64(x), nil
+		case int64:
+			return x, nil
+		case float64:
+			if x != math.Trunc(x) || math.Abs(x) > 1<<53 {
+				return nil, fmt.Errorf("%v is not an integer", x)
+			}
+			return int64(x), nil
+		case json.Number:
+			return x.Int64()
+		}
+	case kindFloat:
+		switch x := v.(type) {
+		case nil:
+			return 0.0, nil
+		case float64:
+			return x, nil
+		case float32:
+			return float64(x), nil
+		case int:
+			return float64(x), nil
+		case int64:
+			return float64(x), nil
+		case json.Number:
+			return x.Float64()
+		}
+	case kindBool:
+		switch x := v.(type) {
+		case nil:
+			return false, nil
+		case bool:
+			return x, nil
+		}
+	case kindTime:
+		switch x := v.(type) {
+		case nil:
+			return time.Time{}, nil
+		case time.Time:
+			return x, nil
+		case string:
+			if x == "" {
+				return time.Time{}, nil
+			}
+			t, err := time.Parse(time.RFC3339Nano, x)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an RFC 3339 time", x)
+			}
+			return t, nil
+		}
+	case kindID:
+		switch x := v.(type) {
+		case nil:
+			return ident.Nil, nil
+		case ident.ID:
+			return x, nil
+		case string:
+			if x == "" {
+				return ident.Nil, nil
+			}
+			id, err := ident.Parse(x)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an id", x)
+			}
+			return id, nil
+		}
+	case kindStrings:
+		switch x := v.(type) {
+		case nil:
+			return []string(nil), nil
+		case []string:
+			return x, nil
+		case bson.A:
+			return stringList(x)
+		case []interface{}:
+			return stringList(x)
+		}
+	}
+	return nil, fmt.Errorf("unexpected value of type %T", v)
+}
+
+func stringList(values []interface{}) ([]string, error) {
+	list := make([]string, len(values))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected list element of type %T", v)
+		}
+		list[i] = s
+	}
+	return list, nil
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"errors"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const webhookColumns = "id, project_id, url, secret, events, active, date_creation, project_deleted"
+
+func (s *SQLStorage) queryWebhooks(where string, args ...interface{}) ([]project.Webhook, error) {
+	rows, err := s.query("SELECT "+webhookColumns+" FROM webhooks"+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []project.Webhook{}
+	for rows.Next() {
+		var w project.Webhook
+		err := rows.Scan(scanID{&w.Id}, scanID{&w.ProjectID}, &w.URL, &w.Secret, scanJSON{&w.Events}, &w.Active, scanTime{&w.DateCreation}, &w.ProjectDeleted)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *SQLStorage) GetWebhooksByProject(projectId ident.ID) ([]project.Webhook, error) {
+	return s.queryWebhooks(" WHERE project_id = $1", projectId)
+}
+func (s *SQLStorage) GetWebhook(projectId, webhookId ident.ID) (*project.Webhook, error) {
+	webhooks, err := s.queryWebhooks(" WHERE id = $1 AND project_id = $2", webhookId, projectId)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+	return &webhooks[0], nil
+}
+func (s *SQLStorage) InsertWebhook(w *project.Webhook, projectId ident.ID) error {
+	w.Id = ident.New()
+	w.ProjectID = projectId
+	if w.DateCreation.IsZero() {
+		w.DateCreation = time.Now()
+	}
+
+	// Внешнего ключа на projects нет, поэтому проект проверяется явно
+	n, err := s.count("SELECT COUNT(*) FROM projects WHERE id = $1", projectId)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("project not found")
+	}
+
+	_, err = s.exec("INSERT INTO webhooks ("+webhookColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		w.Id, w.ProjectID, w.URL, w.Secret, toJSON(w.Events), w.Active, w.DateCreation, w.ProjectDeleted)
+	return err
+}
+func (s *SQLStorage) UpdateWebhook(projectId, webhookId ident.ID, updateFields bson.M) error {
+	n, err := s.update("webhooks", webhookUpdatable, updateFields, "id = $1 AND project_id = $2", webhookId, projectId)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("webhook not found")
+	}
+	return nil
+}
+
+// DeleteWebhook удаляет подписку вместе с журналом доставок (ON DELETE CASCADE)
+func (s *SQLStorage) DeleteWebhook(projectId, webhookId ident.ID) error {
+	res, err := s.exec("DELETE FROM webhooks WHERE id = $1 AND project_id = $2", webhookId, projectId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("webhook not found")
+	}
+	return nil
+}
+
+const deliveryColumns = "id, webhook_id, project_id, event_id, event, payload, status, attempts, next_attempt, date_creation, trace"
+
+func scanDelivery(row rowScanner) (project.WebhookDelivery, error) {
+	var d project.WebhookDelivery
+	err := row.Scan(scanID{&d.Id}, scanID{&d.WebhookID}, scanID{&d.ProjectID}, &d.EventID, &d.Event, &d.Payload,
+		&d.Status, scanJSON{&d.Attempts}, scanTime{&d.NextAttempt}, scanTime{&d.DateCreation}, scanJSON{&d.Trace})
+	return d, err
+}
+
+// traceValue сохраняет пустой контекст трассировки как NULL, как omitempty в MongoDB
+func traceValue(trace map[string]string) interface{} {
+	if len(trace) == 0 {
+		return nil
+	}
+	return toJSON(trace)
+}
+
+func (s *SQLStorage) InsertDelivery(d *project.WebhookDelivery) error {
+	d.Id = ident.New()
+	if d.DateCreation.IsZero() {
+		d.DateCreation = time.Now()
+	}
+
+	_, err := s.exec("INSERT INTO webhook_deliveries ("+deliveryColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		d.Id, d.WebhookID, nullID(d.ProjectID), d.EventID, d.Event, d.Payload, d.Status, toJSON(d.Attempts),
+		nullTime(d.NextAttempt), d.DateCreation, traceValue(d.Trace))
+	if sqlViolation(err) == violationForeignKey {
+		return errors.New("webhook not found")
+	}
+	return err
+}
+
+// UpdateDelivery сохраняет статус, журнал попыток и время следующей попытки
+func (s *SQLStorage) UpdateDelivery(d *project.WebhookDelivery) error {
+	_, err := s.exec("UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt = $3 WHERE id = $4",
+		d.Status, toJSON(d.Attempts), nullTime(d.NextAttempt), d.Id)
+	return err
+}
+func (s *SQLStorage) GetDeliveries(webhookId ident.ID, limit int64) ([]project.WebhookDelivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY date_creation DESC, id DESC"
+	args := []interface{}{webhookId}
+	if limit > 0 {
+		query += " LIMIT $2"
+		args = append(args, limit)
+	}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []project.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+func (s *SQLStorage) GetDelivery(webhookId, deliveryId ident.ID) (*project.WebhookDelivery, error) {
+	rows, err := s.query("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = $1 AND webhook_id = $2", deliveryId, webhookId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	d, err := scanDelivery(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ClaimDueDelivery забирает одну доставку, чья попытка назначена не позже now, и откладывает
+// её следующую попытку на lease, чтобы другой экземпляр сервера не взял её одновременно.
+// nil — доставлять нечего.
+func (s *SQLStorage) ClaimDueDelivery(now time.Time, lease time.Duration) (*project.WebhookDelivery, error) {
+	rows, err := s.query(`UPDATE webhook_deliveries SET next_attempt = $1
+		WHERE id = (SELECT id FROM webhook_deliveries WHERE status = $2 AND next_attempt <= $3
+			ORDER BY next_attempt, id LIMIT 1`+s.dialect.skipLocked+`)
+		RETURNING `+deliveryColumns, now.Add(lease), project.DeliveryPending, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	d, err := scanDelivery(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/report"
+)
+
+const worklogColumns = "id, project_id, task_id, user_id, started, ended, duration, note, running, date_creation, consumed"
+
+func scanWorklog(row rowScanner) (project.Worklog, error) {
+	var w project.Worklog
+	err := row.Scan(scanID{&w.Id}, scanID{&w.ProjectID}, scanID{&w.TaskID}, scanID{&w.UserID}, scanTime{&w.Started},
+		scanTime{&w.Ended}, &w.Duration, &w.Note, &w.Running, scanTime{&w.DateCreation}, &w.Consumed)
+	return w, err
+}
+
+func (s *SQLStorage) insertWorklog(w *project.Worklog) error {
+	_, err := s.exec("INSERT INTO worklogs ("+worklogColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		w.Id, w.ProjectID, w.TaskID, w.UserID, w.Started, nullTime(w.Ended), w.Duration, w.Note, w.Running, w.DateCreation, w.Consumed)
+	return err
+}
+
+func (s *SQLStorage) GetWorklogsByTask(projectId, taskId ident.ID) ([]project.Worklog, error) {
+	rows, err := s.query("SELECT "+worklogColumns+" FROM worklogs WHERE project_id = $1 AND task_id = $2 ORDER BY started, id",
+		projectId, taskId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var worklogs []project.Worklog
+	for rows.Next() {
+		w, err := scanWorklog(rows)
+		if err != nil {
+			return nil, err
+		}
+		worklogs = append(worklogs, w)
+	}
+	return worklogs, rows.Err()
+}
+func (s *SQLStorage) InsertWorklog(w *project.Worklog, projectId, taskId ident.ID) error {
+	return s.inTx(func(tx *SQLStorage) error {
+		if err := tx.checkTask(projectId, taskId); err != nil {
+			return err
+		}
+
+		w.Id = ident.New()
+		w.ProjectID = projectId
+		w.TaskID = taskId
+		w.Running = false
+		if w.DateCreation.IsZero() {
+			w.DateCreation = time.Now()
+		}
+
+		// Списанное время уменьшает оставшуюся оценку задачи
+		consumed, err := tx.consumeRemaining(taskId, w.Hours())
+		if err != nil {
+			return err
+		}
+		w.Consumed = consumed
+		return tx.insertWorklog(w)
+	})
+}
+func (s *SQLStorage) DeleteWorklog(projectId, taskId, worklogId ident.ID) error {
+	return s.inTx(func(tx *SQLStorage) error {
+		row := tx.queryRow("SELECT "+worklogColumns+" FROM worklogs WHERE id = $1 AND project_id = $2 AND task_id = $3",
+			worklogId, projectId, taskId)
+		w, err := scanWorklog(row)
+		if err == sql.ErrNoRows {
+			return errors.New("worklog not found")
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.exec("DELETE FROM worklogs WHERE id = $1", worklogId); err != nil {
+			return err
+		}
+
+		// Возвращаем в оставшуюся оценку то, что запись с неё списала
+		return tx.restoreRemaining(taskId, w.Consumed)
+	})
+}
+func (s *SQLStorage) StartTimer(projectId, taskId, userId ident.ID) (*project.Worklog, error) {
+	if err := s.checkTask(projectId, taskId); err != nil {
+		return nil, err
+	}
+
+	w := project.NewWorklog(projectId, taskId, userId, time.Now(), 0, "")
+	w.Ended = time.Time{}
+	w.Running = true
+
+	// У пользователя может идти только один таймер: второй не пропускает индекс worklogs_one_running
+	err := s.insertWorklog(w)
+	if sqlViolation(err) == violationUnique {
+		return nil, errors.New("timer already running")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+func (s *SQLStorage) StopTimer(projectId, taskId, userId ident.ID, note string) (*project.Worklog, error) {
+	var w project.Worklog
+	err := s.inTx(func(tx *SQLStorage) error {
+		row := tx.queryRow("SELECT "+worklogColumns+" FROM worklogs WHERE project_id = $1 AND task_id = $2 AND user_id = $3 AND running",
+			projectId, taskId, userId)
+		var err error
+		w, err = scanWorklog(row)
+		if err == sql.ErrNoRows {
+			return errors.New("timer not running")
+		}
+		if err != nil {
+			return err
+		}
+
+		w.Ended = time.Now()
+		w.Duration = int64(w.Ended.Sub(w.Started) / time.Second)
+		w.Running = false
+		if note != "" {
+			w.Note = note
+		}
+		if w.Consumed, err = tx.consumeRemaining(taskId, w.Hours()); err != nil {
+			return err
+		}
+
+		// Условие running защищает от двойной остановки; списание откатится вместе с транзакцией
+		res, err := tx.exec("UPDATE worklogs SET ended = $1, duration = $2, running = FALSE, note = $3, consumed = $4 WHERE id = $5 AND running",
+			w.Ended, w.Duration, w.Note, w.Consumed, w.Id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return errors.New("timer not running")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// GetTimeReport суммирует завершённые записи по пользователю и задаче.
+// Нулевые projectId и userId означают отсутствие фильтра.
+func (s *SQLStorage) GetTimeReport(projectId, userId ident.ID, from, to time.Time) ([]report.TimeSpent, error) {
+	where := " WHERE NOT w.running AND w.started >= $1 AND w.started <= $2"
+	args := []interface{}{from, to}
+	if !projectId.IsZero() {
+		args = append(args, projectId)
+		where += " AND w.project_id = $3"
+	}
+	if !userId.IsZero() {
+		args = append(args, userId)
+		where += " AND w.user_id = " + placeholders(len(args), 1)
+	}
+
+	rows, err := s.query(`SELECT w.user_id, COALESCE(u.name, ''), w.project_id, w.task_id, COALESCE(t.name, ''),
+		SUM(w.duration), COUNT(*)
+		FROM worklogs w
+		LEFT JOIN users u ON u.id = w.user_id
+		LEFT JOIN tasks t ON t.id = w.task_id`+where+`
+		GROUP BY w.user_id, u.name, w.project_id, w.task_id, t.name
+		ORDER BY 2, 6 DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []report.TimeSpent{}
+	for rows.Next() {
+		var row report.TimeSpent
+		err := rows.Scan(scanID{&row.UserID}, &row.UserName, scanID{&row.ProjectID}, scanID{&row.TaskID}, &row.TaskName,
+			&row.Seconds, &row.Entries)
+		if err != nil {
+			return nil, err
+		}
+		row.Hours = float64(row.Seconds) / 3600
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStorage) checkTask(projectId, taskId ident.ID) error {
+	n, err := s.count("SELECT COUNT(*) FROM tasks WHERE id = $1 AND project_id = $2", taskId, projectId)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("task not found")
+	}
+	return nil
+}
+
+// consumeRemaining уменьшает оставшуюся оценку на hours, не опуская её ниже нуля, и возвращает,
+// сколько часов списано на самом деле. Вызывается внутри транзакции.
+func (s *SQLStorage) consumeRemaining(taskId ident.ID, hours float64) (float64, error) {
+	if hours <= 0 {
+		return 0, nil
+	}
+	// Пустое обновление блокирует строку задачи до конца транзакции и возвращает текущий остаток
+	var remaining float64
+	err := s.queryRow("UPDATE tasks SET remaining = remaining WHERE id = $1 RETURNING remaining", taskId).Scan(&remaining)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	consumed := math.Min(math.Max(remaining, 0), hours)
+	if consumed == 0 {
+		return 0, nil
+	}
+	_, err = s.exec("UPDATE tasks SET remaining = remaining - $1 WHERE id = $2", consumed, taskId)
+	return consumed, err
+}
+
+// restoreRemaining возвращает в оставшуюся оценку часы, которые списала удалённая запись
+func (s *SQLStorage) restoreRemaining(taskId ident.ID, hours float64) error {
+	if hours <= 0 {
+		return nil
+	}
+	_, err := s.exec("UPDATE tasks SET remaining = remaining + $1 WHERE id = $2", hours, taskId)
+	return err
+}
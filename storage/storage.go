@@ -1,33 +1,116 @@
 package storage
 
 import (
+	"context"
+	"time"
+	"tmv/event"
+	"tmv/ident"
 	"tmv/project"
+	"tmv/report"
 	"tmv/user"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Storage interface {
-	GetAllUsers() map[primitive.ObjectID]user.User
-	GetUser(userId primitive.ObjectID) (user.User, error)
+	GetAllUsers() map[ident.ID]user.User
+	GetUser(userId ident.ID) (user.User, error)
 	InsertUser(u *user.User) error
-	UpdateUser(userId primitive.ObjectID, e *user.User) error
-	DeleteUser(userId primitive.ObjectID) error
-
-	GetAllProjects() map[primitive.ObjectID]project.Project
-	GetProject(userId, projectId primitive.ObjectID) (*project.Project, error)
-	GetProjectByUser(userId primitive.ObjectID) ([]project.Project, error)
-	InsertProject(p *project.Project, userId primitive.ObjectID) error
-	UpdateProject(projectID primitive.ObjectID, updateFields bson.M) error
-	DeleteProject(projectId primitive.ObjectID) error
-	DeleteProjects(userID primitive.ObjectID, projectIDs []primitive.ObjectID) error
-
-	GetAllTasks() map[primitive.ObjectID]project.Task
-	InsertTask(t *project.Task, projectId primitive.ObjectID) error
-	GetTasksByProject(projectId primitive.ObjectID) ([]project.Task, error)
-	GetTask(projectId, taskId primitive.ObjectID) (*project.Task, error)
-	DeleteTasks(projectId primitive.ObjectID, taskIds []primitive.ObjectID) error
-	UpdateTask(projectId, taskId primitive.ObjectID, updateFields bson.M) error
-	DeleteTask(projectId, taskId primitive.ObjectID) error
+	UpdateUser(userId ident.ID, e *user.User) error
+	DeleteUser(userId ident.ID) error
+
+	GetAllProjects() map[ident.ID]project.Project
+	GetProject(userId, projectId ident.ID) (*project.Project, error)
+	GetProjectByUser(userId ident.ID) ([]project.Project, error)
+	InsertProject(p *project.Project, userId ident.ID) error
+	UpdateProject(projectID ident.ID, updateFields bson.M) error
+	DeleteProject(projectId ident.ID) error
+	DeleteProjects(userID ident.ID, projectIDs []ident.ID) error
+
+	GetAllTasks() map[ident.ID]project.Task
+	InsertTask(t *project.Task, projectId ident.ID) error
+	GetTasksByProject(projectId ident.ID) ([]project.Task, error)
+	GetTask(projectId, taskId ident.ID) (*project.Task, error)
+	DeleteTasks(projectId ident.ID, taskIds []ident.ID) error
+	UpdateTask(projectId, taskId ident.ID, updateFields bson.M) error
+	DeleteTask(projectId, taskId ident.ID) error
+	MoveTask(projectId, taskId ident.ID, status string, position int) error
+	InsertTasks(tasks []*project.Task, projectId ident.ID) ([]error, error)
+	UpdateTasks(projectId ident.ID, updates []TaskUpdate) ([]error, error)
+
+	GetSprintsByProject(projectId ident.ID) ([]project.Sprint, error)
+	GetSprint(projectId, sprintId ident.ID) (*project.Sprint, error)
+	InsertSprint(s *project.Sprint, projectId ident.ID) error
+	UpdateSprint(projectId, sprintId ident.ID, updateFields bson.M) error
+	DeleteSprint(projectId, sprintId ident.ID) error
+	StartSprint(projectId, sprintId ident.ID) error
+	CloseSprint(projectId, sprintId, nextSprintId ident.ID) (int64, error)
+	AssignTasksToSprint(projectId, sprintId ident.ID, taskIds []ident.ID) error
+	GetTasksBySprint(projectId, sprintId ident.ID) ([]project.Task, error)
+
+	GetWorkload(projectId ident.ID, from, to time.Time, interval string) ([]report.Workload, error)
+	GetTotals(now time.Time) (*report.Totals, error)
+
+	GetWorklogsByTask(projectId, taskId ident.ID) ([]project.Worklog, error)
+	InsertWorklog(w *project.Worklog, projectId, taskId ident.ID) error
+	DeleteWorklog(projectId, taskId, worklogId ident.ID) error
+	StartTimer(projectId, taskId, userId ident.ID) (*project.Worklog, error)
+	StopTimer(projectId, taskId, userId ident.ID, note string) (*project.Worklog, error)
+	GetTimeReport(projectId, userId ident.ID, from, to time.Time) ([]report.TimeSpent, error)
+
+	GetRecurringTasks() ([]project.Task, error)
+	SpawnOccurrence(t *project.Task) (*project.Task, error)
+	SetTaskRecurrence(projectId, taskId ident.ID, rule string) error
+
+	InsertNotification(n *user.Notification) error
+	GetTasksDueBefore(t time.Time) ([]project.Task, error)
+	GetProjectsDueBefore(t time.Time) ([]project.Project, error)
+	MarkReminderSent(key string) (bool, error)
+	GetNotifications(userId ident.ID, unreadOnly bool, offset, limit int64) ([]user.Notification, int64, error)
+	CountUnreadNotifications(userId ident.ID) (int64, error)
+	MarkNotificationRead(userId, notificationId ident.ID) error
+	MarkAllNotificationsRead(userId ident.ID) (int64, error)
+
+	Watch(w *user.Watch) error
+	Unwatch(userId ident.ID, kind string, targetId ident.ID) error
+	GetWatchers(projectId, taskId ident.ID) ([]ident.ID, error)
+
+	InsertComment(cm *project.Comment, projectId, taskId ident.ID) error
+	GetCommentsByTask(projectId, taskId ident.ID) ([]project.Comment, error)
+
+	GetWebhooksByProject(projectId ident.ID) ([]project.Webhook, error)
+	GetWebhook(projectId, webhookId ident.ID) (*project.Webhook, error)
+	InsertWebhook(w *project.Webhook, projectId ident.ID) error
+	UpdateWebhook(projectId, webhookId ident.ID, updateFields bson.M) error
+	DeleteWebhook(projectId, webhookId ident.ID) error
+	InsertDelivery(d *project.WebhookDelivery) error
+	UpdateDelivery(d *project.WebhookDelivery) error
+	GetDeliveries(webhookId ident.ID, limit int64) ([]project.WebhookDelivery, error)
+	GetDelivery(webhookId, deliveryId ident.ID) (*project.WebhookDelivery, error)
+	ClaimDueDelivery(now time.Time, lease time.Duration) (*project.WebhookDelivery, error)
+
+	InsertOutbox(r *event.Record) error
+	UpdateOutbox(r *event.Record) error
+	DeleteOutbox(id ident.ID) error
+	ClaimOutbox(now time.Time, lease time.Duration) (*event.Record, error)
+}
+
+// TaskUpdate — частичное обновление одной задачи в пакете UpdateTasks
+type TaskUpdate struct {
+	ID     ident.ID
+	Fields bson.M
+}
+
+// ContextBinder реализуют хранилища и декораторы, которые умеют выполнять запросы
+// в контексте вызывающего (отмена запроса, трассировка)
+type ContextBinder interface {
+	WithContext(ctx context.Context) Storage
+}
+
+// WithContext привязывает st к ctx, если хранилище это поддерживает, иначе возвращает st как есть
+func WithContext(st Storage, ctx context.Context) Storage {
+	if b, ok := st.(ContextBinder); ok {
+		return b.WithContext(ctx)
+	}
+	return st
 }
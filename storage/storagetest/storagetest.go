@@ -0,0 +1,1460 @@
+// Package storagetest — общий набор проверок, который проходит любая реализация storage.Storage.
+//
+// Проверяется только поведение, одинаковое у всех хранилищ: то, в чём MongoDB и SQL
+// расходятся (неизвестные поля в частичных обновлениях проектов, спринтов и вебхуков), сюда не входит.
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/storage"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Run прогоняет набор проверок. newStorage вызывается для каждого подтеста и должен
+// возвращать пустое хранилище; освобождать его можно через t.Cleanup.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.Storage) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, st storage.Storage)
+	}{
+		{"Users", testUsers},
+		{"EmailUnique", testEmailUnique},
+		{"Projects", testProjects},
+		{"ProjectNotFound", testProjectNotFound},
+		{"DeleteCascade", testDeleteCascade},
+		{"Tasks", testTasks},
+		{"TaskNotFound", testTaskNotFound},
+		{"MoveTask", testMoveTask},
+		{"BulkTasks", testBulkTasks},
+		{"Sprints", testSprints},
+		{"Worklogs", testWorklogs},
+		{"Recurrence", testRecurrence},
+		{"Notifications", testNotifications},
+		{"Watches", testWatches},
+		{"Comments", testComments},
+		{"Webhooks", testWebhooks},
+		{"Outbox", testOutbox},
+		{"ConcurrentInsertTask", testConcurrentInsertTask},
+		{"ConcurrentInsertProject", testConcurrentInsertProject},
+		{"ConcurrentReminders", testConcurrentReminders},
+		{"ConcurrentClaimDelivery", testConcurrentClaimDelivery},
+		{"ConcurrentStartTimer", testConcurrentStartTimer},
+		{"ConcurrentSpawnOccurrence", testConcurrentSpawnOccurrence},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStorage(t))
+		})
+	}
+}
+
+// Время в хранилищах хранится с точностью до миллисекунды
+func sameTime(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d < time.Millisecond && d > -time.Millisecond
+}
+
+func containsID(ids []ident.ID, id ident.ID) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTask(tasks []project.Task, id ident.ID) bool {
+	for _, t := range tasks {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func mustUser(t *testing.T, st storage.Storage, name, email string) *user.User {
+	t.Helper()
+	u := user.NewUser(name, "dev", 30, 1000, email, nil)
+	if err := st.InsertUser(u); err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	return u
+}
+
+func mustProject(t *testing.T, st storage.Storage, userId ident.ID, name string) *project.Project {
+	t.Helper()
+	p := project.NewProject(userId, name, "desc", 5, "author", "resp", "perf", time.Time{}, "", nil, "open")
+	if err := st.InsertProject(p, userId); err != nil {
+		t.Fatalf("InsertProject: %v", err)
+	}
+	return p
+}
+
+func mustTask(t *testing.T, st storage.Storage, projectId ident.ID, name, status string) *project.Task {
+	t.Helper()
+	task := project.NewTask(projectId, name, "desc", 3, "author", "resp", "perf", time.Time{}, "", status)
+	if err := st.InsertTask(task, projectId); err != nil {
+		t.Fatalf("InsertTask: %v", err)
+	}
+	return task
+}
+
+func mustGetTask(t *testing.T, st storage.Storage, projectId, taskId ident.ID) *project.Task {
+	t.Helper()
+	task, err := st.GetTask(projectId, taskId)
+	if err != nil {
+		t.Fatalf("GetTask: %v", err)
+	}
+	if task == nil {
+		t.Fatalf("GetTask(%s): task not found", taskId)
+	}
+	return task
+}
+
+func mustGetUser(t *testing.T, st storage.Storage, userId ident.ID) user.User {
+	t.Helper()
+	u, err := st.GetUser(userId)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	return u
+}
+
+func mustGetProject(t *testing.T, st storage.Storage, userId, projectId ident.ID) *project.Project {
+	t.Helper()
+	p, err := st.GetProject(userId, projectId)
+	if err != nil {
+		t.Fatalf("GetProject: %v", err)
+	}
+	return p
+}
+
+func testUsers(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "ann@example.com")
+	if u.Id.IsZero() {
+		t.Fatal("InsertUser did not assign an id")
+	}
+
+	got := mustGetUser(t, st, u.Id)
+	if got.Name != "Ann" || got.Work != "dev" || got.Age != 30 || got.Salary != 1000 || got.Email != "ann@example.com" {
+		t.Errorf("GetUser = %+v", got)
+	}
+	if _, ok := st.GetAllUsers()[u.Id]; !ok {
+		t.Error("GetAllUsers does not contain the inserted user")
+	}
+
+	update := *u
+	update.Id = ident.Nil
+	update.Name = "Anna"
+	update.Salary = 2000
+	if err := st.UpdateUser(u.Id, &update); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	got = mustGetUser(t, st, u.Id)
+	if got.Name != "Anna" || got.Salary != 2000 || got.Email != "ann@example.com" {
+		t.Errorf("GetUser after update = %+v", got)
+	}
+
+	if err := st.DeleteUser(u.Id); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := st.GetUser(u.Id); err == nil {
+		t.Error("GetUser after delete: want error")
+	}
+	if _, ok := st.GetAllUsers()[u.Id]; ok {
+		t.Error("GetAllUsers still contains the deleted user")
+	}
+	if _, err := st.GetUser(ident.New()); err == nil {
+		t.Error("GetUser of unknown id: want error")
+	}
+}
+
+func testEmailUnique(t *testing.T, st storage.Storage) {
+	ann := mustUser(t, st, "Ann", "ann@example.com")
+	bob := mustUser(t, st, "Bob", "bob@example.com")
+
+	dup := user.NewUser("Ann 2", "dev", 20, 0, "ann@example.com", nil)
+	if err := st.InsertUser(dup); !errors.Is(err, storage.ErrEmailTaken) {
+		t.Errorf("InsertUser with taken email: err = %v, want ErrEmailTaken", err)
+	}
+
+	update := *bob
+	update.Id = ident.Nil
+	update.Email = ann.Email
+	if err := st.UpdateUser(bob.Id, &update); !errors.Is(err, storage.ErrEmailTaken) {
+		t.Errorf("UpdateUser to taken email: err = %v, want ErrEmailTaken", err)
+	}
+	if got := mustGetUser(t, st, bob.Id); got.Email != "bob@example.com" {
+		t.Errorf("email after rejected update = %q", got.Email)
+	}
+
+	// Пустой email не участвует в уникальности
+	mustUser(t, st, "NoMail 1", "")
+	mustUser(t, st, "NoMail 2", "")
+}
+
+func testProjects(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p1 := mustProject(t, st, u.Id, "First")
+	p2 := mustProject(t, st, u.Id, "Second")
+	if p1.Id.IsZero() || p1.UserID != u.Id {
+		t.Fatalf("InsertProject: id %s, userId %s", p1.Id, p1.UserID)
+	}
+
+	// Обратные ссылки пользователя на проекты
+	got := mustGetUser(t, st, u.Id)
+	if len(got.Projects) != 2 || !containsID(got.Projects, p1.Id) || !containsID(got.Projects, p2.Id) {
+		t.Errorf("User.Projects = %v, want [%s %s]", got.Projects, p1.Id, p2.Id)
+	}
+
+	p := mustGetProject(t, st, u.Id, p1.Id)
+	if p.Name != "First" || p.Priority != 5 || p.Status != "open" || p.UserID != u.Id {
+		t.Errorf("GetProject = %+v", p)
+	}
+	if !sameTime(p.DateCreation, p1.DateCreation) {
+		t.Errorf("DateCreation = %v, want %v", p.DateCreation, p1.DateCreation)
+	}
+	if _, ok := st.GetAllProjects()[p2.Id]; !ok {
+		t.Error("GetAllProjects does not contain the inserted project")
+	}
+	byUser, err := st.GetProjectByUser(u.Id)
+	if err != nil {
+		t.Fatalf("GetProjectByUser: %v", err)
+	}
+	if len(byUser) != 2 {
+		t.Errorf("GetProjectByUser returned %d projects, want 2", len(byUser))
+	}
+
+	// Частичное обновление меняет только переданные поля; числа из JSON приходят как float64
+	err = st.UpdateProject(p1.Id, bson.M{"name": "Renamed", "priority": float64(8)})
+	if err != nil {
+		t.Fatalf("UpdateProject: %v", err)
+	}
+	p = mustGetProject(t, st, u.Id, p1.Id)
+	if p.Name != "Renamed" || p.Priority != 8 || p.Descript != "desc" || p.Status != "open" {
+		t.Errorf("GetProject after update = %+v", p)
+	}
+
+	if err := st.DeleteProject(p1.Id); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	if _, err := st.GetProject(u.Id, p1.Id); err == nil {
+		t.Error("GetProject after delete: want error")
+	}
+	got = mustGetUser(t, st, u.Id)
+	if containsID(got.Projects, p1.Id) || !containsID(got.Projects, p2.Id) {
+		t.Errorf("User.Projects after delete = %v", got.Projects)
+	}
+
+	p3 := mustProject(t, st, u.Id, "Third")
+	if err := st.DeleteProjects(u.Id, []ident.ID{p2.Id, p3.Id}); err != nil {
+		t.Fatalf("DeleteProjects: %v", err)
+	}
+	byUser, err = st.GetProjectByUser(u.Id)
+	if err != nil {
+		t.Fatalf("GetProjectByUser: %v", err)
+	}
+	if len(byUser) != 0 {
+		t.Errorf("GetProjectByUser after DeleteProjects returned %d projects", len(byUser))
+	}
+	if got = mustGetUser(t, st, u.Id); len(got.Projects) != 0 {
+		t.Errorf("User.Projects after DeleteProjects = %v", got.Projects)
+	}
+}
+
+// Удаление работает одинаково во всех хранилищах: вместе с задачей уходят её списания
+// и комментарии, с проектом — задачи, спринты и вебхуки, с пользователем — проекты и уведомления
+func testDeleteCascade(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	kept := mustTask(t, st, p.Id, "Kept", "todo")
+	gone := mustTask(t, st, p.Id, "Gone", "todo")
+	for _, task := range []*project.Task{kept, gone} {
+		w := project.NewWorklog(p.Id, task.ID, u.Id, time.Now().Add(-time.Hour), time.Minute, "")
+		if err := st.InsertWorklog(w, p.Id, task.ID); err != nil {
+			t.Fatalf("InsertWorklog: %v", err)
+		}
+		if err := st.InsertComment(&project.Comment{AuthorID: u.Id, Text: "hi"}, p.Id, task.ID); err != nil {
+			t.Fatalf("InsertComment: %v", err)
+		}
+	}
+
+	if err := st.DeleteTask(p.Id, gone.ID); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	if logs, err := st.GetWorklogsByTask(p.Id, gone.ID); err != nil || len(logs) != 0 {
+		t.Errorf("worklogs of deleted task = %+v, %v", logs, err)
+	}
+	if comments, err := st.GetCommentsByTask(p.Id, gone.ID); err != nil || len(comments) != 0 {
+		t.Errorf("comments of deleted task = %+v, %v", comments, err)
+	}
+	if logs, err := st.GetWorklogsByTask(p.Id, kept.ID); err != nil || len(logs) != 1 {
+		t.Errorf("worklogs of kept task = %+v, %v", logs, err)
+	}
+
+	start := time.Now().Truncate(time.Millisecond)
+	if err := st.InsertSprint(project.NewSprint(p.Id, "Sprint", "", start, start.Add(time.Hour)), p.Id); err != nil {
+		t.Fatalf("InsertSprint: %v", err)
+	}
+	hook := &project.Webhook{URL: "https://example.com/hook", Events: []string{"*"}, Active: true}
+	if err := st.InsertWebhook(hook, p.Id); err != nil {
+		t.Fatalf("InsertWebhook: %v", err)
+	}
+	d := &project.WebhookDelivery{WebhookID: hook.Id, ProjectID: p.Id, EventID: "e1", Event: "task.created",
+		Payload: "{}", Status: project.DeliveryPending, NextAttempt: start}
+	if err := st.InsertDelivery(d); err != nil {
+		t.Fatalf("InsertDelivery: %v", err)
+	}
+
+	// Чтение перед удалением: кэширующая обёртка не должна отдать задачу после удаления проекта
+	mustGetTask(t, st, p.Id, kept.ID)
+	if err := st.DeleteProject(p.Id); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	if task, err := st.GetTask(p.Id, kept.ID); err != nil || task != nil {
+		t.Errorf("GetTask after DeleteProject = %+v, %v; want nil, nil", task, err)
+	}
+	if tasks, err := st.GetTasksByProject(p.Id); err != nil || len(tasks) != 0 {
+		t.Errorf("GetTasksByProject after DeleteProject = %d tasks, %v", len(tasks), err)
+	}
+	if logs, err := st.GetWorklogsByTask(p.Id, kept.ID); err != nil || len(logs) != 0 {
+		t.Errorf("worklogs after DeleteProject = %+v, %v", logs, err)
+	}
+	if sprints, err := st.GetSprintsByProject(p.Id); err != nil || len(sprints) != 0 {
+		t.Errorf("GetSprintsByProject after DeleteProject = %+v, %v", sprints, err)
+	}
+	// Вебхуки с журналом остаются до доставки project.deleted, но помечаются
+	if hooks, err := st.GetWebhooksByProject(p.Id); err != nil || len(hooks) != 1 || !hooks[0].ProjectDeleted {
+		t.Errorf("GetWebhooksByProject after DeleteProject = %+v, %v; want one marked webhook", hooks, err)
+	}
+	if deliveries, err := st.GetDeliveries(hook.Id, 10); err != nil || len(deliveries) != 1 {
+		t.Errorf("GetDeliveries after DeleteProject = %+v, %v", deliveries, err)
+	}
+
+	p2 := mustProject(t, st, u.Id, "Second")
+	task := mustTask(t, st, p2.Id, "Design", "todo")
+	hook2 := &project.Webhook{URL: "https://example.com/hook", Events: []string{"*"}, Active: true}
+	if err := st.InsertWebhook(hook2, p2.Id); err != nil {
+		t.Fatalf("InsertWebhook: %v", err)
+	}
+	if err := st.InsertNotification(&user.Notification{UserID: u.Id, Title: "hi"}); err != nil {
+		t.Fatalf("InsertNotification: %v", err)
+	}
+	mustGetProject(t, st, u.Id, p2.Id)
+	mustGetTask(t, st, p2.Id, task.ID)
+	if err := st.DeleteUser(u.Id); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := st.GetProject(u.Id, p2.Id); err == nil {
+		t.Error("GetProject after DeleteUser: want error")
+	}
+	if projects, err := st.GetProjectByUser(u.Id); err != nil || len(projects) != 0 {
+		t.Errorf("GetProjectByUser after DeleteUser = %+v, %v", projects, err)
+	}
+	if got, err := st.GetTask(p2.Id, task.ID); err != nil || got != nil {
+		t.Errorf("GetTask after DeleteUser = %+v, %v; want nil, nil", got, err)
+	}
+	if _, total, err := st.GetNotifications(u.Id, false, 0, 10); err != nil || total != 0 {
+		t.Errorf("GetNotifications after DeleteUser = %d, %v", total, err)
+	}
+	if got, err := st.GetWebhook(p2.Id, hook2.Id); err != nil || got == nil || !got.ProjectDeleted {
+		t.Errorf("GetWebhook after DeleteUser = %+v, %v; want marked webhook", got, err)
+	}
+}
+
+func testProjectNotFound(t *testing.T, st storage.Storage) {
+	ann := mustUser(t, st, "Ann", "")
+	bob := mustUser(t, st, "Bob", "")
+	p := mustProject(t, st, ann.Id, "Ann's")
+
+	if _, err := st.GetProject(bob.Id, p.Id); err == nil {
+		t.Error("GetProject of another user's project: want error")
+	}
+	if _, err := st.GetProject(ann.Id, ident.New()); err == nil {
+		t.Error("GetProject of unknown id: want error")
+	}
+	if err := st.DeleteProject(ident.New()); err == nil {
+		t.Error("DeleteProject of unknown id: want error")
+	}
+	orphan := project.NewProject(ident.Nil, "Orphan", "", 1, "", "", "", time.Time{}, "", nil, "open")
+	if err := st.InsertProject(orphan, ident.New()); err == nil {
+		t.Error("InsertProject for unknown user: want error")
+	}
+	if got := mustGetUser(t, st, bob.Id); len(got.Projects) != 0 {
+		t.Errorf("Bob's projects = %v, want none", got.Projects)
+	}
+}
+
+func testTasks(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+
+	t1 := mustTask(t, st, p.Id, "Design", "todo")
+	t2 := mustTask(t, st, p.Id, "Build", "todo")
+	if t1.ID.IsZero() || t1.ProjectID != p.Id {
+		t.Fatalf("InsertTask: id %s, projectId %s", t1.ID, t1.ProjectID)
+	}
+
+	// Обратные ссылки проекта на задачи
+	got := mustGetProject(t, st, u.Id, p.Id)
+	if len(got.Tasks) != 2 || !containsID(got.Tasks, t1.ID) || !containsID(got.Tasks, t2.ID) {
+		t.Errorf("Project.Tasks = %v, want [%s %s]", got.Tasks, t1.ID, t2.ID)
+	}
+
+	task := mustGetTask(t, st, p.Id, t1.ID)
+	if task.Name != "Design" || task.Priority != 3 || task.Status != "todo" || task.ProjectID != p.Id {
+		t.Errorf("GetTask = %+v", task)
+	}
+	if task.Rank == "" {
+		t.Error("InsertTask did not assign a rank")
+	}
+	if len(task.StatusHistory) != 1 || task.StatusHistory[0].Status != "todo" {
+		t.Errorf("StatusHistory = %+v, want the initial status", task.StatusHistory)
+	}
+	if _, ok := st.GetAllTasks()[t2.ID]; !ok {
+		t.Error("GetAllTasks does not contain the inserted task")
+	}
+	tasks, err := st.GetTasksByProject(p.Id)
+	if err != nil {
+		t.Fatalf("GetTasksByProject: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Errorf("GetTasksByProject returned %d tasks, want 2", len(tasks))
+	}
+
+	// Смена статуса пишется в историю, остальные поля не меняются
+	err = st.UpdateTask(p.Id, t1.ID, bson.M{"status": "done", "priority": float64(9)})
+	if err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	task = mustGetTask(t, st, p.Id, t1.ID)
+	if task.Status != "done" || task.Priority != 9 || task.Name != "Design" || task.Description != "desc" {
+		t.Errorf("GetTask after update = %+v", task)
+	}
+	if len(task.StatusHistory) != 2 || task.StatusHistory[1].Status != "done" {
+		t.Errorf("StatusHistory after update = %+v", task.StatusHistory)
+	}
+
+	// Повторный тот же статус историю не пополняет
+	if err := st.UpdateTask(p.Id, t1.ID, bson.M{"status": "done"}); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	if task = mustGetTask(t, st, p.Id, t1.ID); len(task.StatusHistory) != 2 {
+		t.Errorf("StatusHistory after same status = %+v", task.StatusHistory)
+	}
+
+	// Ранг ведёт только хранилище: частичное обновление его не меняет
+	rank := task.Rank
+	if err := st.UpdateTask(p.Id, t1.ID, bson.M{"rank": "-", "name": "Design"}); err != nil {
+		t.Fatalf("UpdateTask with rank: %v", err)
+	}
+	if task = mustGetTask(t, st, p.Id, t1.ID); task.Rank != rank {
+		t.Errorf("Rank after update = %q, want %q", task.Rank, rank)
+	}
+
+	if err := st.DeleteTask(p.Id, t1.ID); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	if task, err := st.GetTask(p.Id, t1.ID); err != nil || task != nil {
+		t.Errorf("GetTask after delete = %v, %v; want nil, nil", task, err)
+	}
+	got = mustGetProject(t, st, u.Id, p.Id)
+	if containsID(got.Tasks, t1.ID) || !containsID(got.Tasks, t2.ID) {
+		t.Errorf("Project.Tasks after delete = %v", got.Tasks)
+	}
+
+	t3 := mustTask(t, st, p.Id, "Ship", "todo")
+	if err := st.DeleteTasks(p.Id, []ident.ID{t2.ID, t3.ID}); err != nil {
+		t.Fatalf("DeleteTasks: %v", err)
+	}
+	tasks, err = st.GetTasksByProject(p.Id)
+	if err != nil {
+		t.Fatalf("GetTasksByProject: %v", err)
+	}
+	if len(tasks) != 0 {
+		t.Errorf("GetTasksByProject after DeleteTasks returned %d tasks", len(tasks))
+	}
+	if got = mustGetProject(t, st, u.Id, p.Id); len(got.Tasks) != 0 {
+		t.Errorf("Project.Tasks after DeleteTasks = %v", got.Tasks)
+	}
+}
+
+func testTaskNotFound(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	other := mustProject(t, st, u.Id, "Other")
+	task := mustTask(t, st, p.Id, "Design", "todo")
+
+	if got, err := st.GetTask(p.Id, ident.New()); err != nil || got != nil {
+		t.Errorf("GetTask of unknown id = %v, %v; want nil, nil", got, err)
+	}
+	if got, err := st.GetTask(other.Id, task.ID); err != nil || got != nil {
+		t.Errorf("GetTask from another project = %v, %v; want nil, nil", got, err)
+	}
+	orphan := project.NewTask(ident.Nil, "Orphan", "", 1, "", "", "", time.Time{}, "", "todo")
+	if err := st.InsertTask(orphan, ident.New()); err == nil {
+		t.Error("InsertTask into unknown project: want error")
+	}
+
+	// Обновление задачи через чужой проект ничего не меняет
+	if err := st.UpdateTask(other.Id, task.ID, bson.M{"name": "Hijacked"}); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	if got := mustGetTask(t, st, p.Id, task.ID); got.Name != "Design" {
+		t.Errorf("task renamed through another project: %q", got.Name)
+	}
+}
+
+func testMoveTask(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	a := mustTask(t, st, p.Id, "A", "todo")
+	b := mustTask(t, st, p.Id, "B", "todo")
+	c := mustTask(t, st, p.Id, "C", "doing")
+
+	if got := mustGetTask(t, st, p.Id, a.ID).Rank; got >= mustGetTask(t, st, p.Id, b.ID).Rank {
+		t.Fatalf("new task is not ranked after existing ones")
+	}
+
+	// C переезжает в начало колонки todo
+	if err := st.MoveTask(p.Id, c.ID, "todo", 0); err != nil {
+		t.Fatalf("MoveTask: %v", err)
+	}
+	moved := mustGetTask(t, st, p.Id, c.ID)
+	if moved.Status != "todo" {
+		t.Errorf("status after move = %q, want todo", moved.Status)
+	}
+	if moved.Rank >= mustGetTask(t, st, p.Id, a.ID).Rank {
+		t.Errorf("moved task rank %q is not before %q", moved.Rank, mustGetTask(t, st, p.Id, a.ID).Rank)
+	}
+	if h := moved.StatusHistory; len(h) != 2 || h[1].Status != "todo" {
+		t.Errorf("StatusHistory after move = %+v", h)
+	}
+
+	// Смена статуса без MoveTask ставит задачу в конец новой колонки
+	d := mustTask(t, st, p.Id, "D", "done")
+	if err := st.UpdateTask(p.Id, a.ID, bson.M{"status": "done"}); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	errs, err := st.UpdateTasks(p.Id, []storage.TaskUpdate{{ID: b.ID, Fields: bson.M{"status": "done"}}})
+	if err != nil || errs[0] != nil {
+		t.Fatalf("UpdateTasks = %v, %v", errs, err)
+	}
+	ranks := []string{mustGetTask(t, st, p.Id, d.ID).Rank, mustGetTask(t, st, p.Id, a.ID).Rank, mustGetTask(t, st, p.Id, b.ID).Rank}
+	if ranks[0] >= ranks[1] || ranks[1] >= ranks[2] {
+		t.Errorf("done column ranks = %q, want D, A, B in order", ranks)
+	}
+}
+
+func testBulkTasks(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	existing := mustTask(t, st, p.Id, "Existing", "todo")
+
+	var tasks []*project.Task
+	for i := 0; i < 3; i++ {
+		tasks = append(tasks, project.NewTask(ident.Nil, fmt.Sprint("bulk ", i), "", 1, "", "", "", time.Time{}, "", "todo"))
+	}
+	errs, err := st.InsertTasks(tasks, p.Id)
+	if err != nil {
+		t.Fatalf("InsertTasks: %v", err)
+	}
+	if len(errs) != len(tasks) {
+		t.Fatalf("InsertTasks returned %d results for %d tasks", len(errs), len(tasks))
+	}
+
+	got := mustGetProject(t, st, u.Id, p.Id)
+	if len(got.Tasks) != 4 {
+		t.Errorf("Project.Tasks = %v, want 4 ids", got.Tasks)
+	}
+	// Задачи пакета встают в конец колонки в порядке пакета
+	prev := mustGetTask(t, st, p.Id, existing.ID).Rank
+	for i, task := range tasks {
+		if errs[i] != nil {
+			t.Errorf("task %d: %v", i, errs[i])
+			continue
+		}
+		stored := mustGetTask(t, st, p.Id, task.ID)
+		if stored.Name != task.Name || len(stored.StatusHistory) != 1 || !containsID(got.Tasks, task.ID) {
+			t.Errorf("task %d stored as %+v", i, stored)
+		}
+		if stored.Rank <= prev {
+			t.Errorf("task %d rank %q is not after %q", i, stored.Rank, prev)
+		}
+		prev = stored.Rank
+	}
+
+	orphan := project.NewTask(ident.Nil, "Orphan", "", 1, "", "", "", time.Time{}, "", "todo")
+	if _, err := st.InsertTasks([]*project.Task{orphan}, ident.New()); err == nil {
+		t.Error("InsertTasks into unknown project: want error")
+	}
+
+	missing := ident.New()
+	errs, err = st.UpdateTasks(p.Id, []storage.TaskUpdate{
+		{ID: tasks[0].ID, Fields: bson.M{"status": "done", "priority": float64(7)}},
+		{ID: missing, Fields: bson.M{"name": "Ghost"}},
+		{ID: tasks[1].ID, Fields: bson.M{"name": "Renamed"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateTasks: %v", err)
+	}
+	if len(errs) != 3 || errs[0] != nil || errs[2] != nil {
+		t.Fatalf("UpdateTasks errors = %v", errs)
+	}
+	if !errors.Is(errs[1], storage.ErrTaskNotFound) {
+		t.Errorf("UpdateTasks of unknown task: err = %v, want ErrTaskNotFound", errs[1])
+	}
+	first := mustGetTask(t, st, p.Id, tasks[0].ID)
+	if first.Status != "done" || first.Priority != 7 || first.Name != "bulk 0" || len(first.StatusHistory) != 2 {
+		t.Errorf("task after bulk update = %+v", first)
+	}
+	if second := mustGetTask(t, st, p.Id, tasks[1].ID); second.Name != "Renamed" || second.Status != "todo" {
+		t.Errorf("task after bulk update = %+v", second)
+	}
+
+	// Поля вне списка NormalizeTaskUpdate отклоняются во всех хранилищах, остальные элементы применяются
+	other := mustProject(t, st, u.Id, "Other")
+	errs, err = st.UpdateTasks(p.Id, []storage.TaskUpdate{
+		{ID: tasks[0].ID, Fields: bson.M{"projectId": other.Id.Hex()}},
+		{ID: tasks[1].ID, Fields: bson.M{"remaining": "lots"}},
+		{ID: tasks[2].ID, Fields: bson.M{"priority": float64(2)}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateTasks: %v", err)
+	}
+	if len(errs) != 3 || !errors.Is(errs[0], storage.ErrInvalidUpdate) || !errors.Is(errs[1], storage.ErrInvalidUpdate) || errs[2] != nil {
+		t.Errorf("UpdateTasks with invalid fields: errors = %v", errs)
+	}
+	if got := mustGetTask(t, st, p.Id, tasks[0].ID); got.ProjectID != p.Id {
+		t.Errorf("task moved to project %s by UpdateTasks", got.ProjectID)
+	}
+	if err := st.UpdateTask(p.Id, tasks[0].ID, bson.M{"_id": ident.New().Hex()}); !errors.Is(err, storage.ErrInvalidUpdate) {
+		t.Errorf("UpdateTask of _id: err = %v, want ErrInvalidUpdate", err)
+	}
+
+	// Значения из JSON — строки; хранилище записывает их как id и время, чтобы их находили запросы
+	sprint := project.NewSprint(p.Id, "Sprint", "", time.Time{}, time.Time{})
+	if err := st.InsertSprint(sprint, p.Id); err != nil {
+		t.Fatalf("InsertSprint: %v", err)
+	}
+	deadline := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	if err := st.UpdateTask(p.Id, tasks[1].ID, bson.M{"sprintId": sprint.Id.Hex(), "deadline": deadline.Format(time.RFC3339)}); err != nil {
+		t.Fatalf("UpdateTask with JSON values: %v", err)
+	}
+	errs, err = st.UpdateTasks(p.Id, []storage.TaskUpdate{
+		{ID: tasks[2].ID, Fields: bson.M{"sprintId": sprint.Id.Hex(), "deadline": deadline.Format(time.RFC3339)}},
+	})
+	if err != nil || errs[0] != nil {
+		t.Fatalf("UpdateTasks with JSON values: %v, %v", errs, err)
+	}
+	inSprint, err := st.GetTasksBySprint(p.Id, sprint.Id)
+	if err != nil {
+		t.Fatalf("GetTasksBySprint: %v", err)
+	}
+	if len(inSprint) != 2 || !containsTask(inSprint, tasks[1].ID) || !containsTask(inSprint, tasks[2].ID) {
+		t.Errorf("GetTasksBySprint = %+v, want tasks updated with a string sprintId", inSprint)
+	}
+	due, err := st.GetTasksDueBefore(deadline.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetTasksDueBefore: %v", err)
+	}
+	if !containsTask(due, tasks[1].ID) || !containsTask(due, tasks[2].ID) {
+		t.Errorf("GetTasksDueBefore = %+v, want tasks updated with a string deadline", due)
+	}
+	if got := mustGetTask(t, st, p.Id, tasks[1].ID); !got.Deadline.Equal(deadline) {
+		t.Errorf("Deadline = %v, want %v", got.Deadline, deadline)
+	}
+}
+
+func testSprints(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	start := time.Now().Truncate(time.Millisecond)
+
+	s1 := project.NewSprint(p.Id, "Sprint 1", "goal", start, start.Add(14*24*time.Hour))
+	if err := st.InsertSprint(s1, p.Id); err != nil {
+		t.Fatalf("InsertSprint: %v", err)
+	}
+	s2 := project.NewSprint(p.Id, "Sprint 2", "", start.Add(14*24*time.Hour), start.Add(28*24*time.Hour))
+	if err := st.InsertSprint(s2, p.Id); err != nil {
+		t.Fatalf("InsertSprint: %v", err)
+	}
+
+	sprints, err := st.GetSprintsByProject(p.Id)
+	if err != nil {
+		t.Fatalf("GetSprintsByProject: %v", err)
+	}
+	if len(sprints) != 2 || sprints[0].Id != s1.Id || sprints[1].Id != s2.Id {
+		t.Fatalf("GetSprintsByProject = %+v, want sprints ordered by start", sprints)
+	}
+	if got, err := st.GetSprint(p.Id, ident.New()); err != nil || got != nil {
+		t.Errorf("GetSprint of unknown id = %v, %v; want nil, nil", got, err)
+	}
+
+	if err := st.UpdateSprint(p.Id, s1.Id, bson.M{"goal": "ship it"}); err != nil {
+		t.Fatalf("UpdateSprint: %v", err)
+	}
+	// Значения из JSON приводятся к типам полей, статус и итоги через UpdateSprint не меняются
+	end := start.Add(15 * 24 * time.Hour)
+	if err := st.UpdateSprint(p.Id, s1.Id, bson.M{"end": end.Format(time.RFC3339Nano)}); err != nil {
+		t.Fatalf("UpdateSprint with string end: %v", err)
+	}
+	if got := mustGetSprint(t, st, p.Id, s1.Id); !got.End.Equal(end) || got.Goal != "ship it" {
+		t.Errorf("sprint after update = %+v, want end %v and goal kept", got, end)
+	}
+	for _, fields := range []bson.M{{"status": project.SprintClosed}, {"carriedOver": 3}, {"start": 42}} {
+		if err := st.UpdateSprint(p.Id, s1.Id, fields); !errors.Is(err, storage.ErrInvalidUpdate) {
+			t.Errorf("UpdateSprint(%v): err = %v, want ErrInvalidUpdate", fields, err)
+		}
+	}
+	if got := mustGetSprint(t, st, p.Id, s1.Id); got.Status != project.SprintPlanned {
+		t.Errorf("sprint status = %s, want %s", got.Status, project.SprintPlanned)
+	}
+
+	done := mustTask(t, st, p.Id, "Done", "done")
+	open := mustTask(t, st, p.Id, "Open", "todo")
+	if err := st.AssignTasksToSprint(p.Id, s1.Id, []ident.ID{done.ID, open.ID}); err != nil {
+		t.Fatalf("AssignTasksToSprint: %v", err)
+	}
+	inSprint, err := st.GetTasksBySprint(p.Id, s1.Id)
+	if err != nil {
+		t.Fatalf("GetTasksBySprint: %v", err)
+	}
+	if len(inSprint) != 2 {
+		t.Errorf("GetTasksBySprint returned %d tasks, want 2", len(inSprint))
+	}
+
+	if err := st.StartSprint(p.Id, s1.Id); err != nil {
+		t.Fatalf("StartSprint: %v", err)
+	}
+	if err := st.StartSprint(p.Id, s2.Id); err == nil {
+		t.Error("StartSprint while another sprint is active: want error")
+	}
+	got, err := st.GetSprint(p.Id, s1.Id)
+	if err != nil || got == nil {
+		t.Fatalf("GetSprint = %v, %v", got, err)
+	}
+	if got.Status != project.SprintActive || got.Goal != "ship it" || got.StartedAt.IsZero() {
+		t.Errorf("GetSprint after start = %+v", got)
+	}
+
+	// Незавершённые задачи переезжают в следующий спринт
+	carried, err := st.CloseSprint(p.Id, s1.Id, s2.Id)
+	if err != nil {
+		t.Fatalf("CloseSprint: %v", err)
+	}
+	if carried != 1 {
+		t.Errorf("CloseSprint carried over %d tasks, want 1", carried)
+	}
+	if got = mustGetSprint(t, st, p.Id, s1.Id); got.Status != project.SprintClosed || got.CarriedOver != 1 {
+		t.Errorf("GetSprint after close = %+v", got)
+	}
+	if task := mustGetTask(t, st, p.Id, open.ID); task.SprintID != s2.Id {
+		t.Errorf("open task sprint = %s, want %s", task.SprintID, s2.Id)
+	}
+	if task := mustGetTask(t, st, p.Id, done.ID); task.SprintID != s1.Id {
+		t.Errorf("done task sprint = %s, want %s", task.SprintID, s1.Id)
+	}
+	if err := st.AssignTasksToSprint(p.Id, s1.Id, []ident.ID{open.ID}); err == nil {
+		t.Error("AssignTasksToSprint to a closed sprint: want error")
+	}
+
+	// Удаление спринта возвращает его задачи в бэклог
+	if err := st.DeleteSprint(p.Id, s2.Id); err != nil {
+		t.Fatalf("DeleteSprint: %v", err)
+	}
+	if task := mustGetTask(t, st, p.Id, open.ID); !task.SprintID.IsZero() {
+		t.Errorf("task sprint after sprint deletion = %s, want backlog", task.SprintID)
+	}
+}
+
+func mustGetSprint(t *testing.T, st storage.Storage, projectId, sprintId ident.ID) *project.Sprint {
+	t.Helper()
+	s, err := st.GetSprint(projectId, sprintId)
+	if err != nil {
+		t.Fatalf("GetSprint: %v", err)
+	}
+	if s == nil {
+		t.Fatalf("GetSprint(%s): sprint not found", sprintId)
+	}
+	return s
+}
+
+func testWorklogs(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	task := project.NewTask(p.Id, "Design", "", 1, "", "", "", time.Time{}, "", "todo")
+	task.Estimate = 4
+	if err := st.InsertTask(task, p.Id); err != nil {
+		t.Fatalf("InsertTask: %v", err)
+	}
+
+	started := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	w := project.NewWorklog(p.Id, task.ID, u.Id, started, 90*time.Minute, "pairing")
+	if err := st.InsertWorklog(w, p.Id, task.ID); err != nil {
+		t.Fatalf("InsertWorklog: %v", err)
+	}
+	if got := mustGetTask(t, st, p.Id, task.ID); got.Remaining != 2.5 {
+		t.Errorf("Remaining after worklog = %v, want 2.5", got.Remaining)
+	}
+	worklogs, err := st.GetWorklogsByTask(p.Id, task.ID)
+	if err != nil {
+		t.Fatalf("GetWorklogsByTask: %v", err)
+	}
+	if len(worklogs) != 1 || worklogs[0].Id != w.Id || worklogs[0].Note != "pairing" {
+		t.Errorf("GetWorklogsByTask = %+v", worklogs)
+	}
+
+	report, err := st.GetTimeReport(p.Id, ident.Nil, started.Add(-time.Minute), time.Now())
+	if err != nil {
+		t.Fatalf("GetTimeReport: %v", err)
+	}
+	if len(report) != 1 || report[0].Seconds != 90*60 || report[0].UserName != "Ann" || report[0].TaskName != "Design" {
+		t.Errorf("GetTimeReport = %+v", report)
+	}
+
+	if err := st.DeleteWorklog(p.Id, task.ID, w.Id); err != nil {
+		t.Fatalf("DeleteWorklog: %v", err)
+	}
+	if got := mustGetTask(t, st, p.Id, task.ID); got.Remaining != 4 {
+		t.Errorf("Remaining after deleting worklog = %v, want 4", got.Remaining)
+	}
+	if err := st.DeleteWorklog(p.Id, task.ID, w.Id); err == nil {
+		t.Error("DeleteWorklog of deleted worklog: want error")
+	}
+	if err := st.InsertWorklog(project.NewWorklog(p.Id, ident.Nil, u.Id, started, time.Minute, ""), p.Id, ident.New()); err == nil {
+		t.Error("InsertWorklog for unknown task: want error")
+	}
+
+	// Запись сверх оценки списывает только остаток, и при удалении возвращается только он
+	long := project.NewWorklog(p.Id, task.ID, u.Id, started, 3*time.Hour, "")
+	over := project.NewWorklog(p.Id, task.ID, u.Id, started, 2*time.Hour, "")
+	for _, w := range []*project.Worklog{long, over} {
+		if err := st.InsertWorklog(w, p.Id, task.ID); err != nil {
+			t.Fatalf("InsertWorklog: %v", err)
+		}
+	}
+	if got := mustGetTask(t, st, p.Id, task.ID); got.Remaining != 0 {
+		t.Errorf("Remaining after overrun = %v, want 0", got.Remaining)
+	}
+	if long.Consumed != 3 || over.Consumed != 1 {
+		t.Errorf("Consumed = %v, %v; want 3, 1", long.Consumed, over.Consumed)
+	}
+	if err := st.DeleteWorklog(p.Id, task.ID, over.Id); err != nil {
+		t.Fatalf("DeleteWorklog: %v", err)
+	}
+	if got := mustGetTask(t, st, p.Id, task.ID); got.Remaining != 1 {
+		t.Errorf("Remaining after deleting overrun = %v, want 1", got.Remaining)
+	}
+	if err := st.DeleteWorklog(p.Id, task.ID, long.Id); err != nil {
+		t.Fatalf("DeleteWorklog: %v", err)
+	}
+	if got := mustGetTask(t, st, p.Id, task.ID); got.Remaining != 4 {
+		t.Errorf("Remaining after deleting all worklogs = %v, want 4", got.Remaining)
+	}
+
+	if _, err := st.StartTimer(p.Id, task.ID, u.Id); err != nil {
+		t.Fatalf("StartTimer: %v", err)
+	}
+	if _, err := st.StartTimer(p.Id, task.ID, u.Id); err == nil {
+		t.Error("StartTimer while running: want error")
+	}
+	stopped, err := st.StopTimer(p.Id, task.ID, u.Id, "done")
+	if err != nil {
+		t.Fatalf("StopTimer: %v", err)
+	}
+	if stopped.Running || stopped.Note != "done" || stopped.Ended.IsZero() {
+		t.Errorf("StopTimer = %+v", stopped)
+	}
+	if _, err := st.StopTimer(p.Id, task.ID, u.Id, ""); err == nil {
+		t.Error("StopTimer without running timer: want error")
+	}
+}
+
+func testRecurrence(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	deadline := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	task := project.NewTask(p.Id, "Standup", "", 1, "", "", "", deadline, "", "todo")
+	if err := st.InsertTask(task, p.Id); err != nil {
+		t.Fatalf("InsertTask: %v", err)
+	}
+	if err := st.SetTaskRecurrence(p.Id, task.ID, "FREQ=DAILY;COUNT=2"); err != nil {
+		t.Fatalf("SetTaskRecurrence: %v", err)
+	}
+
+	recurring, err := st.GetRecurringTasks()
+	if err != nil {
+		t.Fatalf("GetRecurringTasks: %v", err)
+	}
+	if len(recurring) != 1 || recurring[0].ID != task.ID {
+		t.Fatalf("GetRecurringTasks = %+v", recurring)
+	}
+	if r := recurring[0].Recurrence; r.SeriesID != task.ID || r.Occurrence != 1 {
+		t.Errorf("Recurrence = %+v", r)
+	}
+
+	// Неудачная вставка вхождения не должна обрывать серию
+	orphan := recurring[0]
+	orphan.ProjectID = ident.New()
+	if _, err := st.SpawnOccurrence(&orphan); err == nil {
+		t.Error("SpawnOccurrence into unknown project: want error")
+	}
+	if again, err := st.GetRecurringTasks(); err != nil || len(again) != 1 {
+		t.Fatalf("GetRecurringTasks after failed spawn = %+v, %v", again, err)
+	}
+
+	next, err := st.SpawnOccurrence(&recurring[0])
+	if err != nil {
+		t.Fatalf("SpawnOccurrence: %v", err)
+	}
+	if next == nil {
+		t.Fatal("SpawnOccurrence returned nil")
+	}
+	if !next.Deadline.Equal(deadline.AddDate(0, 0, 1)) || next.Recurrence.Occurrence != 2 {
+		t.Errorf("next occurrence = deadline %v, recurrence %+v", next.Deadline, next.Recurrence)
+	}
+	if !containsID(mustGetProject(t, st, u.Id, p.Id).Tasks, next.ID) {
+		t.Error("Project.Tasks does not contain the spawned occurrence")
+	}
+
+	// Повторная попытка по той же задаче ничего не создаёт
+	if again, err := st.SpawnOccurrence(&recurring[0]); err != nil || again != nil {
+		t.Errorf("second SpawnOccurrence = %v, %v; want nil, nil", again, err)
+	}
+
+	// Серия из двух вхождений закончилась
+	recurring, err = st.GetRecurringTasks()
+	if err != nil {
+		t.Fatalf("GetRecurringTasks: %v", err)
+	}
+	if len(recurring) != 1 || recurring[0].ID != next.ID {
+		t.Fatalf("GetRecurringTasks after spawn = %+v", recurring)
+	}
+	if last, err := st.SpawnOccurrence(&recurring[0]); err != nil || last != nil {
+		t.Errorf("SpawnOccurrence past COUNT = %v, %v; want nil, nil", last, err)
+	}
+
+	if err := st.SetTaskRecurrence(p.Id, task.ID, ""); err != nil {
+		t.Fatalf("SetTaskRecurrence: %v", err)
+	}
+	if got := mustGetTask(t, st, p.Id, task.ID); got.Recurrence != nil {
+		t.Errorf("Recurrence after clearing = %+v", got.Recurrence)
+	}
+	if err := st.SetTaskRecurrence(p.Id, ident.New(), "FREQ=DAILY"); err == nil {
+		t.Error("SetTaskRecurrence for unknown task: want error")
+	}
+}
+
+func testNotifications(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	other := mustUser(t, st, "Bob", "")
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	var ids []ident.ID
+	for i := 0; i < 5; i++ {
+		n := &user.Notification{UserID: u.Id, Kind: "task.overdue", Title: fmt.Sprint(i), DateCreation: base.Add(time.Duration(i) * time.Minute)}
+		if err := st.InsertNotification(n); err != nil {
+			t.Fatalf("InsertNotification: %v", err)
+		}
+		ids = append(ids, n.Id)
+	}
+	if err := st.InsertNotification(&user.Notification{UserID: other.Id, Title: "other"}); err != nil {
+		t.Fatalf("InsertNotification: %v", err)
+	}
+
+	page, total, err := st.GetNotifications(u.Id, false, 1, 2)
+	if err != nil {
+		t.Fatalf("GetNotifications: %v", err)
+	}
+	if total != 5 || len(page) != 2 || page[0].Id != ids[3] || page[1].Id != ids[2] {
+		t.Errorf("GetNotifications page = %d items of %d, want [3 2] of 5", len(page), total)
+	}
+
+	if err := st.MarkNotificationRead(u.Id, ids[4]); err != nil {
+		t.Fatalf("MarkNotificationRead: %v", err)
+	}
+	if err := st.MarkNotificationRead(other.Id, ids[3]); err == nil {
+		t.Error("MarkNotificationRead of another user's notification: want error")
+	}
+	if n, err := st.CountUnreadNotifications(u.Id); err != nil || n != 4 {
+		t.Errorf("CountUnreadNotifications = %d, %v; want 4", n, err)
+	}
+	unread, total, err := st.GetNotifications(u.Id, true, 0, 0)
+	if err != nil {
+		t.Fatalf("GetNotifications: %v", err)
+	}
+	if total != 4 || len(unread) != 4 {
+		t.Errorf("unread notifications = %d of %d, want 4", len(unread), total)
+	}
+
+	if n, err := st.MarkAllNotificationsRead(u.Id); err != nil || n != 4 {
+		t.Errorf("MarkAllNotificationsRead = %d, %v; want 4", n, err)
+	}
+	if n, err := st.CountUnreadNotifications(u.Id); err != nil || n != 0 {
+		t.Errorf("CountUnreadNotifications after marking all = %d, %v", n, err)
+	}
+	if n, err := st.CountUnreadNotifications(other.Id); err != nil || n != 1 {
+		t.Errorf("other user's unread = %d, %v; want 1", n, err)
+	}
+
+	// Сроки: задача без срока в выборку не попадает
+	p := mustProject(t, st, u.Id, "Board")
+	due := project.NewTask(p.Id, "Due", "", 1, "", "", "", time.Now().Add(time.Hour), "", "todo")
+	if err := st.InsertTask(due, p.Id); err != nil {
+		t.Fatalf("InsertTask: %v", err)
+	}
+	later := project.NewTask(p.Id, "Later", "", 1, "", "", "", time.Now().Add(48*time.Hour), "", "todo")
+	if err := st.InsertTask(later, p.Id); err != nil {
+		t.Fatalf("InsertTask: %v", err)
+	}
+	mustTask(t, st, p.Id, "No deadline", "todo")
+	tasks, err := st.GetTasksDueBefore(time.Now().Add(24 * time.Hour))
+	if err != nil {
+		t.Fatalf("GetTasksDueBefore: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != due.ID {
+		t.Errorf("GetTasksDueBefore = %d tasks, want only %q", len(tasks), due.Name)
+	}
+
+	if sent, err := st.MarkReminderSent("task:1:day"); err != nil || !sent {
+		t.Errorf("first MarkReminderSent = %v, %v; want true", sent, err)
+	}
+	if sent, err := st.MarkReminderSent("task:1:day"); err != nil || sent {
+		t.Errorf("second MarkReminderSent = %v, %v; want false", sent, err)
+	}
+}
+
+func testWatches(t *testing.T, st storage.Storage) {
+	ann := mustUser(t, st, "Ann", "")
+	bob := mustUser(t, st, "Bob", "")
+	p := mustProject(t, st, ann.Id, "Board")
+	task := mustTask(t, st, p.Id, "Design", "todo")
+
+	watches := []*user.Watch{
+		{UserID: ann.Id, Kind: user.WatchProject, TargetID: p.Id, ProjectID: p.Id},
+		{UserID: ann.Id, Kind: user.WatchTask, TargetID: task.ID, ProjectID: p.Id},
+		{UserID: bob.Id, Kind: user.WatchTask, TargetID: task.ID, ProjectID: p.Id},
+		{UserID: bob.Id, Kind: user.WatchTask, TargetID: task.ID, ProjectID: p.Id}, // повторная подписка
+	}
+	for _, w := range watches {
+		if err := st.Watch(w); err != nil {
+			t.Fatalf("Watch: %v", err)
+		}
+	}
+
+	watchers, err := st.GetWatchers(p.Id, task.ID)
+	if err != nil {
+		t.Fatalf("GetWatchers: %v", err)
+	}
+	if len(watchers) != 2 || !containsID(watchers, ann.Id) || !containsID(watchers, bob.Id) {
+		t.Errorf("GetWatchers = %v, want [%s %s]", watchers, ann.Id, bob.Id)
+	}
+
+	if err := st.Unwatch(bob.Id, user.WatchTask, task.ID); err != nil {
+		t.Fatalf("Unwatch: %v", err)
+	}
+	watchers, err = st.GetWatchers(p.Id, task.ID)
+	if err != nil {
+		t.Fatalf("GetWatchers: %v", err)
+	}
+	if len(watchers) != 1 || watchers[0] != ann.Id {
+		t.Errorf("GetWatchers after unwatch = %v, want [%s]", watchers, ann.Id)
+	}
+
+	if err := st.Unwatch(bob.Id, user.WatchTask, task.ID); err == nil {
+		t.Error("Unwatch of missing watch: want error")
+	}
+	unknown := []*user.Watch{
+		{UserID: bob.Id, Kind: user.WatchProject, TargetID: ident.New(), ProjectID: ident.New()},
+		{UserID: bob.Id, Kind: user.WatchTask, TargetID: ident.New(), ProjectID: p.Id},
+		{UserID: bob.Id, Kind: user.WatchTask, TargetID: task.ID, ProjectID: ident.New()}, // задача чужого проекта
+	}
+	for _, w := range unknown {
+		if err := st.Watch(w); err == nil {
+			t.Errorf("Watch of unknown %s %s: want error", w.Kind, w.TargetID)
+		}
+	}
+}
+
+func testComments(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	task := mustTask(t, st, p.Id, "Design", "todo")
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	second := &project.Comment{AuthorID: u.Id, Text: "second", DateCreation: base.Add(time.Minute)}
+	first := &project.Comment{AuthorID: u.Id, Text: "first", DateCreation: base}
+	for _, cm := range []*project.Comment{second, first} {
+		if err := st.InsertComment(cm, p.Id, task.ID); err != nil {
+			t.Fatalf("InsertComment: %v", err)
+		}
+	}
+	comments, err := st.GetCommentsByTask(p.Id, task.ID)
+	if err != nil {
+		t.Fatalf("GetCommentsByTask: %v", err)
+	}
+	if len(comments) != 2 || comments[0].Text != "first" || comments[1].Text != "second" {
+		t.Errorf("GetCommentsByTask = %+v, want comments ordered by date", comments)
+	}
+	if err := st.InsertComment(&project.Comment{AuthorID: u.Id, Text: "lost"}, p.Id, ident.New()); err == nil {
+		t.Error("InsertComment for unknown task: want error")
+	}
+}
+
+func testWebhooks(t *testing.T, st storage.Storage) {
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+
+	w := &project.Webhook{URL: "https://example.com/hook", Secret: "s", Events: []string{"task.*"}, Active: true}
+	if err := st.InsertWebhook(w, p.Id); err != nil {
+		t.Fatalf("InsertWebhook: %v", err)
+	}
+	if err := st.UpdateWebhook(p.Id, w.Id, bson.M{"active": false}); err != nil {
+		t.Fatalf("UpdateWebhook: %v", err)
+	}
+	got, err := st.GetWebhook(p.Id, w.Id)
+	if err != nil || got == nil {
+		t.Fatalf("GetWebhook = %v, %v", got, err)
+	}
+	if got.Active || got.URL != w.URL || len(got.Events) != 1 || got.Events[0] != "task.*" {
+		t.Errorf("GetWebhook after update = %+v", got)
+	}
+	if got, err := st.GetWebhook(ident.New(), w.Id); err != nil || got != nil {
+		t.Errorf("GetWebhook from another project = %v, %v; want nil, nil", got, err)
+	}
+	if err := st.UpdateWebhook(p.Id, ident.New(), bson.M{"active": true}); err == nil {
+		t.Error("UpdateWebhook of unknown id: want error")
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	d := &project.WebhookDelivery{WebhookID: w.Id, ProjectID: p.Id, EventID: "e1", Event: "task.created",
+		Payload: "{}", Status: project.DeliveryPending, NextAttempt: now.Add(-time.Second)}
+	if err := st.InsertDelivery(d); err != nil {
+		t.Fatalf("InsertDelivery: %v", err)
+	}
+
+	claimed, err := st.ClaimDueDelivery(now, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimDueDelivery: %v", err)
+	}
+	if claimed == nil || claimed.Id != d.Id {
+		t.Fatalf("ClaimDueDelivery = %+v, want %s", claimed, d.Id)
+	}
+	if !sameTime(claimed.NextAttempt, now.Add(time.Minute)) {
+		t.Errorf("NextAttempt after claim = %v, want %v", claimed.NextAttempt, now.Add(time.Minute))
+	}
+	if again, err := st.ClaimDueDelivery(now, time.Minute); err != nil || again != nil {
+		t.Errorf("ClaimDueDelivery during lease = %v, %v; want nil, nil", again, err)
+	}
+
+	claimed.Status = project.DeliverySucceeded
+	claimed.Attempts = append(claimed.Attempts, project.DeliveryAttempt{At: now, StatusCode: 200})
+	if err := st.UpdateDelivery(claimed); err != nil {
+		t.Fatalf("UpdateDelivery: %v", err)
+	}
+	stored, err := st.GetDelivery(w.Id, d.Id)
+	if err != nil || stored == nil {
+		t.Fatalf("GetDelivery = %v, %v", stored, err)
+	}
+	if stored.Status != project.DeliverySucceeded || len(stored.Attempts) != 1 || stored.Attempts[0].StatusCode != 200 {
+		t.Errorf("GetDelivery after update = %+v", stored)
+	}
+	deliveries, err := st.GetDeliveries(w.Id, 10)
+	if err != nil {
+		t.Fatalf("GetDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Errorf("GetDeliveries returned %d deliveries, want 1", len(deliveries))
+	}
+
+	if err := st.DeleteWebhook(p.Id, w.Id); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+	if got, err := st.GetWebhook(p.Id, w.Id); err != nil || got != nil {
+		t.Errorf("GetWebhook after delete = %v, %v; want nil, nil", got, err)
+	}
+	hooks, err := st.GetWebhooksByProject(p.Id)
+	if err != nil {
+		t.Fatalf("GetWebhooksByProject: %v", err)
+	}
+	if len(hooks) != 0 {
+		t.Errorf("GetWebhooksByProject after delete returned %d webhooks", len(hooks))
+	}
+	if err := st.DeleteWebhook(p.Id, w.Id); err == nil {
+		t.Error("DeleteWebhook of deleted webhook: want error")
+	}
+}
+
+func testOutbox(t *testing.T, st storage.Storage) {
+	now := time.Now().Truncate(time.Millisecond)
+	payload, err := bson.Marshal(bson.M{"name": "Design"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRecord := func(notBefore time.Time) *event.Record {
+		r := &event.Record{Id: ident.New(), Type: "task.created", ProjectID: ident.New(), OccurredAt: now,
+			Payload: payload, Done: []string{}, NextAttempt: notBefore}
+		if err := st.InsertOutbox(r); err != nil {
+			t.Fatalf("InsertOutbox: %v", err)
+		}
+		return r
+	}
+	later := newRecord(now.Add(-time.Second))
+	first := newRecord(now.Add(-time.Minute))
+	newRecord(now.Add(time.Hour)) // ещё не пора
+
+	claimed, err := st.ClaimOutbox(now, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimOutbox: %v", err)
+	}
+	if claimed == nil || claimed.Id != first.Id {
+		t.Fatalf("ClaimOutbox = %+v, want the earliest record %s", claimed, first.Id)
+	}
+	if bson.Raw(claimed.Payload).Lookup("name").StringValue() != "Design" {
+		t.Errorf("claimed payload = %v", claimed.Payload)
+	}
+
+	claimed.Done = append(claimed.Done, "webhooks")
+	claimed.Attempts = 1
+	claimed.Failed = true
+	if err := st.UpdateOutbox(claimed); err != nil {
+		t.Fatalf("UpdateOutbox: %v", err)
+	}
+
+	// Запись, помеченная как неудавшаяся, больше не выдаётся
+	claimed, err = st.ClaimOutbox(now.Add(time.Hour), time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimOutbox: %v", err)
+	}
+	if claimed == nil || claimed.Id != later.Id {
+		t.Fatalf("ClaimOutbox = %+v, want %s", claimed, later.Id)
+	}
+	if err := st.DeleteOutbox(later.Id); err != nil {
+		t.Fatalf("DeleteOutbox: %v", err)
+	}
+
+	// Осталась только запись на будущее, и её очередь наступает через час
+	if claimed, err := st.ClaimOutbox(now, time.Minute); err != nil || claimed != nil {
+		t.Errorf("ClaimOutbox with nothing due = %v, %v; want nil, nil", claimed, err)
+	}
+}
+
+// parallel запускает fn из n горутин одновременно и собирает ошибки
+func parallel(t *testing.T, n int, fn func(i int) error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := fn(i); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func testConcurrentInsertTask(t *testing.T, st storage.Storage) {
+	const n = 20
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+
+	ids := make([]ident.ID, n)
+	parallel(t, n, func(i int) error {
+		task := project.NewTask(p.Id, fmt.Sprint("task ", i), "", 1, "", "", "", time.Time{}, "", "todo")
+		if err := st.InsertTask(task, p.Id); err != nil {
+			return err
+		}
+		ids[i] = task.ID
+		return nil
+	})
+
+	// Ни одна обратная ссылка не потеряна при одновременных вставках
+	got := mustGetProject(t, st, u.Id, p.Id)
+	if len(got.Tasks) != n {
+		t.Errorf("Project.Tasks has %d ids, want %d", len(got.Tasks), n)
+	}
+	for _, id := range ids {
+		if !containsID(got.Tasks, id) {
+			t.Errorf("Project.Tasks is missing %s", id)
+		}
+	}
+	tasks, err := st.GetTasksByProject(p.Id)
+	if err != nil {
+		t.Fatalf("GetTasksByProject: %v", err)
+	}
+	if len(tasks) != n {
+		t.Errorf("GetTasksByProject returned %d tasks, want %d", len(tasks), n)
+	}
+}
+
+func testConcurrentInsertProject(t *testing.T, st storage.Storage) {
+	const n = 20
+	u := mustUser(t, st, "Ann", "")
+
+	ids := make([]ident.ID, n)
+	parallel(t, n, func(i int) error {
+		p := project.NewProject(u.Id, fmt.Sprint("project ", i), "", 1, "", "", "", time.Time{}, "", nil, "open")
+		if err := st.InsertProject(p, u.Id); err != nil {
+			return err
+		}
+		ids[i] = p.Id
+		return nil
+	})
+
+	got := mustGetUser(t, st, u.Id)
+	if len(got.Projects) != n {
+		t.Errorf("User.Projects has %d ids, want %d", len(got.Projects), n)
+	}
+	for _, id := range ids {
+		if !containsID(got.Projects, id) {
+			t.Errorf("User.Projects is missing %s", id)
+		}
+	}
+}
+
+func testConcurrentReminders(t *testing.T, st storage.Storage) {
+	const n = 20
+	var mu sync.Mutex
+	sent := 0
+	parallel(t, n, func(int) error {
+		ok, err := st.MarkReminderSent("project:1:overdue")
+		if ok {
+			mu.Lock()
+			sent++
+			mu.Unlock()
+		}
+		return err
+	})
+	if sent != 1 {
+		t.Errorf("reminder marked as sent %d times, want 1", sent)
+	}
+}
+
+func testConcurrentClaimDelivery(t *testing.T, st storage.Storage) {
+	const deliveries, workers = 10, 20
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	w := &project.Webhook{URL: "https://example.com/hook", Events: []string{"*"}, Active: true}
+	if err := st.InsertWebhook(w, p.Id); err != nil {
+		t.Fatalf("InsertWebhook: %v", err)
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	for i := 0; i < deliveries; i++ {
+		d := &project.WebhookDelivery{WebhookID: w.Id, ProjectID: p.Id, EventID: fmt.Sprint("e", i),
+			Status: project.DeliveryPending, NextAttempt: now.Add(-time.Duration(i+1) * time.Second)}
+		if err := st.InsertDelivery(d); err != nil {
+			t.Fatalf("InsertDelivery: %v", err)
+		}
+	}
+
+	// Каждую доставку забирает ровно один обработчик
+	var mu sync.Mutex
+	claimed := make(map[ident.ID]int)
+	parallel(t, workers, func(int) error {
+		d, err := st.ClaimDueDelivery(now, time.Minute)
+		if d != nil {
+			mu.Lock()
+			claimed[d.Id]++
+			mu.Unlock()
+		}
+		return err
+	})
+	if len(claimed) != deliveries {
+		t.Errorf("claimed %d distinct deliveries, want %d", len(claimed), deliveries)
+	}
+	for id, n := range claimed {
+		if n != 1 {
+			t.Errorf("delivery %s claimed %d times", id, n)
+		}
+	}
+}
+
+func testConcurrentStartTimer(t *testing.T, st storage.Storage) {
+	const workers = 10
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	task := mustTask(t, st, p.Id, "Design", "todo")
+
+	// Из одновременных запусков проходит ровно один, остальные видят уже идущий таймер
+	var mu sync.Mutex
+	started := 0
+	parallel(t, workers, func(int) error {
+		_, err := st.StartTimer(p.Id, task.ID, u.Id)
+		if err != nil && err.Error() == "timer already running" {
+			return nil
+		}
+		if err == nil {
+			mu.Lock()
+			started++
+			mu.Unlock()
+		}
+		return err
+	})
+	if started != 1 {
+		t.Fatalf("started %d timers, want 1", started)
+	}
+
+	// Остановленный таймер не мешает запустить следующий
+	if _, err := st.StopTimer(p.Id, task.ID, u.Id, ""); err != nil {
+		t.Fatalf("StopTimer: %v", err)
+	}
+	if _, err := st.StartTimer(p.Id, task.ID, u.Id); err != nil {
+		t.Errorf("StartTimer after stop: %v", err)
+	}
+}
+
+func testConcurrentSpawnOccurrence(t *testing.T, st storage.Storage) {
+	const n = 10
+	u := mustUser(t, st, "Ann", "")
+	p := mustProject(t, st, u.Id, "Board")
+	task := project.NewTask(p.Id, "Standup", "", 1, "", "", "", time.Now().Add(-time.Hour), "", "todo")
+	task.Recurrence = &project.Recurrence{Rule: "FREQ=DAILY"}
+	if err := st.InsertTask(task, p.Id); err != nil {
+		t.Fatalf("InsertTask: %v", err)
+	}
+
+	// Несколько экземпляров сервера создают следующее вхождение один раз
+	var mu sync.Mutex
+	spawned := 0
+	parallel(t, n, func(int) error {
+		current := *task
+		recurrence := *task.Recurrence
+		current.Recurrence = &recurrence
+		next, err := st.SpawnOccurrence(&current)
+		if next != nil {
+			mu.Lock()
+			spawned++
+			mu.Unlock()
+		}
+		return err
+	})
+	if spawned != 1 {
+		t.Errorf("occurrence spawned %d times, want 1", spawned)
+	}
+	tasks, err := st.GetTasksByProject(p.Id)
+	if err != nil {
+		t.Fatalf("GetTasksByProject: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Errorf("GetTasksByProject returned %d tasks, want 2", len(tasks))
+	}
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"errors"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (m *MongoStorage) GetWebhooksByProject(projectId ident.ID) ([]project.Webhook, error) {
+	filter := bson.D{{Key: "projectId", Value: projectId}}
+
+	cursor, err := m.WebhookCollection.Find(m.opContext(), filter)
+	if err != nil {
+		return nil, err
+	}
+	webhooks := []project.Webhook{}
+	if err := cursor.All(m.opContext(), &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+func (m *MongoStorage) GetWebhook(projectId, webhookId ident.ID) (*project.Webhook, error) {
+	filter := bson.D{
+		{Key: "_id", Value: webhookId},
+		{Key: "projectId", Value: projectId},
+	}
+
+	var w project.Webhook
+	err := m.WebhookCollection.FindOne(m.opContext(), filter).Decode(&w)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &w, nil
+}
+func (m *MongoStorage) InsertWebhook(w *project.Webhook, projectId ident.ID) error {
+	w.Id = ident.New()
+	w.ProjectID = projectId
+	if w.DateCreation.IsZero() {
+		w.DateCreation = time.Now()
+	}
+
+	_, err := m.WebhookCollection.InsertOne(m.opContext(), w)
+	return err
+}
+func (m *MongoStorage) UpdateWebhook(projectId, webhookId ident.ID, updateFields bson.M) error {
+	filter := bson.D{
+		{Key: "_id", Value: webhookId},
+		{Key: "projectId", Value: projectId},
+	}
+	update := bson.D{{Key: "$set", Value: updateFields}}
+
+	res, err := m.WebhookCollection.UpdateOne(m.opContext(), filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("webhook not found")
+	}
+	return nil
+}
+func (m *MongoStorage) DeleteWebhook(projectId, webhookId ident.ID) error {
+	filter := bson.D{
+		{Key: "_id", Value: webhookId},
+		{Key: "projectId", Value: projectId},
+	}
+
+	res, err := m.WebhookCollection.DeleteOne(m.opContext(), filter)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errors.New("webhook not found")
+	}
+
+	// Журнал доставок удалённой подписки больше не нужен
+	_, err = m.DeliveryCollection.DeleteMany(m.opContext(), bson.D{{Key: "webhookId", Value: webhookId}})
+	return err
+}
+
+func (m *MongoStorage) InsertDelivery(d *project.WebhookDelivery) error {
+	d.Id = ident.New()
+	if d.DateCreation.IsZero() {
+		d.DateCreation = time.Now()
+	}
+
+	_, err := m.DeliveryCollection.InsertOne(m.opContext(), d)
+	return err
+}
+
+// UpdateDelivery сохраняет статус, журнал попыток и время следующей попытки
+func (m *MongoStorage) UpdateDelivery(d *project.WebhookDelivery) error {
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: d.Status},
+		{Key: "attempts", Value: d.Attempts},
+		{Key: "nextAttempt", Value: d.NextAttempt},
+	}}}
+
+	_, err := m.DeliveryCollection.UpdateOne(m.opContext(), bson.D{{Key: "_id", Value: d.Id}}, update)
+	return err
+}
+func (m *MongoStorage) GetDeliveries(webhookId ident.ID, limit int64) ([]project.WebhookDelivery, error) {
+	filter := bson.D{{Key: "webhookId", Value: webhookId}}
+	opts := options.Find().SetSort(bson.D{{Key: "dateCreation", Value: -1}}).SetLimit(limit)
+
+	cursor, err := m.DeliveryCollection.Find(m.opContext(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []project.WebhookDelivery{}
+	if err := cursor.All(m.opContext(), &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+func (m *MongoStorage) GetDelivery(webhookId, deliveryId ident.ID) (*project.WebhookDelivery, error) {
+	filter := bson.D{
+		{Key: "_id", Value: deliveryId},
+		{Key: "webhookId", Value: webhookId},
+	}
+
+	var d project.WebhookDelivery
+	err := m.DeliveryCollection.FindOne(m.opContext(), filter).Decode(&d)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ClaimDueDelivery забирает одну доставку, чья попытка назначена не позже now, и откладывает
+// её следующую попытку на lease, чтобы другой экземпляр сервера не взял её одновременно.
+// nil — доставлять нечего.
+func (m *MongoStorage) ClaimDueDelivery(now time.Time, lease time.Duration) (*project.WebhookDelivery, error) {
+	filter := bson.D{
+		{Key: "status", Value: project.DeliveryPending},
+		{Key: "nextAttempt", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "nextAttempt", Value: now.Add(lease)}}}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttempt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var d project.WebhookDelivery
+	err := m.DeliveryCollection.FindOneAndUpdate(m.opContext(), filter, update, opts).Decode(&d)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
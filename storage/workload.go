@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"tmv/project"
+	"tmv/report"
+)
+
+// aggregateWorkload считает нагрузку по задачам так же, как конвейер MongoDB в reports.go.
+// Им пользуются хранилища, которые не могут выразить разбор performers и ролей запросом.
+func aggregateWorkload(tasks []project.Task, from, to time.Time, interval string, now time.Time) []report.Workload {
+	byUser := make(map[string]*report.Workload)
+	buckets := make(map[string]map[string]*report.WorkloadBucket)
+	epoch := time.Unix(0, 0)
+	for i := range tasks {
+		t := &tasks[i]
+		if project.IsTerminal(t.Status) {
+			continue
+		}
+
+		hasDeadline := t.Deadline.After(epoch)
+		weight := float64(t.Priority)
+		if weight < 1 {
+			weight = 1
+		}
+		if t.Estimate > 0 {
+			weight *= t.Estimate
+		}
+		overdue := 0
+		if hasDeadline && t.Deadline.Before(now) {
+			overdue = 1
+		}
+		period := ""
+		if hasDeadline && !t.Deadline.Before(from) && !t.Deadline.After(to) {
+			period = workloadPeriod(t.Deadline, interval)
+		}
+
+		// Пользователь, который одновременно ответственный и исполнитель, считается один раз
+		for name, roles := range taskAssignees(t) {
+			w, ok := byUser[name]
+			if !ok {
+				w = &report.Workload{User: name, Breakdown: []report.WorkloadBucket{}}
+				byUser[name] = w
+				buckets[name] = make(map[string]*report.WorkloadBucket)
+			}
+			w.OpenTasks++
+			if roles.responsible {
+				w.Responsible++
+			}
+			if roles.performer {
+				w.Performer++
+			}
+			w.Estimate += t.Estimate
+			w.Weighted += weight
+			w.Overdue += overdue
+
+			if period == "" {
+				continue
+			}
+			b, ok := buckets[name][period]
+			if !ok {
+				b = &report.WorkloadBucket{Period: period}
+				buckets[name][period] = b
+			}
+			b.Tasks++
+			b.Weighted += weight
+			b.Overdue += overdue
+		}
+	}
+
+	workloads := make([]report.Workload, 0, len(byUser))
+	for name, w := range byUser {
+		for _, b := range buckets[name] {
+			w.Breakdown = append(w.Breakdown, *b)
+		}
+		w.SortBuckets()
+		workloads = append(workloads, *w)
+	}
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].Weighted != workloads[j].Weighted {
+			return workloads[i].Weighted > workloads[j].Weighted
+		}
+		return workloads[i].User < workloads[j].User
+	})
+	return workloads
+}
+
+type assigneeRoles struct {
+	responsible bool
+	performer   bool
+}
+
+// taskAssignees разбирает ответственного и исполнителей (строка через запятую)
+func taskAssignees(t *project.Task) map[string]assigneeRoles {
+	assignees := make(map[string]assigneeRoles)
+	if name := strings.TrimSpace(t.Responsible); name != "" {
+		assignees[name] = assigneeRoles{responsible: true}
+	}
+	for _, p := range strings.Split(t.Performers, ",") {
+		if name := strings.TrimSpace(p); name != "" {
+			roles := assignees[name]
+			roles.performer = true
+			assignees[name] = roles
+		}
+	}
+	return assignees
+}
+
+// workloadPeriod повторяет форматы report.PeriodFormat; $dateToString в MongoDB работает в UTC
+func workloadPeriod(t time.Time, interval string) string {
+	t = t.UTC()
+	switch interval {
+	case report.IntervalDay:
+		return t.Format("2006-01-02")
+	case report.IntervalWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return t.Format("2006-01")
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"tmv/ident"
+	"tmv/project"
+	"tmv/report"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (m *MongoStorage) GetWorklogsByTask(projectId, taskId ident.ID) ([]project.Worklog, error) {
+	var worklogs []project.Worklog
+	filter := bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "taskId", Value: taskId},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "started", Value: 1}})
+
+	cursor, err := m.WorklogCollection.Find(m.opContext(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(m.opContext())
+
+	for cursor.Next(m.opContext()) {
+		var w project.Worklog
+		if err := cursor.Decode(&w); err != nil {
+			return nil, err
+		}
+		worklogs = append(worklogs, w)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return worklogs, nil
+}
+func (m *MongoStorage) InsertWorklog(w *project.Worklog, projectId, taskId ident.ID) error {
+	if err := m.checkTask(projectId, taskId); err != nil {
+		return err
+	}
+
+	w.Id = ident.New()
+	w.ProjectID = projectId
+	w.TaskID = taskId
+	w.Running = false
+	if w.DateCreation.IsZero() {
+		w.DateCreation = time.Now()
+	}
+
+	// Списанное время уменьшает оставшуюся оценку задачи; запись хранит, сколько списала
+	consumed, err := m.consumeRemaining(taskId, w.Hours())
+	if err != nil {
+		return err
+	}
+	w.Consumed = consumed
+
+	if _, err := m.WorklogCollection.InsertOne(m.opContext(), w); err != nil {
+		return m.undoConsume(taskId, consumed, err)
+	}
+	return nil
+}
+func (m *MongoStorage) DeleteWorklog(projectId, taskId, worklogId ident.ID) error {
+	filter := bson.D{
+		{Key: "_id", Value: worklogId},
+		{Key: "projectId", Value: projectId},
+		{Key: "taskId", Value: taskId},
+	}
+
+	var w project.Worklog
+	err := m.WorklogCollection.FindOneAndDelete(m.opContext(), filter).Decode(&w)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.New("worklog not found")
+		}
+		return err
+	}
+
+	// Возвращаем в оставшуюся оценку то, что запись с неё списала
+	return m.restoreRemaining(taskId, w.Consumed)
+}
+func (m *MongoStorage) StartTimer(projectId, taskId, userId ident.ID) (*project.Worklog, error) {
+	if err := m.checkTask(projectId, taskId); err != nil {
+		return nil, err
+	}
+
+	w := project.NewWorklog(projectId, taskId, userId, time.Now(), 0, "")
+	w.Ended = time.Time{}
+	w.Running = true
+
+	// У пользователя может идти только один таймер: второй не пропускает индекс userId_running_unique
+	_, err := m.WorklogCollection.InsertOne(m.opContext(), w)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, errors.New("timer already running")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+func (m *MongoStorage) StopTimer(projectId, taskId, userId ident.ID, note string) (*project.Worklog, error) {
+	filter := bson.D{
+		{Key: "projectId", Value: projectId},
+		{Key: "taskId", Value: taskId},
+		{Key: "userId", Value: userId},
+		{Key: "running", Value: true},
+	}
+
+	var w project.Worklog
+	err := m.WorklogCollection.FindOne(m.opContext(), filter).Decode(&w)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("timer not running")
+		}
+		return nil, err
+	}
+
+	w.Ended = time.Now()
+	w.Duration = int64(w.Ended.Sub(w.Started) / time.Second)
+	w.Running = false
+	if note != "" {
+		w.Note = note
+	}
+	if w.Consumed, err = m.consumeRemaining(taskId, w.Hours()); err != nil {
+		return nil, err
+	}
+
+	// Фильтр по running защищает от двойной остановки
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "ended", Value: w.Ended},
+		{Key: "duration", Value: w.Duration},
+		{Key: "running", Value: false},
+		{Key: "note", Value: w.Note},
+		{Key: "consumed", Value: w.Consumed},
+	}}}
+	res, err := m.WorklogCollection.UpdateOne(m.opContext(), bson.D{
+		{Key: "_id", Value: w.Id},
+		{Key: "running", Value: true},
+	}, update)
+	if err == nil && res.ModifiedCount == 0 {
+		err = errors.New("timer not running")
+	}
+	if err != nil {
+		return nil, m.undoConsume(taskId, w.Consumed, err)
+	}
+	return &w, nil
+}
+
+// GetTimeReport суммирует завершённые записи по пользователю и задаче.
+// Нулевые projectId и userId означают отсутствие фильтра.
+func (m *MongoStorage) GetTimeReport(projectId, userId ident.ID, from, to time.Time) ([]report.TimeSpent, error) {
+	match := bson.D{
+		{Key: "running", Value: false},
+		{Key: "started", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lte", Value: to}}},
+	}
+	if !projectId.IsZero() {
+		match = append(match, bson.E{Key: "projectId", Value: projectId})
+	}
+	if !userId.IsZero() {
+		match = append(match, bson.E{Key: "userId", Value: userId})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "userId", Value: "$userId"},
+				{Key: "projectId", Value: "$projectId"},
+				{Key: "taskId", Value: "$taskId"},
+			}},
+			{Key: "seconds", Value: bson.D{{Key: "$sum", Value: "$duration"}}},
+			{Key: "entries", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: m.UserCollection.Name()},
+			{Key: "localField", Value: "_id.userId"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "user"},
+		}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: m.TaskCollection.Name()},
+			{Key: "localField", Value: "_id.taskId"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "task"},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "userId", Value: "$_id.userId"},
+			{Key: "projectId", Value: "$_id.projectId"},
+			{Key: "taskId", Value: "$_id.taskId"},
+			{Key: "userName", Value: bson.D{{Key: "$ifNull", Value: bson.A{bson.D{{Key: "$arrayElemAt", Value: bson.A{"$user.name", 0}}}, ""}}}},
+			{Key: "taskName", Value: bson.D{{Key: "$ifNull", Value: bson.A{bson.D{{Key: "$arrayElemAt", Value: bson.A{"$task.name", 0}}}, ""}}}},
+			{Key: "seconds", Value: 1},
+			{Key: "entries", Value: 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "userName", Value: 1}, {Key: "seconds", Value: -1}}}},
+	}
+
+	cursor, err := m.WorklogCollection.Aggregate(m.opContext(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	rows := []report.TimeSpent{}
+	if err := cursor.All(m.opContext(), &rows); err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Hours = float64(rows[i].Seconds) / 3600
+	}
+	return rows, nil
+}
+
+func (m *MongoStorage) checkTask(projectId, taskId ident.ID) error {
+	task, err := m.GetTask(projectId, taskId)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return errors.New("task not found")
+	}
+	return nil
+}
+
+// consumeRemaining уменьшает оставшуюся оценку на hours, не опуская её ниже нуля, и возвращает,
+// сколько часов списано на самом деле
+func (m *MongoStorage) consumeRemaining(taskId ident.ID, hours float64) (float64, error) {
+	if hours <= 0 {
+		return 0, nil
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: "remaining", Value: bson.D{{Key: "$max", Value: bson.A{
+		0,
+		bson.D{{Key: "$subtract", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$remaining", 0}}}, hours}}},
+	}}}}}}}}
+	opts := options.FindOneAndUpdate().
+		SetProjection(bson.D{{Key: "remaining", Value: 1}}).
+		SetReturnDocument(options.Before)
+
+	// Остаток до обновления показывает, сколько из hours поместилось
+	var before struct {
+		Remaining float64 `bson:"remaining"`
+	}
+	err := m.TaskCollection.FindOneAndUpdate(m.opContext(), bson.D{{Key: "_id", Value: taskId}}, update, opts).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return math.Min(math.Max(before.Remaining, 0), hours), nil
+}
+
+// restoreRemaining возвращает в оставшуюся оценку часы, которые списала удалённая запись
+func (m *MongoStorage) restoreRemaining(taskId ident.ID, hours float64) error {
+	if hours <= 0 {
+		return nil
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "remaining", Value: hours}}}}
+	_, err := m.TaskCollection.UpdateOne(m.opContext(), bson.D{{Key: "_id", Value: taskId}}, update)
+	return err
+}
+
+// undoConsume возвращает списанное, когда запись так и не сохранилась, и отдаёт исходную ошибку
+func (m *MongoStorage) undoConsume(taskId ident.ID, hours float64, err error) error {
+	if restoreErr := m.restoreRemaining(taskId, hours); restoreErr != nil {
+		return fmt.Errorf("%w; restore remaining: %v", err, restoreErr)
+	}
+	return err
+}
@@ -0,0 +1,489 @@
+package tracing
+
+import (
+	"context"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+	"tmv/logging"
+	"tmv/project"
+	"tmv/report"
+	"tmv/storage"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracedStorage — декоратор Storage, который открывает span на каждый вызов метода
+// и пишет неудачные вызовы в журнал запроса (с его request_id).
+// Вложенное хранилище привязывается к контексту span-а, поэтому команды MongoDB
+// и события, записанные внутри вызова, становятся его потомками.
+// Span-ы пишутся только после WithContext: фоновые опросы без запроса не засоряют трассы.
+type TracedStorage struct {
+	storage.Storage
+	ctx context.Context
+}
+
+func NewTracedStorage(inner storage.Storage) *TracedStorage {
+	return &TracedStorage{Storage: inner}
+}
+
+// WithContext возвращает копию, span-ы которой становятся потомками span-а из ctx
+func (tr *TracedStorage) WithContext(ctx context.Context) storage.Storage {
+	return &TracedStorage{Storage: tr.Storage, ctx: ctx}
+}
+
+type call struct {
+	ctx    context.Context
+	span   trace.Span
+	method string
+}
+
+func (tr *TracedStorage) start(method string) (*call, storage.Storage) {
+	if tr.ctx == nil {
+		return nil, tr.Storage
+	}
+	ctx, span := tracer.Start(tr.ctx, "storage."+method, trace.WithAttributes(attribute.String("storage.method", method)))
+	return &call{ctx: ctx, span: span, method: method}, storage.WithContext(tr.Storage, ctx)
+}
+
+func (c *call) end(err error) {
+	if c == nil {
+		return
+	}
+	if err != nil {
+		c.span.RecordError(err)
+		c.span.SetStatus(codes.Error, err.Error())
+		logging.FromContext(c.ctx).Warn("storage call failed", "method", c.method, "error", err)
+	}
+	c.span.End()
+}
+
+func (tr *TracedStorage) GetAllUsers() map[ident.ID]user.User {
+	call, inner := tr.start("GetAllUsers")
+	res := inner.GetAllUsers()
+	call.end(nil)
+	return res
+}
+func (tr *TracedStorage) GetUser(userId ident.ID) (user.User, error) {
+	call, inner := tr.start("GetUser")
+	res, err := inner.GetUser(userId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) InsertUser(u *user.User) error {
+	call, inner := tr.start("InsertUser")
+	err := inner.InsertUser(u)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) UpdateUser(userId ident.ID, e *user.User) error {
+	call, inner := tr.start("UpdateUser")
+	err := inner.UpdateUser(userId, e)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) DeleteUser(userId ident.ID) error {
+	call, inner := tr.start("DeleteUser")
+	err := inner.DeleteUser(userId)
+	call.end(err)
+	return err
+}
+
+func (tr *TracedStorage) GetAllProjects() map[ident.ID]project.Project {
+	call, inner := tr.start("GetAllProjects")
+	res := inner.GetAllProjects()
+	call.end(nil)
+	return res
+}
+func (tr *TracedStorage) GetProject(userId, projectId ident.ID) (*project.Project, error) {
+	call, inner := tr.start("GetProject")
+	res, err := inner.GetProject(userId, projectId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) GetProjectByUser(userId ident.ID) ([]project.Project, error) {
+	call, inner := tr.start("GetProjectByUser")
+	res, err := inner.GetProjectByUser(userId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) InsertProject(p *project.Project, userId ident.ID) error {
+	call, inner := tr.start("InsertProject")
+	err := inner.InsertProject(p, userId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) UpdateProject(projectID ident.ID, updateFields bson.M) error {
+	call, inner := tr.start("UpdateProject")
+	err := inner.UpdateProject(projectID, updateFields)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) DeleteProject(projectId ident.ID) error {
+	call, inner := tr.start("DeleteProject")
+	err := inner.DeleteProject(projectId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) DeleteProjects(userID ident.ID, projectIDs []ident.ID) error {
+	call, inner := tr.start("DeleteProjects")
+	err := inner.DeleteProjects(userID, projectIDs)
+	call.end(err)
+	return err
+}
+
+func (tr *TracedStorage) GetAllTasks() map[ident.ID]project.Task {
+	call, inner := tr.start("GetAllTasks")
+	res := inner.GetAllTasks()
+	call.end(nil)
+	return res
+}
+func (tr *TracedStorage) InsertTask(t *project.Task, projectId ident.ID) error {
+	call, inner := tr.start("InsertTask")
+	err := inner.InsertTask(t, projectId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) GetTasksByProject(projectId ident.ID) ([]project.Task, error) {
+	call, inner := tr.start("GetTasksByProject")
+	res, err := inner.GetTasksByProject(projectId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) GetTask(projectId, taskId ident.ID) (*project.Task, error) {
+	call, inner := tr.start("GetTask")
+	res, err := inner.GetTask(projectId, taskId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) DeleteTasks(projectId ident.ID, taskIds []ident.ID) error {
+	call, inner := tr.start("DeleteTasks")
+	err := inner.DeleteTasks(projectId, taskIds)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) UpdateTask(projectId, taskId ident.ID, updateFields bson.M) error {
+	call, inner := tr.start("UpdateTask")
+	err := inner.UpdateTask(projectId, taskId, updateFields)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) InsertTasks(tasks []*project.Task, projectId ident.ID) ([]error, error) {
+	call, inner := tr.start("InsertTasks")
+	res, err := inner.InsertTasks(tasks, projectId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) UpdateTasks(projectId ident.ID, updates []storage.TaskUpdate) ([]error, error) {
+	call, inner := tr.start("UpdateTasks")
+	res, err := inner.UpdateTasks(projectId, updates)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) DeleteTask(projectId, taskId ident.ID) error {
+	call, inner := tr.start("DeleteTask")
+	err := inner.DeleteTask(projectId, taskId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) MoveTask(projectId, taskId ident.ID, status string, position int) error {
+	call, inner := tr.start("MoveTask")
+	err := inner.MoveTask(projectId, taskId, status, position)
+	call.end(err)
+	return err
+}
+
+func (tr *TracedStorage) GetSprintsByProject(projectId ident.ID) ([]project.Sprint, error) {
+	call, inner := tr.start("GetSprintsByProject")
+	res, err := inner.GetSprintsByProject(projectId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) GetSprint(projectId, sprintId ident.ID) (*project.Sprint, error) {
+	call, inner := tr.start("GetSprint")
+	res, err := inner.GetSprint(projectId, sprintId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) InsertSprint(s *project.Sprint, projectId ident.ID) error {
+	call, inner := tr.start("InsertSprint")
+	err := inner.InsertSprint(s, projectId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) UpdateSprint(projectId, sprintId ident.ID, updateFields bson.M) error {
+	call, inner := tr.start("UpdateSprint")
+	err := inner.UpdateSprint(projectId, sprintId, updateFields)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) DeleteSprint(projectId, sprintId ident.ID) error {
+	call, inner := tr.start("DeleteSprint")
+	err := inner.DeleteSprint(projectId, sprintId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) StartSprint(projectId, sprintId ident.ID) error {
+	call, inner := tr.start("StartSprint")
+	err := inner.StartSprint(projectId, sprintId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) CloseSprint(projectId, sprintId, nextSprintId ident.ID) (int64, error) {
+	call, inner := tr.start("CloseSprint")
+	res, err := inner.CloseSprint(projectId, sprintId, nextSprintId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) AssignTasksToSprint(projectId, sprintId ident.ID, taskIds []ident.ID) error {
+	call, inner := tr.start("AssignTasksToSprint")
+	err := inner.AssignTasksToSprint(projectId, sprintId, taskIds)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) GetTasksBySprint(projectId, sprintId ident.ID) ([]project.Task, error) {
+	call, inner := tr.start("GetTasksBySprint")
+	res, err := inner.GetTasksBySprint(projectId, sprintId)
+	call.end(err)
+	return res, err
+}
+
+func (tr *TracedStorage) GetWorkload(projectId ident.ID, from, to time.Time, interval string) ([]report.Workload, error) {
+	call, inner := tr.start("GetWorkload")
+	res, err := inner.GetWorkload(projectId, from, to, interval)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) GetTotals(now time.Time) (*report.Totals, error) {
+	call, inner := tr.start("GetTotals")
+	res, err := inner.GetTotals(now)
+	call.end(err)
+	return res, err
+}
+
+func (tr *TracedStorage) GetWorklogsByTask(projectId, taskId ident.ID) ([]project.Worklog, error) {
+	call, inner := tr.start("GetWorklogsByTask")
+	res, err := inner.GetWorklogsByTask(projectId, taskId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) InsertWorklog(w *project.Worklog, projectId, taskId ident.ID) error {
+	call, inner := tr.start("InsertWorklog")
+	err := inner.InsertWorklog(w, projectId, taskId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) DeleteWorklog(projectId, taskId, worklogId ident.ID) error {
+	call, inner := tr.start("DeleteWorklog")
+	err := inner.DeleteWorklog(projectId, taskId, worklogId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) StartTimer(projectId, taskId, userId ident.ID) (*project.Worklog, error) {
+	call, inner := tr.start("StartTimer")
+	res, err := inner.StartTimer(projectId, taskId, userId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) StopTimer(projectId, taskId, userId ident.ID, note string) (*project.Worklog, error) {
+	call, inner := tr.start("StopTimer")
+	res, err := inner.StopTimer(projectId, taskId, userId, note)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) GetTimeReport(projectId, userId ident.ID, from, to time.Time) ([]report.TimeSpent, error) {
+	call, inner := tr.start("GetTimeReport")
+	res, err := inner.GetTimeReport(projectId, userId, from, to)
+	call.end(err)
+	return res, err
+}
+
+func (tr *TracedStorage) GetRecurringTasks() ([]project.Task, error) {
+	call, inner := tr.start("GetRecurringTasks")
+	res, err := inner.GetRecurringTasks()
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) SpawnOccurrence(t *project.Task) (*project.Task, error) {
+	call, inner := tr.start("SpawnOccurrence")
+	res, err := inner.SpawnOccurrence(t)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) SetTaskRecurrence(projectId, taskId ident.ID, rule string) error {
+	call, inner := tr.start("SetTaskRecurrence")
+	err := inner.SetTaskRecurrence(projectId, taskId, rule)
+	call.end(err)
+	return err
+}
+
+func (tr *TracedStorage) InsertNotification(n *user.Notification) error {
+	call, inner := tr.start("InsertNotification")
+	err := inner.InsertNotification(n)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) GetTasksDueBefore(t time.Time) ([]project.Task, error) {
+	call, inner := tr.start("GetTasksDueBefore")
+	res, err := inner.GetTasksDueBefore(t)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) GetProjectsDueBefore(t time.Time) ([]project.Project, error) {
+	call, inner := tr.start("GetProjectsDueBefore")
+	res, err := inner.GetProjectsDueBefore(t)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) MarkReminderSent(key string) (bool, error) {
+	call, inner := tr.start("MarkReminderSent")
+	res, err := inner.MarkReminderSent(key)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) GetNotifications(userId ident.ID, unreadOnly bool, offset, limit int64) ([]user.Notification, int64, error) {
+	call, inner := tr.start("GetNotifications")
+	res1, res2, err := inner.GetNotifications(userId, unreadOnly, offset, limit)
+	call.end(err)
+	return res1, res2, err
+}
+func (tr *TracedStorage) CountUnreadNotifications(userId ident.ID) (int64, error) {
+	call, inner := tr.start("CountUnreadNotifications")
+	res, err := inner.CountUnreadNotifications(userId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) MarkNotificationRead(userId, notificationId ident.ID) error {
+	call, inner := tr.start("MarkNotificationRead")
+	err := inner.MarkNotificationRead(userId, notificationId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) MarkAllNotificationsRead(userId ident.ID) (int64, error) {
+	call, inner := tr.start("MarkAllNotificationsRead")
+	res, err := inner.MarkAllNotificationsRead(userId)
+	call.end(err)
+	return res, err
+}
+
+func (tr *TracedStorage) Watch(w *user.Watch) error {
+	call, inner := tr.start("Watch")
+	err := inner.Watch(w)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) Unwatch(userId ident.ID, kind string, targetId ident.ID) error {
+	call, inner := tr.start("Unwatch")
+	err := inner.Unwatch(userId, kind, targetId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) GetWatchers(projectId, taskId ident.ID) ([]ident.ID, error) {
+	call, inner := tr.start("GetWatchers")
+	res, err := inner.GetWatchers(projectId, taskId)
+	call.end(err)
+	return res, err
+}
+
+func (tr *TracedStorage) InsertComment(cm *project.Comment, projectId, taskId ident.ID) error {
+	call, inner := tr.start("InsertComment")
+	err := inner.InsertComment(cm, projectId, taskId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) GetCommentsByTask(projectId, taskId ident.ID) ([]project.Comment, error) {
+	call, inner := tr.start("GetCommentsByTask")
+	res, err := inner.GetCommentsByTask(projectId, taskId)
+	call.end(err)
+	return res, err
+}
+
+func (tr *TracedStorage) GetWebhooksByProject(projectId ident.ID) ([]project.Webhook, error) {
+	call, inner := tr.start("GetWebhooksByProject")
+	res, err := inner.GetWebhooksByProject(projectId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) GetWebhook(projectId, webhookId ident.ID) (*project.Webhook, error) {
+	call, inner := tr.start("GetWebhook")
+	res, err := inner.GetWebhook(projectId, webhookId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) InsertWebhook(w *project.Webhook, projectId ident.ID) error {
+	call, inner := tr.start("InsertWebhook")
+	err := inner.InsertWebhook(w, projectId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) UpdateWebhook(projectId, webhookId ident.ID, updateFields bson.M) error {
+	call, inner := tr.start("UpdateWebhook")
+	err := inner.UpdateWebhook(projectId, webhookId, updateFields)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) DeleteWebhook(projectId, webhookId ident.ID) error {
+	call, inner := tr.start("DeleteWebhook")
+	err := inner.DeleteWebhook(projectId, webhookId)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) InsertDelivery(d *project.WebhookDelivery) error {
+	call, inner := tr.start("InsertDelivery")
+	err := inner.InsertDelivery(d)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) UpdateDelivery(d *project.WebhookDelivery) error {
+	call, inner := tr.start("UpdateDelivery")
+	err := inner.UpdateDelivery(d)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) GetDeliveries(webhookId ident.ID, limit int64) ([]project.WebhookDelivery, error) {
+	call, inner := tr.start("GetDeliveries")
+	res, err := inner.GetDeliveries(webhookId, limit)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) GetDelivery(webhookId, deliveryId ident.ID) (*project.WebhookDelivery, error) {
+	call, inner := tr.start("GetDelivery")
+	res, err := inner.GetDelivery(webhookId, deliveryId)
+	call.end(err)
+	return res, err
+}
+func (tr *TracedStorage) ClaimDueDelivery(now time.Time, lease time.Duration) (*project.WebhookDelivery, error) {
+	call, inner := tr.start("ClaimDueDelivery")
+	res, err := inner.ClaimDueDelivery(now, lease)
+	call.end(err)
+	return res, err
+}
+
+func (tr *TracedStorage) InsertOutbox(r *event.Record) error {
+	call, inner := tr.start("InsertOutbox")
+	err := inner.InsertOutbox(r)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) UpdateOutbox(r *event.Record) error {
+	call, inner := tr.start("UpdateOutbox")
+	err := inner.UpdateOutbox(r)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) DeleteOutbox(id ident.ID) error {
+	call, inner := tr.start("DeleteOutbox")
+	err := inner.DeleteOutbox(id)
+	call.end(err)
+	return err
+}
+func (tr *TracedStorage) ClaimOutbox(now time.Time, lease time.Duration) (*event.Record, error) {
+	call, inner := tr.start("ClaimOutbox")
+	res, err := inner.ClaimOutbox(now, lease)
+	call.end(err)
+	return res, err
+}
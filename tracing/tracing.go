@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"tmv/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var tracer = otel.Tracer("tmv/storage")
+
+// Setup настраивает глобальный TracerProvider и распространение контекста W3C Trace Context.
+// Экспортёр задаётся настройкой tracing.exporter (или OTEL_TRACES_EXPORTER):
+//   - otlp — OTLP/HTTP, адрес и заголовки из стандартных OTEL_EXPORTER_OTLP_*;
+//   - console (или stdout) — span-ы печатаются в stdout для локальной отладки;
+//   - none или пусто — span-ы не записываются, но traceparent по-прежнему передаётся дальше.
+//
+// Возвращённая функция выгружает накопленные span-ы и должна быть вызвана при остановке.
+func Setup(ctx context.Context, cfg config.Tracing) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name := strings.ToLower(cfg.Exporter); name {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "console", "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// OTEL_RESOURCE_ATTRIBUTES дополняет описание сервиса
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", cfg.ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,41 @@
+package user
+
+import (
+	"time"
+	"tmv/ident"
+)
+
+// Каналы доставки уведомлений
+const (
+	ChannelInApp   = "inapp"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// Notification — запись во входящих пользователя
+type Notification struct {
+	Id           ident.ID  `bson:"_id,omitempty" json:"id"`
+	UserID       ident.ID  `bson:"userId" json:"userId"`             // Получатель
+	Kind         string    `bson:"kind" json:"kind"`                 // Тип события, например task.overdue
+	Title        string    `bson:"title" json:"title"`               // Заголовок
+	Message      string    `bson:"message" json:"message"`           // Текст
+	ProjectID    ident.ID  `bson:"projectId" json:"projectId"`       // Связанный проект
+	TaskID       ident.ID  `bson:"taskId" json:"taskId"`             // Связанная задача
+	Read         bool      `bson:"read" json:"read"`                 // Прочитано
+	DateCreation time.Time `bson:"dateCreation" json:"dateCreation"` // Дата создания
+}
+
+// NotificationPrefs — настройки уведомлений пользователя
+type NotificationPrefs struct {
+	Disabled   bool     `bson:"disabled" json:"disabled"`     // Не присылать напоминания о сроках
+	Channels   []string `bson:"channels" json:"channels"`     // inapp, email, webhook; пусто — только inapp
+	WebhookURL string   `bson:"webhookUrl" json:"webhookUrl"` // Адрес для канала webhook
+}
+
+// NotificationChannels возвращает каналы доставки с учётом значения по умолчанию
+func (u *User) NotificationChannels() []string {
+	if len(u.Notifications.Channels) == 0 {
+		return []string{ChannelInApp}
+	}
+	return u.Notifications.Channels
+}
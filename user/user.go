@@ -1,18 +1,20 @@
 package user
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import "tmv/ident"
 
 type User struct {
-	Id       primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	Name     string               `bson:"name" json:"name"`
-	Work     string               `bson:"work" json:"work"`
-	Age      int                  `bson:"age" json:"age"`
-	Salary   int                  `bson:"salary" json:"salary"`
-	Email    string               `bson:"email" json:"email"`
-	Projects []primitive.ObjectID `bson:"projects" json:"projects"`
+	Id       ident.ID   `bson:"_id,omitempty" json:"id"`
+	Name     string     `bson:"name" json:"name"`
+	Work     string     `bson:"work" json:"work"`
+	Age      int        `bson:"age" json:"age"`
+	Salary   int        `bson:"salary" json:"salary"`
+	Email    string     `bson:"email" json:"email"`
+	Projects []ident.ID `bson:"projects" json:"projects"`
+
+	Notifications NotificationPrefs `bson:"notifications" json:"notifications"`
 }
 
-func NewUser(name, work string, age, salary int, email string, projects []primitive.ObjectID) *User {
+func NewUser(name, work string, age, salary int, email string, projects []ident.ID) *User {
 	return &User{
 		Name:     name,
 		Work:     work,
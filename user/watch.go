@@ -0,0 +1,22 @@
+package user
+
+import (
+	"time"
+	"tmv/ident"
+)
+
+// Что можно отслеживать
+const (
+	WatchProject = "project"
+	WatchTask    = "task"
+)
+
+// Watch — подписка пользователя на события проекта или задачи
+type Watch struct {
+	Id           ident.ID  `bson:"_id,omitempty" json:"id"`
+	UserID       ident.ID  `bson:"userId" json:"userId"`             // Подписчик
+	Kind         string    `bson:"kind" json:"kind"`                 // project или task
+	TargetID     ident.ID  `bson:"targetId" json:"targetId"`         // Проект или задача
+	ProjectID    ident.ID  `bson:"projectId" json:"projectId"`       // Проект цели
+	DateCreation time.Time `bson:"dateCreation" json:"dateCreation"` // Дата подписки
+}
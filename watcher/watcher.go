@@ -0,0 +1,295 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+	"tmv/logging"
+	"tmv/project"
+	"tmv/storage"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Сущности, изменения которых отслеживаются
+const (
+	KindUser    = "user"
+	KindProject = "project"
+	KindTask    = "task"
+)
+
+// Коды ошибок сервера, после которых продолжить поток по токену нельзя
+const (
+	codeHistoryLost = 286 // ChangeStreamHistoryLost: токен вытеснен из oplog
+	codeFatal       = 280 // ChangeStreamFatalError
+)
+
+// Change — изменение документа, замеченное в change stream любого экземпляра сервера
+type Change struct {
+	Kind      string   // user, project или task
+	Operation string   // insert, update, replace или delete
+	ID        ident.ID // _id документа
+	ProjectID ident.ID // Проект задачи или сам проект; нулевой для пользователей и удалений без pre-image
+	Document  bson.Raw // Документ после изменения, для delete — pre-image, если он доступен
+	Updated   bson.M   // Изменённые поля для update
+	At        time.Time
+}
+
+// Watcher читает change streams коллекций пользователей, проектов и задач.
+// Токены продолжения хранятся отдельно для каждого экземпляра, поэтому после
+// перезапуска экземпляр получает изменения, сделанные, пока он был выключен.
+// Изменения после последнего сохранённого токена после перезапуска могут прийти повторно.
+type Watcher struct {
+	Storage    *storage.MongoStorage
+	Instance   string        // Имя экземпляра в ключе токена
+	PreImages  bool          // Запрашивать документ до удаления (MongoDB 6+, changeStreamPreAndPostImages)
+	RetryDelay time.Duration // Пауза перед переоткрытием потока после ошибки
+	TokenEvery time.Duration // Как часто сохранять токен продолжения
+
+	mu       sync.RWMutex
+	handlers []func(*Change)
+}
+
+type stream struct {
+	kind string
+	coll *mongo.Collection
+	cs   *mongo.ChangeStream
+}
+
+func New(st *storage.MongoStorage, instance string) *Watcher {
+	return &Watcher{
+		Storage:    st,
+		Instance:   instance,
+		RetryDelay: 5 * time.Second,
+		TokenEvery: time.Second,
+	}
+}
+
+// OnChange добавляет обработчик изменений. Обработчики вызываются в горутине потока по порядку.
+func (w *Watcher) OnChange(fn func(*Change)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers = append(w.handlers, fn)
+}
+
+// Start открывает потоки и читает их в фоне до отмены ctx.
+// Ошибка означает, что change streams недоступны (например, MongoDB запущена без replica set).
+func (w *Watcher) Start(ctx context.Context) error {
+	streams := []*stream{
+		{kind: KindUser, coll: w.Storage.UserCollection},
+		{kind: KindProject, coll: w.Storage.ProjectCollection},
+		{kind: KindTask, coll: w.Storage.TaskCollection},
+	}
+	for i, s := range streams {
+		if err := w.open(ctx, s); err != nil {
+			for _, opened := range streams[:i] {
+				opened.cs.Close(context.TODO())
+			}
+			return fmt.Errorf("watch %s: %w", s.coll.Name(), err)
+		}
+	}
+
+	for _, s := range streams {
+		go w.run(ctx, s)
+	}
+	return nil
+}
+
+func (w *Watcher) tokenKey(s *stream) string {
+	return w.Instance + ":" + s.coll.Name()
+}
+
+func (w *Watcher) open(ctx context.Context, s *stream) error {
+	token, err := w.Storage.GetResumeToken(w.tokenKey(s))
+	if err != nil {
+		return err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "operationType", Value: bson.D{
+			{Key: "$in", Value: bson.A{"insert", "update", "replace", "delete"}},
+		}}}}},
+	}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if w.PreImages {
+		opts.SetFullDocumentBeforeChange(options.WhenAvailable)
+	}
+	if token != nil {
+		opts.SetStartAfter(token)
+	}
+
+	cs, err := s.coll.Watch(ctx, pipeline, opts)
+	if err != nil && token != nil && isHistoryLost(err) {
+		// Сервер был выключен дольше, чем хранится oplog: начинаем с текущего момента
+		logging.Default().Warn("watcher: resume token expired, starting from now", "collection", s.coll.Name())
+		cs, err = s.coll.Watch(ctx, pipeline, opts.SetStartAfter(nil))
+	}
+	if err != nil {
+		return err
+	}
+	s.cs = cs
+	return nil
+}
+
+func (w *Watcher) run(ctx context.Context, s *stream) {
+	var saved time.Time
+	for {
+		for s.cs.Next(ctx) {
+			change, err := decode(s.kind, s.cs.Current)
+			if err != nil {
+				logging.Default().Error("watcher: decode change", "collection", s.coll.Name(), "error", err)
+			} else {
+				w.dispatch(change)
+			}
+			// Токен сохраняется не чаще TokenEvery, а не после каждого изменения
+			if time.Since(saved) >= w.TokenEvery {
+				w.saveToken(s, s.cs.ResumeToken())
+				saved = time.Now()
+			}
+		}
+
+		err := s.cs.Err()
+		w.saveToken(s, s.cs.ResumeToken())
+		s.cs.Close(context.TODO())
+		if ctx.Err() != nil {
+			return
+		}
+		logging.Default().Warn("watcher: stream closed", "collection", s.coll.Name(), "error", err)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.RetryDelay):
+			}
+			if err := w.open(ctx, s); err != nil {
+				logging.Default().Error("watcher: reopen stream", "collection", s.coll.Name(), "error", err)
+				continue
+			}
+			break
+		}
+	}
+}
+
+func (w *Watcher) dispatch(change *Change) {
+	w.mu.RLock()
+	handlers := w.handlers
+	w.mu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(change)
+	}
+}
+
+func (w *Watcher) saveToken(s *stream, token bson.Raw) {
+	if token == nil {
+		return
+	}
+	if err := w.Storage.SaveResumeToken(w.tokenKey(s), token); err != nil {
+		logging.Default().Error("watcher: save resume token", "collection", s.coll.Name(), "error", err)
+	}
+}
+
+func isHistoryLost(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && (se.HasErrorCode(codeHistoryLost) || se.HasErrorCode(codeFatal))
+}
+
+func decode(kind string, raw bson.Raw) (*Change, error) {
+	var doc struct {
+		OperationType string              `bson:"operationType"`
+		ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+		DocumentKey   struct {
+			ID ident.ID `bson:"_id"`
+		} `bson:"documentKey"`
+		FullDocument             bson.Raw `bson:"fullDocument"`
+		FullDocumentBeforeChange bson.Raw `bson:"fullDocumentBeforeChange"`
+		UpdateDescription        struct {
+			UpdatedFields bson.M `bson:"updatedFields"`
+		} `bson:"updateDescription"`
+	}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	change := &Change{
+		Kind:      kind,
+		Operation: doc.OperationType,
+		ID:        doc.DocumentKey.ID,
+		Document:  doc.FullDocument,
+		Updated:   doc.UpdateDescription.UpdatedFields,
+		At:        time.Unix(int64(doc.ClusterTime.T), 0),
+	}
+	if change.Operation == "delete" {
+		change.Document = doc.FullDocumentBeforeChange
+	}
+
+	switch kind {
+	case KindProject:
+		change.ProjectID = change.ID
+	case KindTask:
+		if change.Document != nil {
+			if id, ok := change.Document.Lookup("projectId").ObjectIDOK(); ok {
+				change.ProjectID = ident.ID(id)
+			}
+		}
+	}
+	return change, nil
+}
+
+var eventTypes = map[string]map[string]string{
+	KindUser:    {"insert": event.UserCreated, "update": event.UserUpdated, "replace": event.UserUpdated, "delete": event.UserDeleted},
+	KindProject: {"insert": event.ProjectCreated, "update": event.ProjectUpdated, "replace": event.ProjectUpdated, "delete": event.ProjectDeleted},
+	KindTask:    {"insert": event.TaskCreated, "update": event.TaskUpdated, "replace": event.TaskUpdated, "delete": event.TaskDeleted},
+}
+
+// Event переводит изменение в доменное событие для потока событий сервера
+func (c *Change) Event() (*event.Event, error) {
+	eventType, ok := eventTypes[c.Kind][c.Operation]
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s operation %q", c.Kind, c.Operation)
+	}
+
+	var data interface{}
+	switch c.Kind {
+	case KindUser:
+		payload := &event.UserPayload{UserID: c.ID}
+		if c.Document != nil {
+			payload.User = &user.User{}
+			if err := bson.Unmarshal(c.Document, payload.User); err != nil {
+				return nil, err
+			}
+		}
+		data = payload
+	case KindProject:
+		payload := &event.ProjectPayload{ProjectID: c.ID, Changes: c.Updated}
+		if c.Document != nil {
+			payload.Project = &project.Project{}
+			if err := bson.Unmarshal(c.Document, payload.Project); err != nil {
+				return nil, err
+			}
+		}
+		data = payload
+	case KindTask:
+		payload := &event.TaskPayload{ProjectID: c.ProjectID, TaskID: c.ID, Changes: c.Updated}
+		if c.Document != nil {
+			payload.Task = &project.Task{}
+			if err := bson.Unmarshal(c.Document, payload.Task); err != nil {
+				return nil, err
+			}
+		}
+		data = payload
+	}
+
+	e := event.New(eventType, c.ProjectID, data)
+	e.OccurredAt = c.At.UTC()
+	return e, nil
+}
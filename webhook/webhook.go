@@ -0,0 +1,349 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"tmv/event"
+	"tmv/ident"
+	"tmv/logging"
+	"tmv/project"
+	"tmv/storage"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Заголовки запроса к получателю
+const (
+	HeaderEvent     = "X-TMV-Event"
+	HeaderDelivery  = "X-TMV-Delivery"
+	HeaderSignature = "X-TMV-Signature-256"
+)
+
+// Envelope — тело запроса к получателю
+type Envelope struct {
+	ID         string      `json:"id"`
+	Event      string      `json:"event"`
+	ProjectID  string      `json:"projectId"`
+	OccurredAt time.Time   `json:"occurredAt"`
+	Data       interface{} `json:"data"`
+}
+
+// Dispatcher создаёт доставки для подписок проекта и отправляет их с повторами
+type Dispatcher struct {
+	Storage     storage.Storage
+	Client      *http.Client
+	MaxAttempts int           // После стольких неудач доставка помечается failed
+	BaseDelay   time.Duration // Пауза перед второй попыткой, дальше удваивается
+	MaxDelay    time.Duration
+	PollEvery   time.Duration // Как часто воркер ищет отложенные доставки
+
+	wake chan struct{}
+}
+
+func NewDispatcher(st storage.Storage) *Dispatcher {
+	return &Dispatcher{
+		Storage:     st,
+		Client:      &http.Client{Timeout: 10 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		MaxAttempts: 6,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    time.Hour,
+		PollEvery:   5 * time.Second,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// HandleEvent — асинхронный подписчик шины событий: ставит событие в очередь доставки
+// всем подходящим подпискам проекта. Ошибка возвращается, только пока ничего не поставлено,
+// чтобы повтор не дублировал доставки. Подписки удалённого проекта после project.deleted
+// удаляются, как только у них не останется ожидающих доставок.
+func (d *Dispatcher) HandleEvent(e *event.Event) error {
+	if e.ProjectID.IsZero() {
+		return nil
+	}
+	webhooks, err := d.Storage.GetWebhooksByProject(e.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	// id конверта совпадает с id события, по нему получатель отбрасывает повторы
+	envelope := Envelope{
+		ID:         e.ID.Hex(),
+		Event:      e.Type,
+		ProjectID:  e.ProjectID.Hex(),
+		OccurredAt: e.OccurredAt,
+		Data:       e.Data,
+	}
+	var payload []byte
+
+	queued := false
+	for i := range webhooks {
+		if !webhooks[i].Wants(e.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(envelope); err != nil {
+				return err
+			}
+		}
+
+		delivery := &project.WebhookDelivery{
+			WebhookID:   webhooks[i].Id,
+			ProjectID:   e.ProjectID,
+			EventID:     envelope.ID,
+			Event:       e.Type,
+			Payload:     string(payload),
+			Status:      project.DeliveryPending,
+			Attempts:    []project.DeliveryAttempt{},
+			NextAttempt: time.Now(),
+			Trace:       e.Trace,
+		}
+		if err := d.Storage.InsertDelivery(delivery); err != nil {
+			logging.Default().Error("webhook: queue delivery", "event", e.Type, "webhook_id", webhooks[i].Id.Hex(), "error", err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		d.Wake()
+	}
+
+	if e.Type == event.ProjectDeleted {
+		for i := range webhooks {
+			if webhooks[i].ProjectDeleted {
+				d.release(&webhooks[i])
+			}
+		}
+	}
+	return nil
+}
+
+// DropDeleted удаляет подписки удалённого проекта вместе с журналом, ничего не доставляя.
+// Это подписчик project.deleted на случай, когда доставка вебхуков выключена.
+func (d *Dispatcher) DropDeleted(e *event.Event) error {
+	webhooks, err := d.Storage.GetWebhooksByProject(e.ProjectID)
+	if err != nil {
+		return err
+	}
+	for _, w := range webhooks {
+		if !w.ProjectDeleted {
+			continue
+		}
+		if err := d.Storage.DeleteWebhook(w.ProjectID, w.Id); err != nil && err.Error() != "webhook not found" {
+			return err
+		}
+	}
+	return nil
+}
+
+// release удаляет подписку удалённого проекта, если у неё не осталось ожидающих доставок
+func (d *Dispatcher) release(w *project.Webhook) {
+	deliveries, err := d.Storage.GetDeliveries(w.Id, 0)
+	if err != nil {
+		logging.Default().Error("webhook: get deliveries", "webhook_id", w.Id.Hex(), "error", err)
+		return
+	}
+	for _, delivery := range deliveries {
+		if delivery.Status == project.DeliveryPending {
+			return
+		}
+	}
+	if err := d.Storage.DeleteWebhook(w.ProjectID, w.Id); err != nil && err.Error() != "webhook not found" {
+		logging.Default().Error("webhook: delete subscription of deleted project", "webhook_id", w.Id.Hex(), "error", err)
+	}
+}
+
+// Redeliver ставит в очередь копию прошлой доставки с тем же телом
+func (d *Dispatcher) Redeliver(ctx context.Context, projectId, webhookId, deliveryId ident.ID) (*project.WebhookDelivery, error) {
+	w, err := d.Storage.GetWebhook(projectId, webhookId)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return nil, errors.New("webhook not found")
+	}
+	prev, err := d.Storage.GetDelivery(webhookId, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+	if prev == nil {
+		return nil, errors.New("delivery not found")
+	}
+
+	delivery := &project.WebhookDelivery{
+		WebhookID:   webhookId,
+		ProjectID:   projectId,
+		EventID:     prev.EventID,
+		Event:       prev.Event,
+		Payload:     prev.Payload,
+		Status:      project.DeliveryPending,
+		Attempts:    []project.DeliveryAttempt{},
+		NextAttempt: time.Now(),
+	}
+	// Повторная доставка продолжает трассу запроса, который её вызвал
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		delivery.Trace = carrier
+	}
+	if err := d.Storage.InsertDelivery(delivery); err != nil {
+		return nil, err
+	}
+	d.Wake()
+	return delivery, nil
+}
+
+// Wake будит воркер, не дожидаясь очередного опроса
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run доставляет события, пока не отменён ctx
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollEvery)
+	defer ticker.Stop()
+
+	for {
+		d.ProcessDue(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// ProcessDue выполняет все доставки, чья попытка назначена не позже now, и возвращает их число
+func (d *Dispatcher) ProcessDue(now time.Time) int {
+	processed := 0
+	for {
+		// Аренда чуть дольше таймаута клиента: упавший экземпляр не держит доставку вечно
+		delivery, err := d.Storage.ClaimDueDelivery(now, d.Client.Timeout+time.Minute)
+		if err != nil {
+			logging.Default().Error("webhook: claim delivery", "error", err)
+			return processed
+		}
+		if delivery == nil {
+			return processed
+		}
+		d.attempt(delivery)
+		processed++
+	}
+}
+
+func (d *Dispatcher) attempt(delivery *project.WebhookDelivery) {
+	w, err := d.Storage.GetWebhook(delivery.ProjectID, delivery.WebhookID)
+	if err != nil {
+		logging.Default().Error("webhook: get subscription", "webhook_id", delivery.WebhookID.Hex(), "error", err)
+		return
+	}
+
+	var result project.DeliveryAttempt
+	if w == nil {
+		result = project.DeliveryAttempt{At: time.Now(), Error: "webhook deleted"}
+		delivery.Attempts = append(delivery.Attempts, result)
+		delivery.Status = project.DeliveryFailed
+	} else {
+		result = d.send(w, delivery)
+		delivery.Attempts = append(delivery.Attempts, result)
+
+		switch {
+		case result.Error == "":
+			delivery.Status = project.DeliverySucceeded
+		case len(delivery.Attempts) >= d.MaxAttempts:
+			delivery.Status = project.DeliveryFailed
+		default:
+			delivery.NextAttempt = time.Now().Add(d.Backoff(len(delivery.Attempts)))
+		}
+	}
+
+	if err := d.Storage.UpdateDelivery(delivery); err != nil {
+		logging.Default().Error("webhook: save delivery", "delivery_id", delivery.Id.Hex(), "error", err)
+		return
+	}
+	if w != nil && w.ProjectDeleted && delivery.Status != project.DeliveryPending {
+		d.release(w)
+	}
+}
+
+func (d *Dispatcher) send(w *project.Webhook, delivery *project.WebhookDelivery) (result project.DeliveryAttempt) {
+	result.At = time.Now()
+	defer func() { result.DurationMs = time.Since(result.At).Milliseconds() }()
+
+	// Клиент передаёт traceparent сохранённой трассы, поэтому получатель увидит исходный запрос
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(delivery.Trace))
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TMV-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.Id.Hex())
+	req.Header.Set(HeaderSignature, Sign(w.Secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return result
+}
+
+// Backoff — пауза после attempts неудачных попыток: BaseDelay, 2×BaseDelay, 4×… но не больше MaxDelay
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.MaxDelay {
+			return d.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Sign возвращает значение заголовка X-TMV-Signature-256: "sha256=" и HMAC-SHA256 тела в hex
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись на стороне получателя
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// NewSecret генерирует случайный ключ подписи
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
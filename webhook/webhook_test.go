@@ -0,0 +1,341 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"tmv/event"
+	"tmv/project"
+	"tmv/storage"
+	"tmv/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// receiver — тестовый получатель: запоминает запросы и отвечает кодами из statuses по очереди,
+// после их окончания — 200
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, receivedRequest{header: req.Header.Clone(), body: body})
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) received() []receivedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedRequest(nil), r.requests...)
+}
+
+type fixture struct {
+	st      storage.Storage
+	d       *Dispatcher
+	recv    *receiver
+	webhook *project.Webhook
+}
+
+func newFixture(t *testing.T, statuses ...int) *fixture {
+	t.Helper()
+	recv := &receiver{statuses: statuses}
+	srv := httptest.NewServer(recv)
+	t.Cleanup(srv.Close)
+
+	st := storage.NewMemoryStorage()
+	u := user.NewUser("Ann", "dev", 30, 1000, "", nil)
+	if err := st.InsertUser(u); err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	p := project.NewProject(u.Id, "Board", "desc", 5, "author", "resp", "perf", time.Time{}, "", nil, "open")
+	if err := st.InsertProject(p, u.Id); err != nil {
+		t.Fatalf("InsertProject: %v", err)
+	}
+	w := &project.Webhook{URL: srv.URL, Secret: "s3cret", Events: []string{"task.*"}, Active: true}
+	if err := st.InsertWebhook(w, p.Id); err != nil {
+		t.Fatalf("InsertWebhook: %v", err)
+	}
+
+	d := NewDispatcher(st)
+	d.Client = srv.Client()
+	d.Client.Timeout = 5 * time.Second
+	d.MaxAttempts = 3
+	d.BaseDelay = time.Minute
+	d.MaxDelay = time.Hour
+	return &fixture{st: st, d: d, recv: recv, webhook: w}
+}
+
+// publish ставит событие в очередь и возвращает единственную созданную доставку
+func (f *fixture) publish(t *testing.T, eventType string) *project.WebhookDelivery {
+	t.Helper()
+	e := event.New(eventType, f.webhook.ProjectID, map[string]string{"name": "Design"})
+	if err := f.d.HandleEvent(e); err != nil {
+		t.Fatalf("HandleEvent: %v", err)
+	}
+	deliveries := f.deliveries(t)
+	if len(deliveries) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(deliveries))
+	}
+	return &deliveries[0]
+}
+
+func (f *fixture) deliveries(t *testing.T) []project.WebhookDelivery {
+	t.Helper()
+	deliveries, err := f.st.GetDeliveries(f.webhook.Id, 0)
+	if err != nil {
+		t.Fatalf("GetDeliveries: %v", err)
+	}
+	return deliveries
+}
+
+func (f *fixture) delivery(t *testing.T, d *project.WebhookDelivery) *project.WebhookDelivery {
+	t.Helper()
+	got, err := f.st.GetDelivery(f.webhook.Id, d.Id)
+	if err != nil || got == nil {
+		t.Fatalf("GetDelivery = %v, %v", got, err)
+	}
+	return got
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"task.created"}`)
+	sig := Sign("key", body)
+	// Эталон посчитан отдельно: HMAC-SHA256 тела с ключом "key"
+	if want := "sha256=e0d2f8a13aac4a33ded6c5ab4bf2ac3ba51d75099020683dec85d143583c6a0c"; sig != want {
+		t.Fatalf("Sign = %q, want %q", sig, want)
+	}
+	if !Verify("key", body, sig) {
+		t.Error("Verify of own signature = false")
+	}
+	if Verify("other", body, sig) {
+		t.Error("Verify with wrong secret = true")
+	}
+	if Verify("key", []byte(`{"event":"task.deleted"}`), sig) {
+		t.Error("Verify of changed body = true")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute}
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, w := range want {
+		if got := d.Backoff(i + 1); got != w {
+			t.Errorf("Backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestDeliverySigned(t *testing.T) {
+	f := newFixture(t)
+	delivery := f.publish(t, "task.created")
+
+	if n := f.d.ProcessDue(time.Now()); n != 1 {
+		t.Fatalf("ProcessDue = %d, want 1", n)
+	}
+	reqs := f.recv.received()
+	if len(reqs) != 1 {
+		t.Fatalf("requests = %d, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if !Verify(f.webhook.Secret, req.body, req.header.Get(HeaderSignature)) {
+		t.Errorf("%s = %q does not match body", HeaderSignature, req.header.Get(HeaderSignature))
+	}
+	if got := req.header.Get(HeaderEvent); got != "task.created" {
+		t.Errorf("%s = %q, want task.created", HeaderEvent, got)
+	}
+	if got := req.header.Get(HeaderDelivery); got != delivery.Id.Hex() {
+		t.Errorf("%s = %q, want %s", HeaderDelivery, got, delivery.Id.Hex())
+	}
+	var envelope Envelope
+	if err := json.Unmarshal(req.body, &envelope); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if envelope.ID != delivery.EventID || envelope.Event != "task.created" || envelope.ProjectID != f.webhook.ProjectID.Hex() {
+		t.Errorf("envelope = %+v", envelope)
+	}
+
+	got := f.delivery(t, delivery)
+	if got.Status != project.DeliverySucceeded || len(got.Attempts) != 1 || got.Attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("delivery = %+v, want succeeded after one attempt", got)
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	f := newFixture(t)
+	if err := f.d.HandleEvent(event.New("sprint.started", f.webhook.ProjectID, nil)); err != nil {
+		t.Fatalf("HandleEvent: %v", err)
+	}
+	if deliveries := f.deliveries(t); len(deliveries) != 0 {
+		t.Errorf("deliveries for unsubscribed event = %d, want 0", len(deliveries))
+	}
+}
+
+func TestRetryOn5xx(t *testing.T) {
+	f := newFixture(t, http.StatusServiceUnavailable, http.StatusInternalServerError)
+	delivery := f.publish(t, "task.updated")
+
+	start := time.Now()
+	if n := f.d.ProcessDue(start); n != 1 {
+		t.Fatalf("ProcessDue = %d, want 1", n)
+	}
+	got := f.delivery(t, delivery)
+	if got.Status != project.DeliveryPending || len(got.Attempts) != 1 || got.Attempts[0].StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("after 503: delivery = %+v, want pending with one attempt", got)
+	}
+	// Следующая попытка отложена на BaseDelay и раньше срока не выполняется;
+	// хранилище держит время с точностью до миллисекунды
+	if due := start.Add(f.d.BaseDelay).Truncate(time.Millisecond); got.NextAttempt.Before(due) {
+		t.Errorf("NextAttempt = %v, want not before %v", got.NextAttempt, due)
+	}
+	if n := f.d.ProcessDue(time.Now()); n != 0 {
+		t.Errorf("ProcessDue before backoff = %d, want 0", n)
+	}
+
+	if n := f.d.ProcessDue(time.Now().Add(time.Hour)); n != 2 {
+		t.Fatalf("ProcessDue after backoff = %d, want 2", n)
+	}
+	got = f.delivery(t, delivery)
+	if got.Status != project.DeliverySucceeded || len(got.Attempts) != 3 {
+		t.Fatalf("delivery = %+v, want succeeded on third attempt", got)
+	}
+	if code := got.Attempts[1].StatusCode; code != http.StatusInternalServerError || got.Attempts[1].Error == "" {
+		t.Errorf("second attempt = %+v, want failed 500", got.Attempts[1])
+	}
+	if n := len(f.recv.received()); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+}
+
+func TestGiveUpAfterMaxAttempts(t *testing.T) {
+	f := newFixture(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout)
+	delivery := f.publish(t, "task.deleted")
+
+	if n := f.d.ProcessDue(time.Now().Add(24 * time.Hour)); n != f.d.MaxAttempts {
+		t.Fatalf("ProcessDue = %d, want %d", n, f.d.MaxAttempts)
+	}
+	got := f.delivery(t, delivery)
+	if got.Status != project.DeliveryFailed || len(got.Attempts) != f.d.MaxAttempts {
+		t.Fatalf("delivery = %+v, want failed after %d attempts", got, f.d.MaxAttempts)
+	}
+	if n := f.d.ProcessDue(time.Now().Add(48 * time.Hour)); n != 0 {
+		t.Errorf("ProcessDue after failure = %d, want 0", n)
+	}
+	if n := len(f.recv.received()); n != f.d.MaxAttempts {
+		t.Errorf("requests = %d, want %d", n, f.d.MaxAttempts)
+	}
+}
+
+func TestDeletedWebhookFails(t *testing.T) {
+	f := newFixture(t)
+	f.publish(t, "task.created")
+	if err := f.st.DeleteWebhook(f.webhook.ProjectID, f.webhook.Id); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+	if n := f.d.ProcessDue(time.Now()); n != 0 {
+		t.Errorf("ProcessDue = %d, want 0: deliveries go with their webhook", n)
+	}
+	if n := len(f.recv.received()); n != 0 {
+		t.Errorf("requests = %d, want 0", n)
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	f := newFixture(t, http.StatusInternalServerError)
+	f.d.MaxAttempts = 1
+	prev := f.publish(t, "task.created")
+	f.d.ProcessDue(time.Now())
+	if got := f.delivery(t, prev); got.Status != project.DeliveryFailed {
+		t.Fatalf("delivery status = %s, want failed", got.Status)
+	}
+
+	again, err := f.d.Redeliver(context.Background(), f.webhook.ProjectID, f.webhook.Id, prev.Id)
+	if err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	if again.Id == prev.Id || again.EventID != prev.EventID || again.Payload != prev.Payload {
+		t.Errorf("Redeliver = %+v, want new delivery of the same event", again)
+	}
+	if n := f.d.ProcessDue(time.Now()); n != 1 {
+		t.Fatalf("ProcessDue = %d, want 1", n)
+	}
+	if got := f.delivery(t, again); got.Status != project.DeliverySucceeded {
+		t.Errorf("redelivery status = %s, want succeeded", got.Status)
+	}
+	reqs := f.recv.received()
+	if len(reqs) != 2 || string(reqs[0].body) != string(reqs[1].body) {
+		t.Errorf("requests = %d, want 2 with the same body", len(reqs))
+	}
+
+	if _, err := f.d.Redeliver(context.Background(), f.webhook.ProjectID, f.webhook.Id, f.webhook.Id); err == nil || err.Error() != "delivery not found" {
+		t.Errorf("Redeliver of unknown delivery: err = %v, want delivery not found", err)
+	}
+}
+
+// Подписка удалённого проекта получает project.deleted и исчезает, когда доставлять больше нечего
+func TestProjectDeletedDelivered(t *testing.T) {
+	f := newFixture(t)
+	f.publish(t, "task.created")
+	f.webhook.Events = []string{"project.deleted"}
+	if err := f.st.UpdateWebhook(f.webhook.ProjectID, f.webhook.Id, bson.M{"events": f.webhook.Events}); err != nil {
+		t.Fatalf("UpdateWebhook: %v", err)
+	}
+
+	if err := f.st.DeleteProject(f.webhook.ProjectID); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	if err := f.d.HandleEvent(event.New(event.ProjectDeleted, f.webhook.ProjectID, &event.ProjectPayload{ProjectID: f.webhook.ProjectID})); err != nil {
+		t.Fatalf("HandleEvent: %v", err)
+	}
+	// Пока ждёт доставка task.created, подписка остаётся
+	if n := len(f.deliveries(t)); n != 2 {
+		t.Fatalf("deliveries = %d, want 2", n)
+	}
+
+	if n := f.d.ProcessDue(time.Now()); n != 2 {
+		t.Fatalf("ProcessDue = %d, want 2", n)
+	}
+	reqs := f.recv.received()
+	if len(reqs) != 2 || reqs[1].header.Get(HeaderEvent) != event.ProjectDeleted {
+		t.Fatalf("requests = %d, want task.created then project.deleted", len(reqs))
+	}
+	if got, err := f.st.GetWebhook(f.webhook.ProjectID, f.webhook.Id); err != nil || got != nil {
+		t.Errorf("GetWebhook after delivery = %+v, %v; want nil, nil", got, err)
+	}
+}
+
+func TestDropDeleted(t *testing.T) {
+	f := newFixture(t)
+	f.publish(t, "task.created")
+	if err := f.st.DeleteProject(f.webhook.ProjectID); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	if err := f.d.DropDeleted(event.New(event.ProjectDeleted, f.webhook.ProjectID, nil)); err != nil {
+		t.Fatalf("DropDeleted: %v", err)
+	}
+	if got, err := f.st.GetWebhook(f.webhook.ProjectID, f.webhook.Id); err != nil || got != nil {
+		t.Errorf("GetWebhook = %+v, %v; want nil, nil", got, err)
+	}
+	if n := f.d.ProcessDue(time.Now()); n != 0 {
+		t.Errorf("ProcessDue = %d, want 0", n)
+	}
+}